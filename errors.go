@@ -1,6 +1,9 @@
 package rfcquery
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 type Position struct {
 	Offset int
@@ -9,15 +12,71 @@ type Position struct {
 type Error struct {
 	Pos Position
 	Msg string
+
+	// Err is the underlying cause, if any (e.g. context.Canceled)
+	Err error
 }
 
 func (e *Error) Error() string {
 	return fmt.Sprintf("rfcquery: %s at position %d", e.Msg, e.Pos.Offset)
 }
 
+// Unwrap returns the underlying cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 func newError(pos int, format string, args ...any) *Error {
 	return &Error{
 		Pos: Position{Offset: pos},
 		Msg: fmt.Sprintf(format, args...),
 	}
 }
+
+// NewError creates a positioned Error, plugins use it to report
+// syntax errors pointing into the original query
+func NewError(pos int, format string, args ...any) *Error {
+	return newError(pos, format, args...)
+}
+
+// ErrLimitExceeded is the sentinel wrapped by every LimitError
+var ErrLimitExceeded = errors.New("rfcquery: limit exceeded")
+
+// Limit identifies which ParseOptions bound has been violated
+type Limit string
+
+const (
+	LimitInputLength    Limit = "input-length"
+	LimitParams         Limit = "params"
+	LimitKeyLength      Limit = "key-length"
+	LimitValueLength    Limit = "value-length"
+	LimitTokens         Limit = "tokens"
+	LimitJSONDepth      Limit = "json-depth"
+	LimitTMFExpressions Limit = "tmf-expressions"
+)
+
+// LimitError reports a violation of one of the ParseOptions limits
+// Pos is the query offset where the limit was crossed
+type LimitError struct {
+	Limit Limit
+	Max   int
+	Pos   Position
+}
+
+// NewLimitError creates a LimitError for the given limit at the given offset
+func NewLimitError(limit Limit, max int, pos int) *LimitError {
+	return &LimitError{
+		Limit: limit,
+		Max:   max,
+		Pos:   Position{Offset: pos},
+	}
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("rfcquery: %s limit of %d exceeded at position %d", e.Limit, e.Max, e.Pos.Offset)
+}
+
+// Unwrap allows errors.Is(err, ErrLimitExceeded)
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
@@ -0,0 +1,456 @@
+// Package jsonschema validates decoded JSON values against the subset of
+// JSON Schema draft 2020-12 that describes query payloads
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/CRSylar/rfcquery"
+)
+
+// Schema is a compiled JSON Schema document. The keywords are type,
+// enum, const, properties, required, additionalProperties, items,
+// prefixItems, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// minLength, maxLength, pattern, minItems, maxItems and local $ref, other
+// keywords are ignored
+type Schema struct {
+	root     any
+	patterns map[string]*regexp.Regexp
+
+	// refs holds the references compiled already, schemas may be recursive
+	refs map[string]bool
+}
+
+// Violation is a value that does not satisfy the schema
+type Violation struct {
+	// Path is the JSON Pointer of the value, "" for the root
+	Path string
+	Msg  string
+}
+
+var types = []string{"null", "boolean", "object", "array", "number", "string", "integer"}
+
+// Compile reads and checks a JSON Schema document
+func Compile(data []byte) (*Schema, error) {
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+
+	s := &Schema{root: root, patterns: make(map[string]*regexp.Regexp), refs: make(map[string]bool)}
+	if err := s.compile(root, "#"); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return s, nil
+}
+
+// compile checks the keywords of the subschema at location
+func (s *Schema) compile(schema any, location string) error {
+	if _, ok := schema.(bool); ok {
+		return nil
+	}
+	object, ok := schema.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s: a schema must be an object or a boolean", location)
+	}
+
+	for _, keyword := range sortedKeys(object) {
+		value := object[keyword]
+		at := location + "/" + escape(keyword)
+
+		switch keyword {
+		case "type":
+			names, ok := typeNames(value)
+			if !ok {
+				return fmt.Errorf("%s: must be a type name or a list of them", at)
+			}
+			for _, name := range names {
+				if !slices.Contains(types, name) {
+					return fmt.Errorf("%s: unknown type %q", at, name)
+				}
+			}
+
+		case "enum":
+			if _, ok := value.([]any); !ok {
+				return fmt.Errorf("%s: must be an array", at)
+			}
+
+		case "required":
+			list, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("%s: must be an array of strings", at)
+			}
+			for _, name := range list {
+				if _, ok := name.(string); !ok {
+					return fmt.Errorf("%s: must be an array of strings", at)
+				}
+			}
+
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			if _, ok := value.(float64); !ok {
+				return fmt.Errorf("%s: must be a number", at)
+			}
+
+		case "minLength", "maxLength", "minItems", "maxItems":
+			if n, ok := value.(float64); !ok || n < 0 || n != math.Trunc(n) {
+				return fmt.Errorf("%s: must be a non-negative integer", at)
+			}
+
+		case "pattern":
+			expr, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s: must be a string", at)
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("%s: %w", at, err)
+			}
+			s.patterns[expr] = re
+
+		case "items", "additionalProperties":
+			if err := s.compile(value, at); err != nil {
+				return err
+			}
+
+		case "prefixItems":
+			list, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("%s: must be an array of schemas", at)
+			}
+			for i, item := range list {
+				if err := s.compile(item, at+"/"+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+
+		case "properties", "$defs", "definitions":
+			schemas, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: must be an object of schemas", at)
+			}
+			for _, name := range sortedKeys(schemas) {
+				if err := s.compile(schemas[name], at+"/"+escape(name)); err != nil {
+					return err
+				}
+			}
+
+		case "$ref":
+			ref, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s: must be a string", at)
+			}
+			if err := s.checkRef(ref, at); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkRef resolves and compiles ref, found at location, and the $ref
+// chain it starts, which must not loop back without descending into the
+// value. The errors of the targets carry their own location
+func (s *Schema) checkRef(ref, location string) error {
+	seen := []string{}
+	for ref != "" {
+		if slices.Contains(seen, ref) {
+			return fmt.Errorf("%s: circular $ref %q", location, ref)
+		}
+		seen = append(seen, ref)
+
+		target, err := s.resolve(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+		if !s.refs[ref] {
+			s.refs[ref] = true
+			if err := s.compile(target, ref); err != nil {
+				return err
+			}
+		}
+		location = ref + "/$ref"
+		ref = ""
+		if object, ok := target.(map[string]any); ok {
+			ref, _ = object["$ref"].(string)
+		}
+	}
+	return nil
+}
+
+// resolve returns the subschema a local reference, "#/$defs/name",
+// points to
+func (s *Schema) resolve(ref string) (any, error) {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok || pointer != "" && pointer[0] != '/' {
+		return nil, fmt.Errorf("unsupported $ref %q, only local JSON Pointer references are", ref)
+	}
+
+	node := s.root
+	if pointer == "" {
+		return node, nil
+	}
+	for _, segment := range strings.Split(pointer[1:], "/") {
+		segment = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+		switch n := node.(type) {
+		case map[string]any:
+			node, ok = n[segment]
+		case []any:
+			i, err := strconv.Atoi(segment)
+			ok = err == nil && 0 <= i && i < len(n)
+			if ok {
+				node = n[i]
+			}
+		default:
+			ok = false
+		}
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return node, nil
+}
+
+// Validate returns the violations of value, a value decoded by
+// encoding/json, in document order
+func (s *Schema) Validate(value any) []Violation {
+	var violations []Violation
+	s.validate(s.root, value, "", &violations)
+	return violations
+}
+
+// Check validates value and reports each violation as an *rfcquery.Error
+// at offset, the position of the parameter that holds value. subject
+// names it in messages, such as `parameter "filter"`
+func (s *Schema) Check(value any, offset int, subject string) error {
+	var errs []error
+	for _, v := range s.Validate(value) {
+		errs = append(errs, rfcquery.NewError(offset, "%s does not match the schema at %q: %s", subject, v.Path, v.Msg))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Schema) validate(schema, value any, path string, violations *[]Violation) {
+	report := func(format string, args ...any) {
+		*violations = append(*violations, Violation{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			report("no value is allowed")
+		}
+		return
+	}
+	object := schema.(map[string]any)
+
+	if ref, ok := object["$ref"].(string); ok {
+		// Compile resolved every reference
+		target, _ := s.resolve(ref)
+		s.validate(target, value, path, violations)
+	}
+
+	if names, ok := typeNames(object["type"]); ok && !slices.ContainsFunc(names, func(name string) bool { return hasType(value, name) }) {
+		report("expected %s, got %s", strings.Join(names, " or "), typeOf(value))
+		return
+	}
+
+	if enum, ok := object["enum"].([]any); ok && !slices.ContainsFunc(enum, func(e any) bool { return equal(e, value) }) {
+		report("value %s is not one of %s", encode(value), encode(enum))
+	}
+	if constant, ok := object["const"]; ok && !equal(constant, value) {
+		report("value %s must be %s", encode(value), encode(constant))
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		s.validateObject(object, value, path, violations)
+
+	case []any:
+		if n, ok := object["minItems"].(float64); ok && float64(len(value)) < n {
+			report("expected at least %v items, got %d", n, len(value))
+		}
+		if n, ok := object["maxItems"].(float64); ok && float64(len(value)) > n {
+			report("expected at most %v items, got %d", n, len(value))
+		}
+		prefix, _ := object["prefixItems"].([]any)
+		for i, item := range value {
+			itemPath := path + "/" + strconv.Itoa(i)
+			if i < len(prefix) {
+				s.validate(prefix[i], item, itemPath, violations)
+			} else if items, ok := object["items"]; ok {
+				s.validate(items, item, itemPath, violations)
+			}
+		}
+
+	case string:
+		length := float64(utf8.RuneCountInString(value))
+		if n, ok := object["minLength"].(float64); ok && length < n {
+			report("expected at least %v characters, got %v", n, length)
+		}
+		if n, ok := object["maxLength"].(float64); ok && length > n {
+			report("expected at most %v characters, got %v", n, length)
+		}
+		if expr, ok := object["pattern"].(string); ok && !s.patterns[expr].MatchString(value) {
+			report("value %q does not match pattern %q", value, expr)
+		}
+
+	default:
+		n, ok := number(value)
+		if !ok {
+			return
+		}
+		if m, ok := object["minimum"].(float64); ok && n < m {
+			report("value %v is below the minimum %v", n, m)
+		}
+		if m, ok := object["exclusiveMinimum"].(float64); ok && n <= m {
+			report("value %v must be greater than %v", n, m)
+		}
+		if m, ok := object["maximum"].(float64); ok && n > m {
+			report("value %v is above the maximum %v", n, m)
+		}
+		if m, ok := object["exclusiveMaximum"].(float64); ok && n >= m {
+			report("value %v must be less than %v", n, m)
+		}
+	}
+}
+
+func (s *Schema) validateObject(schema, value map[string]any, path string, violations *[]Violation) {
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if _, ok := value[name.(string)]; !ok {
+				*violations = append(*violations, Violation{Path: path, Msg: fmt.Sprintf("missing required property %q", name)})
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	additional, hasAdditional := schema["additionalProperties"]
+	for _, name := range sortedKeys(value) {
+		propPath := path + "/" + escape(name)
+		if prop, ok := properties[name]; ok {
+			s.validate(prop, value[name], propPath, violations)
+		} else if hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				*violations = append(*violations, Violation{Path: propPath, Msg: "additional property is not allowed"})
+				continue
+			}
+			s.validate(additional, value[name], propPath, violations)
+		}
+	}
+}
+
+// typeNames reads the type keyword, a name or a list of names
+func typeNames(value any) ([]string, bool) {
+	switch value := value.(type) {
+	case string:
+		return []string{value}, true
+	case []any:
+		names := make([]string, len(value))
+		for i, v := range value {
+			name, ok := v.(string)
+			if !ok {
+				return nil, false
+			}
+			names[i] = name
+		}
+		return names, true
+	}
+	return nil, false
+}
+
+// hasType reports whether value is an instance of the type name
+func hasType(value any, name string) bool {
+	if name == "integer" {
+		n, ok := number(value)
+		return ok && n == math.Trunc(n) && !math.IsInf(n, 0)
+	}
+	return typeOf(value) == name
+}
+
+// typeOf returns the JSON type of a decoded value
+func typeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	}
+	if _, ok := number(value); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// number reads the numbers of encoding/json, json.Number included
+func number(value any) (float64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return value, true
+	case json.Number:
+		n, err := value.Float64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// equal compares decoded values, numbers by value
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, v := range a {
+			if w, ok := b[key]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		return ok && slices.EqualFunc(a, b, equal)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func encode(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// escape encodes a JSON Pointer segment
+func escape(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1")
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,96 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const userSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["name", "age"],
+	"properties": {
+		"name": {"type": "string", "minLength": 2, "pattern": "^[A-Z]"},
+		"age": {"type": "integer", "minimum": 18, "exclusiveMaximum": 150},
+		"role": {"enum": ["admin", "user"]},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+		"manager": {"$ref": "#"},
+		"a/b": {"$ref": "#/$defs/flag"}
+	},
+	"additionalProperties": false,
+	"$defs": {"flag": {"type": ["boolean", "null"]}}
+}`
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := Compile([]byte(userSchema))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  []Violation
+	}{
+		{"valid", `{"name": "Ann", "age": 30, "role": "admin", "tags": ["x"], "a/b": null, "manager": {"name": "Bob", "age": 50}}`, nil},
+		{"root type", `[1]`, []Violation{{"", "expected object, got array"}}},
+		{"required", `{"name": "Ann"}`, []Violation{{"", `missing required property "age"`}}},
+		{"keywords", `{"name": "a", "age": 150.5, "role": "root", "tags": ["x", 1, "z"], "a/b": 1, "extra": 0}`, []Violation{
+			{"/a~1b", "expected boolean or null, got number"},
+			{"/age", "expected integer, got number"},
+			{"/extra", "additional property is not allowed"},
+			{"/name", "expected at least 2 characters, got 1"},
+			{"/name", `value "a" does not match pattern "^[A-Z]"`},
+			{"/role", `value "root" is not one of ["admin","user"]`},
+			{"/tags", "expected at most 2 items, got 3"},
+			{"/tags/1", "expected string, got number"},
+		}},
+		{"bounds", `{"name": "Ann", "age": 150}`, []Violation{{"/age", "value 150 must be less than 150"}}},
+		{"recursive", `{"name": "Ann", "age": 30, "manager": {"name": "Bob", "age": 17}}`, []Violation{
+			{"/manager/age", "value 17 is below the minimum 18"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			if got := schema.Validate(value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantMsg string
+	}{
+		{"not json", `{`, "unexpected end of JSON input"},
+		{"not a schema", `{"properties": {"a": 1}}`, "#/properties/a: a schema must be an object or a boolean"},
+		{"unknown type", `{"type": "float"}`, `#/type: unknown type "float"`},
+		{"bad pattern", `{"pattern": "("}`, "#/pattern: error parsing regexp"},
+		{"negative length", `{"minLength": -1}`, "#/minLength: must be a non-negative integer"},
+		{"remote ref", `{"$ref": "https://example.com/schema"}`, `#/$ref: unsupported $ref "https://example.com/schema"`},
+		{"missing ref", `{"$ref": "#/$defs/nope"}`, `#/$ref: unresolvable $ref "#/$defs/nope"`},
+		{"circular ref", `{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"$ref": "#/$defs/a"}}}`, `#/$defs/a/$ref: circular $ref "#/$defs/b"`},
+		{"ref chain to a non-schema", `{"$ref": "#/$defs/a", "$defs": {"a": {"$ref": "#/x"}}, "x": 3}`, "#/x: a schema must be an object or a boolean"},
+		{"ref to a non-schema", `{"$ref": "#/x", "x": 3}`, "#/x: a schema must be an object or a boolean"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile([]byte(tt.schema))
+			// the location prefixes the message once
+			if err == nil || !strings.HasPrefix(err.Error(), "invalid JSON schema: "+tt.wantMsg) {
+				t.Errorf("got %v, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package percent
 
-import "testing"
+import (
+	"net/url"
+	"testing"
+)
 
 func TestDecode(t *testing.T) {
 	tests := []struct {
@@ -35,3 +38,21 @@ func TestDecode(t *testing.T) {
 		})
 	}
 }
+
+func FuzzDecode(f *testing.F) {
+	for _, seed := range []string{"", "hello", "hello%20world", "test%2A%2b%2f", "test%", "%%", "test%1G", "%F0%9F%91%8D"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		got, err := Decode(input)
+		want, stdErr := url.PathUnescape(input)
+
+		if (err == nil) != (stdErr == nil) {
+			t.Fatalf("Decode() error = %v, net/url PathUnescape() error = %v", err, stdErr)
+		}
+		if err == nil && got != want {
+			t.Fatalf("Decode() = %q, net/url PathUnescape() = %q", got, want)
+		}
+	})
+}
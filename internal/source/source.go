@@ -0,0 +1,230 @@
+// Package source maps decoded parameter values back to query offsets,
+// for plugins that parse a value with their own grammar
+package source
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+)
+
+// Source is the decoded text of a token slice. Every token decodes to
+// exactly one byte, so byte i of Text comes from Tokens[i]
+type Source struct {
+	Text   string
+	Tokens rfcquery.TokenSlice
+
+	// end is the offset reported for positions past the last byte
+	end int
+}
+
+// New creates the Source of tokens, end is the offset following them
+// and is only used when tokens is empty
+func New(tokens rfcquery.TokenSlice, end int) Source {
+	if len(tokens) > 0 {
+		end = tokens[len(tokens)-1].End.Offset
+	}
+	return Source{Text: tokens.StringDecoded(), Tokens: tokens, end: end}
+}
+
+// Offset returns the query offset of byte i
+func (s Source) Offset(i int) int {
+	if i >= len(s.Tokens) {
+		return s.end
+	}
+	return s.Tokens[i].Start.Offset
+}
+
+// Position returns the query position of byte i
+func (s Source) Position(i int) rfcquery.Position {
+	return rfcquery.Position{Offset: s.Offset(i)}
+}
+
+// Slice returns the Source of bytes [i, j)
+func (s Source) Slice(i, j int) Source {
+	return Source{Text: s.Text[i:j], Tokens: s.Tokens[i:j], end: s.Offset(j)}
+}
+
+// Mapped returns the Source of text, a rewrite of s whose byte j comes
+// from byte index[j] of s. A nil index maps every byte to the start of s,
+// for text decoded from s as a whole
+func (s Source) Mapped(text string, index []int) Source {
+	tokens := make(rfcquery.TokenSlice, len(text))
+	for j := range tokens {
+		i := 0
+		if index != nil {
+			i = index[j]
+		}
+		if i < len(s.Tokens) {
+			tokens[j] = s.Tokens[i]
+		} else {
+			tokens[j].Start.Offset = s.Offset(i)
+		}
+	}
+	return Source{Text: text, Tokens: tokens, end: s.Offset(len(s.Tokens))}
+}
+
+// Errorf returns an error positioned on byte i
+func (s Source) Errorf(i int, format string, args ...any) error {
+	return rfcquery.NewError(s.Offset(i), format, args...)
+}
+
+// JSONOffset returns the byte of Text that err, an encoding/json error
+// decoding Text, reports: the offending byte of a syntax error, or the
+// start of the value of a type mismatch
+func (s Source) JSONOffset(err error) (int, bool) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	var i int
+	switch {
+	case errors.As(err, &syntaxErr):
+		i = int(syntaxErr.Offset) - 1
+		if strings.HasPrefix(syntaxErr.Error(), "unexpected end") {
+			i = len(s.Text)
+		}
+	case errors.As(err, &typeErr):
+		i = valueStart(s.Text, int(typeErr.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		i = len(s.Text)
+	default:
+		return 0, false
+	}
+	return max(0, min(i, len(s.Text))), true
+}
+
+// JSONError positions err, an encoding/json error decoding Text, on the
+// query byte it reports. msg prefixes the message, which keeps the
+// decoded offset. Errors without an offset are returned as is
+func (s Source) JSONError(err error, msg string) error {
+	i, ok := s.JSONOffset(err)
+	if !ok {
+		return err
+	}
+	e := rfcquery.NewError(s.Offset(i), "%s (decoded offset %d): %v", msg, i, err)
+	e.Err = err
+	return e
+}
+
+// CheckJSONDepth walks the JSON text of s and reports the query position
+// of the first bracket nested deeper than max. Brackets inside JSON
+// strings are ignored. A max of 0 disables the check
+func (s Source) CheckJSONDepth(max int) error {
+	if max <= 0 {
+		return nil
+	}
+
+	depth := 0
+	inString, escaped := false, false
+	for i := 0; i < len(s.Text); i++ {
+		c := s.Text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+			if depth > max {
+				return rfcquery.NewLimitError(rfcquery.LimitJSONDepth, max, s.Offset(i))
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+
+	return nil
+}
+
+// valueStart returns the offset of the JSON value of text that ends at
+// end, or that starts with the delimiter ending at end
+func valueStart(text string, end int) int {
+	dec := json.NewDecoder(strings.NewReader(text))
+	prev := 0
+	for {
+		if _, err := dec.Token(); err != nil {
+			return max(0, end-1)
+		}
+		if int(dec.InputOffset()) >= end {
+			break
+		}
+		prev = int(dec.InputOffset())
+	}
+
+	// tokens start after the whitespace and separators of the previous one
+	for prev < len(text) && strings.IndexByte(" \t\r\n,:", text[prev]) >= 0 {
+		prev++
+	}
+	return prev
+}
+
+// Param is one key=value pair of a form-encoded query
+type Param struct {
+	Key         string
+	KeyTokens   rfcquery.TokenSlice
+	ValueTokens rfcquery.TokenSlice
+	Pos         rfcquery.Position // position of the key, or of '=' for an empty key
+}
+
+// Value returns the Source of the parameter value
+func (p Param) Value() Source {
+	end := p.Pos.Offset + p.KeyTokens.Span() + 1
+	return New(p.ValueTokens, end)
+}
+
+// Params lists the pairs parsed by the form parser in query order,
+// collapsing the values it produced by splitting a value on ','
+func Params(values *rfcquery.Values) []Param {
+	var params []Param
+	for _, key := range values.AllKeys() {
+		for _, val := range values.Get(key) {
+			if n := len(params); n > 0 && params[n-1].Pos == val.KeyPos && params[n-1].Key == key {
+				continue
+			}
+			params = append(params, Param{
+				Key:         key,
+				KeyTokens:   val.KeyTokens,
+				ValueTokens: val.ValueTokens,
+				Pos:         val.KeyPos,
+			})
+		}
+	}
+
+	slices.SortStableFunc(params, func(a, b Param) int {
+		return a.Pos.Offset - b.Pos.Offset
+	})
+	return params
+}
+
+// Lookup returns the params named key, in query order
+func Lookup(params []Param, key string) []Param {
+	var found []Param
+	for _, param := range params {
+		if param.Key == key {
+			found = append(found, param)
+		}
+	}
+	return found
+}
+
+// Single returns the only param named key. kind names the grammar of the
+// value in the errors, a repeated param is reported at its second value
+func Single(params []Param, key, kind string) (Param, error) {
+	found := Lookup(params, key)
+	switch len(found) {
+	case 0:
+		return Param{}, fmt.Errorf("%s parameter %q not found", kind, key)
+	case 1:
+		return found[0], nil
+	default:
+		return Param{}, rfcquery.NewError(found[1].Pos.Offset, "multiple values for %s parameter %q", kind, key)
+	}
+}
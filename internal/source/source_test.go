@@ -0,0 +1,124 @@
+package source
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/CRSylar/rfcquery"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+func TestParams(t *testing.T) {
+	values, err := formurlencoded.ParseFormURLEncoded("b=1,2&a=x%20y&b=3&c")
+	if err != nil {
+		t.Fatalf("ParseFormURLEncoded() error = %v", err)
+	}
+
+	params := Params(values)
+
+	want := []struct {
+		key   string
+		value string
+		pos   int
+	}{
+		{"b", "1,2", 0},
+		{"a", "x y", 6},
+		{"b", "3", 14},
+		{"c", "", 18},
+	}
+	if len(params) != len(want) {
+		t.Fatalf("Params() = %+v, want %d params", params, len(want))
+	}
+	for i, w := range want {
+		p := params[i]
+		if p.Key != w.key || p.Value().Text != w.value || p.Pos.Offset != w.pos {
+			t.Errorf("param %d = %q=%q at %d, want %q=%q at %d", i, p.Key, p.Value().Text, p.Pos.Offset, w.key, w.value, w.pos)
+		}
+	}
+
+	if b := Lookup(params, "b"); len(b) != 2 || b[0].Pos.Offset != 0 || b[1].Pos.Offset != 14 {
+		t.Errorf("Lookup(b) = %+v, want the params at 0 and 14", b)
+	}
+	if missing := Lookup(params, "z"); missing != nil {
+		t.Errorf("Lookup(z) = %+v, want none", missing)
+	}
+
+	if a, err := Single(params, "a", "test"); err != nil || a.Pos.Offset != 6 {
+		t.Errorf("Single(a) = %+v, %v, want the param at 6", a, err)
+	}
+	var rfcErr *rfcquery.Error
+	if _, err := Single(params, "b", "test"); !errors.As(err, &rfcErr) || rfcErr.Pos.Offset != 14 {
+		t.Errorf("Single(b) error = %v, want multiple values at 14", err)
+	}
+	if _, err := Single(params, "z", "test"); err == nil || err.Error() != `test parameter "z" not found` {
+		t.Errorf("Single(z) error = %v", err)
+	}
+}
+
+func TestSource_Offset(t *testing.T) {
+	tokens, err := rfcquery.NewScanner("k=a%20b").CollectAll()
+	if err != nil {
+		t.Fatalf("CollectAll() error = %v", err)
+	}
+
+	src := New(tokens[2:], 0)
+	if src.Text != "a b" {
+		t.Fatalf("Text = %q, want %q", src.Text, "a b")
+	}
+
+	for i, want := range []int{2, 3, 6, 7} {
+		if got := src.Offset(i); got != want {
+			t.Errorf("Offset(%d) = %d, want %d", i, got, want)
+		}
+	}
+
+	sub := src.Slice(1, 3)
+	if sub.Text != " b" || sub.Offset(0) != 3 || sub.Offset(2) != 7 {
+		t.Errorf("Slice(1, 3) = %q with offsets %d, %d", sub.Text, sub.Offset(0), sub.Offset(2))
+	}
+
+	if empty := src.Slice(3, 3); empty.Offset(0) != 7 {
+		t.Errorf("empty Slice offset = %d, want 7", empty.Offset(0))
+	}
+
+	mapped := src.Mapped("xb!", []int{0, 2, 3})
+	if mapped.Offset(0) != 2 || mapped.Offset(1) != 6 || mapped.Offset(2) != 7 || mapped.Offset(3) != 7 {
+		t.Errorf("Mapped() offsets = %d, %d, %d, %d", mapped.Offset(0), mapped.Offset(1), mapped.Offset(2), mapped.Offset(3))
+	}
+	if whole := src.Mapped("decoded", nil); whole.Offset(4) != 2 || whole.Offset(7) != 7 {
+		t.Errorf("Mapped() with a nil index offsets = %d, %d", whole.Offset(4), whole.Offset(7))
+	}
+}
+
+func TestSource_JSONOffset(t *testing.T) {
+	var v struct {
+		A int `json:"a"`
+		B struct {
+			C []int `json:"c"`
+		} `json:"b"`
+	}
+
+	tests := []struct {
+		text string
+		want int
+	}{
+		{`{"a": 1 x}`, 8},
+		{`{"a"`, 4},
+		{`{} }`, 3},
+		{`{"a":  "xyz"}`, 7},
+		{`{"b": {"c": [1, true]}}`, 16},
+		{`{"b": {"c": {}}}`, 12},
+		{`[1]`, 0},
+	}
+	for _, tt := range tests {
+		err := json.Unmarshal([]byte(tt.text), &v)
+		if got, ok := (Source{Text: tt.text}).JSONOffset(err); !ok || got != tt.want {
+			t.Errorf("JSONOffset(%q) = %d, %v, want %d", tt.text, got, ok, tt.want)
+		}
+	}
+
+	if _, ok := (Source{}).JSONOffset(errors.New("other")); ok {
+		t.Error("JSONOffset() of an error without offset should fail")
+	}
+}
@@ -1,6 +1,7 @@
 package rfcquery
 
 import (
+	"net/url"
 	"strings"
 	"testing"
 )
@@ -98,3 +99,57 @@ func TestPositionInError(t *testing.T) {
 		t.Errorf("expected position 4, got %d", rfcErr.Pos.Offset)
 	}
 }
+
+func FuzzLexerValid(f *testing.F) {
+	for _, seed := range []string{
+		"", "key=value", "name=John%20Doe", "a=!$&'()*+,;=", "user:pass@host",
+		"path/to/file?search", "test%", "test%GG", "hello world", "text\xc3\xa9",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		validErr := NewLexer(input).Valid()
+
+		tokens, scanErr := NewScanner(input).CollectAll()
+		if (validErr == nil) != (scanErr == nil) {
+			t.Fatalf("Valid() error = %v, but tokenization error = %v", validErr, scanErr)
+		}
+
+		if validErr != nil {
+			rfcErr, ok := validErr.(*Error)
+			if !ok {
+				t.Fatalf("expected *Error, got %T", validErr)
+			}
+			if rfcErr.Pos.Offset < 0 || rfcErr.Pos.Offset >= len(input) {
+				t.Fatalf("error position %d out of input bounds [0, %d)", rfcErr.Pos.Offset, len(input))
+			}
+			if scanErr.(*Error).Pos != rfcErr.Pos {
+				t.Fatalf("Valid() and scanner disagree on error position: %d vs %d", rfcErr.Pos.Offset, scanErr.(*Error).Pos.Offset)
+			}
+			return
+		}
+
+		if got := tokens.String(); got != input {
+			t.Fatalf("TokenSlice.String() = %q, want %q", got, input)
+		}
+
+		decoded, err := NewLexer(input).Decode()
+		if err != nil {
+			t.Fatalf("Decode() of valid input failed: %v", err)
+		}
+		if got := tokens.StringDecoded(); got != decoded {
+			t.Fatalf("TokenSlice.StringDecoded() = %q, Decode() = %q", got, decoded)
+		}
+
+		// Every character the lexer accepts is one net/url leaves untouched when unescaping
+		// a path segment, except for percent-encoded sequences which both must decode alike
+		stdDecoded, err := url.PathUnescape(input)
+		if err != nil {
+			t.Fatalf("net/url rejected RFC3986-valid input %q: %v", input, err)
+		}
+		if stdDecoded != decoded {
+			t.Fatalf("Decode() = %q, net/url PathUnescape() = %q", decoded, stdDecoded)
+		}
+	})
+}
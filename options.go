@@ -0,0 +1,60 @@
+package rfcquery
+
+import "context"
+
+// ParseOptions bounds the work done by the scanner and by the parsers
+// reading from it. A zero value for any field means "no limit"
+type ParseOptions struct {
+	// MaxInputLength is the maximum length in bytes of the raw query
+	MaxInputLength int
+
+	// MaxParams is the maximum number of key-value pairs
+	MaxParams int
+
+	// MaxKeyLength and MaxValueLength bound the raw length of a single key or value
+	MaxKeyLength   int
+	MaxValueLength int
+
+	// MaxTokens is the maximum number of tokens the scanner will produce
+	MaxTokens int
+
+	// MaxJSONDepth is the maximum nesting of objects and arrays in JSON values
+	MaxJSONDepth int
+
+	// MaxTMFExpressions is the maximum number of TMF filter expressions
+	MaxTMFExpressions int
+}
+
+// CheckParam enforces MaxParams, MaxKeyLength and MaxValueLength for the
+// index-th (zero based) parameter of a query. pos is used to report a MaxParams
+// violation when the parameter has no key tokens
+func (o ParseOptions) CheckParam(index int, pos Position, key, value TokenSlice) error {
+	if len(key) > 0 {
+		pos = key[0].Start
+	}
+
+	if o.MaxParams > 0 && index >= o.MaxParams {
+		return NewLimitError(LimitParams, o.MaxParams, pos.Offset)
+	}
+
+	if o.MaxKeyLength > 0 && key.Span() > o.MaxKeyLength {
+		return NewLimitError(LimitKeyLength, o.MaxKeyLength, key[0].Start.Offset+o.MaxKeyLength)
+	}
+
+	if o.MaxValueLength > 0 && value.Span() > o.MaxValueLength {
+		return NewLimitError(LimitValueLength, o.MaxValueLength, value[0].Start.Offset+o.MaxValueLength)
+	}
+
+	return nil
+}
+
+// ParseContext runs parser over query, enforcing opts and aborting
+// as soon as ctx is canceled
+func ParseContext(ctx context.Context, parser Parser, query string, opts ParseOptions) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &Error{Msg: "parsing canceled", Err: err}
+	}
+
+	scanner := NewScannerContext(ctx, query, opts)
+	return parser.Parse(scanner)
+}
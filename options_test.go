@@ -0,0 +1,161 @@
+package rfcquery
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// collectParser drains the scanner, used to exercise the scanner limits
+type collectParser struct{}
+
+func (p *collectParser) Parse(scanner *Scanner) (any, error) {
+	return scanner.CollectAll()
+}
+
+func (p *collectParser) Name() string {
+	return "collect"
+}
+
+func TestParseContextLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		opts      ParseOptions
+		wantLimit Limit
+		wantPos   int
+	}{
+		{
+			name:      "input too long",
+			input:     "key=value",
+			opts:      ParseOptions{MaxInputLength: 5},
+			wantLimit: LimitInputLength,
+			wantPos:   5,
+		},
+		{
+			name:      "too many tokens",
+			input:     "a=b%20c",
+			opts:      ParseOptions{MaxTokens: 3},
+			wantLimit: LimitTokens,
+			wantPos:   3,
+		},
+		{
+			name:  "within limits",
+			input: "a=b%20c",
+			opts:  ParseOptions{MaxInputLength: 7, MaxTokens: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseContext(context.Background(), &collectParser{}, tt.input, tt.opts)
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Fatalf("ParseContext() error = %v", err)
+				}
+				return
+			}
+
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("expected *LimitError, got %T (%v)", err, err)
+			}
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("errors.Is(err, ErrLimitExceeded) = false")
+			}
+			if limitErr.Limit != tt.wantLimit {
+				t.Errorf("Limit = %q, want %q", limitErr.Limit, tt.wantLimit)
+			}
+			if limitErr.Pos.Offset != tt.wantPos {
+				t.Errorf("Pos = %d, want %d", limitErr.Pos.Offset, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestScannerTokensNotCountedTwice(t *testing.T) {
+	scanner := NewScannerContext(context.Background(), "abc", ParseOptions{MaxTokens: 3})
+
+	if _, err := scanner.PeekN(3); err != nil {
+		t.Fatalf("PeekN() error = %v", err)
+	}
+	scanner.NextToken()
+	scanner.Rewind(1)
+
+	if _, err := scanner.CollectAll(); err != nil {
+		t.Errorf("re-scanned tokens should not count against MaxTokens: %v", err)
+	}
+}
+
+func TestParseContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ParseContext(ctx, &collectParser{}, "key=value", ParseOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestScannerCanceledDuringScan(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	scanner := NewScannerContext(ctx, strings.Repeat("a", cancelCheckInterval*2), ParseOptions{})
+
+	for range cancelCheckInterval {
+		if _, err := scanner.NextToken(); err != nil {
+			t.Fatalf("NextToken() error = %v", err)
+		}
+	}
+	cancel()
+
+	_, err := scanner.CollectAll()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	var rfcErr *Error
+	if !errors.As(err, &rfcErr) || rfcErr.Pos.Offset != cancelCheckInterval {
+		t.Errorf("expected cancellation at position %d, got %v", cancelCheckInterval, err)
+	}
+}
+
+func TestParseOptionsCheckParam(t *testing.T) {
+	scanner := NewScanner("key=value")
+	key, _ := scanner.CollectN(3)
+	scanner.NextToken()
+	value, _ := scanner.CollectAll()
+
+	tests := []struct {
+		name      string
+		opts      ParseOptions
+		index     int
+		wantLimit Limit
+		wantPos   int
+	}{
+		{"no limits", ParseOptions{}, 10, "", 0},
+		{"too many params", ParseOptions{MaxParams: 2}, 2, LimitParams, 0},
+		{"key too long", ParseOptions{MaxKeyLength: 2}, 0, LimitKeyLength, 2},
+		{"value too long", ParseOptions{MaxValueLength: 3}, 0, LimitValueLength, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.CheckParam(tt.index, Position{}, key, value)
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Fatalf("CheckParam() error = %v", err)
+				}
+				return
+			}
+
+			limitErr, ok := err.(*LimitError)
+			if !ok {
+				t.Fatalf("expected *LimitError, got %T", err)
+			}
+			if limitErr.Limit != tt.wantLimit || limitErr.Pos.Offset != tt.wantPos {
+				t.Errorf("got %v, want %s at %d", limitErr, tt.wantLimit, tt.wantPos)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package aip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+// AIPListRequest holds the standard fields of an AIP-132 List request
+type AIPListRequest struct {
+	// Filter is nil when absent or blank
+	Filter *AIPExpr
+
+	OrderBy []AIPOrderBy
+
+	// PageSize is 0 when unspecified, letting the server choose
+	PageSize  int
+	PageToken string
+
+	// OtherParams holds the remaining parameters, e.g. show_deleted
+	OtherParams map[string][]string
+}
+
+// AIPOrderBy is one field of order_by, "display_name desc"
+type AIPOrderBy struct {
+	Field string // dotted path, "author.name"
+	Path  []string
+	Desc  bool
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// AIPParser parses AIP-132 list requests with AIP-160 filters.
+// Spaces must be percent-encoded as %20
+type AIPParser struct {
+	// StrictValidation enforces RFC3986 compliance
+	StrictValidation bool
+
+	// Schema declares the filterable and sortable fields by dotted path.
+	// When set, unknown fields are rejected and the right operands of
+	// restrictions are type-checked. Nil accepts any field
+	Schema map[string]FieldType
+
+	// MaxPageSize caps page_size, larger values are lowered to it as
+	// AIP-158 requires. 0 means no maximum
+	MaxPageSize int
+}
+
+// NewAIPParser creates a parser with default settings
+func NewAIPParser() *AIPParser {
+	return &AIPParser{
+		StrictValidation: true,
+	}
+}
+
+// Name returns the parser identifier
+func (p *AIPParser) Name() string {
+	return "aip"
+}
+
+// Parse implements the Parser interface
+func (p *AIPParser) Parse(scanner *rfcquery.Scanner) (any, error) {
+	if p.StrictValidation {
+		if err := scanner.Valid(); err != nil {
+			return nil, fmt.Errorf("RFC3986 validation failed: %w", err)
+		}
+		scanner.Reset()
+	}
+
+	formParser := &formurlencoded.FormURLEncodedParser{}
+	result, err := formParser.Parse(scanner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query parameters: %w", err)
+	}
+
+	request := &AIPListRequest{OtherParams: make(map[string][]string)}
+	seen := make(map[string]bool)
+
+	for _, param := range source.Params(result.(*rfcquery.Values)) {
+		value := param.Value()
+
+		switch param.Key {
+		case "filter", "order_by", "page_size", "page_token":
+			if seen[param.Key] {
+				return nil, rfcquery.NewError(param.Pos.Offset, "duplicate parameter %q", param.Key)
+			}
+			seen[param.Key] = true
+		default:
+			request.OtherParams[param.Key] = append(request.OtherParams[param.Key], value.Text)
+			continue
+		}
+
+		switch param.Key {
+		case "filter":
+			request.Filter, err = p.parseFilter(value)
+		case "order_by":
+			request.OrderBy, err = p.parseOrderBy(value)
+		case "page_size":
+			request.PageSize, err = p.parsePageSize(value)
+		case "page_token":
+			request.PageToken = value.Text
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return request, nil
+}
+
+func (p *AIPParser) parseFilter(value source.Source) (*AIPExpr, error) {
+	expr, err := parseFilter(value)
+	if err != nil || expr == nil || p.Schema == nil {
+		return expr, err
+	}
+	if err := check(p.Schema, expr); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// parseOrderBy parses "field [asc|desc]" items separated by commas
+func (p *AIPParser) parseOrderBy(value source.Source) ([]AIPOrderBy, error) {
+	var items []AIPOrderBy
+	if trimSpaces(value).Text == "" {
+		return nil, nil
+	}
+
+	start := 0
+	for i := 0; i <= len(value.Text); i++ {
+		if i < len(value.Text) && value.Text[i] != ',' {
+			continue
+		}
+		part := trimSpaces(value.Slice(start, i))
+		start = i + 1
+
+		item := AIPOrderBy{Pos: part.Position(0), Tokens: part.Tokens}
+		field := part
+		if sp := strings.IndexByte(part.Text, ' '); sp >= 0 {
+			field = part.Slice(0, sp)
+			switch direction := strings.TrimLeft(part.Text[sp:], " "); direction {
+			case "desc":
+				item.Desc = true
+			case "asc":
+			default:
+				return nil, part.Errorf(len(part.Text)-len(direction), "expected asc or desc, got %q", direction)
+			}
+		}
+
+		if field.Text == "" {
+			return nil, part.Errorf(0, "empty order_by field")
+		}
+		item.Field = field.Text
+		item.Path = strings.Split(field.Text, ".")
+		for _, segment := range item.Path {
+			if segment == "" || strings.ContainsAny(segment, textStop) {
+				return nil, field.Errorf(0, "invalid order_by field %q", field.Text)
+			}
+		}
+
+		if p.Schema != nil {
+			fieldType, ok := lookup(p.Schema, item.Path)
+			if !ok {
+				return nil, field.Errorf(0, "unknown field %q", field.Text)
+			}
+			if fieldType.Repeated || fieldType.Kind == FieldMap {
+				return nil, field.Errorf(0, "cannot order by %s field %q", describeType(fieldType), field.Text)
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (p *AIPParser) parsePageSize(value source.Source) (int, error) {
+	n, err := strconv.Atoi(value.Text)
+	if err != nil || n < 0 || strings.HasPrefix(value.Text, "+") {
+		return 0, value.Errorf(0, "page_size must be a non-negative integer, got %q", value.Text)
+	}
+	if p.MaxPageSize > 0 {
+		n = min(n, p.MaxPageSize)
+	}
+	return n, nil
+}
+
+// trimSpaces removes the surrounding spaces of src
+func trimSpaces(src source.Source) source.Source {
+	i, j := 0, len(src.Text)
+	for i < j && src.Text[i] == ' ' {
+		i++
+	}
+	for j > i && src.Text[j-1] == ' ' {
+		j--
+	}
+	return src.Slice(i, j)
+}
+
+// newError returns an error positioned on expr
+func newError(expr *AIPExpr, format string, args ...any) error {
+	return rfcquery.NewError(expr.Pos.Offset, format, args...)
+}
+
+// ParseAIPListRequest - convenience function
+func ParseAIPListRequest(query string) (*AIPListRequest, error) {
+	scanner := rfcquery.NewScanner(query)
+	if err := scanner.Valid(); err != nil {
+		return nil, err
+	}
+
+	result, err := NewAIPParser().Parse(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, ok := result.(*AIPListRequest)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %T", result)
+	}
+
+	return parsed, nil
+}
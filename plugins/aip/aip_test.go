@@ -0,0 +1,246 @@
+package aip_test
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/plugins/aip"
+)
+
+func TestAIPParser_Filter(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"equality", "filter=title%20%3D%20%22Hello%22", `title="Hello"`},
+		{"no spaces", "filter=a.b.c%3E%3D5", "a.b.c>=5"},
+		{"or binds tighter", "filter=a%20AND%20b%20OR%20c", "a AND b OR c"},
+		{"implicit and", "filter=a%20b%20AND%20c", "a AND b AND c"},
+		{"not", "filter=NOT%20deleted%20%3D%20true", "NOT deleted=true"},
+		{"minus", "filter=-tags%3Aarchived", "NOT tags:archived"},
+		{"has", "filter=labels.env%3A%2A", "labels.env:*"},
+		{"composite", "filter=%28a%20%3D%201%20OR%20b%20%3D%202%29%20c%20%21%3D%203", "a=1 OR b=2 AND c!=3"},
+		{"and inside or", "filter=%28a%20AND%20b%29%20OR%20c", "(a AND b) OR c"},
+		{"composite argument", "filter=state%20%3D%20%28ACTIVE%20OR%20PENDING%29", "state=(ACTIVE OR PENDING)"},
+		{"negated composite", "filter=NOT%20%28a%20OR%20b%29", "NOT (a OR b)"},
+		{"function", "filter=regex%28name%2C%20%22%5Ea.%2A%22%29%20AND%20time.now%28%29%20%3E%20t", `regex(name, "^a.*") AND time.now()>t`},
+		{"numbers", "filter=rating%20%3E%204.5%20AND%20delta%20%3C%20-30", "rating>4.5 AND delta<-30"},
+		{"quoted traversal", "filter=labels.%22my%20key%22.%222%22%20%3D%20x", `labels."my key"."2"=x`},
+		{"single quotes", "filter=name%20%3D%20%27it%5C%27s%27", `name="it's"`},
+		{"global restriction", "filter=%22quick%20fox%22", `"quick fox"`},
+		{"wildcard", "filter=name%20%3D%20%22%2A.pdf%22", `name="*.pdf"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := aip.ParseAIPListRequest(tt.input)
+			if err != nil {
+				t.Fatalf("ParseAIPListRequest() error = %v", err)
+			}
+			if got := request.Filter.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAIPParser_FilterPositions(t *testing.T) {
+	const (
+		logical   = "filter=a%20%3D%201%20OR%20b"
+		call      = "filter=NOT%20f(x,%22y%22)"
+		composite = "filter=(a%20OR%20b)%20c"
+	)
+
+	tests := []struct {
+		name       string
+		input      string
+		node       func(f *aip.AIPExpr) *aip.AIPExpr
+		wantPos    int
+		wantTokens string
+	}{
+		{"or", logical, func(f *aip.AIPExpr) *aip.AIPExpr { return f }, 7, "a%20%3D%201%20OR%20b"},
+		{"restriction", logical, func(f *aip.AIPExpr) *aip.AIPExpr { return f.Args[0] }, 7, "a%20%3D%201"},
+		{"restriction argument", logical, func(f *aip.AIPExpr) *aip.AIPExpr { return f.Args[0].Args[1] }, 17, "1"},
+		{"member", logical, func(f *aip.AIPExpr) *aip.AIPExpr { return f.Args[1] }, 26, "b"},
+		{"not", call, func(f *aip.AIPExpr) *aip.AIPExpr { return f }, 7, "NOT%20f(x,%22y%22)"},
+		{"call", call, func(f *aip.AIPExpr) *aip.AIPExpr { return f.Args[0] }, 13, "f(x,%22y%22)"},
+		{"text argument", call, func(f *aip.AIPExpr) *aip.AIPExpr { return f.Args[0].Args[1] }, 17, "%22y%22"},
+		{"sequence", composite, func(f *aip.AIPExpr) *aip.AIPExpr { return f }, 7, "(a%20OR%20b)%20c"},
+		{"composite", composite, func(f *aip.AIPExpr) *aip.AIPExpr { return f.Args[0] }, 8, "a%20OR%20b"},
+		{"after composite", composite, func(f *aip.AIPExpr) *aip.AIPExpr { return f.Args[1] }, 22, "c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := aip.ParseAIPListRequest(tt.input)
+			if err != nil {
+				t.Fatalf("ParseAIPListRequest() error = %v", err)
+			}
+			node := tt.node(request.Filter)
+			if node.Pos.Offset != tt.wantPos || node.Tokens.String() != tt.wantTokens {
+				t.Errorf("node at %d with tokens %q, want %d with %q", node.Pos.Offset, node.Tokens.String(), tt.wantPos, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestAIPParser_ListRequest(t *testing.T) {
+	parser := aip.NewAIPParser()
+	parser.MaxPageSize = 100
+
+	result, err := parser.Parse(rfcquery.NewScanner("order_by=display_name%20desc,%20create_time,author.name%20asc&page_size=500&page_token=abc&show_deleted=true&filter="))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	request := result.(*aip.AIPListRequest)
+
+	var order []string
+	for _, o := range request.OrderBy {
+		order = append(order, fmt.Sprintf("%s:%v@%d", o.Field, o.Desc, o.Pos.Offset))
+	}
+	if got, want := strings.Join(order, " "), "display_name:true@9 create_time:false@32 author.name:false@44"; got != want {
+		t.Errorf("OrderBy = %s, want %s", got, want)
+	}
+	if request.PageSize != 100 || request.PageToken != "abc" {
+		t.Errorf("page = %d %q, want 100 (capped) and abc", request.PageSize, request.PageToken)
+	}
+	if request.Filter != nil {
+		t.Errorf("blank filter = %v, want nil", request.Filter)
+	}
+	if got := request.OtherParams["show_deleted"]; len(got) != 1 || got[0] != "true" {
+		t.Errorf("OtherParams = %v", request.OtherParams)
+	}
+}
+
+func TestAIPParser_Schema(t *testing.T) {
+	parser := aip.NewAIPParser()
+	parser.Schema = map[string]aip.FieldType{
+		"rating":      {Kind: aip.FieldNumber},
+		"count":       {Kind: aip.FieldInteger},
+		"published":   {Kind: aip.FieldBoolean},
+		"create_time": {Kind: aip.FieldTimestamp},
+		"ttl":         {Kind: aip.FieldDuration},
+		"state":       {Kind: aip.FieldEnum, Enum: []string{"ACTIVE", "PENDING"}},
+		"tags":        {Kind: aip.FieldString, Repeated: true},
+		"labels":      {Kind: aip.FieldMap},
+		"author.name": {Kind: aip.FieldString},
+	}
+
+	filter := `rating >= 4.5 count < 10 published = true create_time > "2024-01-02T03:04:05Z" ` +
+		`ttl <= 1.5s state = (ACTIVE OR PENDING) tags:urgent labels.env = prod labels:team author.name:*`
+	result, err := parser.Parse(rfcquery.NewScanner("filter=" + strings.ReplaceAll(url.QueryEscape(filter), "+", "%20") + "&order_by=rating%20desc,author.name"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	args := result.(*aip.AIPListRequest).Filter.Args
+	want := []any{
+		4.5, int64(10), true, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), 1500 * time.Millisecond,
+	}
+	for i, w := range want {
+		if got := args[i].Args[1].Value; fmt.Sprint(got) != fmt.Sprint(w) {
+			t.Errorf("restriction %d value = %#v, want %#v", i, got, w)
+		}
+	}
+	if got := args[5].Args[1].Args[1].Value; got != "PENDING" {
+		t.Errorf("enum in composite = %#v", got)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		wantPos int
+		wantMsg string
+	}{
+		{"unknown field", "filter=colour%20%3D%20red", 7, `unknown field "colour"`},
+		{"bad integer", "filter=count%20%3D%20many", 21, "invalid integer value"},
+		{"bad timestamp", "filter=create_time%20%3E%20yesterday", 27, "invalid timestamp value"},
+		{"bad duration", "filter=ttl%20%3D%205m", 19, "invalid duration value"},
+		{"bad enum", "filter=state%20%3D%20DONE", 21, "expected one of ACTIVE, PENDING"},
+		{"ordering on enum", "filter=state%20%3E%20ACTIVE", 7, "operator > not allowed on enum"},
+		{"equality on repeated", "filter=tags%20%3D%20a", 7, "not allowed on repeated string"},
+		{"unknown order_by", "order_by=colour", 9, "unknown field"},
+		{"order by repeated", "order_by=tags", 9, "cannot order by repeated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parser.Parse(rfcquery.NewScanner(tt.query))
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestAIPParser_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{"missing argument", "filter=a%20%3D", 14, "expected a value"},
+		{"dangling and", "filter=a%20AND", 11, "unexpected AND"},
+		{"unclosed composite", "filter=%28a%20OR%20b", 20, "expected ')'"},
+		{"unclosed call", "filter=f%28a%20b%29", 15, "expected ',' or ')'"},
+		{"unterminated string", "filter=a%20%3D%20%22b", 17, "unterminated string"},
+		{"trailing paren", "filter=a%29", 8, "unexpected ')'"},
+		{"bad direction", "order_by=a%20up", 13, "expected asc or desc"},
+		{"empty order field", "order_by=a,,b", 11, "empty order_by field"},
+		{"negative page size", "page_size=-1", 10, "non-negative integer"},
+		{"duplicate", "page_size=1&page_size=2", 12, "duplicate parameter"},
+		{"too deep", "filter=" + strings.Repeat("(", 200) + "a" + strings.Repeat(")", 200), 107, "nested deeper"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := aip.ParseAIPListRequest(tt.input)
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func FuzzAIPParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		"filter=a%20AND%20b%20OR%20c",
+		"filter=NOT%20%28x.y%20%3D%20%22z%22%20OR%20-tags%3Afoo%29%20rating%3E%3D4.5",
+		"filter=regex%28name%2C%20%22%5Ea.%2A%22%29%20labels.%22k%22%3A%2A",
+		"order_by=a%20desc,b&page_size=10&page_token=x",
+		"filter=" + strings.Repeat("(", 50),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		request, err := aip.ParseAIPListRequest(input)
+		if err != nil || request.Filter == nil {
+			return
+		}
+
+		// rendered filters parse back to the same filter
+		rendered := request.Filter.String()
+		again, err := aip.ParseAIPListRequest("filter=" + strings.ReplaceAll(url.QueryEscape(rendered), "+", "%20"))
+		if err != nil {
+			t.Fatalf("ParseAIPListRequest() of rendered filter %q error = %v", rendered, err)
+		}
+		if got := again.Filter.String(); got != rendered {
+			t.Fatalf("rendered filter %q renders again as %q", rendered, got)
+		}
+	})
+}
@@ -0,0 +1,522 @@
+package aip
+
+import (
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+)
+
+// AIPExprKind is the kind of a node of a filter expression
+type AIPExprKind int
+
+const (
+	AIPAnd         AIPExprKind = iota // Args joined by AND, explicit or by juxtaposition
+	AIPOr                             // Args joined by OR
+	AIPNot                            // NOT Args[0], also written as -Args[0]
+	AIPRestriction                    // Args[0] Op Args[1], Op is "=", "!=", "<", "<=", ">", ">=" or ":"
+	AIPMember                         // Path such as ["a", "b", "c"] for a.b.c, or a bare value
+	AIPText                           // quoted string Value
+	AIPCall                           // Name(Args...)
+)
+
+func (k AIPExprKind) String() string {
+	switch k {
+	case AIPAnd:
+		return "and"
+	case AIPOr:
+		return "or"
+	case AIPNot:
+		return "not"
+	case AIPRestriction:
+		return "restriction"
+	case AIPMember:
+		return "member"
+	case AIPText:
+		return "text"
+	case AIPCall:
+		return "call"
+	default:
+		return "invalid"
+	}
+}
+
+// AIPExpr is a node of an AIP-160 filter expression.
+//
+// The grammar, where OR binds tighter than AND and juxtaposed terms are
+// joined by AND:
+//
+//	expression  = sequence *( WS "AND" WS sequence )
+//	sequence    = factor *( WS factor )
+//	factor      = term *( WS "OR" WS term )
+//	term        = [ "NOT" WS / "-" ] simple
+//	simple      = restriction / "(" expression ")"
+//	restriction = comparable [ [WS] comparator [WS] arg ]
+//	comparator  = "<=" / "<" / ">=" / ">" / "!=" / "=" / ":"
+//	comparable  = member / function
+//	member      = value *( "." value )
+//	function    = text *( "." text ) "(" [ arg *( "," arg ) ] ")"
+//	arg         = comparable / "(" expression ")"
+//	value       = text / DQUOTE *char DQUOTE / "'" *char "'"
+type AIPExpr struct {
+	Kind AIPExprKind
+
+	Op   string
+	Args []*AIPExpr
+
+	// Path holds the member segments, Name the dotted member or function name
+	Path []string
+	Name string
+
+	// Value is the unquoted string of AIPText. When the parser has a
+	// schema, the right operand of a restriction on a known field also gets
+	// its typed value: string, int64, float64, bool, time.Time or time.Duration
+	Value any
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// String renders the expression with explicit AND operators, comparators
+// without spaces and only the parentheses its precedence requires
+func (e *AIPExpr) String() string {
+	switch e.Kind {
+	case AIPAnd, AIPOr:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = arg.operand(e.precedence() + 1)
+		}
+		return strings.Join(args, " "+e.Op+" ")
+	case AIPNot:
+		return "NOT " + e.Args[0].operand(4)
+	case AIPRestriction:
+		return e.Args[0].operand(5) + e.Op + e.Args[1].operand(5)
+	case AIPMember:
+		if len(e.Path) == 1 {
+			return e.Path[0]
+		}
+		path := make([]string, len(e.Path))
+		for i, segment := range e.Path {
+			path[i] = segment
+			if needsQuotes(segment) {
+				path[i] = quote(segment)
+			}
+		}
+		return strings.Join(path, ".")
+	case AIPText:
+		s, _ := e.Value.(string)
+		return quote(s)
+	case AIPCall:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = arg.operand(5)
+		}
+		return e.Name + "(" + strings.Join(args, ", ") + ")"
+	default:
+		return "?"
+	}
+}
+
+// precedence ranks the node from AND (1) to the comparables (5)
+func (e *AIPExpr) precedence() int {
+	switch e.Kind {
+	case AIPAnd:
+		return 1
+	case AIPOr:
+		return 2
+	case AIPNot:
+		return 3
+	case AIPRestriction:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// operand renders e, parenthesized when it binds looser than min
+func (e *AIPExpr) operand(min int) string {
+	if e.precedence() < min {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+// needsQuotes reports whether a member segment would not read back as
+// the same unquoted text
+func needsQuotes(segment string) bool {
+	switch segment {
+	case "", "AND", "OR", "NOT":
+		return true
+	}
+	return strings.ContainsAny(segment, textStop+`\ `) || segment[0] == '-' || isDigit(segment[0])
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// maxExprDepth bounds the recursion of the filter parser
+const maxExprDepth = 100
+
+// textStop are the bytes ending an unquoted value
+const textStop = " ()\"':=<>!,."
+
+var comparators = []string{"<=", "<", ">=", ">", "!=", "=", ":"}
+
+// exprParser works on the decoded filter value, positions are mapped back
+// to the original query through the source tokens
+type exprParser struct {
+	src   source.Source
+	pos   int
+	depth int
+}
+
+func parseFilter(src source.Source) (*AIPExpr, error) {
+	ep := &exprParser{src: src}
+
+	ep.skipSpaces()
+	if ep.eof() {
+		return nil, nil
+	}
+
+	expr, err := ep.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	ep.skipSpaces()
+	if !ep.eof() {
+		return nil, ep.errorf("unexpected %q in filter", ep.src.Text[ep.pos])
+	}
+	return expr, nil
+}
+
+func (ep *exprParser) eof() bool {
+	return ep.pos >= len(ep.src.Text)
+}
+
+func (ep *exprParser) peek() byte {
+	if ep.eof() {
+		return 0
+	}
+	return ep.src.Text[ep.pos]
+}
+
+func (ep *exprParser) errorf(format string, args ...any) error {
+	return ep.src.Errorf(ep.pos, format, args...)
+}
+
+func (ep *exprParser) skipSpaces() {
+	for !ep.eof() && ep.src.Text[ep.pos] == ' ' {
+		ep.pos++
+	}
+}
+
+// node fills the position and tokens of a node that started at start
+func (ep *exprParser) node(expr *AIPExpr, start int) *AIPExpr {
+	expr.Pos = ep.src.Position(start)
+	expr.Tokens = ep.src.Tokens[start:ep.pos]
+	return expr
+}
+
+// keywordAt reports whether word starts at i and is followed by a space
+func (ep *exprParser) keywordAt(i int, word string) bool {
+	rest := ep.src.Text[i:]
+	return strings.HasPrefix(rest, word) && len(rest) > len(word) && rest[len(word)] == ' '
+}
+
+// binaryOp consumes " word " after an operand
+func (ep *exprParser) binaryOp(word string) bool {
+	save := ep.pos
+	if ep.peek() != ' ' {
+		return false
+	}
+	ep.skipSpaces()
+	if ep.keywordAt(ep.pos, word) {
+		ep.pos += len(word)
+		ep.skipSpaces()
+		return true
+	}
+	ep.pos = save
+	return false
+}
+
+func (ep *exprParser) enter() error {
+	ep.depth++
+	if ep.depth > maxExprDepth {
+		return ep.errorf("filter nested deeper than %d levels", maxExprDepth)
+	}
+	return nil
+}
+
+// nary collects operands joined by next into a node of kind, a single
+// operand is returned as is
+func (ep *exprParser) nary(kind AIPExprKind, operand func() (*AIPExpr, error), next func() bool) (*AIPExpr, error) {
+	start := ep.pos
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	if !next() {
+		return first, nil
+	}
+
+	args := flatten(nil, kind, first)
+	for ok := true; ok; ok = next() {
+		arg, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		args = flatten(args, kind, arg)
+	}
+
+	op := "AND"
+	if kind == AIPOr {
+		op = "OR"
+	}
+	return ep.node(&AIPExpr{Kind: kind, Op: op, Args: args}, start), nil
+}
+
+// flatten appends expr to args, or its arguments when it has the same kind:
+// "a b AND c" is a single AND of three terms
+func flatten(args []*AIPExpr, kind AIPExprKind, expr *AIPExpr) []*AIPExpr {
+	if expr.Kind == kind {
+		return append(args, expr.Args...)
+	}
+	return append(args, expr)
+}
+
+func (ep *exprParser) parseExpression() (*AIPExpr, error) {
+	if err := ep.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { ep.depth-- }()
+
+	return ep.nary(AIPAnd, ep.parseSequence, func() bool { return ep.binaryOp("AND") })
+}
+
+func (ep *exprParser) parseSequence() (*AIPExpr, error) {
+	return ep.nary(AIPAnd, ep.parseFactor, func() bool {
+		save := ep.pos
+		if ep.peek() != ' ' {
+			return false
+		}
+		ep.skipSpaces()
+		// the sequence ends with the expression or before an explicit AND
+		if ep.eof() || ep.peek() == ')' || ep.keywordAt(ep.pos, "AND") {
+			ep.pos = save
+			return false
+		}
+		return true
+	})
+}
+
+func (ep *exprParser) parseFactor() (*AIPExpr, error) {
+	return ep.nary(AIPOr, ep.parseTerm, func() bool { return ep.binaryOp("OR") })
+}
+
+func (ep *exprParser) parseTerm() (*AIPExpr, error) {
+	start := ep.pos
+
+	negated := false
+	switch {
+	case ep.keywordAt(ep.pos, "NOT"):
+		ep.pos += len("NOT")
+		ep.skipSpaces()
+		negated = true
+	case ep.peek() == '-' && ep.pos+1 < len(ep.src.Text) && ep.src.Text[ep.pos+1] != ' ':
+		ep.pos++
+		negated = true
+	}
+
+	if !negated {
+		return ep.parseSimple()
+	}
+
+	if err := ep.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { ep.depth-- }()
+
+	operand, err := ep.parseSimple()
+	if err != nil {
+		return nil, err
+	}
+	return ep.node(&AIPExpr{Kind: AIPNot, Op: "NOT", Args: []*AIPExpr{operand}}, start), nil
+}
+
+func (ep *exprParser) parseSimple() (*AIPExpr, error) {
+	if ep.peek() == '(' {
+		return ep.parseComposite()
+	}
+
+	start := ep.pos
+	left, err := ep.parseComparable()
+	if err != nil {
+		return nil, err
+	}
+
+	save := ep.pos
+	ep.skipSpaces()
+	op := ep.comparator()
+	if op == "" {
+		ep.pos = save
+		return left, nil
+	}
+	ep.skipSpaces()
+
+	right, err := ep.parseArg()
+	if err != nil {
+		return nil, err
+	}
+	return ep.node(&AIPExpr{Kind: AIPRestriction, Op: op, Args: []*AIPExpr{left, right}}, start), nil
+}
+
+func (ep *exprParser) comparator() string {
+	for _, op := range comparators {
+		if strings.HasPrefix(ep.src.Text[ep.pos:], op) {
+			ep.pos += len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+func (ep *exprParser) parseComposite() (*AIPExpr, error) {
+	ep.pos++
+	ep.skipSpaces()
+	expr, err := ep.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	ep.skipSpaces()
+	if ep.peek() != ')' {
+		return nil, ep.errorf("expected ')'")
+	}
+	ep.pos++
+	return expr, nil
+}
+
+func (ep *exprParser) parseArg() (*AIPExpr, error) {
+	if ep.peek() == '(' {
+		return ep.parseComposite()
+	}
+	return ep.parseComparable()
+}
+
+func (ep *exprParser) parseComparable() (*AIPExpr, error) {
+	start := ep.pos
+
+	first, quoted, err := ep.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if !quoted && (first == "AND" || first == "OR") {
+		ep.pos = start
+		return nil, ep.errorf("unexpected %s, expected a value", first)
+	}
+
+	path := []string{first}
+	allText := !quoted
+	for ep.peek() == '.' {
+		ep.pos++
+		segment, quoted, err := ep.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, segment)
+		allText = allText && !quoted
+	}
+
+	name := strings.Join(path, ".")
+	if ep.peek() == '(' && allText {
+		return ep.parseCall(name, start)
+	}
+	if len(path) == 1 && quoted {
+		return ep.node(&AIPExpr{Kind: AIPText, Value: first}, start), nil
+	}
+	return ep.node(&AIPExpr{Kind: AIPMember, Path: path, Name: name}, start), nil
+}
+
+func (ep *exprParser) parseCall(name string, start int) (*AIPExpr, error) {
+	if err := ep.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { ep.depth-- }()
+
+	ep.pos++
+	ep.skipSpaces()
+
+	call := &AIPExpr{Kind: AIPCall, Name: name}
+	if ep.peek() == ')' {
+		ep.pos++
+		return ep.node(call, start), nil
+	}
+
+	for {
+		arg, err := ep.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		ep.skipSpaces()
+		switch ep.peek() {
+		case ',':
+			ep.pos++
+			ep.skipSpaces()
+		case ')':
+			ep.pos++
+			return ep.node(call, start), nil
+		default:
+			return nil, ep.errorf("expected ',' or ')' in the arguments of %s", name)
+		}
+	}
+}
+
+// parseValue reads a quoted string or an unquoted text. Numbers keep their
+// decimal point, so "2.5" is one value rather than a traversal
+func (ep *exprParser) parseValue() (string, bool, error) {
+	start := ep.pos
+
+	if quote := ep.peek(); quote == '"' || quote == '\'' {
+		var sb strings.Builder
+		for ep.pos++; !ep.eof(); ep.pos++ {
+			c := ep.src.Text[ep.pos]
+			switch {
+			case c == quote:
+				ep.pos++
+				return sb.String(), true, nil
+			case c == '\\' && ep.pos+1 < len(ep.src.Text):
+				ep.pos++
+				sb.WriteByte(ep.src.Text[ep.pos])
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		ep.pos = start
+		return "", false, ep.errorf("unterminated string")
+	}
+
+	numeric := isDigit(ep.peek()) || ep.peek() == '-' && ep.pos+1 < len(ep.src.Text) && isDigit(ep.src.Text[ep.pos+1])
+	for !ep.eof() {
+		c := ep.src.Text[ep.pos]
+		if strings.IndexByte(textStop, c) >= 0 && !(numeric && c == '.') {
+			break
+		}
+		ep.pos++
+	}
+
+	if ep.pos == start {
+		if ep.eof() {
+			return "", false, ep.errorf("expected a value")
+		}
+		return "", false, ep.errorf("unexpected %q, expected a value", ep.src.Text[ep.pos])
+	}
+	return ep.src.Text[start:ep.pos], false, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,204 @@
+package aip
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldKind is the type a filter value is checked against and converted to
+type FieldKind int
+
+const (
+	FieldString    FieldKind = iota // string, '*' acts as a wildcard
+	FieldInteger                    // int64
+	FieldNumber                     // float64
+	FieldBoolean                    // bool, "true" or "false"
+	FieldTimestamp                  // time.Time from an RFC 3339 timestamp
+	FieldDuration                   // time.Duration from seconds with an "s" suffix, "1.5s"
+	FieldEnum                       // string, one of FieldType.Enum
+	FieldMap                        // map of strings, "labels.env" addresses the key env
+)
+
+func (k FieldKind) String() string {
+	switch k {
+	case FieldInteger:
+		return "integer"
+	case FieldNumber:
+		return "number"
+	case FieldBoolean:
+		return "boolean"
+	case FieldTimestamp:
+		return "timestamp"
+	case FieldDuration:
+		return "duration"
+	case FieldEnum:
+		return "enum"
+	case FieldMap:
+		return "map"
+	default:
+		return "string"
+	}
+}
+
+// FieldType declares the type of a filterable field in AIPParser.Schema,
+// keyed by its dotted path
+type FieldType struct {
+	Kind FieldKind
+
+	// Enum lists the accepted values of a FieldEnum
+	Enum []string
+
+	// Repeated fields only support the has operator, "tags:urgent"
+	Repeated bool
+}
+
+var durationPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?s$`)
+
+// Coerce converts a raw value into the Go value of the field type
+func (t FieldType) Coerce(value string) (any, error) {
+	switch t.Kind {
+	case FieldInteger:
+		return strconv.ParseInt(value, 10, 64)
+
+	case FieldNumber:
+		return strconv.ParseFloat(value, 64)
+
+	case FieldBoolean:
+		switch value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, strconv.ErrSyntax
+
+	case FieldTimestamp:
+		return time.Parse(time.RFC3339Nano, value)
+
+	case FieldDuration:
+		if !durationPattern.MatchString(value) {
+			return nil, strconv.ErrSyntax
+		}
+		return time.ParseDuration(value)
+
+	case FieldEnum:
+		if !slices.Contains(t.Enum, value) {
+			return nil, strconv.ErrSyntax
+		}
+		return value, nil
+
+	default:
+		return value, nil
+	}
+}
+
+// allowedOperators returns the comparators legal on a field
+func (t FieldType) allowedOperators() []string {
+	switch {
+	case t.Repeated, t.Kind == FieldMap:
+		return []string{":"}
+	case t.Kind == FieldBoolean, t.Kind == FieldEnum:
+		return []string{"=", "!=", ":"}
+	default:
+		return comparators
+	}
+}
+
+// lookup resolves a member path in the schema, a path below a FieldMap
+// addresses one of its string values
+func lookup(schema map[string]FieldType, path []string) (FieldType, bool) {
+	if t, ok := schema[strings.Join(path, ".")]; ok {
+		return t, true
+	}
+	for i := len(path) - 1; i > 0; i-- {
+		if t, ok := schema[strings.Join(path[:i], ".")]; ok && t.Kind == FieldMap && !t.Repeated {
+			return FieldType{Kind: FieldString}, true
+		}
+	}
+	return FieldType{}, false
+}
+
+// check type-checks the restrictions of a filter against the schema and
+// fills the typed values of their right operands
+func check(schema map[string]FieldType, expr *AIPExpr) error {
+	switch expr.Kind {
+	case AIPAnd, AIPOr, AIPNot:
+		for _, arg := range expr.Args {
+			if err := check(schema, arg); err != nil {
+				return err
+			}
+		}
+	case AIPRestriction:
+		return checkRestriction(schema, expr)
+	}
+	return nil
+}
+
+func checkRestriction(schema map[string]FieldType, expr *AIPExpr) error {
+	field, value := expr.Args[0], expr.Args[1]
+	if field.Kind != AIPMember {
+		// the result type of a function is unknown
+		return nil
+	}
+
+	fieldType, ok := lookup(schema, field.Path)
+	if !ok {
+		return newError(field, "unknown field %q", field.Name)
+	}
+
+	// presence test, "field:*"
+	if expr.Op == ":" && value.Kind == AIPMember && value.Name == "*" {
+		return nil
+	}
+
+	if !slices.Contains(fieldType.allowedOperators(), expr.Op) {
+		return newError(expr, "operator %s not allowed on %s field %q", expr.Op, describeType(fieldType), field.Name)
+	}
+
+	// the has operator on a map tests for a key
+	if fieldType.Kind == FieldMap {
+		return nil
+	}
+	return coerce(fieldType, field.Name, value)
+}
+
+// coerce converts the values of a right operand, a composite such as
+// "(ACTIVE OR PENDING)" is converted item by item
+func coerce(fieldType FieldType, name string, value *AIPExpr) error {
+	var raw string
+	switch value.Kind {
+	case AIPAnd, AIPOr, AIPNot:
+		for _, arg := range value.Args {
+			if err := coerce(fieldType, name, arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	case AIPMember:
+		raw = value.Name
+	case AIPText:
+		raw = value.Value.(string)
+	default:
+		return nil
+	}
+
+	typed, err := fieldType.Coerce(raw)
+	if err != nil {
+		if fieldType.Kind == FieldEnum {
+			return newError(value, "invalid value %q for enum field %q, expected one of %s", raw, name, strings.Join(fieldType.Enum, ", "))
+		}
+		return newError(value, "invalid %s value %q for field %q", fieldType.Kind, raw, name)
+	}
+	value.Value = typed
+	return nil
+}
+
+func describeType(t FieldType) string {
+	if t.Repeated {
+		return "repeated " + t.Kind.String()
+	}
+	return t.Kind.String()
+}
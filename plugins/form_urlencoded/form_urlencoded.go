@@ -24,9 +24,11 @@ func (p *FormURLEncodedParser) Name() string {
 // Parse implements the Parser interface
 func (p *FormURLEncodedParser) Parse(scanner *rfcquery.Scanner) (any, error) {
 	values := rfcquery.NewValues()
+	opts := scanner.Options()
 
 	var currKey rfcquery.TokenSlice
 	var currValue rfcquery.TokenSlice
+	params := 0
 
 	for {
 		tok, err := scanner.PeekToken()
@@ -34,9 +36,9 @@ func (p *FormURLEncodedParser) Parse(scanner *rfcquery.Scanner) (any, error) {
 			return nil, err
 		}
 
-		// Collect key
+		// Collect key, a key without value ends at the next '&'
 		currKey, err = scanner.CollectUntil(func(t rfcquery.Token) bool {
-			return t.Type == rfcquery.TokenSubDelims && t.Value == "="
+			return t.Type == rfcquery.TokenSubDelims && (t.Value == "=" || t.Value == "&")
 		})
 		if err != nil {
 			return nil, err
@@ -48,19 +50,29 @@ func (p *FormURLEncodedParser) Parse(scanner *rfcquery.Scanner) (any, error) {
 			return nil, err
 		}
 
-		if eqTok.Type == rfcquery.TokenEOF {
-			// No more token, assume the value is empty
+		if eqTok.Type == rfcquery.TokenEOF || eqTok.Value == "&" {
+			// No value for this key, assume the value is empty
 			if len(currKey) > 0 {
+				if err := opts.CheckParam(params, eqTok.Start, currKey, nil); err != nil {
+					return nil, err
+				}
+				params++
+
 				keyStr := currKey.StringDecoded()
 				val := rfcquery.Value{
 					Value:       "",
+					KeyPos:      currKey[0].Start,
 					ValuePos:    eqTok.Start,
 					KeyTokens:   currKey,
 					ValueTokens: rfcquery.TokenSlice{},
 				}
 				values.Add(keyStr, val)
 			}
-			break
+
+			if eqTok.Type == rfcquery.TokenEOF {
+				break
+			}
+			continue
 		}
 
 		if eqTok.Value != "=" {
@@ -74,6 +86,11 @@ func (p *FormURLEncodedParser) Parse(scanner *rfcquery.Scanner) (any, error) {
 			return nil, err
 		}
 
+		if err := opts.CheckParam(params, eqTok.Start, currKey, currValue); err != nil {
+			return nil, err
+		}
+		params++
+
 		keyStr := currKey.StringDecoded()
 		for _, slice := range currValue.SplitSubDelimiter(",") {
 			valStr := slice.StringDecoded()
@@ -87,9 +104,15 @@ func (p *FormURLEncodedParser) Parse(scanner *rfcquery.Scanner) (any, error) {
 				}
 			}
 
+			// an empty key is positioned on the '=' that follows it
+			keyPos := eqTok.Start
+			if len(currKey) > 0 {
+				keyPos = currKey[0].Start
+			}
+
 			value := rfcquery.Value{
 				Value:       valStr,
-				KeyPos:      currKey[0].Start,
+				KeyPos:      keyPos,
 				ValuePos:    valPos,
 				KeyTokens:   currKey,
 				ValueTokens: currValue,
@@ -1,8 +1,11 @@
 package formurlencoded_test
 
 import (
+	"context"
+	"errors"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/CRSylar/rfcquery"
@@ -84,6 +87,22 @@ func TestFormURLEncodedParser_Parse(t *testing.T) {
 				"data":  {"x*y+z"},
 			},
 		},
+		{
+			name:  "key without value between pairs",
+			input: "a=1&flag&b=2",
+			want: map[string][]string{
+				"a":    {"1"},
+				"flag": {""},
+				"b":    {"2"},
+			},
+		},
+		{
+			name:  "empty key",
+			input: "=value",
+			want: map[string][]string{
+				"": {"value"},
+			},
+		},
 		{
 			name:  "path-style query",
 			input: "path/to/file?search=value",
@@ -167,3 +186,89 @@ func TestStdlibCompatibility(t *testing.T) {
 		})
 	}
 }
+
+func TestFormURLEncodedParser_Limits(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		opts      rfcquery.ParseOptions
+		wantLimit rfcquery.Limit
+		wantPos   int
+	}{
+		{"too many params", "a=1&b=2&c=3", rfcquery.ParseOptions{MaxParams: 2}, rfcquery.LimitParams, 8},
+		{"key too long", "a=1&long=2", rfcquery.ParseOptions{MaxKeyLength: 3}, rfcquery.LimitKeyLength, 7},
+		{"value too long", "a=123456", rfcquery.ParseOptions{MaxValueLength: 4}, rfcquery.LimitValueLength, 6},
+		{"within limits", "a=1&b=2", rfcquery.ParseOptions{MaxParams: 2, MaxKeyLength: 1, MaxValueLength: 1}, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := rfcquery.ParseContext(context.Background(), &formurlencoded.FormURLEncodedParser{}, tt.input, tt.opts)
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+				return
+			}
+
+			var limitErr *rfcquery.LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("expected *LimitError, got %v", err)
+			}
+			if limitErr.Limit != tt.wantLimit || limitErr.Pos.Offset != tt.wantPos {
+				t.Errorf("got %v, want %s limit at position %d", limitErr, tt.wantLimit, tt.wantPos)
+			}
+		})
+	}
+}
+
+func FuzzFormURLEncodedParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		"key=value", "a=1&b=2&c=3", "tag=go,library", "name=John%20Doe", "key=", "key", "=value", "&&", "a=b=c", "%41=%42", "a&b=1",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		scanner := rfcquery.NewScanner(input)
+		if scanner.Valid() != nil {
+			return
+		}
+
+		result, err := (&formurlencoded.FormURLEncodedParser{}).Parse(scanner)
+		if err != nil {
+			return
+		}
+		values := result.(*rfcquery.Values)
+
+		// Differential check against net/url, restricted to the inputs where both
+		// grammars agree: no '+' (space in forms), no ',' (list separator here),
+		// no ';' (rejected by net/url), no empty keys and no '=' inside values
+		if strings.ContainsAny(input, "+,;") {
+			return
+		}
+		for _, pair := range strings.Split(input, "&") {
+			key, _, _ := strings.Cut(pair, "=")
+			if key == "" || strings.Count(pair, "=") > 1 {
+				return
+			}
+		}
+
+		stdValues, err := url.ParseQuery(input)
+		if err != nil {
+			return
+		}
+
+		for key, stdVals := range stdValues {
+			rfcVals := values.Get(key)
+			if len(rfcVals) != len(stdVals) {
+				t.Fatalf("key %q: net/url has %d values, rfcquery has %d", key, len(stdVals), len(rfcVals))
+			}
+			for i := range stdVals {
+				if rfcVals[i].Value != stdVals[i] {
+					t.Fatalf("key %q[%d]: net/url=%q, rfcquery=%q", key, i, stdVals[i], rfcVals[i].Value)
+				}
+			}
+		}
+	})
+}
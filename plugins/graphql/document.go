@@ -0,0 +1,672 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+)
+
+// OperationType is the type of a GraphQL operation
+type OperationType string
+
+const (
+	OperationQuery        OperationType = "query"
+	OperationMutation     OperationType = "mutation"
+	OperationSubscription OperationType = "subscription"
+)
+
+// GraphQLOperation is an operation defined by a GraphQL document
+type GraphQLOperation struct {
+	Type OperationType
+
+	// Name is empty for an anonymous operation
+	Name string
+
+	// Pos is the position of the operation in the query string
+	Pos rfcquery.Position
+}
+
+// maxDocumentDepth bounds the nesting of selection sets, values and types
+const maxDocumentDepth = 1000
+
+// docTokenKind is the kind of a lexical token of a GraphQL document
+type docTokenKind int
+
+const (
+	docEOF docTokenKind = iota
+	docPunct
+	docName
+	docInt
+	docFloat
+	docString
+)
+
+type docToken struct {
+	kind docTokenKind
+	text string
+	pos  int
+}
+
+func (t docToken) String() string {
+	switch t.kind {
+	case docEOF:
+		return "end of document"
+	case docName:
+		return fmt.Sprintf("name %q", t.text)
+	case docInt, docFloat:
+		return "number " + t.text
+	case docString:
+		return "string"
+	default:
+		return strconv.Quote(t.text)
+	}
+}
+
+// documentParser checks the syntax of an executable GraphQL document, per
+// the grammar of the October 2021 specification. It works on the decoded
+// parameter value, positions are mapped back to the original query
+// through the source tokens
+type documentParser struct {
+	src   source.Source
+	pos   int // next byte to lex
+	tok   docToken
+	depth int
+
+	operations []GraphQLOperation
+}
+
+// parseDocument validates the document held by src and lists its
+// operations. Type system definitions are rejected, as are anonymous
+// operations next to other operations and duplicate operation names
+func parseDocument(src source.Source) ([]GraphQLOperation, error) {
+	dp := &documentParser{src: src}
+	if err := dp.advance(); err != nil {
+		return nil, err
+	}
+	if dp.tok.kind == docEOF {
+		return nil, dp.errorf("empty GraphQL document")
+	}
+
+	for dp.tok.kind != docEOF {
+		if err := dp.definition(); err != nil {
+			return nil, err
+		}
+	}
+
+	names := map[string]bool{}
+	for _, op := range dp.operations {
+		if op.Name == "" && len(dp.operations) > 1 {
+			return nil, rfcquery.NewError(op.Pos.Offset, "an anonymous operation must be the only operation of the document")
+		}
+		if names[op.Name] {
+			return nil, rfcquery.NewError(op.Pos.Offset, "duplicate operation name %q", op.Name)
+		}
+		names[op.Name] = true
+	}
+	return dp.operations, nil
+}
+
+// errorf reports an error on the current token
+func (dp *documentParser) errorf(format string, args ...any) error {
+	return dp.src.Errorf(dp.tok.pos, format, args...)
+}
+
+func (dp *documentParser) unexpected() error {
+	return dp.errorf("unexpected %s", dp.tok)
+}
+
+func (dp *documentParser) enter() error {
+	dp.depth++
+	if dp.depth > maxDocumentDepth {
+		return dp.errorf("document nested deeper than %d levels", maxDocumentDepth)
+	}
+	return nil
+}
+
+func (dp *documentParser) leave() {
+	dp.depth--
+}
+
+func (dp *documentParser) isPunct(p string) bool {
+	return dp.tok.kind == docPunct && dp.tok.text == p
+}
+
+func (dp *documentParser) isName(name string) bool {
+	return dp.tok.kind == docName && dp.tok.text == name
+}
+
+func (dp *documentParser) expectPunct(p string) error {
+	if !dp.isPunct(p) {
+		return dp.errorf("expected %q, got %s", p, dp.tok)
+	}
+	return dp.advance()
+}
+
+func (dp *documentParser) expectName() (string, error) {
+	if dp.tok.kind != docName {
+		return "", dp.errorf("expected a name, got %s", dp.tok)
+	}
+	name := dp.tok.text
+	return name, dp.advance()
+}
+
+// advance lexes the next token, skipping the ignored tokens: white space,
+// line terminators, comments, commas and the byte order mark
+func (dp *documentParser) advance() error {
+	text := dp.src.Text
+	for dp.pos < len(text) {
+		switch c := text[dp.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			dp.pos++
+		case c == '#':
+			for dp.pos < len(text) && text[dp.pos] != '\n' && text[dp.pos] != '\r' {
+				dp.pos++
+			}
+		case strings.HasPrefix(text[dp.pos:], "\uFEFF"):
+			dp.pos += len("\uFEFF")
+		default:
+			return dp.lex()
+		}
+	}
+	dp.tok = docToken{kind: docEOF, pos: len(text)}
+	return nil
+}
+
+func (dp *documentParser) lex() error {
+	text := dp.src.Text
+	start := dp.pos
+	dp.tok = docToken{pos: start}
+
+	switch c := text[start]; {
+	case strings.IndexByte("!$&():=@[]{|}", c) >= 0:
+		dp.pos++
+		dp.tok.kind, dp.tok.text = docPunct, text[start:dp.pos]
+		return nil
+
+	case c == '.':
+		if !strings.HasPrefix(text[start:], "...") {
+			return dp.src.Errorf(start, `unexpected ".", expected "..."`)
+		}
+		dp.pos += 3
+		dp.tok.kind, dp.tok.text = docPunct, "..."
+		return nil
+
+	case isNameStart(c):
+		for dp.pos < len(text) && (isNameStart(text[dp.pos]) || isDigit(text[dp.pos])) {
+			dp.pos++
+		}
+		dp.tok.kind, dp.tok.text = docName, text[start:dp.pos]
+		return nil
+
+	case c == '-' || isDigit(c):
+		return dp.lexNumber()
+
+	case c == '"':
+		if strings.HasPrefix(text[start:], `"""`) {
+			return dp.lexBlockString()
+		}
+		return dp.lexString()
+	}
+
+	r, _ := utf8.DecodeRuneInString(text[start:])
+	return dp.src.Errorf(start, "unexpected character %q", r)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// lexNumber reads an IntValue or a FloatValue
+func (dp *documentParser) lexNumber() error {
+	text := dp.src.Text
+	start := dp.pos
+	digits := func() error {
+		from := dp.pos
+		for dp.pos < len(text) && isDigit(text[dp.pos]) {
+			dp.pos++
+		}
+		if dp.pos == from {
+			return dp.src.Errorf(dp.pos, "invalid number, expected a digit")
+		}
+		return nil
+	}
+
+	if text[dp.pos] == '-' {
+		dp.pos++
+	}
+	intStart := dp.pos
+	if err := digits(); err != nil {
+		return err
+	}
+	if dp.pos-intStart > 1 && text[intStart] == '0' {
+		return dp.src.Errorf(intStart+1, "invalid number, unexpected digit after 0")
+	}
+
+	kind := docInt
+	if dp.pos < len(text) && text[dp.pos] == '.' {
+		dp.pos++
+		kind = docFloat
+		if err := digits(); err != nil {
+			return err
+		}
+	}
+	if dp.pos < len(text) && (text[dp.pos] == 'e' || text[dp.pos] == 'E') {
+		dp.pos++
+		kind = docFloat
+		if dp.pos < len(text) && (text[dp.pos] == '+' || text[dp.pos] == '-') {
+			dp.pos++
+		}
+		if err := digits(); err != nil {
+			return err
+		}
+	}
+
+	// a number can't be followed by a name or a dot: 1x, 1.2.3
+	if dp.pos < len(text) && (text[dp.pos] == '.' || isNameStart(text[dp.pos])) {
+		return dp.src.Errorf(dp.pos, "invalid number, unexpected %q", text[dp.pos])
+	}
+	dp.tok.kind, dp.tok.text = kind, text[start:dp.pos]
+	return nil
+}
+
+// lexString reads a quoted string on a single line
+func (dp *documentParser) lexString() error {
+	text := dp.src.Text
+	start := dp.pos
+	dp.pos++
+	for {
+		if dp.pos >= len(text) || text[dp.pos] == '\n' || text[dp.pos] == '\r' {
+			return dp.src.Errorf(start, "unterminated string")
+		}
+
+		switch c := text[dp.pos]; {
+		case c == '"':
+			dp.pos++
+			dp.tok.kind, dp.tok.text = docString, text[start:dp.pos]
+			return nil
+
+		case c == '\\':
+			escape := dp.pos
+			dp.pos++
+			if dp.pos >= len(text) {
+				return dp.src.Errorf(start, "unterminated string")
+			}
+			switch e := text[dp.pos]; {
+			case strings.IndexByte(`"\/bfnrt`, e) >= 0:
+				dp.pos++
+			case e == 'u' && strings.HasPrefix(text[dp.pos:], "u{"):
+				end := strings.IndexByte(text[dp.pos:], '}')
+				if end < 0 {
+					return dp.src.Errorf(escape, "invalid unicode escape")
+				}
+				n, err := strconv.ParseUint(text[dp.pos+2:dp.pos+end], 16, 32)
+				if err != nil || n > utf8.MaxRune || 0xD800 <= n && n <= 0xDFFF {
+					return dp.src.Errorf(escape, "invalid unicode escape")
+				}
+				dp.pos += end + 1
+			case e == 'u':
+				if dp.pos+5 > len(text) {
+					return dp.src.Errorf(escape, "invalid unicode escape")
+				}
+				if _, err := strconv.ParseUint(text[dp.pos+1:dp.pos+5], 16, 16); err != nil {
+					return dp.src.Errorf(escape, "invalid unicode escape")
+				}
+				dp.pos += 5
+			default:
+				return dp.src.Errorf(escape, "invalid escape sequence")
+			}
+
+		default:
+			if err := dp.sourceChar(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// lexBlockString reads a """ string, where \""" escapes the delimiter
+func (dp *documentParser) lexBlockString() error {
+	text := dp.src.Text
+	start := dp.pos
+	dp.pos += 3
+	for {
+		switch rest := text[dp.pos:]; {
+		case rest == "":
+			return dp.src.Errorf(start, "unterminated block string")
+		case strings.HasPrefix(rest, `\"""`):
+			dp.pos += 4
+		case strings.HasPrefix(rest, `"""`):
+			dp.pos += 3
+			dp.tok.kind, dp.tok.text = docString, text[start:dp.pos]
+			return nil
+		case rest[0] == '\n' || rest[0] == '\r':
+			dp.pos++
+		default:
+			if err := dp.sourceChar(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sourceChar moves past a string character, control characters other
+// than tab are not allowed
+func (dp *documentParser) sourceChar() error {
+	r, size := utf8.DecodeRuneInString(dp.src.Text[dp.pos:])
+	if r == utf8.RuneError && size == 1 {
+		return dp.src.Errorf(dp.pos, "invalid UTF-8 in string")
+	}
+	if r < 0x20 && r != '\t' {
+		return dp.src.Errorf(dp.pos, "invalid character %q in string", r)
+	}
+	dp.pos += size
+	return nil
+}
+
+// definition parses an operation or a fragment definition
+func (dp *documentParser) definition() error {
+	if dp.isPunct("{") {
+		dp.operations = append(dp.operations, GraphQLOperation{Type: OperationQuery, Pos: dp.src.Position(dp.tok.pos)})
+		return dp.selectionSet()
+	}
+	if dp.tok.kind != docName {
+		return dp.unexpected()
+	}
+
+	switch keyword := dp.tok.text; keyword {
+	case "query", "mutation", "subscription":
+		op := GraphQLOperation{Type: OperationType(keyword), Pos: dp.src.Position(dp.tok.pos)}
+		if err := dp.advance(); err != nil {
+			return err
+		}
+		if dp.tok.kind == docName {
+			op.Name = dp.tok.text
+			if err := dp.advance(); err != nil {
+				return err
+			}
+		}
+		dp.operations = append(dp.operations, op)
+
+		if dp.isPunct("(") {
+			if err := dp.variableDefinitions(); err != nil {
+				return err
+			}
+		}
+		if err := dp.directives(false); err != nil {
+			return err
+		}
+		return dp.selectionSet()
+
+	case "fragment":
+		if err := dp.advance(); err != nil {
+			return err
+		}
+		if dp.isName("on") {
+			return dp.errorf(`a fragment can't be named "on"`)
+		}
+		if _, err := dp.expectName(); err != nil {
+			return err
+		}
+		if err := dp.typeCondition(); err != nil {
+			return err
+		}
+		if err := dp.directives(false); err != nil {
+			return err
+		}
+		return dp.selectionSet()
+
+	case "schema", "scalar", "type", "interface", "union", "enum", "input", "directive", "extend":
+		return dp.errorf("type system definition %q is not allowed in an executable document", keyword)
+
+	default:
+		return dp.unexpected()
+	}
+}
+
+func (dp *documentParser) typeCondition() error {
+	if !dp.isName("on") {
+		return dp.errorf(`expected "on", got %s`, dp.tok)
+	}
+	if err := dp.advance(); err != nil {
+		return err
+	}
+	_, err := dp.expectName()
+	return err
+}
+
+// variableDefinitions parses ( $name: Type = default @directive ... )
+func (dp *documentParser) variableDefinitions() error {
+	if err := dp.expectPunct("("); err != nil {
+		return err
+	}
+	if dp.isPunct(")") {
+		return dp.errorf("expected a variable definition")
+	}
+
+	for !dp.isPunct(")") {
+		if err := dp.expectPunct("$"); err != nil {
+			return err
+		}
+		if _, err := dp.expectName(); err != nil {
+			return err
+		}
+		if err := dp.expectPunct(":"); err != nil {
+			return err
+		}
+		if err := dp.typeRef(); err != nil {
+			return err
+		}
+		if dp.isPunct("=") {
+			if err := dp.advance(); err != nil {
+				return err
+			}
+			if err := dp.value(true); err != nil {
+				return err
+			}
+		}
+		if err := dp.directives(true); err != nil {
+			return err
+		}
+	}
+	return dp.advance()
+}
+
+// typeRef parses Name, [Type] and their non-null Type! forms
+func (dp *documentParser) typeRef() error {
+	if err := dp.enter(); err != nil {
+		return err
+	}
+	defer dp.leave()
+
+	if dp.isPunct("[") {
+		if err := dp.advance(); err != nil {
+			return err
+		}
+		if err := dp.typeRef(); err != nil {
+			return err
+		}
+		if err := dp.expectPunct("]"); err != nil {
+			return err
+		}
+	} else if _, err := dp.expectName(); err != nil {
+		return err
+	}
+
+	if dp.isPunct("!") {
+		return dp.advance()
+	}
+	return nil
+}
+
+func (dp *documentParser) directives(constant bool) error {
+	for dp.isPunct("@") {
+		if err := dp.advance(); err != nil {
+			return err
+		}
+		if _, err := dp.expectName(); err != nil {
+			return err
+		}
+		if dp.isPunct("(") {
+			if err := dp.arguments(constant); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (dp *documentParser) arguments(constant bool) error {
+	if err := dp.expectPunct("("); err != nil {
+		return err
+	}
+	if dp.isPunct(")") {
+		return dp.errorf("expected an argument")
+	}
+
+	for !dp.isPunct(")") {
+		if _, err := dp.expectName(); err != nil {
+			return err
+		}
+		if err := dp.expectPunct(":"); err != nil {
+			return err
+		}
+		if err := dp.value(constant); err != nil {
+			return err
+		}
+	}
+	return dp.advance()
+}
+
+func (dp *documentParser) selectionSet() error {
+	if err := dp.enter(); err != nil {
+		return err
+	}
+	defer dp.leave()
+
+	if err := dp.expectPunct("{"); err != nil {
+		return err
+	}
+	if dp.isPunct("}") {
+		return dp.errorf("expected a selection")
+	}
+
+	for !dp.isPunct("}") {
+		if err := dp.selection(); err != nil {
+			return err
+		}
+	}
+	return dp.advance()
+}
+
+// selection parses a field, a fragment spread or an inline fragment
+func (dp *documentParser) selection() error {
+	if dp.isPunct("...") {
+		if err := dp.advance(); err != nil {
+			return err
+		}
+		if dp.tok.kind == docName && !dp.isName("on") {
+			// fragment spread
+			if err := dp.advance(); err != nil {
+				return err
+			}
+			return dp.directives(false)
+		}
+		if dp.isName("on") {
+			if err := dp.typeCondition(); err != nil {
+				return err
+			}
+		}
+		if err := dp.directives(false); err != nil {
+			return err
+		}
+		return dp.selectionSet()
+	}
+
+	// field, with an optional alias
+	if _, err := dp.expectName(); err != nil {
+		return err
+	}
+	if dp.isPunct(":") {
+		if err := dp.advance(); err != nil {
+			return err
+		}
+		if _, err := dp.expectName(); err != nil {
+			return err
+		}
+	}
+	if dp.isPunct("(") {
+		if err := dp.arguments(false); err != nil {
+			return err
+		}
+	}
+	if err := dp.directives(false); err != nil {
+		return err
+	}
+	if dp.isPunct("{") {
+		return dp.selectionSet()
+	}
+	return nil
+}
+
+// value parses an input value, variables are not allowed in constant ones
+func (dp *documentParser) value(constant bool) error {
+	if err := dp.enter(); err != nil {
+		return err
+	}
+	defer dp.leave()
+
+	switch {
+	case dp.isPunct("$"):
+		if constant {
+			return dp.errorf("variables are not allowed in constant values")
+		}
+		if err := dp.advance(); err != nil {
+			return err
+		}
+		_, err := dp.expectName()
+		return err
+
+	case dp.tok.kind == docName, dp.tok.kind == docInt, dp.tok.kind == docFloat, dp.tok.kind == docString:
+		return dp.advance()
+
+	case dp.isPunct("["):
+		if err := dp.advance(); err != nil {
+			return err
+		}
+		for !dp.isPunct("]") {
+			if dp.tok.kind == docEOF {
+				return dp.unexpected()
+			}
+			if err := dp.value(constant); err != nil {
+				return err
+			}
+		}
+		return dp.advance()
+
+	case dp.isPunct("{"):
+		if err := dp.advance(); err != nil {
+			return err
+		}
+		for !dp.isPunct("}") {
+			if _, err := dp.expectName(); err != nil {
+				return err
+			}
+			if err := dp.expectPunct(":"); err != nil {
+				return err
+			}
+			if err := dp.value(constant); err != nil {
+				return err
+			}
+		}
+		return dp.advance()
+	}
+	return dp.unexpected()
+}
@@ -1,10 +1,15 @@
 package graphql
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/jsonschema"
+	"github.com/CRSylar/rfcquery/internal/source"
 	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
 )
 
@@ -19,10 +24,21 @@ type GraphQLQuery struct {
 	// Optional variables JSON object
 	Variables map[string]any
 
+	// Optional extensions JSON object, and its persistedQuery member
+	Extensions     map[string]any
+	PersistedQuery *PersistedQuery
+
+	// Operations lists the operations of the document, and Operation is
+	// the one the operationName parameter selects. Both are set by
+	// ValidateDocument
+	Operations []GraphQLOperation
+	Operation  *GraphQLOperation
+
 	// Raw tokens for metadata
-	QueryTokens     rfcquery.TokenSlice
-	VariablesTokens rfcquery.TokenSlice
-	OperationTokens rfcquery.TokenSlice
+	QueryTokens      rfcquery.TokenSlice
+	VariablesTokens  rfcquery.TokenSlice
+	OperationTokens  rfcquery.TokenSlice
+	ExtensionsTokens rfcquery.TokenSlice
 }
 
 // GraphQLParser extracts and validates GraphQL query from URL params
@@ -37,8 +53,42 @@ type GraphQLParser struct {
 	// ParseOperationName enable parsing the <operation_name> parameter
 	ParseOperationName bool
 
+	// ParseExtensions enables parsing the "extensions" parameter as JSON,
+	// with the persistedQuery extension of automatic persisted queries
+	ParseExtensions bool
+
+	// PersistedQueries resolves hash-only requests and registers the
+	// documents sent with their hash once the request is parsed, nil
+	// disables both. The hash is only read with ParseExtensions
+	PersistedQueries PersistedQueryStore
+
+	// AllowHashOnly accepts requests with a persistedQuery but no query
+	// parameter. Without PersistedQueries, Query is then left empty for
+	// the caller to resolve
+	AllowHashOnly bool
+
 	// Strict validate using the RFC
 	StrictValidation bool
+
+	// VariablesSchema is a JSON Schema draft 2020-12 document the
+	// variables object must satisfy when the parameter is present, nil
+	// skips validation. It is compiled by the first Parse, later changes
+	// are not read
+	VariablesSchema json.RawMessage
+
+	// ValidateDocument checks the syntax of the query document, lists its
+	// operations and selects the one to execute, which operationName must
+	// name when the document has several
+	ValidateDocument bool
+
+	// Method is the HTTP method of the request, "GET" when empty, in any
+	// case. ValidateDocument rejects mutations unless it is POST, as
+	// GraphQL-over-HTTP requires
+	Method string
+
+	compileOnce     sync.Once
+	variablesSchema *jsonschema.Schema
+	schemaErr       error
 }
 
 // NewGraphQLParser crates a parser with default setting
@@ -70,37 +120,137 @@ func (p *GraphQLParser) Parse(scanner *rfcquery.Scanner) (any, error) {
 		return nil, fmt.Errorf("failed to parse query paramters: %w", err)
 	}
 
-	values := result.(*rfcquery.Values)
+	// the form parser splits values on ',', which GraphQL documents and
+	// JSON variables use freely
+	params := source.Params(result.(*rfcquery.Values))
 	graphql := &GraphQLQuery{}
 
-	queryVals := values.Get(p.TargetParam)
-	if len(queryVals) == 0 {
-		return nil, fmt.Errorf("GrapQL query parameter %q not found", p.TargetParam)
+	maxDepth := scanner.Options().MaxJSONDepth
+	extPos := 0
+	if p.ParseExtensions {
+		if extPos, err = p.parseExtensions(params, maxDepth, graphql); err != nil {
+			return nil, err
+		}
+	}
+
+	queryVals := source.Lookup(params, p.TargetParam)
+	if len(queryVals) == 0 && graphql.PersistedQuery == nil {
+		return nil, fmt.Errorf("GraphQL query parameter %q not found", p.TargetParam)
 	}
 	if len(queryVals) > 1 {
-		return nil, fmt.Errorf("Multiple values found for GrapQL query paramter %q", p.TargetParam)
+		return nil, fmt.Errorf("Multiple values found for GraphQL query parameter %q", p.TargetParam)
 	}
 
-	graphql.Query = queryVals[0].Value
-	graphql.QueryTokens = queryVals[0].ValueTokens
+	document, hasDocument, err := p.resolveDocument(scanner.Context(), queryVals, extPos, graphql)
+	if err != nil {
+		return nil, err
+	}
 
 	if p.ParseVariables {
-		if err := p.parseVariables(values, graphql); err != nil {
+		if err := p.parseVariables(params, maxDepth, graphql); err != nil {
 			return nil, err
 		}
 	}
 
 	if p.ParseOperationName {
-		if err := p.parseOperationName(values, graphql); err != nil {
+		if err := p.parseOperationName(params, graphql); err != nil {
 			return nil, err
 		}
 	}
 
+	if p.ValidateDocument && hasDocument {
+		if err := p.validateDocument(document, source.Lookup(params, "operationName"), graphql); err != nil {
+			return nil, err
+		}
+	}
+
+	// only a document that passed every check is registered
+	if graphql.PersistedQuery != nil && len(queryVals) == 1 && p.PersistedQueries != nil {
+		if err := p.PersistedQueries.Put(scanner.Context(), graphql.PersistedQuery.SHA256Hash, graphql.Query); err != nil {
+			return nil, fmt.Errorf("failed to register persisted query: %w", err)
+		}
+	}
+
 	return graphql, nil
 }
 
-func (p *GraphQLParser) parseVariables(values *rfcquery.Values, query *GraphQLQuery) error {
-	varVals := values.Get("variables")
+// parseExtensions parses the extensions parameter and returns its position
+func (p *GraphQLParser) parseExtensions(params []source.Param, maxDepth int, query *GraphQLQuery) (int, error) {
+	extVals := source.Lookup(params, "extensions")
+	if len(extVals) == 0 {
+		return 0, nil
+	}
+
+	if len(extVals) > 1 {
+		return 0, rfcquery.NewError(extVals[1].Pos.Offset, "multiple values found for extensions parameter")
+	}
+
+	query.ExtensionsTokens = extVals[0].ValueTokens
+
+	src := extVals[0].Value()
+	if err := src.CheckJSONDepth(maxDepth); err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal([]byte(src.Text), &query.Extensions); err != nil {
+		return 0, src.JSONError(err, "invalid JSON in extensions parameter")
+	}
+
+	pos := extVals[0].Pos.Offset
+	pq, err := persistedQuery(query.Extensions, pos)
+	if err != nil {
+		return 0, err
+	}
+	query.PersistedQuery = pq
+	return pos, nil
+}
+
+// resolveDocument sets the query document: the query parameter, whose
+// hash must match the persistedQuery when both are sent, or the document
+// the store holds for a hash-only request. hasDocument is false for a
+// hash-only request without a store
+func (p *GraphQLParser) resolveDocument(ctx context.Context, queryVals []source.Param, extPos int, query *GraphQLQuery) (document source.Source, hasDocument bool, err error) {
+	pq := query.PersistedQuery
+
+	if len(queryVals) == 1 {
+		document = queryVals[0].Value()
+		query.Query = document.Text
+		query.QueryTokens = queryVals[0].ValueTokens
+
+		if pq != nil {
+			if HashQuery(query.Query) != pq.SHA256Hash {
+				e := rfcquery.NewError(extPos, "%v", ErrPersistedQueryHashMismatch)
+				e.Err = ErrPersistedQueryHashMismatch
+				return document, false, e
+			}
+		}
+		return document, true, nil
+	}
+
+	if !p.AllowHashOnly {
+		return document, false, rfcquery.NewError(extPos, "GraphQL query parameter %q not found, hash-only persisted queries are not allowed", p.TargetParam)
+	}
+	if p.PersistedQueries == nil {
+		return document, false, nil
+	}
+
+	stored, ok, err := p.PersistedQueries.Get(ctx, pq.SHA256Hash)
+	if err != nil {
+		return document, false, fmt.Errorf("failed to resolve persisted query: %w", err)
+	}
+	if !ok {
+		e := rfcquery.NewError(extPos, "%v", ErrPersistedQueryNotFound)
+		e.Err = ErrPersistedQueryNotFound
+		return document, false, e
+	}
+
+	// the stored document has no query tokens, its positions are the
+	// position of the extensions parameter
+	query.Query = stored
+	return source.New(nil, extPos).Mapped(stored, nil), true, nil
+}
+
+func (p *GraphQLParser) parseVariables(params []source.Param, maxDepth int, query *GraphQLQuery) error {
+	varVals := source.Lookup(params, "variables")
 	if len(varVals) == 0 {
 		return nil
 	}
@@ -111,15 +261,38 @@ func (p *GraphQLParser) parseVariables(values *rfcquery.Values, query *GraphQLQu
 
 	query.VariablesTokens = varVals[0].ValueTokens
 
-	if err := json.Unmarshal([]byte(varVals[0].Value), &query.Variables); err != nil {
-		return fmt.Errorf("invalid JSON in variables parameter: %w", err)
+	src := varVals[0].Value()
+	if err := src.CheckJSONDepth(maxDepth); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(src.Text), &query.Variables); err != nil {
+		return src.JSONError(err, "invalid JSON in variables parameter")
+	}
+
+	p.compileOnce.Do(func() {
+		if p.VariablesSchema != nil {
+			p.variablesSchema, p.schemaErr = jsonschema.Compile(p.VariablesSchema)
+		}
+	})
+	if p.schemaErr != nil {
+		return p.schemaErr
+	}
+	if schema := p.variablesSchema; schema != nil {
+		var variables any = query.Variables
+		if query.Variables == nil {
+			// "variables=null" is no variables
+			variables = map[string]any{}
+		}
+		if err := schema.Check(variables, varVals[0].Pos.Offset, "variables"); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (p *GraphQLParser) parseOperationName(values *rfcquery.Values, query *GraphQLQuery) error {
-	opVals := values.Get("operationName")
+func (p *GraphQLParser) parseOperationName(params []source.Param, query *GraphQLQuery) error {
+	opVals := source.Lookup(params, "operationName")
 	if len(opVals) == 0 {
 		return nil
 	}
@@ -128,12 +301,57 @@ func (p *GraphQLParser) parseOperationName(values *rfcquery.Values, query *Graph
 		return fmt.Errorf("multiple values found for operationName parameter")
 	}
 
-	query.OperationName = opVals[0].Value
+	query.OperationName = opVals[0].Value().Text
 	query.OperationTokens = opVals[0].ValueTokens
 
 	return nil
 }
 
+// validateDocument parses the query document and selects the operation
+// named by the operationName parameter
+func (p *GraphQLParser) validateDocument(document source.Source, opVals []source.Param, query *GraphQLQuery) error {
+	ops, err := parseDocument(document)
+	if err != nil {
+		return err
+	}
+	query.Operations = ops
+
+	name := ""
+	if len(opVals) > 1 {
+		return fmt.Errorf("multiple values found for operationName parameter")
+	}
+	if len(opVals) == 1 {
+		name = opVals[0].Value().Text
+	}
+
+	switch {
+	case len(ops) == 0:
+		return document.Errorf(0, "document defines no operation")
+	case name != "":
+		for i := range ops {
+			if ops[i].Name == name {
+				query.Operation = &ops[i]
+			}
+		}
+		if query.Operation == nil {
+			return opVals[0].Value().Errorf(0, "operationName %q matches no operation of the document", name)
+		}
+	case len(ops) == 1:
+		query.Operation = &ops[0]
+	default:
+		return document.Errorf(0, "operationName is required, the document defines %d operations", len(ops))
+	}
+
+	if query.Operation.Type == OperationMutation && !strings.EqualFold(p.Method, "POST") {
+		method := strings.ToUpper(p.Method)
+		if method == "" {
+			method = "GET"
+		}
+		return rfcquery.NewError(query.Operation.Pos.Offset, "mutation operations are not allowed over %s", method)
+	}
+	return nil
+}
+
 func ParseGraphQLQuery(query string) (*GraphQLQuery, error) {
 	scanner := rfcquery.NewScanner(query)
 	if err := scanner.Valid(); err != nil {
@@ -1,9 +1,13 @@
 package graphql_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/CRSylar/rfcquery"
@@ -65,6 +69,14 @@ func TestGraphQLParser_Parse(t *testing.T) {
 				Query: `{search(filter:{field:"value"}){results}}`,
 			},
 		},
+		{
+			name:  "commas in query and variables",
+			input: fmt.Sprintf(`query=%s&variables=%s`, url.QueryEscape("{user(id:$id,first:2){name,email}}"), url.QueryEscape(`{"id":"123","x":[1,2]}`)),
+			want: &graphql.GraphQLQuery{
+				Query:     `{user(id:$id,first:2){name,email}}`,
+				Variables: map[string]any{"id": "123", "x": []any{1.0, 2.0}},
+			},
+		},
 		{
 			name:    "missing query parameter",
 			input:   fmt.Sprintf(`variables=%s`, url.QueryEscape(`{"id":"123"}`)),
@@ -166,6 +178,316 @@ func TestGraphQLParser_DisableFeatures(t *testing.T) {
 	}
 }
 
+func TestGraphQLParser_VariablesSchema(t *testing.T) {
+	parser := graphql.NewGraphQLParser()
+	parser.VariablesSchema = json.RawMessage(`{
+		"type": "object",
+		"required": ["id"],
+		"properties": {"id": {"type": "string", "pattern": "^[0-9]+$"}},
+		"additionalProperties": false
+	}`)
+
+	valid := fmt.Sprintf(`query=%s&variables=%s`, url.QueryEscape("{user(id:$id){name}}"), url.QueryEscape(`{"id":"123"}`))
+	if _, err := parser.Parse(rfcquery.NewScanner(valid)); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// variables starts at 43
+	invalid := fmt.Sprintf(`query=%s&variables=%s`, url.QueryEscape("{user(id:$id){name}}"), url.QueryEscape(`{"id":"abc","x":1}`))
+	_, err := parser.Parse(rfcquery.NewScanner(invalid))
+	var rfcErr *rfcquery.Error
+	if !errors.As(err, &rfcErr) || rfcErr.Pos.Offset != 43 {
+		t.Fatalf("expected *rfcquery.Error at position 43, got %v", err)
+	}
+	for _, msg := range []string{
+		`variables does not match the schema at "/id": value "abc" does not match pattern "^[0-9]+$"`,
+		`variables does not match the schema at "/x": additional property is not allowed`,
+	} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("error %q does not contain %q", err, msg)
+		}
+	}
+
+	missing := fmt.Sprintf(`query=%s&variables=null`, url.QueryEscape("{user(id:$id){name}}"))
+	if _, err := parser.Parse(rfcquery.NewScanner(missing)); err == nil || !strings.Contains(err.Error(), `missing required property "id"`) {
+		t.Errorf("null variables: got %v", err)
+	}
+}
+
+func TestGraphQLParser_VariablesErrorPosition(t *testing.T) {
+	_, err := graphql.ParseGraphQLQuery(`query=%7Bfoo%7D&variables=%7B%22id%22:%7D`)
+
+	var rfcErr *rfcquery.Error
+	if !errors.As(err, &rfcErr) {
+		t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+	}
+	want := "invalid JSON in variables parameter (decoded offset 6): invalid character '}' looking for beginning of value"
+	if rfcErr.Pos.Offset != 38 || rfcErr.Msg != want {
+		t.Errorf("got %v, want %q at position 38", err, want)
+	}
+}
+
+func TestGraphQLParser_MaxJSONDepth(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantPos int
+	}{
+		{"variables", `query=%7Bfoo%7D&variables=%7B%22a%22:%5B%5B1%5D%5D%7D`, 40},
+		{"extensions", `query=%7Bfoo%7D&extensions=%7B%22a%22:%7B%22b%22:%7B%7D%7D%7D`, 49},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := rfcquery.NewScannerContext(context.Background(), tt.query, rfcquery.ParseOptions{MaxJSONDepth: 2})
+			parser := graphql.NewGraphQLParser()
+			parser.ParseExtensions = true
+			_, err := parser.Parse(scanner)
+
+			var limitErr *rfcquery.LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != rfcquery.LimitJSONDepth || limitErr.Pos.Offset != tt.wantPos {
+				t.Errorf("expected a json-depth limit error at position %d, got %v", tt.wantPos, err)
+			}
+		})
+	}
+}
+
+func TestGraphQLParser_ValidateDocument(t *testing.T) {
+	const document = `
+		# a comment
+		query GetUser($id: ID!, $first: Int = 10, $tags: [String!]! = ["a"]) @cached(ttl: 60) {
+			user(id: $id) {
+				name: fullName
+				...UserFields
+				... on Admin @include(if: true) { level }
+				friends(first: $first, filter: {min: -1.5e3, names: ["x", """block "quoted" \""" text"""], kind: ENUM, none: null}) { id }
+			}
+		}
+		mutation UpdateUser { update(input: {name: "\u{1F600} \u00e9"}) { id } }
+		subscription OnEvent { event }
+		fragment UserFields on User { id }`
+
+	tests := []struct {
+		name    string
+		query   string
+		opName  string
+		method  string
+		wantOp  graphql.GraphQLOperation
+		wantErr string
+		wantPos int
+	}{
+		{name: "named query", query: document, opName: "GetUser", wantOp: graphql.GraphQLOperation{Type: graphql.OperationQuery, Name: "GetUser", Pos: rfcquery.Position{Offset: 41}}},
+		{name: "subscription", query: document, opName: "OnEvent", wantOp: graphql.GraphQLOperation{Type: graphql.OperationSubscription, Name: "OnEvent", Pos: rfcquery.Position{Offset: 798}}},
+		{name: "mutation over POST", query: document, opName: "UpdateUser", method: "POST", wantOp: graphql.GraphQLOperation{Type: graphql.OperationMutation, Name: "UpdateUser", Pos: rfcquery.Position{Offset: 665}}},
+		{name: "lone anonymous query", query: "{ me { id } }", wantOp: graphql.GraphQLOperation{Type: graphql.OperationQuery, Pos: rfcquery.Position{Offset: 6}}},
+		{name: "mutation over lowercase post", query: document, opName: "UpdateUser", method: "post", wantOp: graphql.GraphQLOperation{Type: graphql.OperationMutation, Name: "UpdateUser", Pos: rfcquery.Position{Offset: 665}}},
+		{name: "mutation over GET", query: document, opName: "UpdateUser", wantErr: "mutation operations are not allowed over GET", wantPos: 665},
+		{name: "mutation over lowercase get", query: document, opName: "UpdateUser", method: "get", wantErr: "mutation operations are not allowed over GET", wantPos: 665},
+		{name: "mutation over PUT", query: document, opName: "UpdateUser", method: "PUT", wantErr: "mutation operations are not allowed over PUT", wantPos: 665},
+		{name: "unknown operation", query: document, opName: "Nope", wantErr: `operationName "Nope" matches no operation of the document`, wantPos: -1},
+		{name: "missing operationName", query: document, wantErr: "operationName is required, the document defines 3 operations", wantPos: 6},
+		{name: "anonymous next to named", query: "{ a } query B { b }", wantErr: "an anonymous operation must be the only operation", wantPos: 6},
+		{name: "duplicate name", query: "query A { a } query A { b }", wantErr: `duplicate operation name "A"`, wantPos: 34},
+		{name: "unclosed selection", query: "{ user { name }", wantErr: "expected a name, got end of document", wantPos: 35},
+		{name: "empty selection", query: "{ user { } }", wantErr: "expected a selection", wantPos: 25},
+		{name: "bad token", query: "{ user(id: 1) { name } } }", wantErr: `unexpected "}"`, wantPos: 59},
+		{name: "invalid number", query: "{ a(x: 01) }", wantErr: "unexpected digit after 0", wantPos: 24},
+		{name: "unterminated string", query: `{ a(x: "abc) }`, wantErr: "unterminated string", wantPos: 23},
+		{name: "variable in a default", query: "query Q($a: Int = $b) { a }", wantErr: "variables are not allowed in constant values", wantPos: 40},
+		{name: "type system", query: "type User { id: ID }", wantErr: `type system definition "type" is not allowed`, wantPos: 6},
+		{name: "empty document", query: " # nothing", wantErr: "empty GraphQL document", wantPos: 22},
+		{name: "fragments only", query: "fragment F on T { a }", wantErr: "document defines no operation", wantPos: 6},
+		{name: "fragments only with operationName", query: "fragment F on T { a }", opName: "F", wantErr: "document defines no operation", wantPos: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "query=" + strings.ReplaceAll(url.QueryEscape(tt.query), "+", "%20")
+			if tt.opName != "" {
+				input += "&operationName=" + tt.opName
+			}
+
+			parser := graphql.NewGraphQLParser()
+			parser.ValidateDocument = true
+			parser.Method = tt.method
+			result, err := parser.Parse(rfcquery.NewScanner(input))
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+				q := result.(*graphql.GraphQLQuery)
+				if q.Operation == nil || *q.Operation != tt.wantOp {
+					t.Errorf("Operation = %+v, want %+v", q.Operation, tt.wantOp)
+				}
+				return
+			}
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			wantPos := tt.wantPos
+			if wantPos < 0 {
+				wantPos = strings.Index(input, "operationName=") + len("operationName=")
+			}
+			if rfcErr.Pos.Offset != wantPos || !strings.Contains(rfcErr.Msg, tt.wantErr) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantErr, wantPos)
+			}
+		})
+	}
+
+	// the operation is selected even when operationName is not copied
+	// into the result
+	parser := graphql.NewGraphQLParser()
+	parser.ValidateDocument = true
+	parser.ParseOperationName = false
+	input := "query=" + strings.ReplaceAll(url.QueryEscape(document), "+", "%20")
+	if _, err := parser.Parse(rfcquery.NewScanner(input + "&operationName=UpdateUser")); err == nil || !strings.Contains(err.Error(), "mutation operations are not allowed over GET") {
+		t.Errorf("Parse() without ParseOperationName error = %v, want the mutation rejected", err)
+	}
+	result, err := parser.Parse(rfcquery.NewScanner(input + "&operationName=OnEvent"))
+	if err != nil {
+		t.Fatalf("Parse() without ParseOperationName error = %v", err)
+	}
+	if q := result.(*graphql.GraphQLQuery); q.Operation == nil || q.Operation.Name != "OnEvent" || q.OperationName != "" {
+		t.Errorf("Parse() without ParseOperationName = %+v, want OnEvent selected and OperationName empty", q)
+	}
+
+	q, err := graphql.ParseGraphQLQuery("query=" + url.QueryEscape(document))
+	if err != nil || q.Operations != nil {
+		t.Errorf("ParseGraphQLQuery() validates the document by default: %v, %v", q, err)
+	}
+}
+
+func TestGraphQLParser_PersistedQueries(t *testing.T) {
+	const document = "{ hello }"
+	const hash = "001c3174e099bd72b729d0c0a529ba9f5a740c446e2a6e1d71b283cb84ec3065"
+	if got := graphql.HashQuery(document); got != hash {
+		t.Fatalf("HashQuery() = %s, want %s", got, hash)
+	}
+
+	extensions := func(hash string) string {
+		return url.QueryEscape(fmt.Sprintf(`{"persistedQuery":{"version":1,"sha256Hash":%q}}`, hash))
+	}
+	hashOnly := "operationName=&extensions=" + extensions(hash)
+	withQuery := "query=" + strings.ReplaceAll(url.QueryEscape(document), "+", "%20") + "&extensions=" + extensions(strings.ToUpper(hash))
+
+	parser := graphql.NewGraphQLParser()
+	parser.ParseExtensions = true
+	parser.PersistedQueries = graphql.NewMemoryStore()
+	parser.AllowHashOnly = true
+	parser.ValidateDocument = true
+
+	// unknown hash: the client retries with the document, which registers it
+	_, err := parser.Parse(rfcquery.NewScanner(hashOnly))
+	var rfcErr *rfcquery.Error
+	if !errors.Is(err, graphql.ErrPersistedQueryNotFound) || !errors.As(err, &rfcErr) || rfcErr.Pos.Offset != 15 {
+		t.Fatalf("expected PersistedQueryNotFound at position 15, got %v", err)
+	}
+
+	result, err := parser.Parse(rfcquery.NewScanner(withQuery))
+	if err != nil {
+		t.Fatalf("Parse() with the document error = %v", err)
+	}
+	q := result.(*graphql.GraphQLQuery)
+	if q.PersistedQuery == nil || *q.PersistedQuery != (graphql.PersistedQuery{Version: 1, SHA256Hash: hash}) {
+		t.Errorf("PersistedQuery = %+v", q.PersistedQuery)
+	}
+
+	result, err = parser.Parse(rfcquery.NewScanner(hashOnly))
+	if err != nil {
+		t.Fatalf("Parse() of a registered hash error = %v", err)
+	}
+	q = result.(*graphql.GraphQLQuery)
+	if q.Query != document || q.Operation == nil || q.Operation.Pos.Offset != 15 {
+		t.Errorf("registered hash resolved to %q, operation %+v", q.Query, q.Operation)
+	}
+
+	noHashOnly := graphql.NewGraphQLParser()
+	noHashOnly.ParseExtensions = true
+
+	tests := []struct {
+		name    string
+		parser  *graphql.GraphQLParser
+		input   string
+		wantErr error
+		wantMsg string
+		wantPos int
+	}{
+		{"hash mismatch", parser, "query=%7Bbye%7D&extensions=" + extensions(hash), graphql.ErrPersistedQueryHashMismatch, "provided sha does not match query", 16},
+		{"hash-only not allowed", noHashOnly, "extensions=" + extensions(hash), nil, "hash-only persisted queries are not allowed", 0},
+		{"unsupported version", parser, "x=1&extensions=" + url.QueryEscape(`{"persistedQuery":{"version":2}}`), nil, "unsupported persistedQuery version 2", 4},
+		{"malformed hash", parser, "extensions=" + extensions("abc"), nil, "sha256Hash must be 64 hexadecimal digits", 0},
+		{"invalid JSON", parser, "query=%7Ba%7D&extensions=%7B%7D%7D", nil, "invalid JSON in extensions parameter (decoded offset 2)", 31},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parser.Parse(rfcquery.NewScanner(tt.input))
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v to be wrapped", tt.wantErr)
+			}
+		})
+	}
+
+	// an invalid document is not registered under its hash
+	const invalid = "{ a } query B { b }"
+	invalidHash := graphql.HashQuery(invalid)
+	if _, err := parser.Parse(rfcquery.NewScanner("query=" + url.QueryEscape(invalid) + "&extensions=" + extensions(invalidHash))); err == nil {
+		t.Fatal("Parse() of an invalid document succeeded")
+	}
+	if _, err := parser.Parse(rfcquery.NewScanner("extensions=" + extensions(invalidHash))); !errors.Is(err, graphql.ErrPersistedQueryNotFound) {
+		t.Errorf("invalid document was registered: got %v", err)
+	}
+
+	// without a store, hash-only requests are left for the caller to resolve
+	unresolved := graphql.NewGraphQLParser()
+	unresolved.ParseExtensions = true
+	unresolved.AllowHashOnly = true
+	result, err = unresolved.Parse(rfcquery.NewScanner("extensions=" + extensions(hash)))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if q := result.(*graphql.GraphQLQuery); q.Query != "" || q.PersistedQuery.SHA256Hash != hash || q.Extensions["persistedQuery"] == nil {
+		t.Errorf("hash-only request without a store = %+v", q)
+	}
+
+	// extensions are ignored unless ParseExtensions is set
+	result, err = graphql.NewGraphQLParser().Parse(rfcquery.NewScanner(withQuery))
+	if err != nil {
+		t.Fatalf("Parse() with default settings error = %v", err)
+	}
+	if q := result.(*graphql.GraphQLQuery); q.Extensions != nil || q.PersistedQuery != nil {
+		t.Errorf("default parser read extensions: %+v", q)
+	}
+}
+
+func TestMemoryStore_Limit(t *testing.T) {
+	ctx := context.Background()
+	store := graphql.NewMemoryStoreWithLimit(2)
+	for _, query := range []string{"{ a }", "{ b }", "{ a }", "{ c }"} {
+		if err := store.Put(ctx, graphql.HashQuery(query), query); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	// registering "{ a }" again keeps its place, "{ c }" evicts it
+	for query, want := range map[string]bool{"{ a }": false, "{ b }": true, "{ c }": true} {
+		if got, ok, err := store.Get(ctx, graphql.HashQuery(query)); ok != want || err != nil || ok && got != query {
+			t.Errorf("Get(%q) = %q, %v, %v, want found %v", query, got, ok, err, want)
+		}
+	}
+}
+
 func TestGraphQLParser_RFC3986Advantage(t *testing.T) {
 	// GraphQL queries often contain special characters that break stdlib
 	tests := []string{
@@ -189,3 +511,61 @@ func TestGraphQLParser_RFC3986Advantage(t *testing.T) {
 		})
 	}
 }
+
+func FuzzGraphQLParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		`query=%7Buser%7Bname%7D%7D`,
+		`query=%7Buser%7D&variables=%7B%22id%22:%22123%22%7D&operationName=GetUser`,
+		`query=&variables=`,
+		`variables=null`,
+		`=`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		result, err := graphql.NewGraphQLParser().Parse(rfcquery.NewScanner(input))
+		if err != nil {
+			return
+		}
+
+		q := result.(*graphql.GraphQLQuery)
+		if got := q.QueryTokens.StringDecoded(); got != q.Query {
+			t.Fatalf("QueryTokens decode to %q, Query is %q", got, q.Query)
+		}
+	})
+}
+
+func FuzzGraphQLParser_ValidateDocument(f *testing.F) {
+	for _, seed := range []string{
+		"query Q($a: [Int!] = [1]) { a(x: $a) @skip(if: false) { ...F ... on T { b } } } fragment F on T { c }",
+		`mutation M { m(s: "é", b: """x""") }`,
+		"{ a } query B { b }",
+		"{ a(x: {y: [1.5e3, -2, null, ENUM]}) }",
+	} {
+		f.Add(seed, "")
+		f.Add(seed, "Q")
+	}
+
+	f.Fuzz(func(t *testing.T, document, operationName string) {
+		input := "query=" + url.QueryEscape(document) + "&operationName=" + url.QueryEscape(operationName)
+		parser := graphql.NewGraphQLParser()
+		parser.ValidateDocument = true
+		parser.Method = "POST"
+		result, err := parser.Parse(rfcquery.NewScanner(input))
+		if err != nil {
+			return
+		}
+
+		q := result.(*graphql.GraphQLQuery)
+		start, end := q.QueryTokens[0].Start.Offset, q.QueryTokens[len(q.QueryTokens)-1].End.Offset
+		for _, op := range q.Operations {
+			if op.Pos.Offset < start || op.Pos.Offset >= end {
+				t.Fatalf("operation %+v is outside the query parameter [%d, %d)", op, start, end)
+			}
+		}
+		if q.Operation == nil {
+			t.Fatal("no operation selected")
+		}
+	})
+}
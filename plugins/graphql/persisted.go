@@ -0,0 +1,125 @@
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/CRSylar/rfcquery"
+)
+
+// ErrPersistedQueryNotFound is wrapped by the error of a hash-only request
+// whose hash the store doesn't know. Apollo clients retry with the
+// document when the error message is "PersistedQueryNotFound"
+var ErrPersistedQueryNotFound = errors.New("PersistedQueryNotFound")
+
+// ErrPersistedQueryHashMismatch is wrapped by the error of a request
+// whose document doesn't hash to the sha256Hash of its persistedQuery
+var ErrPersistedQueryHashMismatch = errors.New("provided sha does not match query")
+
+// PersistedQuery is the persistedQuery extension of Apollo automatic
+// persisted queries:
+//
+//	extensions={"persistedQuery":{"version":1,"sha256Hash":"ecf4edb4..."}}
+type PersistedQuery struct {
+	Version int
+
+	// SHA256Hash is the lowercase hex SHA-256 of the query document
+	SHA256Hash string
+}
+
+// PersistedQueryStore resolves the hashes of persisted queries
+type PersistedQueryStore interface {
+	// Get returns the document registered under hash, ok is false when
+	// the hash is unknown
+	Get(ctx context.Context, hash string) (query string, ok bool, err error)
+
+	// Put registers the document under its hash
+	Put(ctx context.Context, hash, query string) error
+}
+
+// DefaultMemoryStoreLimit is the number of documents NewMemoryStore keeps
+const DefaultMemoryStoreLimit = 1000
+
+// MemoryStore is an in-memory PersistedQueryStore, safe for concurrent use.
+// Any client can register documents, so past its limit the oldest ones are
+// evicted and clients resend them
+type MemoryStore struct {
+	mu      sync.RWMutex
+	queries map[string]string
+	limit   int
+
+	// order lists the hashes from the oldest registered
+	order []string
+}
+
+// NewMemoryStore creates an empty MemoryStore holding at most
+// DefaultMemoryStoreLimit documents
+func NewMemoryStore() *MemoryStore {
+	return NewMemoryStoreWithLimit(DefaultMemoryStoreLimit)
+}
+
+// NewMemoryStoreWithLimit creates an empty MemoryStore holding at most
+// limit documents. 0 means no limit, for stores that untrusted clients
+// cannot reach
+func NewMemoryStoreWithLimit(limit int) *MemoryStore {
+	return &MemoryStore{queries: map[string]string{}, limit: limit}
+}
+
+// Get returns the document registered under hash
+func (s *MemoryStore) Get(_ context.Context, hash string) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	query, ok := s.queries[strings.ToLower(hash)]
+	return query, ok, nil
+}
+
+// Put registers the document under hash, evicting the oldest document
+// when the store is full
+func (s *MemoryStore) Put(_ context.Context, hash, query string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash = strings.ToLower(hash)
+	if _, ok := s.queries[hash]; !ok {
+		if s.limit > 0 && len(s.order) >= s.limit {
+			delete(s.queries, s.order[0])
+			s.order = s.order[1:]
+		}
+		s.order = append(s.order, hash)
+	}
+	s.queries[hash] = query
+	return nil
+}
+
+// HashQuery returns the sha256Hash of a query document
+func HashQuery(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// persistedQuery reads the persistedQuery member of the extensions object,
+// errors are reported at pos, the position of the extensions parameter
+func persistedQuery(extensions map[string]any, pos int) (*PersistedQuery, error) {
+	raw, ok := extensions["persistedQuery"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	object, ok := raw.(map[string]any)
+	if !ok {
+		return nil, rfcquery.NewError(pos, "extensions: persistedQuery must be an object")
+	}
+	if version, ok := object["version"].(float64); !ok || version != 1 {
+		return nil, rfcquery.NewError(pos, "extensions: unsupported persistedQuery version %v, expected 1", object["version"])
+	}
+
+	hash, ok := object["sha256Hash"].(string)
+	if _, err := hex.DecodeString(hash); !ok || len(hash) != 2*sha256.Size || err != nil {
+		return nil, rfcquery.NewError(pos, "extensions: persistedQuery sha256Hash must be 64 hexadecimal digits")
+	}
+	return &PersistedQuery{Version: 1, SHA256Hash: strings.ToLower(hash)}, nil
+}
@@ -0,0 +1,441 @@
+package jsoninquery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// CBOR major types, RFC 8949 section 3.1
+const (
+	cborUint = iota
+	cborNegint
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// cborError is a CBOR decoding error at byte Offset of the data
+type cborError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *cborError) Error() string {
+	return e.Msg
+}
+
+// cborDecoder converts a CBOR data item into the values of encoding/json,
+// following the CBOR to JSON advice of RFC 8949 section 6.1: byte strings
+// become base64url strings, bignums and integers json.Number, tags are
+// dropped. Map keys must be text strings or integers
+type cborDecoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+// cborToJSON converts a CBOR data item into JSON text
+func cborToJSON(data []byte) (string, error) {
+	d := &cborDecoder{data: data}
+	value, err := d.item()
+	if err != nil {
+		return "", err
+	}
+	if d.pos < len(d.data) {
+		return "", d.errorf("unexpected data after the CBOR item")
+	}
+
+	text, err := json.Marshal(value)
+	if err != nil {
+		return "", d.errorf("%v", err)
+	}
+	return string(text), nil
+}
+
+func (d *cborDecoder) errorf(format string, args ...any) error {
+	return &cborError{Offset: d.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// head reads the initial byte and argument of a data item. indefinite is
+// set for the indefinite-length marker, additional information 31
+func (d *cborDecoder) head() (major byte, arg uint64, indefinite bool, err error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, false, d.errorf("unexpected end of CBOR data")
+	}
+	initial := d.data[d.pos]
+	major, info := initial>>5, initial&0x1f
+	d.pos++
+
+	switch {
+	case info < 24:
+		return major, uint64(info), false, nil
+	case info <= 27:
+		size := 1 << (info - 24)
+		if d.pos+size > len(d.data) {
+			return 0, 0, false, d.errorf("unexpected end of CBOR data")
+		}
+		var buf [8]byte
+		copy(buf[8-size:], d.data[d.pos:d.pos+size])
+		d.pos += size
+		return major, binary.BigEndian.Uint64(buf[:]), false, nil
+	case info == 31 && major >= cborBytes && major <= cborMap || info == 31 && major == cborSimple:
+		return major, 0, true, nil
+	default:
+		d.pos--
+		return 0, 0, false, d.errorf("invalid CBOR initial byte 0x%02x", initial)
+	}
+}
+
+// length checks that n items of at least size bytes fit in the data left
+func (d *cborDecoder) length(n uint64, size int) (int, error) {
+	if n > uint64(len(d.data)-d.pos)/uint64(size) {
+		return 0, d.errorf("CBOR length %d exceeds the data", n)
+	}
+	return int(n), nil
+}
+
+func (d *cborDecoder) item() (any, error) {
+	start := d.pos
+	major, arg, indefinite, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		return json.Number(strconv.FormatUint(arg, 10)), nil
+
+	case cborNegint:
+		n := new(big.Int).SetUint64(arg)
+		return json.Number(n.Neg(n.Add(n, big.NewInt(1))).String()), nil
+
+	case cborBytes, cborText:
+		s, err := d.str(major, arg, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if major == cborBytes {
+			return base64.RawURLEncoding.EncodeToString(s), nil
+		}
+		return string(s), nil
+
+	case cborArray, cborMap:
+		if d.depth++; d.depth > maxNesting {
+			d.pos = start
+			return nil, d.errorf("exceeded max depth")
+		}
+		defer func() { d.depth-- }()
+		if major == cborArray {
+			return d.array(arg, indefinite)
+		}
+		return d.object(arg, indefinite)
+
+	case cborTag:
+		// bignums, tags 2 and 3, hold the magnitude in a byte string
+		if arg == 2 || arg == 3 {
+			major, size, indefinite, err := d.head()
+			if err != nil {
+				return nil, err
+			}
+			if major != cborBytes {
+				d.pos = start
+				return nil, d.errorf("invalid CBOR bignum")
+			}
+			magnitude, err := d.str(major, size, indefinite)
+			if err != nil {
+				return nil, err
+			}
+			n := new(big.Int).SetBytes(magnitude)
+			if arg == 3 {
+				n.Neg(n.Add(n, big.NewInt(1)))
+			}
+			return json.Number(n.String()), nil
+		}
+		return d.item()
+
+	default:
+		return d.simple(start, arg, indefinite)
+	}
+}
+
+// str reads the bytes of a definite or indefinite-length string
+func (d *cborDecoder) str(major byte, arg uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		n, err := d.length(arg, 1)
+		if err != nil {
+			return nil, err
+		}
+		s := d.data[d.pos : d.pos+n]
+		d.pos += n
+		if major == cborText && !utf8.Valid(s) {
+			d.pos -= n
+			return nil, d.errorf("invalid UTF-8 in CBOR text string")
+		}
+		return s, nil
+	}
+
+	var buf bytes.Buffer
+	for {
+		if d.pos < len(d.data) && d.data[d.pos] == 0xff {
+			d.pos++
+			return buf.Bytes(), nil
+		}
+		chunk, arg, chunkIndefinite, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if chunk != major || chunkIndefinite {
+			return nil, d.errorf("invalid chunk in indefinite-length CBOR string")
+		}
+		s, err := d.str(major, arg, false)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(s)
+	}
+}
+
+func (d *cborDecoder) array(arg uint64, indefinite bool) ([]any, error) {
+	n, err := d.length(arg, 1)
+	if indefinite {
+		n, err = 0, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	array := make([]any, 0, n)
+	for i := 0; indefinite || i < n; i++ {
+		if indefinite && d.pos < len(d.data) && d.data[d.pos] == 0xff {
+			d.pos++
+			break
+		}
+		value, err := d.item()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+	}
+	return array, nil
+}
+
+func (d *cborDecoder) object(arg uint64, indefinite bool) (map[string]any, error) {
+	n, err := d.length(arg, 2)
+	if indefinite {
+		n, err = 0, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	object := make(map[string]any, n)
+	for i := 0; indefinite || i < n; i++ {
+		if indefinite && d.pos < len(d.data) && d.data[d.pos] == 0xff {
+			d.pos++
+			break
+		}
+
+		keyStart := d.pos
+		key, err := d.item()
+		if err != nil {
+			return nil, err
+		}
+		var name string
+		switch key := key.(type) {
+		case json.Number:
+			name = key.String()
+		case string:
+			if d.data[keyStart]>>5 != cborText {
+				d.pos = keyStart
+				return nil, d.errorf("unsupported CBOR map key, keys must be text strings or integers")
+			}
+			name = key
+		default:
+			d.pos = keyStart
+			return nil, d.errorf("unsupported CBOR map key, keys must be text strings or integers")
+		}
+		if _, dup := object[name]; dup {
+			d.pos = keyStart
+			return nil, d.errorf("duplicate CBOR map key %q", name)
+		}
+
+		if object[name], err = d.item(); err != nil {
+			return nil, err
+		}
+	}
+	return object, nil
+}
+
+// simple reads the simple values and floats of major type 7
+func (d *cborDecoder) simple(start int, arg uint64, indefinite bool) (any, error) {
+	if indefinite {
+		d.pos = start
+		return nil, d.errorf("unexpected CBOR break")
+	}
+
+	var f float64
+	switch size := d.pos - start - 1; {
+	case size == 0 && arg == 20:
+		return false, nil
+	case size == 0 && arg == 21:
+		return true, nil
+	case size == 0 && (arg == 22 || arg == 23):
+		return nil, nil
+	case size == 2:
+		f = float16(uint16(arg))
+	case size == 4:
+		f = float64(math.Float32frombits(uint32(arg)))
+	case size == 8:
+		f = math.Float64frombits(arg)
+	default:
+		d.pos = start
+		return nil, d.errorf("unsupported CBOR simple value %d", arg)
+	}
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		d.pos = start
+		return nil, d.errorf("%v has no JSON representation", f)
+	}
+	return f, nil
+}
+
+// float16 decodes an IEEE 754 half-precision float
+func float16(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		f = math.Inf(1)
+		if mant != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// encodeCBOR writes a value decoded by encoding/json with UseNumber as
+// CBOR, with the map keys sorted per the deterministic encoding of RFC
+// 8949 section 4.2.1
+func encodeCBOR(buf *bytes.Buffer, value any) error {
+	switch value := value.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if value {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case string:
+		cborHead(buf, cborText, uint64(len(value)))
+		buf.WriteString(value)
+	case json.Number:
+		return encodeCBORNumber(buf, value)
+	case []any:
+		cborHead(buf, cborArray, uint64(len(value)))
+		for _, item := range value {
+			if err := encodeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		type entry struct {
+			key   []byte
+			value any
+		}
+		entries := make([]entry, 0, len(value))
+		for key, v := range value {
+			var k bytes.Buffer
+			cborHead(&k, cborText, uint64(len(key)))
+			k.WriteString(key)
+			entries = append(entries, entry{k.Bytes(), v})
+		}
+		slices.SortFunc(entries, func(a, b entry) int { return bytes.Compare(a.key, b.key) })
+
+		cborHead(buf, cborMap, uint64(len(value)))
+		for _, e := range entries {
+			buf.Write(e.key)
+			if err := encodeCBOR(buf, e.value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode %T as CBOR", value)
+	}
+	return nil
+}
+
+// encodeCBORNumber writes integers as integers or bignums, and other
+// numbers as the shortest float that keeps their value
+func encodeCBORNumber(buf *bytes.Buffer, n json.Number) error {
+	if i, ok := new(big.Int).SetString(n.String(), 10); ok {
+		switch {
+		case i.Sign() >= 0 && i.IsUint64():
+			cborHead(buf, cborUint, i.Uint64())
+		case i.Sign() < 0 && new(big.Int).Not(i).IsUint64():
+			// -1 - n is ^n in two's complement
+			cborHead(buf, cborNegint, new(big.Int).Not(i).Uint64())
+		default:
+			tag := uint64(2)
+			if i.Sign() < 0 {
+				tag, i = 3, new(big.Int).Not(i)
+			}
+			cborHead(buf, cborTag, tag)
+			magnitude := i.Bytes()
+			cborHead(buf, cborBytes, uint64(len(magnitude)))
+			buf.Write(magnitude)
+		}
+		return nil
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("cannot encode %s as CBOR: %w", n, err)
+	}
+	if f32 := float32(f); float64(f32) == f {
+		buf.WriteByte(0xfa)
+		return binary.Write(buf, binary.BigEndian, math.Float32bits(f32))
+	}
+	buf.WriteByte(0xfb)
+	return binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+}
+
+// cborHead writes the shortest head of a data item
+func cborHead(buf *bytes.Buffer, major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.Write([]byte{major | 24, byte(arg)})
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		buf.WriteByte(major | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
@@ -0,0 +1,249 @@
+package jsoninquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+// DecodeOptions controls how JSON values are decoded
+type DecodeOptions struct {
+	// UseNumber decodes numbers into interface values as json.Number
+	// instead of float64, keeping large integers exact
+	UseNumber bool
+
+	// DisallowUnknownFields rejects object keys that match no field of
+	// the destination struct
+	DisallowUnknownFields bool
+
+	// ValueEncoding is the encoding of the values, decoded to JSON
+	// before unmarshalling. EncodeValue produces it for clients
+	ValueEncoding ValueEncoding
+}
+
+// decode converts src to JSON per the ValueEncoding of p, checks its
+// depth and unmarshals it into v, positioning the errors of subject, the
+// parameter at pos
+func (p *JSONParser) decode(src source.Source, maxDepth, pos int, subject string, v any) error {
+	src, err := p.toJSON(src, subject)
+	if err != nil {
+		return err
+	}
+	if err := src.CheckJSONDepth(maxDepth); err != nil {
+		return err
+	}
+	if err := p.unmarshal(src.Text, v); err != nil {
+		return decodeError(err, src, pos, subject, reflect.TypeOf(v))
+	}
+	return nil
+}
+
+// unmarshal decodes the JSON text into v per the options of p, the text
+// must hold a single value
+func (p *JSONParser) unmarshal(text string, v any) error {
+	// the syntax is checked first, as json.Unmarshal does
+	if err := json.Unmarshal([]byte(text), new(json.RawMessage)); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(text))
+	if p.UseNumber {
+		dec.UseNumber()
+	}
+	if p.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(v)
+}
+
+// Decode unmarshals the JSON value of param into a T, such as a request
+// struct. An empty param reads the entire query as JSON
+func Decode[T any](query, param string) (T, error) {
+	return DecodeWithOptions[T](query, param, DecodeOptions{})
+}
+
+// DecodeWithOptions is Decode with UseNumber, DisallowUnknownFields and
+// a ValueEncoding.
+// Type mismatches and unknown fields are *rfcquery.Error values at the
+// position of the parameter, naming the offending field
+func DecodeWithOptions[T any](query, param string, opts DecodeOptions) (T, error) {
+	var result T
+
+	scanner := rfcquery.NewScanner(query)
+	if err := scanner.Valid(); err != nil {
+		return result, err
+	}
+	scanner.Reset()
+
+	p := &JSONParser{TargetParam: param, DecodeOptions: opts}
+	src, pos, err := p.target(scanner)
+	if err != nil {
+		return result, err
+	}
+
+	subject := "query"
+	if param != "" {
+		subject = fmt.Sprintf("parameter %q", param)
+	}
+	if err := p.decode(src, scanner.Options().MaxJSONDepth, pos, subject, &result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// target returns the JSON text to decode and the position of the
+// parameter holding it
+func (p *JSONParser) target(scanner *rfcquery.Scanner) (source.Source, int, error) {
+	if p.TargetParam == "" {
+		tokens, err := scanner.CollectAll()
+		if err != nil {
+			return source.Source{}, 0, fmt.Errorf("failed to collect query: %w", err)
+		}
+		return source.New(tokens, 0), 0, nil
+	}
+
+	formParser := &formurlencoded.FormURLEncodedParser{}
+	result, err := formParser.Parse(scanner)
+	if err != nil {
+		return source.Source{}, 0, fmt.Errorf("failed to parse as form-urlencoded: %w", err)
+	}
+
+	targetValues := source.Lookup(source.Params(result.(*rfcquery.Values)), p.TargetParam)
+	if len(targetValues) == 0 {
+		return source.Source{}, 0, fmt.Errorf("target parameter %q not found", p.TargetParam)
+	}
+	if len(targetValues) > 1 {
+		return source.Source{}, 0, rfcquery.NewError(targetValues[1].Pos.Offset, "multiple values found for parameter %q", p.TargetParam)
+	}
+	return targetValues[0].Value(), targetValues[0].Pos.Offset, nil
+}
+
+// decodeError positions the errors of encoding/json: type mismatches on
+// the mismatched value, unknown fields of t on the parameter at pos and
+// invalid JSON on the offending byte
+func decodeError(err error, src source.Source, pos int, subject string, t reflect.Type) error {
+	var typeErr *json.UnmarshalTypeError
+	var rfcErr *rfcquery.Error
+
+	if errors.As(err, &typeErr) {
+		i, _ := src.JSONOffset(err)
+		if typeErr.Field == "" {
+			rfcErr = src.Errorf(i, "%s: cannot decode JSON %s into %s", subject, typeErr.Value, typeErr.Type).(*rfcquery.Error)
+		} else {
+			rfcErr = src.Errorf(i, "%s: field %q expects %s, got JSON %s", subject, typeErr.Field, typeErr.Type, typeErr.Value).(*rfcquery.Error)
+		}
+	} else if field, ok := unknownField([]byte(src.Text), t); ok {
+		rfcErr = rfcquery.NewError(pos, "%s: unknown field %q", subject, field)
+	} else {
+		return src.JSONError(err, "invalid JSON in "+subject)
+	}
+
+	rfcErr.Err = err
+	return rfcErr
+}
+
+var unmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// unknownField returns the first object key of data, in document order,
+// that matches no field of the struct it decodes into within t
+func unknownField(data []byte, t reflect.Type) (string, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	// custom unmarshalers read their own keys
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return "", false
+	}
+
+	var ok bool
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+			return "", false
+		}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return "", false
+			}
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return "", false
+			}
+
+			key := tok.(string)
+			var elem reflect.Type
+			if t.Kind() == reflect.Map {
+				elem = t.Elem()
+			} else if elem, ok = structField(t, key); !ok {
+				return key, true
+			}
+			if field, ok := unknownField(value, elem); ok {
+				return field, true
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return "", false
+		}
+		for _, item := range items {
+			if field, ok := unknownField(item, t.Elem()); ok {
+				return field, true
+			}
+		}
+	}
+	return "", false
+}
+
+// structField returns the type of the field of the struct t that
+// encoding/json decodes key into, promoted fields included
+func structField(t reflect.Type, key string) (reflect.Type, bool) {
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || !promoted(t, f.Index) {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && indirect(f.Type).Kind() == reflect.Struct {
+			// its fields are promoted
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.EqualFold(name, key) {
+			return f.Type, true
+		}
+	}
+	return nil, false
+}
+
+// promoted reports whether the embedded structs on the path index to a
+// field are untagged, a tagged one is a field of its own
+func promoted(t reflect.Type, index []int) bool {
+	for i := 1; i < len(index); i++ {
+		if name, _, _ := strings.Cut(t.FieldByIndex(index[:i]).Tag.Get("json"), ","); name != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,272 @@
+package jsoninquery
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/CRSylar/rfcquery/internal/source"
+)
+
+// ValueEncoding is the transport encoding of a JSON value in the query
+type ValueEncoding int
+
+const (
+	// EncodingRaw is plain, possibly percent-encoded, JSON
+	EncodingRaw ValueEncoding = iota
+
+	// EncodingBase64URL is JSON in unpadded base64url (RFC 4648 section 5),
+	// trailing '=' padding is accepted
+	EncodingBase64URL
+
+	// EncodingBase64URLDeflate is JSON compressed with raw DEFLATE
+	// (RFC 1951), then base64url encoded
+	EncodingBase64URLDeflate
+
+	// EncodingJSON5 is a JSON5 document, with comments, trailing commas,
+	// unquoted keys, single quoted strings and hexadecimal numbers
+	EncodingJSON5
+
+	// EncodingCBOR is a CBOR data item (RFC 8949) in base64url. Byte
+	// strings decode to base64url strings and tags are dropped
+	EncodingCBOR
+)
+
+// maxInflatedSize bounds the JSON text a deflated value expands to
+const maxInflatedSize = 1 << 20
+
+func (e ValueEncoding) String() string {
+	switch e {
+	case EncodingRaw:
+		return "raw"
+	case EncodingBase64URL:
+		return "base64url"
+	case EncodingBase64URLDeflate:
+		return "base64url+deflate"
+	case EncodingJSON5:
+		return "json5"
+	case EncodingCBOR:
+		return "cbor"
+	default:
+		return fmt.Sprintf("ValueEncoding(%d)", int(e))
+	}
+}
+
+// toJSON decodes src per the ValueEncoding of p into JSON text. JSON5
+// bytes keep the position they come from, base64url bytes the position
+// of their first character, while the text inflated from DEFLATE or
+// converted from CBOR is positioned at the start of src
+func (p *JSONParser) toJSON(src source.Source, subject string) (source.Source, error) {
+	if p.ValueEncoding == EncodingRaw {
+		return src, nil
+	}
+
+	if p.ValueEncoding == EncodingJSON5 {
+		text, index, err := json5ToJSON(src.Text)
+		if err != nil {
+			e := err.(*json5Error)
+			return source.Source{}, src.Errorf(e.Offset, "%s: invalid JSON5: %s", subject, e.Msg)
+		}
+		return src.Mapped(text, index), nil
+	}
+
+	switch p.ValueEncoding {
+	case EncodingBase64URL, EncodingBase64URLDeflate, EncodingCBOR:
+	default:
+		return source.Source{}, fmt.Errorf("unknown value encoding %v", p.ValueEncoding)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(src.Text, "="))
+	if err != nil {
+		var corrupt base64.CorruptInputError
+		errors.As(err, &corrupt)
+		return source.Source{}, src.Errorf(int(corrupt), "%s: invalid base64url", subject)
+	}
+
+	// byte k of the decoded data starts in character 4k/3 of src
+	char := func(k int) int { return k * 4 / 3 }
+
+	switch p.ValueEncoding {
+	case EncodingBase64URLDeflate:
+		r := flate.NewReader(bytes.NewReader(data))
+		text, err := io.ReadAll(io.LimitReader(r, maxInflatedSize+1))
+		if err != nil {
+			var corrupt flate.CorruptInputError
+			if errors.As(err, &corrupt) {
+				return source.Source{}, src.Errorf(char(int(corrupt)), "%s: invalid DEFLATE data", subject)
+			}
+			return source.Source{}, src.Errorf(len(src.Text), "%s: invalid DEFLATE data: %v", subject, err)
+		}
+		if len(text) > maxInflatedSize {
+			return source.Source{}, src.Errorf(0, "%s: inflated value exceeds %d bytes", subject, maxInflatedSize)
+		}
+		return src.Mapped(string(text), nil), nil
+
+	case EncodingCBOR:
+		text, err := cborToJSON(data)
+		if err != nil {
+			e := err.(*cborError)
+			return source.Source{}, src.Errorf(char(e.Offset), "%s: invalid CBOR: %s", subject, e.Msg)
+		}
+		return src.Mapped(text, nil), nil
+	}
+
+	index := make([]int, len(data))
+	for k := range index {
+		index[k] = char(k)
+	}
+	return src.Mapped(string(data), index), nil
+}
+
+// EncodeValue encodes v, marshaled with encoding/json, for a query
+// parameter read by a JSONParser with the same ValueEncoding. The result
+// is percent-encoded and safe to use as a form value
+func EncodeValue(v any, enc ValueEncoding) (string, error) {
+	text, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	switch enc {
+	case EncodingRaw:
+		return escapeValue(string(text)), nil
+
+	case EncodingBase64URL:
+		return base64.RawURLEncoding.EncodeToString(text), nil
+
+	case EncodingBase64URLDeflate:
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		w.Write(text)
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+
+	case EncodingJSON5, EncodingCBOR:
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.UseNumber()
+		var value any
+		if err := dec.Decode(&value); err != nil {
+			return "", err
+		}
+
+		if enc == EncodingJSON5 {
+			var sb strings.Builder
+			encodeJSON5(&sb, value)
+			return escapeValue(sb.String()), nil
+		}
+
+		var buf bytes.Buffer
+		if err := encodeCBOR(&buf, value); err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+
+	default:
+		return "", fmt.Errorf("unknown value encoding %v", enc)
+	}
+}
+
+// encodeJSON5 writes a value decoded by encoding/json with UseNumber as
+// compact JSON5, with identifier keys unquoted and single quoted strings
+func encodeJSON5(sb *strings.Builder, value any) {
+	switch value := value.(type) {
+	case nil:
+		sb.WriteString("null")
+	case bool:
+		fmt.Fprint(sb, value)
+	case json.Number:
+		sb.WriteString(value.String())
+	case string:
+		writeJSON5String(sb, value)
+	case []any:
+		sb.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			encodeJSON5(sb, item)
+		}
+		sb.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		sb.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			if isJSON5Identifier(key) {
+				sb.WriteString(key)
+			} else {
+				writeJSON5String(sb, key)
+			}
+			sb.WriteByte(':')
+			encodeJSON5(sb, value[key])
+		}
+		sb.WriteByte('}')
+	}
+}
+
+func writeJSON5String(sb *strings.Builder, s string) {
+	sb.WriteByte('\'')
+	for _, r := range s {
+		switch {
+		case r == '\'' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r < 0x20 || r == '\u2028' || r == '\u2029':
+			fmt.Fprintf(sb, `\u%04x`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('\'')
+}
+
+// isJSON5Identifier reports whether key can be written unquoted, limited
+// to ASCII identifiers
+func isJSON5Identifier(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		letter := c == '$' || c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeValue percent-encodes s for a form value, keeping the unreserved
+// characters and the sub-delimiters that carry no form meaning
+func escapeValue(s string) string {
+	const upperhex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~!$'()*,;:@/?", c) >= 0 {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(upperhex[c>>4])
+		sb.WriteByte(upperhex[c&0xf])
+	}
+	return sb.String()
+}
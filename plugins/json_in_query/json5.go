@@ -0,0 +1,430 @@
+package jsoninquery
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxNesting bounds the recursion of the JSON5 and CBOR decoders, as
+// encoding/json does
+const maxNesting = 10000
+
+// json5Error is a JSON5 syntax error at byte Offset of the input
+type json5Error struct {
+	Offset int
+	Msg    string
+}
+
+func (e *json5Error) Error() string {
+	return e.Msg
+}
+
+// json5Converter rewrites JSON5 into JSON, recording for each output byte
+// the input byte it comes from
+type json5Converter struct {
+	in    string
+	pos   int
+	depth int
+	out   strings.Builder
+	index []int
+}
+
+// json5ToJSON converts a JSON5 document into JSON. index maps the output
+// bytes to the input bytes they come from
+func json5ToJSON(in string) (string, []int, error) {
+	c := &json5Converter{in: in}
+	c.skipSpace()
+	if err := c.value(); err != nil {
+		return "", nil, err
+	}
+	c.skipSpace()
+	if c.pos < len(c.in) {
+		return "", nil, c.errorf("unexpected %q after JSON5 value", c.in[c.pos:c.pos+1])
+	}
+	return c.out.String(), c.index, nil
+}
+
+func (c *json5Converter) errorf(format string, args ...any) error {
+	return &json5Error{Offset: c.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// emit writes s to the output, coming from input byte at
+func (c *json5Converter) emit(s string, at int) {
+	c.out.WriteString(s)
+	for range len(s) {
+		c.index = append(c.index, at)
+	}
+}
+
+func (c *json5Converter) peek() byte {
+	if c.pos < len(c.in) {
+		return c.in[c.pos]
+	}
+	return 0
+}
+
+// skipSpace moves past whitespace and comments
+func (c *json5Converter) skipSpace() {
+	for c.pos < len(c.in) {
+		switch r, size := utf8.DecodeRuneInString(c.in[c.pos:]); {
+		case r == '\uFEFF' || unicode.IsSpace(r) || unicode.Is(unicode.Zs, r):
+			c.pos += size
+		case strings.HasPrefix(c.in[c.pos:], "//"):
+			end := strings.IndexAny(c.in[c.pos:], "\n\r\u2028\u2029")
+			if end < 0 {
+				c.pos = len(c.in)
+			} else {
+				c.pos += end
+			}
+		case strings.HasPrefix(c.in[c.pos:], "/*"):
+			end := strings.Index(c.in[c.pos+2:], "*/")
+			if end < 0 {
+				// left for the caller to report
+				return
+			}
+			c.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+func (c *json5Converter) value() error {
+	if strings.HasPrefix(c.in[c.pos:], "/*") {
+		return c.errorf("unterminated comment")
+	}
+	if c.pos == len(c.in) {
+		return c.errorf("unexpected end of JSON5 input")
+	}
+
+	switch ch := c.in[c.pos]; {
+	case ch == '{' || ch == '[':
+		if c.depth++; c.depth > maxNesting {
+			return c.errorf("exceeded max depth")
+		}
+		defer func() { c.depth-- }()
+		if ch == '{' {
+			return c.object()
+		}
+		return c.array()
+	case ch == '"' || ch == '\'':
+		return c.string()
+	case ch == '-' || ch == '+' || ch == '.' || '0' <= ch && ch <= '9':
+		return c.number()
+	}
+
+	start := c.pos
+	word := c.identifier()
+	switch word {
+	case "true", "false", "null":
+		c.emit(word, start)
+		return nil
+	case "Infinity", "NaN":
+		c.pos = start
+		return c.errorf("%s has no JSON representation", word)
+	case "":
+		_, size := utf8.DecodeRuneInString(c.in[c.pos:])
+		return c.errorf("invalid character %q looking for beginning of value", c.in[c.pos:c.pos+size])
+	default:
+		c.pos = start
+		return c.errorf("invalid literal %q", word)
+	}
+}
+
+func (c *json5Converter) object() error {
+	c.emit("{", c.pos)
+	c.pos++
+	for first := true; ; first = false {
+		c.skipSpace()
+		if c.peek() == '}' {
+			c.emit("}", c.pos)
+			c.pos++
+			return nil
+		}
+		if !first {
+			c.emit(",", c.pos)
+		}
+
+		if err := c.key(); err != nil {
+			return err
+		}
+		c.skipSpace()
+		if c.peek() != ':' {
+			return c.errorf("expected ':' after object key")
+		}
+		c.emit(":", c.pos)
+		c.pos++
+		c.skipSpace()
+		if err := c.value(); err != nil {
+			return err
+		}
+
+		c.skipSpace()
+		switch c.peek() {
+		case ',':
+			c.pos++
+		case '}':
+		default:
+			return c.errorf("expected ',' or '}' after object value")
+		}
+	}
+}
+
+func (c *json5Converter) array() error {
+	c.emit("[", c.pos)
+	c.pos++
+	for first := true; ; first = false {
+		c.skipSpace()
+		if c.peek() == ']' {
+			c.emit("]", c.pos)
+			c.pos++
+			return nil
+		}
+		if !first {
+			c.emit(",", c.pos)
+		}
+		if err := c.value(); err != nil {
+			return err
+		}
+
+		c.skipSpace()
+		switch c.peek() {
+		case ',':
+			c.pos++
+		case ']':
+		default:
+			return c.errorf("expected ',' or ']' after array element")
+		}
+	}
+}
+
+// key reads a quoted key or an identifier
+func (c *json5Converter) key() error {
+	if ch := c.peek(); ch == '"' || ch == '\'' {
+		return c.string()
+	}
+
+	start := c.pos
+	name := c.identifier()
+	if name == "" {
+		if c.pos == len(c.in) {
+			return c.errorf("unexpected end of JSON5 input")
+		}
+		return c.errorf("invalid object key")
+	}
+	c.emit(`"`, start)
+	for _, r := range name {
+		c.emitRune(r, start)
+	}
+	c.emit(`"`, start)
+	return nil
+}
+
+// identifier reads an ECMAScript IdentifierName, with \uXXXX escapes
+func (c *json5Converter) identifier() string {
+	var sb strings.Builder
+	for c.pos < len(c.in) {
+		r, size := utf8.DecodeRuneInString(c.in[c.pos:])
+		if r == '\\' && strings.HasPrefix(c.in[c.pos:], "\\u") && c.pos+6 <= len(c.in) {
+			n, err := strconv.ParseUint(c.in[c.pos+2:c.pos+6], 16, 16)
+			if err != nil {
+				break
+			}
+			r, size = rune(n), 6
+		}
+
+		ok := r == '$' || r == '_' || unicode.IsLetter(r) || unicode.Is(unicode.Nl, r)
+		if sb.Len() > 0 {
+			ok = ok || unicode.IsDigit(r) || unicode.In(r, unicode.Mn, unicode.Mc, unicode.Pc) || r == '\u200C' || r == '\u200D'
+		}
+		if !ok {
+			break
+		}
+		sb.WriteRune(r)
+		c.pos += size
+	}
+	return sb.String()
+}
+
+// string converts a single or double quoted string
+func (c *json5Converter) string() error {
+	quote := c.in[c.pos]
+	c.emit(`"`, c.pos)
+	c.pos++
+
+	for {
+		if c.pos == len(c.in) {
+			return c.errorf("unterminated string")
+		}
+		start := c.pos
+		r, size := utf8.DecodeRuneInString(c.in[c.pos:])
+		c.pos += size
+
+		switch {
+		case r == rune(quote):
+			c.emit(`"`, start)
+			return nil
+		case r == '\n' || r == '\r':
+			c.pos = start
+			return c.errorf("unescaped line break in string")
+		case r == utf8.RuneError && size == 1:
+			c.pos = start
+			return c.errorf("invalid UTF-8 in string")
+		case r != '\\':
+			c.emitRune(r, start)
+			continue
+		}
+
+		if c.pos == len(c.in) {
+			return c.errorf("unterminated string")
+		}
+		r, size = utf8.DecodeRuneInString(c.in[c.pos:])
+		c.pos += size
+		switch r {
+		case 'b':
+			c.emitRune('\b', start)
+		case 'f':
+			c.emitRune('\f', start)
+		case 'n':
+			c.emitRune('\n', start)
+		case 'r':
+			c.emitRune('\r', start)
+		case 't':
+			c.emitRune('\t', start)
+		case 'v':
+			c.emitRune('\v', start)
+		case '0':
+			if ch := c.peek(); '0' <= ch && ch <= '9' {
+				return c.errorf("octal escapes are not allowed")
+			}
+			c.emitRune(0, start)
+		case 'x', 'u':
+			digits := 2
+			if r == 'u' {
+				digits = 4
+			}
+			if c.pos+digits > len(c.in) {
+				return c.errorf("invalid escape")
+			}
+			n, err := strconv.ParseUint(c.in[c.pos:c.pos+digits], 16, 16)
+			if err != nil {
+				return c.errorf("invalid escape")
+			}
+			c.pos += digits
+			if digits == 4 {
+				// keep surrogate halves escaped, encoding/json pairs them
+				c.emit(`\u`+c.in[c.pos-4:c.pos], start)
+			} else {
+				c.emitRune(rune(n), start)
+			}
+		case '\r':
+			if c.peek() == '\n' {
+				c.pos++
+			}
+		case '\n', '\u2028', '\u2029':
+			// line continuation
+		default:
+			if '1' <= r && r <= '9' {
+				return c.errorf("octal escapes are not allowed")
+			}
+			c.emitRune(r, start)
+		}
+	}
+}
+
+// emitRune writes r escaped for a JSON string
+func (c *json5Converter) emitRune(r rune, at int) {
+	switch {
+	case r == '"' || r == '\\':
+		c.emit(`\`+string(r), at)
+	case r < 0x20:
+		c.emit(fmt.Sprintf(`\u%04x`, r), at)
+	default:
+		c.emit(string(r), at)
+	}
+}
+
+// number converts hexadecimal, signed and dotted numbers to JSON
+func (c *json5Converter) number() error {
+	start := c.pos
+	var sign string
+	switch c.peek() {
+	case '-':
+		sign = "-"
+		c.pos++
+	case '+':
+		c.pos++
+	}
+
+	rest := c.in[c.pos:]
+	for _, word := range []string{"Infinity", "NaN"} {
+		if strings.HasPrefix(rest, word) {
+			return c.errorf("%s has no JSON representation", word)
+		}
+	}
+
+	if strings.HasPrefix(rest, "0x") || strings.HasPrefix(rest, "0X") {
+		end := 2
+		for end < len(rest) && strings.IndexByte("0123456789abcdefABCDEF", rest[end]) >= 0 {
+			end++
+		}
+		n, ok := new(big.Int).SetString(rest[2:end], 16)
+		if !ok {
+			return c.errorf("invalid hexadecimal number")
+		}
+		c.pos += end
+		c.emit(sign+n.String(), start)
+		return nil
+	}
+
+	var intPart, fracPart, exp string
+	end := 0
+	for end < len(rest) && '0' <= rest[end] && rest[end] <= '9' {
+		end++
+	}
+	intPart = rest[:end]
+	if end < len(rest) && rest[end] == '.' {
+		fracStart := end + 1
+		end = fracStart
+		for end < len(rest) && '0' <= rest[end] && rest[end] <= '9' {
+			end++
+		}
+		fracPart = rest[fracStart:end]
+	}
+	if intPart == "" && fracPart == "" {
+		return c.errorf("invalid number")
+	}
+	if len(intPart) > 1 && intPart[0] == '0' {
+		return c.errorf("leading zeros are not allowed")
+	}
+	if end < len(rest) && (rest[end] == 'e' || rest[end] == 'E') {
+		expStart := end
+		end++
+		if end < len(rest) && (rest[end] == '+' || rest[end] == '-') {
+			end++
+		}
+		digits := end
+		for end < len(rest) && '0' <= rest[end] && rest[end] <= '9' {
+			end++
+		}
+		if end == digits {
+			return c.errorf("invalid number exponent")
+		}
+		exp = rest[expStart:end]
+	}
+	c.pos += end
+
+	if intPart == "" {
+		intPart = "0"
+	}
+	number := sign + intPart
+	if fracPart != "" {
+		number += "." + fracPart
+	}
+	c.emit(number+exp, start)
+	return nil
+}
@@ -3,8 +3,11 @@ package jsoninquery
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/jsonschema"
+	"github.com/CRSylar/rfcquery/internal/source"
 	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
 )
 
@@ -20,6 +23,19 @@ type JSONParser struct {
 
 	// StrictValidation requires valid RFC3986 before JSON parsing
 	StrictValidation bool
+
+	// DecodeOptions tunes the decoding of the JSON values
+	DecodeOptions
+
+	// Schema is a JSON Schema draft 2020-12 document the parsed values
+	// must satisfy, nil skips validation. Violations are reported at the
+	// position of the parameter with the JSON Pointer of the value. It is
+	// compiled by the first Parse, later changes are not read
+	Schema json.RawMessage
+
+	compileOnce sync.Once
+	schema      *jsonschema.Schema
+	schemaErr   error
 }
 
 // Name returns the parser identifier
@@ -39,39 +55,54 @@ func (p *JSONParser) Parse(scanner *rfcquery.Scanner) (any, error) {
 		scanner.Reset()
 	}
 
+	p.compileOnce.Do(func() {
+		if p.Schema != nil {
+			p.schema, p.schemaErr = jsonschema.Compile(p.Schema)
+		}
+	})
+	if p.schemaErr != nil {
+		return nil, p.schemaErr
+	}
+	schema := p.schema
+
 	if p.TargetParam == "" {
-		return p.parseEntireQuery(scanner)
+		return p.parseEntireQuery(scanner, schema)
 	}
 
-	return p.parseTargetParam(scanner)
+	return p.parseTargetParam(scanner, schema)
 }
 
 // parseEntireQuery treats the whole query string as JSON
-func (p *JSONParser) parseEntireQuery(scanner *rfcquery.Scanner) (any, error) {
+func (p *JSONParser) parseEntireQuery(scanner *rfcquery.Scanner, schema *jsonschema.Schema) (any, error) {
 	tokens, err := scanner.CollectAll()
 	if err != nil {
 		return nil, fmt.Errorf("failed to collect query: %w", err)
 	}
 
-	jsonStr := tokens.StringDecoded()
 	var result any
-	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
-		return nil, fmt.Errorf("invalid JSON in query: %w", err)
+	if err := p.decode(source.New(tokens, 0), scanner.Options().MaxJSONDepth, 0, "query", &result); err != nil {
+		return nil, err
+	}
+
+	if schema != nil {
+		if err := schema.Check(result, 0, "query"); err != nil {
+			return nil, err
+		}
 	}
 
 	return result, nil
 }
 
 // parseTargetParam extracts JSON from a specific parameter
-func (p *JSONParser) parseTargetParam(scanner *rfcquery.Scanner) (map[string]any, error) {
+func (p *JSONParser) parseTargetParam(scanner *rfcquery.Scanner, schema *jsonschema.Schema) (map[string]any, error) {
 	formParser := &formurlencoded.FormURLEncodedParser{}
 	result, err := formParser.Parse(scanner)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse as form-urlencoded: %w", err)
 	}
 
-	values := result.(*rfcquery.Values)
-	targetValues := values.Get(p.TargetParam)
+	// the form parser splits values on ',', which JSON documents use freely
+	targetValues := source.Lookup(source.Params(result.(*rfcquery.Values)), p.TargetParam)
 
 	if len(targetValues) == 0 {
 		return nil, fmt.Errorf("target parameter %q not found", p.TargetParam)
@@ -84,8 +115,15 @@ func (p *JSONParser) parseTargetParam(scanner *rfcquery.Scanner) (map[string]any
 	results := make(map[string]any)
 	for i, val := range targetValues {
 		var jsonData any
-		if err := json.Unmarshal([]byte(val.Value), &jsonData); err != nil {
-			return nil, fmt.Errorf("invalid JSON in parameter %q (value %d): %w", p.TargetParam, i, err)
+		subject := fmt.Sprintf("parameter %q (value %d)", p.TargetParam, i)
+		if err := p.decode(val.Value(), scanner.Options().MaxJSONDepth, val.Pos.Offset, subject, &jsonData); err != nil {
+			return nil, err
+		}
+
+		if schema != nil {
+			if err := schema.Check(jsonData, val.Pos.Offset, fmt.Sprintf("parameter %q", p.TargetParam)); err != nil {
+				return nil, err
+			}
 		}
 
 		key := p.TargetParam
@@ -1,8 +1,13 @@
 package jsoninquery_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/CRSylar/rfcquery"
@@ -265,3 +270,446 @@ func BenchmarkJSONParser(b *testing.B) {
 		}
 	}
 }
+
+func TestJSONParser_DecodedValue(t *testing.T) {
+	// values are decoded from their tokens: raw commas, which the form
+	// parser splits on, and percent-encoded bytes are part of the JSON
+	input := `filter=%7B%22tags%22:%5B%22a%22,%22b%22%5D,%22q%22:%221%2B1%20%26%20x%22%7D&page=2`
+	got, err := jsoninquery.ParseJSONQuery(input, "filter")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := map[string]any{
+		"filter": map[string]any{"tags": []any{"a", "b"}, "q": "1+1 & x"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %#v, want %#v", got, want)
+	}
+}
+
+func TestJSONParser_MaxDepth(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		target  string
+		wantPos int
+	}{
+		{
+			name:    "nested arrays in parameter",
+			input:   `filter=%5B%5B%5B1%5D%5D%5D`, // [[[1]]]
+			target:  "filter",
+			wantPos: 13,
+		},
+		{
+			name:    "entire query",
+			input:   `%7B%22a%22:%7B%22b%22:%7B%7D%7D%7D`, // {"a":{"b":{}}}
+			wantPos: 22,
+		},
+		{
+			name:   "brackets inside strings are ignored",
+			input:  `filter=%5B%22%5B%5B%5B%22%5D`, // ["[[["]
+			target: "filter",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := &jsoninquery.JSONParser{TargetParam: tt.target}
+			_, err := rfcquery.ParseContext(context.Background(), parser, tt.input, rfcquery.ParseOptions{MaxJSONDepth: 2})
+			if tt.wantPos == 0 {
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+				return
+			}
+
+			var limitErr *rfcquery.LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != rfcquery.LimitJSONDepth {
+				t.Fatalf("expected JSON depth LimitError, got %v", err)
+			}
+			if limitErr.Pos.Offset != tt.wantPos {
+				t.Errorf("Pos = %d, want %d", limitErr.Pos.Offset, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestJSONParser_Schema(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": "integer", "minimum": 18},
+			"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}}
+		},
+		"$defs": {"tag": {"enum": ["a", "b"]}}
+	}`)
+
+	tests := []struct {
+		name    string
+		input   string
+		target  string
+		wantPos int
+		wantMsg []string
+	}{
+		{"valid", `page=1&filter=%7B%22name%22:%22John%22,%22age%22:30%7D`, "filter", -1, nil},
+		{"violations", `page=1&filter=%7B%22age%22:17,%22tags%22:%5B%22a%22,%22c%22%5D%7D`, "filter", 7, []string{
+			`parameter "filter" does not match the schema at "": missing required property "name"`,
+			`parameter "filter" does not match the schema at "/age": value 17 is below the minimum 18`,
+			`parameter "filter" does not match the schema at "/tags/1": value "c" is not one of ["a","b"]`,
+		}},
+		{"entire query", `%5B1%5D`, "", 0, []string{`query does not match the schema at "": expected object, got array`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := &jsoninquery.JSONParser{TargetParam: tt.target, StrictValidation: true, Schema: schema}
+			_, err := parser.Parse(rfcquery.NewScanner(tt.input))
+			if tt.wantMsg == nil {
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+				return
+			}
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) || rfcErr.Pos.Offset != tt.wantPos {
+				t.Fatalf("expected *rfcquery.Error at position %d, got %v", tt.wantPos, err)
+			}
+			for _, msg := range tt.wantMsg {
+				if !strings.Contains(err.Error(), msg) {
+					t.Errorf("error %q does not contain %q", err, msg)
+				}
+			}
+		})
+	}
+
+	// the schema is compiled once, every Parse reports its error
+	parser := &jsoninquery.JSONParser{TargetParam: "filter", Schema: json.RawMessage(`{"type": "float"}`)}
+	for range 2 {
+		if _, err := parser.Parse(rfcquery.NewScanner("filter=1")); err == nil || !strings.Contains(err.Error(), "invalid JSON schema") {
+			t.Errorf("invalid schema: got %v", err)
+		}
+	}
+}
+
+func TestJSONParser_ErrorPositions(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		target  string
+		wantPos int
+		wantMsg string
+	}{
+		{"percent-encoded value", `filter=%7B%22a%22:tru%7D`, "filter", 21,
+			`invalid JSON in parameter "filter" (value 0) (decoded offset 8): invalid character '}' in literal true (expecting 'e')`},
+		{"after other parameters", `page=1&filter=%5B1,%202,%5D`, "filter", 24, "(decoded offset 6): invalid character ']' looking for beginning of value"},
+		{"truncated", `filter=%7B%22a%22`, "filter", 17, "(decoded offset 4): unexpected end of JSON input"},
+		{"entire query", `%7B%22a%22:%7D`, "", 11, `invalid JSON in query (decoded offset 5): invalid character '}'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := &jsoninquery.JSONParser{TargetParam: tt.target, StrictValidation: true}
+			_, err := parser.Parse(rfcquery.NewScanner(tt.input))
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+
+			var syntaxErr *json.SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Errorf("expected the *json.SyntaxError to be wrapped, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	type filter struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	got, err := jsoninquery.Decode[filter](`page=1&filter=%7B%22name%22:%22Ann%22,%22age%22:30,%22x%22:1%7D`, "filter")
+	if err != nil || got != (filter{Name: "Ann", Age: 30}) {
+		t.Errorf("Decode() = %+v, %v", got, err)
+	}
+
+	numbers, err := jsoninquery.DecodeWithOptions[map[string]any](`n=%7B%22id%22:12345678901234567890%7D`, "n", jsoninquery.DecodeOptions{UseNumber: true})
+	if err != nil || numbers["id"] != json.Number("12345678901234567890") {
+		t.Errorf("DecodeWithOptions() with UseNumber = %#v, %v", numbers, err)
+	}
+
+	list, err := jsoninquery.Decode[[]int](`%5B1,2%5D`, "")
+	if err != nil || !reflect.DeepEqual(list, []int{1, 2}) {
+		t.Errorf("Decode() of the entire query = %v, %v", list, err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		opts    jsoninquery.DecodeOptions
+		wantPos int
+		wantMsg string
+	}{
+		{"type mismatch", `page=1&filter=%7B%22age%22:%22x%22%7D`, jsoninquery.DecodeOptions{}, 27, `parameter "filter": field "age" expects int, got JSON string`},
+		{"root mismatch", `filter=%5B%5D`, jsoninquery.DecodeOptions{}, 7, `parameter "filter": cannot decode JSON array into jsoninquery_test.filter`},
+		{"unknown field", `filter=%7B%22extra%22:1%7D`, jsoninquery.DecodeOptions{DisallowUnknownFields: true}, 0, `parameter "filter": unknown field "extra"`},
+		{"multiple values", `filter=%7B%7D&filter=%7B%7D`, jsoninquery.DecodeOptions{}, 14, `multiple values found for parameter "filter"`},
+		{"invalid JSON", `filter=%7B%22age%22`, jsoninquery.DecodeOptions{}, 19, `invalid JSON in parameter "filter" (decoded offset 6): unexpected end of JSON input`},
+		{"trailing data", `filter=%7B%7D%7D`, jsoninquery.DecodeOptions{}, 13, `(decoded offset 2): invalid character '}' after top-level value`},
+		{"missing", `page=1`, jsoninquery.DecodeOptions{}, -1, `target parameter "filter" not found`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jsoninquery.DecodeWithOptions[filter](tt.query, "filter", tt.opts)
+			if tt.wantPos < 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantMsg) {
+					t.Errorf("got %v, want %q", err, tt.wantMsg)
+				}
+				return
+			}
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestDecode_UnknownFields(t *testing.T) {
+	type item struct{ Label string }
+	type base struct {
+		ID int `json:"id"`
+	}
+	type request struct {
+		base
+		Name  string          `json:"name"`
+		Items []item          `json:"items"`
+		Meta  map[string]item `json:"meta"`
+		Skip  string          `json:"-"`
+	}
+
+	tests := []struct {
+		name      string
+		json      string
+		wantField string
+	}{
+		{"known", `{"id":1,"NAME":"a","items":[{"label":"x"}],"meta":{"k":{"Label":"y"}}}`, ""},
+		{"top level", `{"name":"a","b":1,"c":2}`, "b"},
+		{"in a slice", `{"items":[{"label":"x","color":1}]}`, "color"},
+		{"in a map", `{"meta":{"k":{"z":1}}}`, "z"},
+		{"ignored field", `{"Skip":"x"}`, "Skip"},
+	}
+
+	opts := jsoninquery.DecodeOptions{DisallowUnknownFields: true}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jsoninquery.DecodeWithOptions[request]("r="+url.QueryEscape(tt.json), "r", opts)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("DecodeWithOptions() error = %v", err)
+				}
+				return
+			}
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if want := fmt.Sprintf(`parameter "r": unknown field %q`, tt.wantField); rfcErr.Pos.Offset != 0 || rfcErr.Msg != want || rfcErr.Err == nil {
+				t.Errorf("got %v, want %q at position 0", err, want)
+			}
+		})
+	}
+}
+
+func TestJSONParser_ValueEncoding(t *testing.T) {
+	value := map[string]any{
+		"name":      "Ann & Bob's 'ünïcode'",
+		"big":       json.Number("-123456789012345678901234"),
+		"count":     json.Number("12345678901234567890"),
+		"tags":      []any{"x", json.Number("1.5"), nil, true},
+		"weird key": map[string]any{"line\u2028sep": "a\nb"},
+	}
+
+	encodings := []jsoninquery.ValueEncoding{
+		jsoninquery.EncodingRaw,
+		jsoninquery.EncodingBase64URL,
+		jsoninquery.EncodingBase64URLDeflate,
+		jsoninquery.EncodingJSON5,
+		jsoninquery.EncodingCBOR,
+	}
+	for _, enc := range encodings {
+		t.Run(enc.String(), func(t *testing.T) {
+			encoded, err := jsoninquery.EncodeValue(value, enc)
+			if err != nil {
+				t.Fatalf("EncodeValue() error = %v", err)
+			}
+
+			parser := &jsoninquery.JSONParser{
+				TargetParam:      "filter",
+				StrictValidation: true,
+				DecodeOptions:    jsoninquery.DecodeOptions{UseNumber: true, ValueEncoding: enc},
+			}
+			result, err := parser.Parse(rfcquery.NewScanner("page=1&filter=" + encoded))
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", encoded, err)
+			}
+			if got := result.(map[string]any)["filter"]; !reflect.DeepEqual(got, value) {
+				t.Errorf("round trip of %q = %#v, want %#v", encoded, got, value)
+			}
+		})
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		enc   jsoninquery.ValueEncoding
+		want  any
+	}{
+		{"padded base64url", "f=eyJhIjoxfQ==", jsoninquery.EncodingBase64URL, map[string]any{"a": 1.0}},
+		{"json5", "f=%7Ba:'x',/*c*/b:0x10,c:.5,%7D", jsoninquery.EncodingJSON5, map[string]any{"a": "x", "b": 16.0, "c": 0.5}},
+		{"cbor", "f=omFhgwEhYXhhYvU", jsoninquery.EncodingCBOR, map[string]any{"a": []any{1.0, -2.0, "x"}, "b": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := &jsoninquery.JSONParser{TargetParam: "f", DecodeOptions: jsoninquery.DecodeOptions{ValueEncoding: tt.enc}}
+			result, err := parser.Parse(rfcquery.NewScanner(tt.query))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := result.(map[string]any)["f"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	type filter struct {
+		Age int `json:"age"`
+	}
+	got, err := jsoninquery.DecodeWithOptions[filter]("eyJhZ2UiOjMwfQ", "", jsoninquery.DecodeOptions{ValueEncoding: jsoninquery.EncodingBase64URL})
+	if err != nil || got.Age != 30 {
+		t.Errorf("DecodeWithOptions() of the entire query = %+v, %v", got, err)
+	}
+}
+
+func TestJSONParser_ValueEncodingErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		enc     jsoninquery.ValueEncoding
+		wantPos int
+		wantMsg string
+	}{
+		{"base64url character", "x=1&f=eyJh!", jsoninquery.EncodingBase64URL, 10, `parameter "f": invalid base64url`},
+		{"json inside base64url", "f=eyJhIjp9", jsoninquery.EncodingBase64URL, 8, `invalid JSON in parameter "f" (decoded offset 5)`},
+		{"deflate", "f=_____w", jsoninquery.EncodingBase64URLDeflate, 3, `parameter "f": invalid DEFLATE data`},
+		{"json5", "f=%7Ba:Infinity%7D", jsoninquery.EncodingJSON5, 7, `parameter "f": invalid JSON5: Infinity has no JSON representation`},
+		{"json5 type mismatch", "f=%7Bage:'x'%7D", jsoninquery.EncodingJSON5, 9, `parameter "f": field "age" expects int, got JSON string`},
+		{"cbor", "f=oWFh", jsoninquery.EncodingCBOR, 6, `parameter "f": invalid CBOR: unexpected end of CBOR data`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jsoninquery.DecodeWithOptions[struct {
+				Age int `json:"age"`
+			}](tt.query, "f", jsoninquery.DecodeOptions{ValueEncoding: tt.enc})
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+
+	if _, err := jsoninquery.EncodeValue(1, jsoninquery.ValueEncoding(9)); err == nil {
+		t.Error("EncodeValue() with an unknown encoding should fail")
+	}
+}
+
+func FuzzJSONParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		`filter=%7B%22name%22:%22John%22,%22age%22:30%7D`,
+		`data=%5B%22a%22,%22b%22%5D&data=null`,
+		`%7B%22name%22%3A%22John%22%7D`,
+		`filter=`,
+		`=`,
+	} {
+		f.Add(seed, "filter")
+		f.Add(seed, "")
+	}
+
+	f.Fuzz(func(t *testing.T, input string, target string) {
+		parser := &jsoninquery.JSONParser{
+			TargetParam:      target,
+			AllowMultiple:    true,
+			StrictValidation: true,
+		}
+
+		result, err := parser.Parse(rfcquery.NewScanner(input))
+		if err != nil {
+			return
+		}
+
+		if target != "" {
+			if _, ok := result.(map[string]any); !ok {
+				t.Fatalf("expected map[string]any for target parameter, got %T", result)
+			}
+		}
+	})
+}
+
+func FuzzJSONParser_ValueEncoding(f *testing.F) {
+	for _, seed := range []string{
+		`%7Ba:'x',/*c*/b:0x10,c:.5,%7D`,
+		`omFhgwEhYXhhYvU`,
+		`eyJhIjoxfQ==`,
+		`q1YqSyxSslIqSsxT0lEqLkksLQYA`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		for enc := jsoninquery.EncodingRaw; enc <= jsoninquery.EncodingCBOR; enc++ {
+			parser := &jsoninquery.JSONParser{
+				TargetParam:   "f",
+				DecodeOptions: jsoninquery.DecodeOptions{UseNumber: true, ValueEncoding: enc},
+			}
+			result, err := parser.Parse(rfcquery.NewScanner("f=" + value))
+			if err != nil {
+				continue
+			}
+
+			// decoded values encode back to the same value
+			parsed := result.(map[string]any)["f"]
+			encoded, err := jsoninquery.EncodeValue(parsed, enc)
+			if err != nil {
+				t.Fatalf("EncodeValue(%#v, %v) error = %v", parsed, enc, err)
+			}
+			again, err := parser.Parse(rfcquery.NewScanner("f=" + encoded))
+			if err != nil {
+				t.Fatalf("Parse(%q) of the encoded value error = %v", encoded, err)
+			}
+			if got := again.(map[string]any)["f"]; !reflect.DeepEqual(got, parsed) {
+				t.Fatalf("%v round trip = %#v, want %#v", enc, got, parsed)
+			}
+		}
+	})
+}
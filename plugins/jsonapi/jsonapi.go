@@ -0,0 +1,396 @@
+package jsonapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+// JSONAPIQuery holds the query parameters defined by JSON:API v1.1.
+// Include is nil when absent and empty for "include=", likewise for
+// the field lists of Fields
+type JSONAPIQuery struct {
+	Include []JSONAPIInclude
+
+	// Fields maps a resource type to its sparse fieldset, fields[articles]=title,body
+	Fields map[string][]string
+
+	Sort   []JSONAPISortField
+	Page   JSONAPIPage
+	Filter []JSONAPIFilter
+
+	// OtherParams holds implementation-specific parameters, such as "camelCase"
+	OtherParams map[string][]string
+}
+
+// JSONAPIInclude is a relationship path of include, "comments.author"
+// is ["comments", "author"]
+type JSONAPIInclude struct {
+	Path   []string
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// JSONAPISortField is a sort field, "-created" sorts descending
+type JSONAPISortField struct {
+	Field  string // may be a dotted relationship path, "author.name"
+	Desc   bool
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// JSONAPIPage holds the page[...] family, unset numbers are nil
+type JSONAPIPage struct {
+	Number *int
+	Size   *int
+	Cursor string
+
+	// Other holds the remaining members, e.g. page[offset] or page[after]
+	Other map[string]string
+}
+
+// JSONAPIFilter is a member of the filter family, filter[author][name]=x
+// has Path ["author", "name"]. A bare "filter" parameter has an empty Path
+type JSONAPIFilter struct {
+	Path   []string
+	Value  string
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice // value tokens
+}
+
+// JSONAPIParser parses the JSON:API query parameter families and enforces
+// the spec's naming rules: member names in family brackets and field lists,
+// and implementation-specific names that are not all lowercase a-z
+// (those are reserved for future versions of the spec)
+type JSONAPIParser struct {
+	// StrictValidation enforces RFC3986 compliance
+	StrictValidation bool
+
+	// MaxPageSize rejects larger page[size] values, 0 means no maximum
+	MaxPageSize int
+
+	// MaxIncludeDepth bounds the length of include paths, 0 means no limit
+	MaxIncludeDepth int
+}
+
+// NewJSONAPIParser creates a parser with default settings
+func NewJSONAPIParser() *JSONAPIParser {
+	return &JSONAPIParser{
+		StrictValidation: true,
+	}
+}
+
+// Name returns the parser identifier
+func (p *JSONAPIParser) Name() string {
+	return "jsonapi"
+}
+
+// Parse implements the Parser interface
+func (p *JSONAPIParser) Parse(scanner *rfcquery.Scanner) (any, error) {
+	if p.StrictValidation {
+		if err := scanner.Valid(); err != nil {
+			return nil, fmt.Errorf("RFC3986 validation failed: %w", err)
+		}
+		scanner.Reset()
+	}
+
+	formParser := &formurlencoded.FormURLEncodedParser{}
+	result, err := formParser.Parse(scanner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query parameters: %w", err)
+	}
+
+	query := &JSONAPIQuery{
+		Fields:      make(map[string][]string),
+		OtherParams: make(map[string][]string),
+	}
+	seen := make(map[string]bool)
+
+	for _, param := range source.Params(result.(*rfcquery.Values)) {
+		key := source.New(param.KeyTokens, param.Pos.Offset)
+		base, members, err := parseFamily(key)
+		if err != nil {
+			return nil, err
+		}
+
+		// filter and implementation-specific parameters may repeat
+		if base != "filter" && isReserved(base) {
+			if seen[param.Key] {
+				return nil, rfcquery.NewError(param.Pos.Offset, "duplicate parameter %q", param.Key)
+			}
+			seen[param.Key] = true
+		}
+
+		if err := p.apply(query, param, base, members); err != nil {
+			return nil, err
+		}
+	}
+
+	return query, nil
+}
+
+// apply stores a parameter of the family base with the bracketed members
+func (p *JSONAPIParser) apply(query *JSONAPIQuery, param source.Param, base string, members []string) error {
+	value := param.Value()
+	pos := param.Pos.Offset
+
+	expectMembers := func(n int) error {
+		if len(members) != n {
+			return rfcquery.NewError(pos, "%q expects %d bracketed member(s), got %d", base, n, len(members))
+		}
+		if n > 0 && members[0] == "" {
+			return rfcquery.NewError(pos, "empty brackets in %q", param.Key)
+		}
+		return nil
+	}
+
+	var err error
+	switch base {
+	case "include":
+		if err := expectMembers(0); err != nil {
+			return err
+		}
+		query.Include, err = p.parseInclude(value)
+
+	case "fields":
+		if err := expectMembers(1); err != nil {
+			return err
+		}
+		query.Fields[members[0]], err = parseFieldList(value)
+
+	case "sort":
+		if err := expectMembers(0); err != nil {
+			return err
+		}
+		query.Sort, err = parseSort(value)
+
+	case "page":
+		if err := expectMembers(1); err != nil {
+			return err
+		}
+		err = p.applyPage(&query.Page, members[0], value)
+
+	case "filter":
+		query.Filter = append(query.Filter, JSONAPIFilter{
+			Path:   members,
+			Value:  value.Text,
+			Pos:    param.Pos,
+			Tokens: value.Tokens,
+		})
+
+	default:
+		if isReserved(base) {
+			return rfcquery.NewError(pos, "parameter %q is reserved by JSON:API, implementation-specific names need a non a-z character", base)
+		}
+		query.OtherParams[param.Key] = append(query.OtherParams[param.Key], value.Text)
+	}
+	return err
+}
+
+func (p *JSONAPIParser) parseInclude(value source.Source) ([]JSONAPIInclude, error) {
+	items := []JSONAPIInclude{}
+	if value.Text == "" {
+		return items, nil
+	}
+
+	for _, part := range split(value, ',') {
+		path, err := parsePath(part)
+		if err != nil {
+			return nil, err
+		}
+		if p.MaxIncludeDepth > 0 && len(path) > p.MaxIncludeDepth {
+			return nil, part.Errorf(0, "include path %q is deeper than %d relationships", part.Text, p.MaxIncludeDepth)
+		}
+		items = append(items, JSONAPIInclude{Path: path, Pos: part.Position(0), Tokens: part.Tokens})
+	}
+	return items, nil
+}
+
+func parseFieldList(value source.Source) ([]string, error) {
+	fields := []string{}
+	if value.Text == "" {
+		return fields, nil
+	}
+
+	for _, part := range split(value, ',') {
+		if err := checkMemberName(part); err != nil {
+			return nil, err
+		}
+		fields = append(fields, part.Text)
+	}
+	return fields, nil
+}
+
+func parseSort(value source.Source) ([]JSONAPISortField, error) {
+	if value.Text == "" {
+		return nil, value.Errorf(0, "empty sort")
+	}
+
+	var items []JSONAPISortField
+	for _, part := range split(value, ',') {
+		item := JSONAPISortField{Pos: part.Position(0), Tokens: part.Tokens}
+		field := part
+		if strings.HasPrefix(part.Text, "-") {
+			item.Desc = true
+			field = part.Slice(1, len(part.Text))
+		}
+
+		if _, err := parsePath(field); err != nil {
+			return nil, err
+		}
+		item.Field = field.Text
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (p *JSONAPIParser) applyPage(page *JSONAPIPage, member string, value source.Source) error {
+	switch member {
+	case "number", "size":
+		n, err := strconv.Atoi(value.Text)
+		if err != nil || n < 1 || strings.HasPrefix(value.Text, "+") {
+			return value.Errorf(0, "page[%s] must be a positive integer, got %q", member, value.Text)
+		}
+		if member == "number" {
+			page.Number = &n
+			return nil
+		}
+		if p.MaxPageSize > 0 && n > p.MaxPageSize {
+			return value.Errorf(0, "page[size] %d exceeds the maximum of %d", n, p.MaxPageSize)
+		}
+		page.Size = &n
+	case "cursor":
+		page.Cursor = value.Text
+	default:
+		if page.Other == nil {
+			page.Other = make(map[string]string)
+		}
+		page.Other[member] = value.Text
+	}
+	return nil
+}
+
+// parseFamily splits a parameter name such as "filter[author][name]" into
+// its base name and bracketed members. Empty brackets are kept as ""
+func parseFamily(key source.Source) (string, []string, error) {
+	open := strings.IndexByte(key.Text, '[')
+	if open < 0 {
+		open = len(key.Text)
+	}
+
+	base := key.Slice(0, open)
+	if err := checkMemberName(base); err != nil {
+		return "", nil, err
+	}
+
+	var members []string
+	for i := open; i < len(key.Text); {
+		if key.Text[i] != '[' {
+			return "", nil, key.Errorf(i, "expected '[' in parameter name")
+		}
+		end := strings.IndexByte(key.Text[i:], ']')
+		if end < 0 {
+			return "", nil, key.Errorf(len(key.Text), "missing ']' in parameter name")
+		}
+
+		member := key.Slice(i+1, i+end)
+		if member.Text != "" {
+			if err := checkMemberName(member); err != nil {
+				return "", nil, err
+			}
+		}
+		members = append(members, member.Text)
+		i += end + 1
+	}
+	return base.Text, members, nil
+}
+
+// parsePath splits a dotted relationship path into member names
+func parsePath(src source.Source) ([]string, error) {
+	var path []string
+	for _, segment := range split(src, '.') {
+		if err := checkMemberName(segment); err != nil {
+			return nil, err
+		}
+		path = append(path, segment.Text)
+	}
+	return path, nil
+}
+
+// checkMemberName enforces the member name rules: letters, digits and
+// non-ASCII characters, with '-', '_' and ' ' allowed except at the ends
+func checkMemberName(name source.Source) error {
+	if name.Text == "" {
+		return name.Errorf(0, "empty member name")
+	}
+
+	for i := 0; i < len(name.Text); {
+		r, size := utf8.DecodeRuneInString(name.Text[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			return name.Errorf(i, "invalid UTF-8 in member name")
+		case r >= 0x80, isAlphaNum(byte(r)):
+		case r == '-' || r == '_' || r == ' ':
+			if i == 0 || i+size == len(name.Text) {
+				return name.Errorf(i, "member name %q cannot start or end with %q", name.Text, r)
+			}
+		default:
+			return name.Errorf(i, "invalid character %q in member name %q", r, name.Text)
+		}
+		i += size
+	}
+	return nil
+}
+
+// isReserved reports whether a parameter name consists only of a-z,
+// the names the spec reserves for itself
+func isReserved(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < 'a' || name[i] > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphaNum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// split splits src on every sep
+func split(src source.Source, sep byte) []source.Source {
+	var parts []source.Source
+	start := 0
+	for i := 0; i < len(src.Text); i++ {
+		if src.Text[i] == sep {
+			parts = append(parts, src.Slice(start, i))
+			start = i + 1
+		}
+	}
+	return append(parts, src.Slice(start, len(src.Text)))
+}
+
+// ParseJSONAPIQuery - convenience function
+func ParseJSONAPIQuery(query string) (*JSONAPIQuery, error) {
+	scanner := rfcquery.NewScanner(query)
+	if err := scanner.Valid(); err != nil {
+		return nil, err
+	}
+
+	result, err := NewJSONAPIParser().Parse(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, ok := result.(*JSONAPIQuery)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %T", result)
+	}
+
+	return parsed, nil
+}
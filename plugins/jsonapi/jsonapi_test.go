@@ -0,0 +1,179 @@
+package jsonapi_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/plugins/jsonapi"
+)
+
+func TestParseJSONAPIQuery(t *testing.T) {
+	query := "include=author,comments.author" +
+		"&fields%5Barticles%5D=title,body&fields%5Bpeople%5D=" +
+		"&sort=-created,author.name" +
+		"&page%5Bnumber%5D=3&page%5Bsize%5D=25&page%5Boffset%5D=10" +
+		"&filter%5Bauthor%5D%5Bname%5D=Dan&filter=recent" +
+		"&camelCase=true"
+
+	q, err := jsonapi.ParseJSONAPIQuery(query)
+	if err != nil {
+		t.Fatalf("ParseJSONAPIQuery() error = %v", err)
+	}
+
+	var include [][]string
+	for _, inc := range q.Include {
+		include = append(include, inc.Path)
+	}
+	if want := [][]string{{"author"}, {"comments", "author"}}; !reflect.DeepEqual(include, want) {
+		t.Errorf("Include = %v, want %v", include, want)
+	}
+
+	wantFields := map[string][]string{"articles": {"title", "body"}, "people": {}}
+	if !reflect.DeepEqual(q.Fields, wantFields) {
+		t.Errorf("Fields = %v, want %v", q.Fields, wantFields)
+	}
+
+	if len(q.Sort) != 2 || q.Sort[0].Field != "created" || !q.Sort[0].Desc || q.Sort[1].Field != "author.name" || q.Sort[1].Desc {
+		t.Errorf("Sort = %+v", q.Sort)
+	}
+
+	if q.Page.Number == nil || *q.Page.Number != 3 || q.Page.Size == nil || *q.Page.Size != 25 || q.Page.Other["offset"] != "10" {
+		t.Errorf("Page = %+v", q.Page)
+	}
+
+	if len(q.Filter) != 2 ||
+		!reflect.DeepEqual(q.Filter[0].Path, []string{"author", "name"}) || q.Filter[0].Value != "Dan" ||
+		len(q.Filter[1].Path) != 0 || q.Filter[1].Value != "recent" {
+		t.Errorf("Filter = %+v", q.Filter)
+	}
+
+	if !reflect.DeepEqual(q.OtherParams, map[string][]string{"camelCase": {"true"}}) {
+		t.Errorf("OtherParams = %v", q.OtherParams)
+	}
+}
+
+func TestParseJSONAPIQuery_Absent(t *testing.T) {
+	q, err := jsonapi.ParseJSONAPIQuery("include=")
+	if err != nil {
+		t.Fatalf("ParseJSONAPIQuery() error = %v", err)
+	}
+	if q.Include == nil || len(q.Include) != 0 {
+		t.Errorf("Include = %#v, want empty and non-nil", q.Include)
+	}
+
+	q, err = jsonapi.ParseJSONAPIQuery("sort=title")
+	if err != nil {
+		t.Fatalf("ParseJSONAPIQuery() error = %v", err)
+	}
+	if q.Include != nil || q.Page.Number != nil || q.Filter != nil {
+		t.Errorf("absent parameters are set: %+v", q)
+	}
+}
+
+func TestParseJSONAPIQuery_Positions(t *testing.T) {
+	q, err := jsonapi.ParseJSONAPIQuery("page%5Bsize%5D=5&include=a,b.c&sort=x,-y")
+	if err != nil {
+		t.Fatalf("ParseJSONAPIQuery() error = %v", err)
+	}
+
+	if q.Include[1].Pos.Offset != 27 || q.Include[1].Tokens.String() != "b.c" {
+		t.Errorf("Include[1] at %d = %q", q.Include[1].Pos.Offset, q.Include[1].Tokens.String())
+	}
+	if q.Sort[1].Pos.Offset != 38 || q.Sort[1].Tokens.String() != "-y" {
+		t.Errorf("Sort[1] at %d = %q", q.Sort[1].Pos.Offset, q.Sort[1].Tokens.String())
+	}
+}
+
+func TestParseJSONAPIQuery_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{"reserved name", "foo=1", 0, "reserved by JSON:API"},
+		{"reserved family", "search%5Bq%5D=x", 0, "reserved by JSON:API"},
+		{"duplicate include", "include=a&include=b", 10, "duplicate parameter"},
+		{"duplicate fieldset", "fields%5Ba%5D=x&fields%5Ba%5D=y", 16, "duplicate parameter"},
+		{"fields without type", "fields=title", 0, "expects 1 bracketed member"},
+		{"include with brackets", "include%5Ba%5D=b", 0, "expects 0 bracketed member"},
+		{"empty brackets", "page%5B%5D=1", 0, "empty brackets"},
+		{"unclosed bracket", "filter%5Bname=x", 13, "missing ']'"},
+		{"text after bracket", "filter%5Ba%5Db=x", 13, "expected '['"},
+		{"bad member char", "fields%5Ba%2Bb%5D=x", 10, "invalid character '+'"},
+		{"member edge", "fields%5Barticles%5D=title,-body", 27, "cannot start or end"},
+		{"empty include segment", "include=a..b", 10, "empty member name"},
+		{"empty sort", "sort=", 5, "empty sort"},
+		{"empty sort field", "sort=a,,b", 7, "empty member name"},
+		{"bad page number", "page%5Bnumber%5D=0", 17, "positive integer"},
+		{"bad page size", "page%5Bsize%5D=ten", 15, "positive integer"},
+		{"custom name edge", "_debug=1", 0, "cannot start or end"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jsonapi.ParseJSONAPIQuery(tt.input)
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestJSONAPIParser_Limits(t *testing.T) {
+	parser := jsonapi.NewJSONAPIParser()
+	parser.MaxPageSize = 100
+	parser.MaxIncludeDepth = 2
+
+	if _, err := parser.Parse(rfcquery.NewScanner("page%5Bsize%5D=101")); err == nil {
+		t.Errorf("page[size] above MaxPageSize accepted")
+	}
+	if _, err := parser.Parse(rfcquery.NewScanner("include=a.b.c")); err == nil {
+		t.Errorf("include deeper than MaxIncludeDepth accepted")
+	}
+	if _, err := parser.Parse(rfcquery.NewScanner("page%5Bsize%5D=100&include=a.b")); err != nil {
+		t.Errorf("Parse() error = %v", err)
+	}
+}
+
+func FuzzJSONAPIParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		"include=author,comments.author&sort=-created",
+		"fields%5Barticles%5D=title,body&page%5Bsize%5D=10",
+		"filter%5Ba%5D%5B%5D=1&filter=x&camelCase=1",
+		"fields%5Bcaf%C3%A9%5D=na%C3%AFve",
+		"page%5Bcursor%5D=abc&page%5Bafter%5D=x",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		q, err := jsonapi.ParseJSONAPIQuery(input)
+		if err != nil {
+			return
+		}
+
+		for _, inc := range q.Include {
+			if inc.Tokens.StringDecoded() != strings.Join(inc.Path, ".") {
+				t.Fatalf("include %v does not match its tokens %q", inc.Path, inc.Tokens.StringDecoded())
+			}
+		}
+		for _, s := range q.Sort {
+			want := s.Field
+			if s.Desc {
+				want = "-" + want
+			}
+			if s.Tokens.StringDecoded() != want || input[s.Pos.Offset:s.Pos.Offset+s.Tokens.Span()] != s.Tokens.String() {
+				t.Fatalf("sort field %q at %d does not match its tokens %q", want, s.Pos.Offset, s.Tokens.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package lucene
+
+import (
+	"fmt"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+// LuceneParser parses the Lucene / Elasticsearch query_string syntax held
+// by one parameter. Spaces must be percent-encoded as %20, '+' is the
+// required-clause modifier
+type LuceneParser struct {
+	// TargetParam is the parameter holding the query, "q" by default
+	TargetParam string
+
+	// DefaultOperator joins juxtaposed clauses, "OR" or "AND".
+	// Empty means "OR", as in Lucene and Elasticsearch
+	DefaultOperator string
+
+	// StrictValidation enforces RFC3986 compliance
+	StrictValidation bool
+}
+
+// NewLuceneParser creates a parser reading the "q" parameter
+func NewLuceneParser() *LuceneParser {
+	return &LuceneParser{
+		TargetParam:      "q",
+		DefaultOperator:  "OR",
+		StrictValidation: true,
+	}
+}
+
+// Name returns the parser identifier
+func (p *LuceneParser) Name() string {
+	return "lucene"
+}
+
+// Parse implements the Parser interface, the result is a *LuceneNode,
+// nil when the query is blank
+func (p *LuceneParser) Parse(scanner *rfcquery.Scanner) (any, error) {
+	defaultKind := LuceneOr
+	switch p.DefaultOperator {
+	case "", "OR":
+	case "AND":
+		defaultKind = LuceneAnd
+	default:
+		return nil, fmt.Errorf("invalid default operator %q, expected OR or AND", p.DefaultOperator)
+	}
+
+	if p.StrictValidation {
+		if err := scanner.Valid(); err != nil {
+			return nil, fmt.Errorf("RFC3986 validation failed: %w", err)
+		}
+		scanner.Reset()
+	}
+
+	formParser := &formurlencoded.FormURLEncodedParser{}
+	result, err := formParser.Parse(scanner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query parameters: %w", err)
+	}
+
+	target := p.TargetParam
+	if target == "" {
+		target = "q"
+	}
+
+	param, err := source.Single(source.Params(result.(*rfcquery.Values)), target, "lucene")
+	if err != nil {
+		return nil, err
+	}
+	return parseQuery(param.Value(), defaultKind)
+}
+
+// ParseLucene - convenience function, the query is read from "q"
+func ParseLucene(query string) (*LuceneNode, error) {
+	scanner := rfcquery.NewScanner(query)
+	if err := scanner.Valid(); err != nil {
+		return nil, err
+	}
+
+	result, err := NewLuceneParser().Parse(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	node, ok := result.(*LuceneNode)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %T", result)
+	}
+
+	return node, nil
+}
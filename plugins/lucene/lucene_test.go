@@ -0,0 +1,192 @@
+package lucene_test
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/plugins/lucene"
+)
+
+func TestLuceneParser_Parse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"term", "q=quick", "quick"},
+		{"implicit or", "q=quick%20brown%20fox", "quick OR brown OR fox"},
+		{"field group", "q=title%3A%28quick%20OR%20brown%29", "title:(quick OR brown)"},
+		{"request example", "q=title%3A%28quick%20OR%20brown%29%20AND%20date%3A%5B2020-01-01%20TO%20%2A%5D%20-status%3Adraft", "title:(quick OR brown) AND date:[2020-01-01 TO *] OR -status:draft"},
+		{"precedence", "q=a%20OR%20b%20AND%20NOT%20c", "a OR b AND NOT c"},
+		{"symbols", "q=a%20%7C%7C%20b%20%26%26%20%21c", "a OR b AND NOT c"},
+		{"modifiers", "q=%2Brequired%20-excluded%20optional", "+required OR -excluded OR optional"},
+		{"phrase slop", "q=%22quick%20fox%22~5", `"quick fox"~5`},
+		{"fuzzy", "q=roam~%20foam~1", "roam~2 OR foam~1"},
+		{"boost", "q=title%3Aquick%5E2%20%28a%20b%29%5E0.5", "title:quick^2 OR (a OR b)^0.5"},
+		{"wildcard", "q=qu%3Fck%20bro%2A", "qu?ck OR bro*"},
+		{"escaped wildcard", "q=a%5C%2Ab", `a\*b`},
+		{"escaped wildcard kept", "q=a%5C%2Ab%2A", `a\*b*`},
+		{"exclusive range", "q=count%3A%7B1%20TO%205%5D", "count:{1 TO 5]"},
+		{"quoted bounds", "q=name%3A%5B%22a%20b%22%20TO%20%22c%22%5D", `name:["a b" TO c]`},
+		{"comparison", "q=age%3A%3E%3D10%20age%3A%3C5%20age%3A%3C%3D7", "age:[10 TO *} OR age:{* TO 5} OR age:{* TO 7]"},
+		{"regexp", "q=name%3A%2Fjo%3Fh.n%2F", "name:/jo?h.n/"},
+		{"match all", "q=%2A%3A%2A", "*:*"},
+		{"escaped colon", "q=url%3Ahttp%5C%3A%5C%2F%5C%2Fx", `url:http\:\/\/x`},
+		{"escaped keyword", "q=%5CAND%20%5C-a", `\AND OR \-a`},
+		{"hyphenated term", "q=wi-fi", "wi-fi"},
+		{"exists", "q=_exists_%3Atitle", "_exists_:title"},
+		{"nested groups", "q=%28%28a%29%29", "((a))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := lucene.ParseLucene(tt.query)
+			if err != nil {
+				t.Fatalf("ParseLucene() error = %v", err)
+			}
+			if got := node.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLuceneParser_Options(t *testing.T) {
+	parser := lucene.NewLuceneParser()
+	parser.TargetParam = "query"
+	parser.DefaultOperator = "AND"
+
+	result, err := parser.Parse(rfcquery.NewScanner("page=2&query=a%20b%20OR%20c"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := result.(*lucene.LuceneNode).String(); got != "a AND (b OR c)" {
+		t.Errorf("got %s", got)
+	}
+
+	node, err := lucene.ParseLucene("q=%20%20")
+	if err != nil || node != nil {
+		t.Errorf("blank query = %v, %v, want nil", node, err)
+	}
+
+	parser.DefaultOperator = "XOR"
+	if _, err := parser.Parse(rfcquery.NewScanner("query=a")); err == nil {
+		t.Error("expected an error for an invalid default operator")
+	}
+}
+
+func TestLuceneParser_Positions(t *testing.T) {
+	const (
+		clause = "q=a%20AND%20-b:c~"
+		group  = "q=title:(x%20OR%20y)%5E2"
+		not    = "q=NOT%20!a"
+	)
+
+	tests := []struct {
+		name       string
+		input      string
+		node       func(n *lucene.LuceneNode) *lucene.LuceneNode
+		wantPos    int
+		wantTokens string
+	}{
+		{"and", clause, func(n *lucene.LuceneNode) *lucene.LuceneNode { return n }, 2, "a%20AND%20-b:c~"},
+		{"term", clause, func(n *lucene.LuceneNode) *lucene.LuceneNode { return n.Children[0] }, 2, "a"},
+		{"clause", clause, func(n *lucene.LuceneNode) *lucene.LuceneNode { return n.Children[1] }, 12, "-b:c~"},
+		{"group", group, func(n *lucene.LuceneNode) *lucene.LuceneNode { return n }, 2, "title:(x%20OR%20y)%5E2"},
+		{"grouped query", group, func(n *lucene.LuceneNode) *lucene.LuceneNode { return n.Children[0] }, 9, "x%20OR%20y"},
+		{"grouped term", group, func(n *lucene.LuceneNode) *lucene.LuceneNode { return n.Children[0].Children[1] }, 18, "y"},
+		{"not", not, func(n *lucene.LuceneNode) *lucene.LuceneNode { return n }, 2, "NOT%20!a"},
+		{"nested not", not, func(n *lucene.LuceneNode) *lucene.LuceneNode { return n.Children[0] }, 8, "!a"},
+		{"negated term", not, func(n *lucene.LuceneNode) *lucene.LuceneNode { return n.Children[0].Children[0] }, 9, "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := lucene.ParseLucene(tt.input)
+			if err != nil {
+				t.Fatalf("ParseLucene() error = %v", err)
+			}
+			node := tt.node(root)
+			if node.Pos.Offset != tt.wantPos || node.Tokens.String() != tt.wantTokens {
+				t.Errorf("node at %d with tokens %q, want %d with %q", node.Pos.Offset, node.Tokens.String(), tt.wantPos, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestLuceneParser_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{"dangling and", "q=a%20AND", 6, "unexpected AND"},
+		{"leading or", "q=OR%20a", 2, "unexpected OR"},
+		{"unclosed group", "q=%28a%20b", 10, "expected ')'"},
+		{"empty group", "q=a%3A%28%29", 9, "empty group"},
+		{"missing to", "q=%5B1%205%5D", 6, "expected TO"},
+		{"unclosed range", "q=%5B1%20TO%205", 15, "expected ']' or '}'"},
+		{"unterminated phrase", "q=%22ab", 2, "unterminated phrase"},
+		{"unterminated regexp", "q=%2Fab", 2, "unterminated regular expression"},
+		{"bad boost", "q=a%5Ex", 6, "invalid boost"},
+		{"bad fuzziness", "q=a~0.8", 4, "invalid fuzziness"},
+		{"dangling escape", `q=a%5C`, 3, "dangling escape"},
+		{"missing term", "q=title%3A", 10, "expected a term"},
+		{"stray paren", "q=a%29", 3, `unexpected ')'`},
+		{"missing param", "x=1", -1, `"q" not found`},
+		{"repeated param", "q=a&q=b", 4, "multiple values"},
+		{"too deep", "q=" + strings.Repeat("(", 150) + "a" + strings.Repeat(")", 150), 102, "nested deeper"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := lucene.ParseLucene(tt.input)
+			if tt.wantPos < 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantMsg) {
+					t.Errorf("got %v, want %q", err, tt.wantMsg)
+				}
+				return
+			}
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func FuzzLuceneParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		"q=title%3A%28quick%20OR%20brown%29%20AND%20date%3A%5B2020-01-01%20TO%20%2A%5D%20-status%3Adraft",
+		"q=%2Ba%20-b%20%22c%20d%22~2%20e~1%5E3%20%2Fre.ex%2F%20f%3A%3E%3D10%20NOT%20g%20%26%26%20h%20%7C%7C%20%21i",
+		"q=a%5C%2Ab%2A%20%2A%3A%2A%20url%3Ahttp%5C%3A%5C%2F%5C%2Fx",
+		"q=" + strings.Repeat("(", 50),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		node, err := lucene.ParseLucene(input)
+		if err != nil || node == nil {
+			return
+		}
+
+		// rendered queries parse back to the same query
+		rendered := node.String()
+		again, err := lucene.ParseLucene("q=" + strings.ReplaceAll(url.QueryEscape(rendered), "+", "%20"))
+		if err != nil {
+			t.Fatalf("ParseLucene() of rendered query %q error = %v", rendered, err)
+		}
+		if got := again.String(); got != rendered {
+			t.Fatalf("rendered query %q renders again as %q", rendered, got)
+		}
+	})
+}
@@ -0,0 +1,716 @@
+package lucene
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+)
+
+// LuceneNodeKind is the kind of a node of a query_string AST
+type LuceneNodeKind int
+
+const (
+	LuceneOr     LuceneNodeKind = iota // any of Children, OR, || or juxtaposition by default
+	LuceneAnd                          // all Children, AND or &&
+	LuceneNot                          // NOT Children[0], also written !Children[0]
+	LuceneGroup                        // parenthesized Children[0], "title:(quick OR brown)"
+	LuceneTerm                         // single term Value, possibly with wildcards or fuzziness
+	LucenePhrase                       // quoted Value, possibly with a slop
+	LuceneRange                        // Lower TO Upper, or a comparison such as >=10
+	LuceneRegexp                       // /Value/
+)
+
+func (k LuceneNodeKind) String() string {
+	switch k {
+	case LuceneOr:
+		return "or"
+	case LuceneAnd:
+		return "and"
+	case LuceneNot:
+		return "not"
+	case LuceneGroup:
+		return "group"
+	case LuceneTerm:
+		return "term"
+	case LucenePhrase:
+		return "phrase"
+	case LuceneRange:
+		return "range"
+	case LuceneRegexp:
+		return "regexp"
+	default:
+		return "invalid"
+	}
+}
+
+// LuceneModifier is the occurrence prefix of a clause
+type LuceneModifier int
+
+const (
+	LuceneShould  LuceneModifier = iota // no prefix
+	LuceneMust                          // "+"
+	LuceneMustNot                       // "-"
+)
+
+// LuceneNode is a node of a query_string query.
+//
+// The grammar, where NOT binds tighter than AND, AND tighter than OR, and
+// juxtaposed clauses are joined by the parser's DefaultOperator:
+//
+//	query   = or *( WS or )
+//	or      = and *( WS ( "OR" / "||" ) WS and )
+//	and     = not *( WS ( "AND" / "&&" ) WS not )
+//	not     = ( "NOT" WS / "!" ) not / clause
+//	clause  = [ "+" / "-" ] [ term ":" ] ( "(" query ")" / atom ) [ "^" boost ]
+//	atom    = term [ "~" [ distance ] ] / phrase [ "~" slop ] / range / regexp
+//	range   = ( "[" / "{" ) bound WS "TO" WS bound ( "]" / "}" ) / ( ">" / ">=" / "<" / "<=" ) bound
+//	phrase  = DQUOTE *char DQUOTE
+//	regexp  = "/" *char "/"
+type LuceneNode struct {
+	Kind     LuceneNodeKind
+	Modifier LuceneModifier
+
+	// Field is the "field:" prefix of a clause, empty for the default field
+	Field string
+
+	Children []*LuceneNode
+
+	// Value is the unescaped text of terms and phrases, and the pattern of
+	// regexps. Wildcard terms keep their backslash escapes, so that a
+	// literal "\*" stays distinguishable from the "*" wildcard
+	Value    string
+	Wildcard bool
+
+	// Fuzzy is set by "~": Distance is then the edit distance of a term,
+	// 2 when omitted, or the slop of a phrase
+	Fuzzy    bool
+	Distance int
+
+	// Boost is nil unless the clause has a "^" suffix
+	Boost *float64
+
+	// Lower and Upper bound ranges, "*" is unbounded
+	Lower        string
+	Upper        string
+	IncludeLower bool
+	IncludeUpper bool
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// String renders the node with explicit AND and OR operators, ranges in
+// bracket form and only the parentheses its precedence requires
+func (n *LuceneNode) String() string {
+	switch n.Kind {
+	case LuceneOr, LuceneAnd:
+		children := make([]string, len(n.Children))
+		for i, child := range n.Children {
+			children[i] = child.operand(n.precedence() + 1)
+		}
+		return strings.Join(children, " "+strings.ToUpper(n.Kind.String())+" ")
+	case LuceneNot:
+		return "NOT " + n.Children[0].operand(3)
+	}
+
+	var sb strings.Builder
+	switch n.Modifier {
+	case LuceneMust:
+		sb.WriteByte('+')
+	case LuceneMustNot:
+		sb.WriteByte('-')
+	}
+	if n.Field != "" {
+		sb.WriteString(escapeTerm(n.Field, termStop+`\`) + ":")
+	}
+
+	switch n.Kind {
+	case LuceneGroup:
+		sb.WriteString("(" + n.Children[0].String() + ")")
+	case LuceneTerm:
+		if n.Wildcard {
+			sb.WriteString(n.Value)
+		} else {
+			sb.WriteString(escapeTerm(n.Value, termStop+`\*?`))
+		}
+		if n.Fuzzy {
+			sb.WriteString("~" + strconv.Itoa(n.Distance))
+		}
+	case LucenePhrase:
+		sb.WriteString(quoteTerm(n.Value))
+		if n.Fuzzy {
+			sb.WriteString("~" + strconv.Itoa(n.Distance))
+		}
+	case LuceneRange:
+		open, close := "{", "}"
+		if n.IncludeLower {
+			open = "["
+		}
+		if n.IncludeUpper {
+			close = "]"
+		}
+		sb.WriteString(open + rangeBound(n.Lower) + " TO " + rangeBound(n.Upper) + close)
+	case LuceneRegexp:
+		sb.WriteString("/" + n.Value + "/")
+	}
+
+	if n.Boost != nil {
+		sb.WriteString("^" + strconv.FormatFloat(*n.Boost, 'f', -1, 64))
+	}
+	return sb.String()
+}
+
+// precedence ranks the node from OR (1) to the clauses (4)
+func (n *LuceneNode) precedence() int {
+	switch n.Kind {
+	case LuceneOr:
+		return 1
+	case LuceneAnd:
+		return 2
+	case LuceneNot:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// operand renders n, parenthesized when it binds looser than min
+func (n *LuceneNode) operand(min int) string {
+	if n.precedence() < min {
+		return "(" + n.String() + ")"
+	}
+	return n.String()
+}
+
+// escapeTerm escapes the bytes of special, and what would read as an
+// operator or a clause prefix
+func escapeTerm(s, special string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if strings.IndexByte(special, c) >= 0 || i == 0 && strings.IndexByte("+-<>", c) >= 0 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+
+	switch s {
+	case "AND", "OR", "NOT", "&&", "||":
+		return `\` + s
+	}
+	return sb.String()
+}
+
+func quoteTerm(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// rangeBound quotes the bounds that would not read back unquoted
+func rangeBound(bound string) string {
+	if bound == "*" || bound != "" && bound != "TO" && !strings.ContainsAny(bound, ` ]}"\`) {
+		return bound
+	}
+	return quoteTerm(bound)
+}
+
+// maxQueryDepth bounds the recursion of the query parser
+const maxQueryDepth = 100
+
+// termStop are the bytes ending an unescaped term
+const termStop = " ()[]{}^\"~:/!"
+
+// defaultFuzziness is the edit distance of a bare "~"
+const defaultFuzziness = 2
+
+// queryParser works on the decoded parameter value, positions are mapped
+// back to the original query through the source tokens
+type queryParser struct {
+	src         source.Source
+	pos         int
+	depth       int
+	defaultKind LuceneNodeKind
+}
+
+func parseQuery(src source.Source, defaultKind LuceneNodeKind) (*LuceneNode, error) {
+	qp := &queryParser{src: src, defaultKind: defaultKind}
+
+	qp.skipSpaces()
+	if qp.eof() {
+		return nil, nil
+	}
+
+	node, err := qp.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	qp.skipSpaces()
+	if !qp.eof() {
+		return nil, qp.errorf("unexpected %q in query", qp.src.Text[qp.pos])
+	}
+	return node, nil
+}
+
+func (qp *queryParser) eof() bool {
+	return qp.pos >= len(qp.src.Text)
+}
+
+func (qp *queryParser) peek() byte {
+	if qp.eof() {
+		return 0
+	}
+	return qp.src.Text[qp.pos]
+}
+
+func (qp *queryParser) errorf(format string, args ...any) error {
+	return qp.src.Errorf(qp.pos, format, args...)
+}
+
+func (qp *queryParser) skipSpaces() {
+	for !qp.eof() && qp.src.Text[qp.pos] == ' ' {
+		qp.pos++
+	}
+}
+
+// node fills the position and tokens of a node that started at start
+func (qp *queryParser) node(n *LuceneNode, start int) *LuceneNode {
+	n.Pos = qp.src.Position(start)
+	n.Tokens = qp.src.Tokens[start:qp.pos]
+	return n
+}
+
+// keywordAt returns the operator among words starting at i and followed
+// by a space or a parenthesis, or ""
+func (qp *queryParser) keywordAt(i int, words ...string) string {
+	rest := qp.src.Text[i:]
+	for _, word := range words {
+		if strings.HasPrefix(rest, word) && len(rest) > len(word) && (rest[len(word)] == ' ' || rest[len(word)] == '(') {
+			return word
+		}
+	}
+	return ""
+}
+
+// binaryOp consumes " word " after an operand
+func (qp *queryParser) binaryOp(words ...string) bool {
+	save := qp.pos
+	if qp.peek() != ' ' {
+		return false
+	}
+	qp.skipSpaces()
+	if word := qp.keywordAt(qp.pos, words...); word != "" {
+		qp.pos += len(word)
+		qp.skipSpaces()
+		return true
+	}
+	qp.pos = save
+	return false
+}
+
+func (qp *queryParser) enter() error {
+	qp.depth++
+	if qp.depth > maxQueryDepth {
+		return qp.errorf("query nested deeper than %d levels", maxQueryDepth)
+	}
+	return nil
+}
+
+// nary collects operands joined by next into a node of kind, a single
+// operand is returned as is
+func (qp *queryParser) nary(kind LuceneNodeKind, operand func() (*LuceneNode, error), next func() bool) (*LuceneNode, error) {
+	start := qp.pos
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	if !next() {
+		return first, nil
+	}
+
+	children := flatten(nil, kind, first)
+	for ok := true; ok; ok = next() {
+		child, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		children = flatten(children, kind, child)
+	}
+	return qp.node(&LuceneNode{Kind: kind, Children: children}, start), nil
+}
+
+// flatten appends n to children, or its children when it has the same
+// kind: "a OR b OR c" is a single OR of three clauses
+func flatten(children []*LuceneNode, kind LuceneNodeKind, n *LuceneNode) []*LuceneNode {
+	if n.Kind == kind {
+		return append(children, n.Children...)
+	}
+	return append(children, n)
+}
+
+func (qp *queryParser) parseQuery() (*LuceneNode, error) {
+	if err := qp.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { qp.depth-- }()
+
+	return qp.nary(qp.defaultKind, qp.parseOr, func() bool {
+		save := qp.pos
+		if qp.peek() != ' ' {
+			return false
+		}
+		qp.skipSpaces()
+		if qp.eof() || qp.peek() == ')' {
+			qp.pos = save
+			return false
+		}
+		return true
+	})
+}
+
+func (qp *queryParser) parseOr() (*LuceneNode, error) {
+	return qp.nary(LuceneOr, qp.parseAnd, func() bool { return qp.binaryOp("OR", "||") })
+}
+
+func (qp *queryParser) parseAnd() (*LuceneNode, error) {
+	return qp.nary(LuceneAnd, qp.parseNot, func() bool { return qp.binaryOp("AND", "&&") })
+}
+
+func (qp *queryParser) parseNot() (*LuceneNode, error) {
+	start := qp.pos
+
+	switch {
+	case qp.keywordAt(qp.pos, "NOT") != "":
+		qp.pos += len("NOT")
+		qp.skipSpaces()
+	case qp.peek() == '!' && qp.pos+1 < len(qp.src.Text) && qp.src.Text[qp.pos+1] != ' ':
+		qp.pos++
+	default:
+		return qp.parseClause()
+	}
+
+	if err := qp.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { qp.depth-- }()
+
+	operand, err := qp.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return qp.node(&LuceneNode{Kind: LuceneNot, Children: []*LuceneNode{operand}}, start), nil
+}
+
+func (qp *queryParser) parseClause() (*LuceneNode, error) {
+	start := qp.pos
+
+	modifier := LuceneShould
+	switch qp.peek() {
+	case '+':
+		modifier = LuceneMust
+		qp.pos++
+	case '-':
+		modifier = LuceneMustNot
+		qp.pos++
+	}
+
+	field, err := qp.parseField()
+	if err != nil {
+		return nil, err
+	}
+
+	var n *LuceneNode
+	switch c := qp.peek(); {
+	case c == '(':
+		n, err = qp.parseGroup()
+	case c == '"':
+		n, err = qp.parsePhrase()
+	case c == '[' || c == '{':
+		n, err = qp.parseRange()
+	case c == '/':
+		n, err = qp.parseRegexp()
+	case (c == '>' || c == '<') && field != "":
+		n, err = qp.parseComparison()
+	default:
+		n, err = qp.parseTerm()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if qp.peek() == '^' {
+		qp.pos++
+		boost, err := qp.parseNumber("boost")
+		if err != nil {
+			return nil, err
+		}
+		n.Boost = &boost
+	}
+
+	n.Modifier = modifier
+	n.Field = field
+	return qp.node(n, start), nil
+}
+
+// parseField consumes a "field:" prefix, it returns "" when there is none
+func (qp *queryParser) parseField() (string, error) {
+	save := qp.pos
+	if strings.IndexByte(termStop, qp.peek()) >= 0 {
+		return "", nil
+	}
+
+	field, _, err := qp.readTerm()
+	if err != nil || qp.peek() != ':' {
+		qp.pos = save
+		return "", nil
+	}
+	qp.pos++
+	return field, nil
+}
+
+func (qp *queryParser) parseGroup() (*LuceneNode, error) {
+	qp.pos++
+	qp.skipSpaces()
+	if qp.peek() == ')' {
+		return nil, qp.errorf("empty group")
+	}
+
+	query, err := qp.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	qp.skipSpaces()
+	if qp.peek() != ')' {
+		return nil, qp.errorf("expected ')'")
+	}
+	qp.pos++
+	return &LuceneNode{Kind: LuceneGroup, Children: []*LuceneNode{query}}, nil
+}
+
+func (qp *queryParser) parsePhrase() (*LuceneNode, error) {
+	value, err := qp.readQuoted()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &LuceneNode{Kind: LucenePhrase, Value: value}
+	if qp.peek() == '~' {
+		qp.pos++
+		n.Fuzzy = true
+		if isDigit(qp.peek()) {
+			n.Distance, err = qp.parseInt("slop")
+		}
+	}
+	return n, err
+}
+
+func (qp *queryParser) parseTerm() (*LuceneNode, error) {
+	start := qp.pos
+	value, wildcard, err := qp.readTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	switch raw := qp.src.Text[start:qp.pos]; raw {
+	case "AND", "OR", "NOT", "&&", "||":
+		qp.pos = start
+		return nil, qp.errorf("unexpected %s, expected a term", raw)
+	default:
+		if wildcard {
+			value = raw
+		}
+	}
+
+	n := &LuceneNode{Kind: LuceneTerm, Value: value, Wildcard: wildcard}
+	if qp.peek() == '~' {
+		qp.pos++
+		n.Fuzzy = true
+		n.Distance = defaultFuzziness
+		if isDigit(qp.peek()) {
+			n.Distance, err = qp.parseInt("fuzziness")
+		}
+	}
+	return n, err
+}
+
+func (qp *queryParser) parseRange() (*LuceneNode, error) {
+	n := &LuceneNode{Kind: LuceneRange, IncludeLower: qp.peek() == '['}
+	qp.pos++
+	qp.skipSpaces()
+
+	var err error
+	if n.Lower, err = qp.parseBound(); err != nil {
+		return nil, err
+	}
+	if !qp.binaryOp("TO") {
+		return nil, qp.errorf("expected TO in range")
+	}
+	if n.Upper, err = qp.parseBound(); err != nil {
+		return nil, err
+	}
+	qp.skipSpaces()
+
+	switch qp.peek() {
+	case ']':
+		n.IncludeUpper = true
+	case '}':
+	default:
+		return nil, qp.errorf("expected ']' or '}' closing the range")
+	}
+	qp.pos++
+	return n, nil
+}
+
+// parseComparison parses the ">=10" shorthand for ranges
+func (qp *queryParser) parseComparison() (*LuceneNode, error) {
+	op := qp.src.Text[qp.pos : qp.pos+1]
+	qp.pos++
+	if qp.peek() == '=' {
+		op += "="
+		qp.pos++
+	}
+
+	var bound string
+	var err error
+	if qp.peek() == '"' {
+		bound, err = qp.readQuoted()
+	} else {
+		bound, _, err = qp.readTerm()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n := &LuceneNode{Kind: LuceneRange, Lower: "*", Upper: "*"}
+	if op[0] == '>' {
+		n.Lower, n.IncludeLower = bound, op == ">="
+	} else {
+		n.Upper, n.IncludeUpper = bound, op == "<="
+	}
+	return n, nil
+}
+
+// parseBound reads a quoted or unquoted range bound
+func (qp *queryParser) parseBound() (string, error) {
+	if qp.peek() == '"' {
+		return qp.readQuoted()
+	}
+
+	var sb strings.Builder
+	start := qp.pos
+	for !qp.eof() && strings.IndexByte(" ]}", qp.peek()) < 0 {
+		c := qp.src.Text[qp.pos]
+		if c == '\\' && qp.pos+1 < len(qp.src.Text) {
+			qp.pos++
+			c = qp.src.Text[qp.pos]
+		}
+		sb.WriteByte(c)
+		qp.pos++
+	}
+	if qp.pos == start {
+		return "", qp.errorf("expected a range bound")
+	}
+	return sb.String(), nil
+}
+
+func (qp *queryParser) parseRegexp() (*LuceneNode, error) {
+	start := qp.pos
+	for qp.pos++; !qp.eof(); qp.pos++ {
+		switch qp.src.Text[qp.pos] {
+		case '\\':
+			qp.pos++
+		case '/':
+			qp.pos++
+			return &LuceneNode{Kind: LuceneRegexp, Value: qp.src.Text[start+1 : qp.pos-1]}, nil
+		}
+	}
+	qp.pos = start
+	return nil, qp.errorf("unterminated regular expression")
+}
+
+// readTerm reads an unquoted term, unescaping it. It reports whether the
+// term holds an unescaped wildcard
+func (qp *queryParser) readTerm() (string, bool, error) {
+	var sb strings.Builder
+	wildcard := false
+
+	start := qp.pos
+	for !qp.eof() {
+		c := qp.src.Text[qp.pos]
+		if strings.IndexByte(termStop, c) >= 0 {
+			break
+		}
+		if c == '\\' {
+			if qp.pos+1 == len(qp.src.Text) {
+				return "", false, qp.errorf("dangling escape")
+			}
+			qp.pos++
+			c = qp.src.Text[qp.pos]
+		} else if c == '*' || c == '?' {
+			wildcard = true
+		}
+		sb.WriteByte(c)
+		qp.pos++
+	}
+
+	if qp.pos == start {
+		if qp.eof() {
+			return "", false, qp.errorf("expected a term")
+		}
+		return "", false, qp.errorf("unexpected %q, expected a term", qp.src.Text[qp.pos])
+	}
+	return sb.String(), wildcard, nil
+}
+
+// readQuoted reads a double-quoted string, unescaping it
+func (qp *queryParser) readQuoted() (string, error) {
+	start := qp.pos
+	var sb strings.Builder
+	for qp.pos++; !qp.eof(); qp.pos++ {
+		c := qp.src.Text[qp.pos]
+		switch {
+		case c == '"':
+			qp.pos++
+			return sb.String(), nil
+		case c == '\\' && qp.pos+1 < len(qp.src.Text):
+			qp.pos++
+			sb.WriteByte(qp.src.Text[qp.pos])
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	qp.pos = start
+	return "", qp.errorf("unterminated phrase")
+}
+
+func (qp *queryParser) parseInt(what string) (int, error) {
+	start := qp.pos
+	for isDigit(qp.peek()) {
+		qp.pos++
+	}
+	n, err := strconv.Atoi(qp.src.Text[start:qp.pos])
+	if err != nil || qp.peek() == '.' {
+		qp.pos = start
+		return 0, qp.errorf("invalid %s, expected an integer", what)
+	}
+	return n, nil
+}
+
+func (qp *queryParser) parseNumber(what string) (float64, error) {
+	start := qp.pos
+	for isDigit(qp.peek()) || qp.peek() == '.' {
+		qp.pos++
+	}
+	n, err := strconv.ParseFloat(qp.src.Text[start:qp.pos], 64)
+	if err != nil {
+		qp.pos = start
+		return 0, qp.errorf("invalid %s, expected a number", what)
+	}
+	return n, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
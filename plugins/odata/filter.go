@@ -0,0 +1,825 @@
+package odata
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+)
+
+// ODataExprKind is the kind of a node of a $filter or $orderby expression
+type ODataExprKind int
+
+const (
+	ODataBinary  ODataExprKind = iota // Left Op Right, Op is "and", "or", "eq", "add", "in", ...
+	ODataUnary                        // Op Left, Op is "not" or "-"
+	ODataLiteral                      // Value of LiteralType
+	ODataMember                       // Name is a member path such as "Address/City" or "$it"
+	ODataCall                         // Name(Args...)
+	ODataList                         // (Args...), the right operand of "in"
+	ODataLambda                       // Left/Name(Var: Right), Name is "any" or "all"
+)
+
+func (k ODataExprKind) String() string {
+	switch k {
+	case ODataBinary:
+		return "binary"
+	case ODataUnary:
+		return "unary"
+	case ODataLiteral:
+		return "literal"
+	case ODataMember:
+		return "member"
+	case ODataCall:
+		return "call"
+	case ODataList:
+		return "list"
+	case ODataLambda:
+		return "lambda"
+	default:
+		return "invalid"
+	}
+}
+
+// ODataExpr is a node of a $filter or $orderby expression.
+//
+// The supported grammar, a subset of the OData v4 ABNF:
+//
+//	or-expr    = and-expr *( " or " and-expr )
+//	and-expr   = not-expr *( " and " not-expr )
+//	not-expr   = "not " not-expr / compare
+//	compare    = additive [ ( " eq " / " ne " / " gt " / " ge " / " lt " / " le " / " has " ) additive
+//	                      / " in " ( list / primary ) ]
+//	additive   = multiplic *( ( " add " / " sub " ) multiplic )
+//	multiplic  = unary *( ( " mul " / " div " / " divby " / " mod " ) unary )
+//	unary      = "-" unary / primary
+//	primary    = "(" or-expr ")" / literal / function "(" [ or-expr *( "," or-expr ) ] ")"
+//	           / member *( "/" member ) [ "/" ( "any" / "all" ) "(" [ var ":" or-expr ] ")" ]
+//	literal    = string / number / date / date-time / guid / "true" / "false" / "null"
+//	           / "INF" / "NaN" / type-name string
+type ODataExpr struct {
+	Kind ODataExprKind
+
+	Op    string
+	Left  *ODataExpr
+	Right *ODataExpr
+
+	// Name is the member path, the function name or the lambda operator
+	Name string
+
+	// Var is the lambda variable, "" for an argument-less any()
+	Var string
+
+	// Args are the function arguments or the list items
+	Args []*ODataExpr
+
+	// Value is the literal value: string, int64, float64, bool, nil or time.Time.
+	// LiteralType is "string", "int", "decimal", "bool", "null", "date",
+	// "datetimeoffset", "guid" or the type name of a typed literal
+	// such as duration'P1D' or an enum value NS.Color'Red'
+	Value       any
+	LiteralType string
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// String renders the expression in the syntax it was parsed from, with
+// only the parentheses its precedence requires
+func (e *ODataExpr) String() string {
+	switch e.Kind {
+	case ODataBinary:
+		// comparisons do not chain, their operands are additive
+		left, right := e.precedence(), e.precedence()+1
+		if left == 4 {
+			left = 5
+		}
+		return e.Left.operand(left) + " " + e.Op + " " + e.Right.operand(right)
+	case ODataUnary:
+		if e.Op == "not" {
+			return "not " + e.Left.operand(3)
+		}
+		// "-5" and "-INF" would read as a single literal
+		s := e.Left.operand(7)
+		if s[0] >= '0' && s[0] <= '9' || strings.HasPrefix(s, "INF") {
+			s = "(" + s + ")"
+		}
+		return "-" + s
+	case ODataLiteral:
+		return e.literal()
+	case ODataMember:
+		return e.Name
+	case ODataCall, ODataList:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = arg.String()
+		}
+		return e.Name + "(" + strings.Join(args, ",") + ")"
+	case ODataLambda:
+		if e.Right == nil {
+			return e.Left.String() + "/" + e.Name + "()"
+		}
+		return e.Left.String() + "/" + e.Name + "(" + e.Var + ":" + e.Right.String() + ")"
+	default:
+		return "?"
+	}
+}
+
+// precedence ranks the node from "or" (1) to the primary expressions (8)
+func (e *ODataExpr) precedence() int {
+	switch e.Kind {
+	case ODataBinary:
+		switch e.Op {
+		case "or":
+			return 1
+		case "and":
+			return 2
+		case "add", "sub":
+			return 5
+		case "mul", "div", "divby", "mod":
+			return 6
+		default:
+			return 4
+		}
+	case ODataUnary:
+		if e.Op == "not" {
+			return 3
+		}
+		return 7
+	default:
+		return 8
+	}
+}
+
+// operand renders e, parenthesized when it binds looser than min
+func (e *ODataExpr) operand(min int) string {
+	if e.precedence() < min {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+func (e *ODataExpr) literal() string {
+	switch v := e.Value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return "INF"
+		case math.IsInf(v, -1):
+			return "-INF"
+		case math.IsNaN(v):
+			return "NaN"
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case time.Time:
+		if e.LiteralType == "date" {
+			return v.Format(time.DateOnly)
+		}
+		return v.Format(time.RFC3339Nano)
+	case string:
+		switch e.LiteralType {
+		case "guid":
+			return v
+		case "string":
+			return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		default:
+			return e.LiteralType + "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		}
+	default:
+		return "?"
+	}
+}
+
+// maxExprDepth bounds the recursion of the expression parser
+const maxExprDepth = 100
+
+// odataFunctions lists the canonical functions with their minimum and
+// maximum number of arguments. Namespace-qualified functions are accepted
+// with any number of arguments
+var odataFunctions = map[string][2]int{
+	"contains":           {2, 2},
+	"startswith":         {2, 2},
+	"endswith":           {2, 2},
+	"matchesPattern":     {2, 2},
+	"length":             {1, 1},
+	"indexof":            {2, 2},
+	"substring":          {2, 3},
+	"tolower":            {1, 1},
+	"toupper":            {1, 1},
+	"trim":               {1, 1},
+	"concat":             {2, 2},
+	"hassubset":          {2, 2},
+	"hassubsequence":     {2, 2},
+	"year":               {1, 1},
+	"month":              {1, 1},
+	"day":                {1, 1},
+	"hour":               {1, 1},
+	"minute":             {1, 1},
+	"second":             {1, 1},
+	"fractionalseconds":  {1, 1},
+	"totalseconds":       {1, 1},
+	"totaloffsetminutes": {1, 1},
+	"date":               {1, 1},
+	"time":               {1, 1},
+	"now":                {0, 0},
+	"maxdatetime":        {0, 0},
+	"mindatetime":        {0, 0},
+	"round":              {1, 1},
+	"floor":              {1, 1},
+	"ceiling":            {1, 1},
+	"cast":               {1, 2},
+	"isof":               {1, 2},
+	"geo.distance":       {2, 2},
+	"geo.length":         {1, 1},
+	"geo.intersects":     {2, 2},
+}
+
+var (
+	numberPattern   = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][+-]?[0-9]+)?`)
+	datePattern     = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}`)
+	dateTimePattern = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}(:[0-9]{2}(\.[0-9]+)?)?(Z|[+-][0-9]{2}:[0-9]{2})`)
+	guidPattern     = regexp.MustCompile(`^[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}`)
+)
+
+// exprParser works on the decoded option value, positions are mapped back
+// to the original query through the source tokens
+type exprParser struct {
+	src   source.Source
+	pos   int
+	depth int
+}
+
+// parseFilter parses a whole $filter (or $orderby item) expression
+func parseFilter(src source.Source) (*ODataExpr, error) {
+	ep := &exprParser{src: src}
+
+	ep.skipSpaces()
+	expr, err := ep.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	ep.skipSpaces()
+	if !ep.eof() {
+		return nil, ep.errorf("unexpected %q in expression", ep.src.Text[ep.pos])
+	}
+	return expr, nil
+}
+
+func (ep *exprParser) eof() bool {
+	return ep.pos >= len(ep.src.Text)
+}
+
+func (ep *exprParser) peek() byte {
+	if ep.eof() {
+		return 0
+	}
+	return ep.src.Text[ep.pos]
+}
+
+func (ep *exprParser) errorf(format string, args ...any) error {
+	return ep.src.Errorf(ep.pos, format, args...)
+}
+
+func (ep *exprParser) skipSpaces() {
+	for !ep.eof() && ep.src.Text[ep.pos] == ' ' {
+		ep.pos++
+	}
+}
+
+// node fills the position and tokens of a node that started at start
+func (ep *exprParser) node(expr *ODataExpr, start int) *ODataExpr {
+	expr.Pos = ep.src.Position(start)
+	expr.Tokens = ep.src.Tokens[start:ep.pos]
+	return expr
+}
+
+// keyword consumes one of words when it is followed by a space, by one of
+// the bytes in also or by the end of the value
+func (ep *exprParser) keyword(words []string, also string) (string, bool) {
+	for _, w := range words {
+		rest := ep.src.Text[ep.pos:]
+		if !strings.HasPrefix(rest, w) {
+			continue
+		}
+		if next := len(w); next == len(rest) || rest[next] == ' ' || strings.IndexByte(also, rest[next]) >= 0 {
+			ep.pos += len(w)
+			return w, true
+		}
+	}
+	return "", false
+}
+
+// binaryOp consumes " op " after an operand
+func (ep *exprParser) binaryOp(ops []string, also string) (string, bool) {
+	save := ep.pos
+	if ep.peek() != ' ' {
+		return "", false
+	}
+	ep.skipSpaces()
+	if op, ok := ep.keyword(ops, also); ok {
+		ep.skipSpaces()
+		return op, true
+	}
+	ep.pos = save
+	return "", false
+}
+
+func (ep *exprParser) enter() error {
+	ep.depth++
+	if ep.depth > maxExprDepth {
+		return ep.errorf("expression nested deeper than %d levels", maxExprDepth)
+	}
+	return nil
+}
+
+func (ep *exprParser) parseOr() (*ODataExpr, error) {
+	if err := ep.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { ep.depth-- }()
+
+	start := ep.pos
+	left, err := ep.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := ep.binaryOp([]string{"or"}, "("); !ok {
+			return left, nil
+		}
+		right, err := ep.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = ep.node(&ODataExpr{Kind: ODataBinary, Op: "or", Left: left, Right: right}, start)
+	}
+}
+
+func (ep *exprParser) parseAnd() (*ODataExpr, error) {
+	start := ep.pos
+	left, err := ep.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := ep.binaryOp([]string{"and"}, "("); !ok {
+			return left, nil
+		}
+		right, err := ep.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = ep.node(&ODataExpr{Kind: ODataBinary, Op: "and", Left: left, Right: right}, start)
+	}
+}
+
+func (ep *exprParser) parseNot() (*ODataExpr, error) {
+	start := ep.pos
+	if _, ok := ep.keyword([]string{"not"}, "("); !ok {
+		return ep.parseCompare()
+	}
+
+	if err := ep.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { ep.depth-- }()
+
+	ep.skipSpaces()
+	operand, err := ep.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return ep.node(&ODataExpr{Kind: ODataUnary, Op: "not", Left: operand}, start), nil
+}
+
+func (ep *exprParser) parseCompare() (*ODataExpr, error) {
+	start := ep.pos
+	left, err := ep.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := ep.binaryOp([]string{"eq", "ne", "gt", "ge", "lt", "le", "has", "in"}, "(")
+	if !ok {
+		return left, nil
+	}
+
+	var right *ODataExpr
+	if op == "in" && ep.peek() == '(' {
+		right, err = ep.parseList()
+	} else {
+		right, err = ep.parseAdditive()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ep.node(&ODataExpr{Kind: ODataBinary, Op: op, Left: left, Right: right}, start), nil
+}
+
+func (ep *exprParser) parseAdditive() (*ODataExpr, error) {
+	start := ep.pos
+	left, err := ep.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := ep.binaryOp([]string{"add", "sub"}, "(")
+		if !ok {
+			return left, nil
+		}
+		right, err := ep.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = ep.node(&ODataExpr{Kind: ODataBinary, Op: op, Left: left, Right: right}, start)
+	}
+}
+
+func (ep *exprParser) parseMultiplicative() (*ODataExpr, error) {
+	start := ep.pos
+	left, err := ep.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := ep.binaryOp([]string{"mul", "divby", "div", "mod"}, "(")
+		if !ok {
+			return left, nil
+		}
+		right, err := ep.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = ep.node(&ODataExpr{Kind: ODataBinary, Op: op, Left: left, Right: right}, start)
+	}
+}
+
+func (ep *exprParser) parseUnary() (*ODataExpr, error) {
+	start := ep.pos
+
+	// a minus directly followed by a digit is part of a number literal
+	if ep.peek() == '-' && !numberPattern.MatchString(ep.src.Text[ep.pos:]) && !strings.HasPrefix(ep.src.Text[ep.pos:], "-INF") {
+		if err := ep.enter(); err != nil {
+			return nil, err
+		}
+		defer func() { ep.depth-- }()
+
+		ep.pos++
+		operand, err := ep.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return ep.node(&ODataExpr{Kind: ODataUnary, Op: "-", Left: operand}, start), nil
+	}
+
+	return ep.parsePrimary()
+}
+
+func (ep *exprParser) parsePrimary() (*ODataExpr, error) {
+	start := ep.pos
+	rest := ep.src.Text[ep.pos:]
+
+	switch c := ep.peek(); {
+	case ep.eof():
+		return nil, ep.errorf("expected operand")
+
+	case c == '(':
+		ep.pos++
+		ep.skipSpaces()
+		expr, err := ep.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		ep.skipSpaces()
+		if ep.peek() != ')' {
+			return nil, ep.errorf("expected ')'")
+		}
+		ep.pos++
+		return expr, nil
+
+	case c == '\'':
+		s, err := ep.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return ep.node(&ODataExpr{Kind: ODataLiteral, Value: s, LiteralType: "string"}, start), nil
+
+	case guidPattern.MatchString(rest) && !isIdentByte(byteAt(rest, 36)):
+		ep.pos += 36
+		return ep.node(&ODataExpr{Kind: ODataLiteral, Value: rest[:36], LiteralType: "guid"}, start), nil
+
+	case c == '-' || c >= '0' && c <= '9':
+		return ep.parseNumberOrDate()
+	}
+
+	name := ep.parseIdentifier()
+	if name == "" {
+		return nil, ep.errorf("unexpected %q, expected operand", ep.peek())
+	}
+
+	switch {
+	case ep.peek() == '\'':
+		value, err := ep.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return ep.node(&ODataExpr{Kind: ODataLiteral, Value: value, LiteralType: name}, start), nil
+
+	case ep.peek() == '(':
+		return ep.parseCall(name, start)
+	}
+
+	switch name {
+	case "true", "false":
+		return ep.node(&ODataExpr{Kind: ODataLiteral, Value: name == "true", LiteralType: "bool"}, start), nil
+	case "null":
+		return ep.node(&ODataExpr{Kind: ODataLiteral, Value: nil, LiteralType: "null"}, start), nil
+	case "INF", "NaN":
+		value, _ := strconv.ParseFloat(name, 64)
+		return ep.node(&ODataExpr{Kind: ODataLiteral, Value: value, LiteralType: "decimal"}, start), nil
+	}
+
+	return ep.parseMemberPath(name, start)
+}
+
+func (ep *exprParser) parseString() (string, error) {
+	start := ep.pos
+	ep.pos++
+
+	var sb strings.Builder
+	for !ep.eof() {
+		c := ep.src.Text[ep.pos]
+		ep.pos++
+		if c != '\'' {
+			sb.WriteByte(c)
+			continue
+		}
+		// a doubled quote is an escaped quote
+		if ep.peek() != '\'' {
+			return sb.String(), nil
+		}
+		sb.WriteByte('\'')
+		ep.pos++
+	}
+
+	ep.pos = start
+	return "", ep.errorf("unterminated string")
+}
+
+func (ep *exprParser) parseNumberOrDate() (*ODataExpr, error) {
+	start := ep.pos
+	rest := ep.src.Text[ep.pos:]
+
+	if strings.HasPrefix(rest, "-INF") {
+		ep.pos += 4
+		return ep.node(&ODataExpr{Kind: ODataLiteral, Value: math.Inf(-1), LiteralType: "decimal"}, start), nil
+	}
+
+	if m := dateTimePattern.FindString(rest); m != "" {
+		t, err := time.Parse(time.RFC3339Nano, m)
+		if err != nil {
+			return nil, ep.errorf("invalid date-time %q", m)
+		}
+		ep.pos += len(m)
+		return ep.node(&ODataExpr{Kind: ODataLiteral, Value: t, LiteralType: "datetimeoffset"}, start), nil
+	}
+
+	if m := datePattern.FindString(rest); m != "" {
+		t, err := time.Parse(time.DateOnly, m)
+		if err != nil {
+			return nil, ep.errorf("invalid date %q", m)
+		}
+		ep.pos += len(m)
+		return ep.node(&ODataExpr{Kind: ODataLiteral, Value: t, LiteralType: "date"}, start), nil
+	}
+
+	m := numberPattern.FindString(rest)
+	if m == "" || isIdentByte(byteAt(rest, len(m))) {
+		return nil, ep.errorf("invalid number")
+	}
+
+	if !strings.ContainsAny(m, ".eE") {
+		if n, err := strconv.ParseInt(m, 10, 64); err == nil {
+			ep.pos += len(m)
+			return ep.node(&ODataExpr{Kind: ODataLiteral, Value: n, LiteralType: "int"}, start), nil
+		}
+	}
+
+	f, err := strconv.ParseFloat(m, 64)
+	if err != nil {
+		return nil, ep.errorf("invalid number %q", m)
+	}
+	ep.pos += len(m)
+	return ep.node(&ODataExpr{Kind: ODataLiteral, Value: f, LiteralType: "decimal"}, start), nil
+}
+
+// parseIdentifier reads a possibly namespace-qualified identifier,
+// "$it", "$root" and "$this" are accepted as well
+func (ep *exprParser) parseIdentifier() string {
+	start := ep.pos
+	if ep.peek() == '$' {
+		ep.pos++
+	}
+	for !ep.eof() && (isIdentByte(ep.src.Text[ep.pos]) || ep.src.Text[ep.pos] == '.') {
+		ep.pos++
+	}
+
+	name := ep.src.Text[start:ep.pos]
+	if !isIdentifier(name) {
+		ep.pos = start
+		return ""
+	}
+	return name
+}
+
+func (ep *exprParser) parseCall(name string, start int) (*ODataExpr, error) {
+	arity, known := odataFunctions[name]
+	if !known && !strings.Contains(name, ".") {
+		return nil, ep.src.Errorf(start, "unknown function %q", name)
+	}
+
+	if err := ep.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { ep.depth-- }()
+
+	args, err := ep.parseArguments()
+	if err != nil {
+		return nil, err
+	}
+
+	if known && (len(args) < arity[0] || len(args) > arity[1]) {
+		return nil, ep.src.Errorf(start, "function %s expects %s, got %d", name, describeArity(arity), len(args))
+	}
+	return ep.node(&ODataExpr{Kind: ODataCall, Name: name, Args: args}, start), nil
+}
+
+func describeArity(arity [2]int) string {
+	if arity[0] == arity[1] {
+		return strconv.Itoa(arity[0]) + " arguments"
+	}
+	return strconv.Itoa(arity[0]) + " to " + strconv.Itoa(arity[1]) + " arguments"
+}
+
+func (ep *exprParser) parseList() (*ODataExpr, error) {
+	start := ep.pos
+	if err := ep.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { ep.depth-- }()
+
+	args, err := ep.parseArguments()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, ep.src.Errorf(start, "empty list")
+	}
+	return ep.node(&ODataExpr{Kind: ODataList, Args: args}, start), nil
+}
+
+// parseArguments reads "(" [ or-expr *( "," or-expr ) ] ")"
+func (ep *exprParser) parseArguments() ([]*ODataExpr, error) {
+	ep.pos++ // '('
+	ep.skipSpaces()
+
+	var args []*ODataExpr
+	if ep.peek() == ')' {
+		ep.pos++
+		return args, nil
+	}
+
+	for {
+		ep.skipSpaces()
+		arg, err := ep.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		ep.skipSpaces()
+		switch ep.peek() {
+		case ',':
+			ep.pos++
+		case ')':
+			ep.pos++
+			return args, nil
+		default:
+			return nil, ep.errorf("expected ',' or ')'")
+		}
+	}
+}
+
+func (ep *exprParser) parseMemberPath(first string, start int) (*ODataExpr, error) {
+	path := first
+
+	for ep.peek() == '/' {
+		segStart := ep.pos + 1
+		ep.pos++
+
+		name := ep.parseIdentifier()
+		if name == "" {
+			return nil, ep.errorf("expected member name after '/'")
+		}
+
+		if (name == "any" || name == "all") && ep.peek() == '(' {
+			member := &ODataExpr{Kind: ODataMember, Name: path, Pos: ep.src.Position(start), Tokens: ep.src.Tokens[start : segStart-1]}
+			return ep.parseLambda(member, name, start)
+		}
+		path += "/" + name
+	}
+
+	return ep.node(&ODataExpr{Kind: ODataMember, Name: path}, start), nil
+}
+
+func (ep *exprParser) parseLambda(member *ODataExpr, name string, start int) (*ODataExpr, error) {
+	if err := ep.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { ep.depth-- }()
+
+	ep.pos++ // '('
+	ep.skipSpaces()
+
+	lambda := &ODataExpr{Kind: ODataLambda, Name: name, Left: member}
+	if ep.peek() == ')' {
+		if name == "all" {
+			return nil, ep.errorf("all() requires a lambda expression")
+		}
+		ep.pos++
+		return ep.node(lambda, start), nil
+	}
+
+	lambda.Var = ep.parseIdentifier()
+	if lambda.Var == "" {
+		return nil, ep.errorf("expected lambda variable")
+	}
+	ep.skipSpaces()
+	if ep.peek() != ':' {
+		return nil, ep.errorf("expected ':' after lambda variable")
+	}
+	ep.pos++
+	ep.skipSpaces()
+
+	body, err := ep.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	lambda.Right = body
+
+	ep.skipSpaces()
+	if ep.peek() != ')' {
+		return nil, ep.errorf("expected ')'")
+	}
+	ep.pos++
+	return ep.node(lambda, start), nil
+}
+
+func isIdentByte(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c >= 0x80
+}
+
+// isIdentifier reports whether s is a (namespace-qualified) OData identifier
+func isIdentifier(s string) bool {
+	s = strings.TrimPrefix(s, "$")
+	if s == "" {
+		return false
+	}
+	for part := range strings.SplitSeq(s, ".") {
+		if part == "" || part[0] >= '0' && part[0] <= '9' {
+			return false
+		}
+		for i := 0; i < len(part); i++ {
+			if !isIdentByte(part[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func byteAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
@@ -0,0 +1,422 @@
+package odata
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+// ODataQuery holds the OData v4 system query options of a request.
+// Options that were not present are left nil
+type ODataQuery struct {
+	Filter  *ODataExpr
+	Select  []ODataSelectItem
+	Expand  []ODataExpandItem
+	OrderBy []ODataOrderByItem
+	Top     *int
+	Skip    *int
+	Count   *bool
+	Search  *ODataSearchExpr
+
+	// OtherParams holds custom query options and parameter aliases (@p)
+	OtherParams map[string][]string
+}
+
+// ODataSelectItem is a $select path such as "Address/City", "*" or "NS.*"
+type ODataSelectItem struct {
+	Path   string
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// ODataExpandItem is a navigation property of $expand with its nested options
+type ODataExpandItem struct {
+	Path string // navigation path, "*" to expand everything
+
+	// Ref and Count are set for the "/$ref" and "/$count" suffixes
+	Ref   bool
+	Count bool
+
+	// Options are the nested query options, e.g. Orders($filter=...;$top=5)
+	Options *ODataQuery
+
+	// Levels is the nested $levels option, -1 for "max", 0 when absent
+	Levels int
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// ODataOrderByItem is one $orderby expression
+type ODataOrderByItem struct {
+	Expr *ODataExpr
+	Desc bool
+	Pos  rfcquery.Position
+}
+
+// ODataParser parses the system query options of the OData v4 URL conventions
+type ODataParser struct {
+	// StrictValidation enforces RFC3986 compliance
+	StrictValidation bool
+
+	// MaxTop rejects larger $top values, 0 means no maximum
+	MaxTop int
+
+	// MaxExpandDepth bounds the nesting of $expand options, 0 means no limit
+	MaxExpandDepth int
+}
+
+// NewODataParser creates a parser with default settings
+func NewODataParser() *ODataParser {
+	return &ODataParser{
+		StrictValidation: true,
+	}
+}
+
+// Name returns the parser identifier
+func (p *ODataParser) Name() string {
+	return "odata"
+}
+
+// Parse implements the Parser interface
+func (p *ODataParser) Parse(scanner *rfcquery.Scanner) (any, error) {
+	if p.StrictValidation {
+		if err := scanner.Valid(); err != nil {
+			return nil, fmt.Errorf("RFC3986 validation failed: %w", err)
+		}
+		scanner.Reset()
+	}
+
+	formParser := &formurlencoded.FormURLEncodedParser{}
+	result, err := formParser.Parse(scanner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query parameters: %w", err)
+	}
+
+	query := &ODataQuery{OtherParams: make(map[string][]string)}
+	seen := make(map[string]bool)
+
+	for _, param := range source.Params(result.(*rfcquery.Values)) {
+		if !strings.HasPrefix(param.Key, "$") {
+			query.OtherParams[param.Key] = append(query.OtherParams[param.Key], param.ValueTokens.StringDecoded())
+			continue
+		}
+
+		if seen[param.Key] {
+			return nil, rfcquery.NewError(param.Pos.Offset, "duplicate system query option %q", param.Key)
+		}
+		seen[param.Key] = true
+
+		if err := p.applyOption(query, param.Key, param.Pos.Offset, param.Value(), 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return query, nil
+}
+
+// applyOption parses the value of a system query option into query,
+// depth is the $expand nesting level
+func (p *ODataParser) applyOption(query *ODataQuery, name string, pos int, value source.Source, depth int) error {
+	if value.Text == "" {
+		return rfcquery.NewError(pos, "empty value for %s", name)
+	}
+
+	var err error
+	switch name {
+	case "$filter":
+		query.Filter, err = parseFilter(value)
+	case "$select":
+		query.Select, err = parseSelect(value)
+	case "$expand":
+		if p.MaxExpandDepth > 0 && depth >= p.MaxExpandDepth {
+			return rfcquery.NewError(pos, "$expand nested deeper than %d levels", p.MaxExpandDepth)
+		}
+		query.Expand, err = p.parseExpand(value, depth)
+	case "$orderby":
+		query.OrderBy, err = parseOrderBy(value)
+	case "$top":
+		query.Top, err = parseCount(value, name)
+		if err == nil && p.MaxTop > 0 && *query.Top > p.MaxTop {
+			err = value.Errorf(0, "$top %d exceeds the maximum of %d", *query.Top, p.MaxTop)
+		}
+	case "$skip":
+		query.Skip, err = parseCount(value, name)
+	case "$count":
+		query.Count, err = parseBool(value)
+	case "$search":
+		query.Search, err = parseSearch(value)
+	default:
+		return rfcquery.NewError(pos, "unknown system query option %q", name)
+	}
+	return err
+}
+
+func parseCount(value source.Source, name string) (*int, error) {
+	n, err := strconv.Atoi(value.Text)
+	if err != nil || n < 0 || strings.HasPrefix(value.Text, "+") {
+		return nil, value.Errorf(0, "%s must be a non-negative integer, got %q", name, value.Text)
+	}
+	return &n, nil
+}
+
+func parseBool(value source.Source) (*bool, error) {
+	switch value.Text {
+	case "true":
+		b := true
+		return &b, nil
+	case "false":
+		b := false
+		return &b, nil
+	}
+	return nil, value.Errorf(0, "$count must be true or false, got %q", value.Text)
+}
+
+// splitTopLevel splits src on sep outside of parentheses and quoted strings
+func splitTopLevel(src source.Source, sep byte) ([]source.Source, error) {
+	var parts []source.Source
+	depth, start := 0, 0
+
+	for i := 0; i < len(src.Text); i++ {
+		switch c := src.Text[i]; c {
+		case '\'', '"':
+			end := closingQuote(src.Text, i)
+			if end < 0 {
+				return nil, src.Errorf(i, "unterminated string")
+			}
+			i = end
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return nil, src.Errorf(i, "unbalanced ')'")
+			}
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, src.Slice(start, i))
+				start = i + 1
+			}
+		}
+	}
+	if depth > 0 {
+		return nil, src.Errorf(len(src.Text), "missing ')'")
+	}
+
+	return append(parts, src.Slice(start, len(src.Text))), nil
+}
+
+// closingQuote returns the index of the quote closing the string opened at i,
+// -1 if unterminated. Doubled single quotes are read as two strings, which
+// does not change where the option ends; phrases escape '"' with '\'
+func closingQuote(text string, i int) int {
+	quote := text[i]
+	for j := i + 1; j < len(text); j++ {
+		switch {
+		case text[j] == '\\' && quote == '"':
+			j++
+		case text[j] == quote:
+			return j
+		}
+	}
+	return -1
+}
+
+// trimSpaces removes the surrounding spaces of src
+func trimSpaces(src source.Source) source.Source {
+	i, j := 0, len(src.Text)
+	for i < j && src.Text[i] == ' ' {
+		i++
+	}
+	for j > i && src.Text[j-1] == ' ' {
+		j--
+	}
+	return src.Slice(i, j)
+}
+
+func parseSelect(value source.Source) ([]ODataSelectItem, error) {
+	parts, err := splitTopLevel(value, ',')
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ODataSelectItem, 0, len(parts))
+	for _, part := range parts {
+		part = trimSpaces(part)
+		if err := checkPath(part, true); err != nil {
+			return nil, err
+		}
+		items = append(items, ODataSelectItem{Path: part.Text, Pos: part.Position(0), Tokens: part.Tokens})
+	}
+	return items, nil
+}
+
+// checkPath validates a "/" separated path of identifiers, wildcards
+// "*" and "NS.*" are accepted as the last segment when wildcard is set
+func checkPath(path source.Source, wildcard bool) error {
+	if path.Text == "" {
+		return path.Errorf(0, "empty path")
+	}
+
+	start := 0
+	for i := 0; i <= len(path.Text); i++ {
+		if i < len(path.Text) && path.Text[i] != '/' {
+			continue
+		}
+
+		segment := path.Text[start:i]
+		last := i == len(path.Text)
+		switch {
+		case segment == "":
+			return path.Errorf(start, "empty path segment")
+		case wildcard && last && (segment == "*" || strings.HasSuffix(segment, ".*") && isIdentifier(strings.TrimSuffix(segment, ".*"))):
+		case !isIdentifier(segment):
+			return path.Errorf(start, "invalid path segment %q", segment)
+		}
+		start = i + 1
+	}
+	return nil
+}
+
+func (p *ODataParser) parseExpand(value source.Source, depth int) ([]ODataExpandItem, error) {
+	parts, err := splitTopLevel(value, ',')
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ODataExpandItem, 0, len(parts))
+	for _, part := range parts {
+		part = trimSpaces(part)
+		item := ODataExpandItem{Pos: part.Position(0), Tokens: part.Tokens}
+
+		path := part
+		var options source.Source
+		hasOptions := false
+		if open := strings.IndexByte(part.Text, '('); open >= 0 {
+			if !strings.HasSuffix(part.Text, ")") {
+				return nil, part.Errorf(len(part.Text), "expected ')' to close the options of %q", part.Text[:open])
+			}
+			path = part.Slice(0, open)
+			options = part.Slice(open+1, len(part.Text)-1)
+			hasOptions = true
+		}
+
+		if trimmed, ok := strings.CutSuffix(path.Text, "/$ref"); ok {
+			item.Ref = true
+			path = path.Slice(0, len(trimmed))
+		} else if trimmed, ok := strings.CutSuffix(path.Text, "/$count"); ok {
+			item.Count = true
+			path = path.Slice(0, len(trimmed))
+		}
+
+		if path.Text != "*" {
+			if err := checkPath(path, false); err != nil {
+				return nil, err
+			}
+		}
+		item.Path = path.Text
+
+		if hasOptions {
+			if err := p.parseExpandOptions(&item, options, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseExpandOptions parses the ';' separated options of an expanded item
+func (p *ODataParser) parseExpandOptions(item *ODataExpandItem, options source.Source, depth int) error {
+	parts, err := splitTopLevel(options, ';')
+	if err != nil {
+		return err
+	}
+
+	item.Options = &ODataQuery{}
+	seen := make(map[string]bool)
+
+	for _, part := range parts {
+		eq := strings.IndexByte(part.Text, '=')
+		if eq <= 0 {
+			return part.Errorf(0, "expected a name=value expand option")
+		}
+
+		name := part.Text[:eq]
+		if seen[name] {
+			return part.Errorf(0, "duplicate expand option %q", name)
+		}
+		seen[name] = true
+
+		value := part.Slice(eq+1, len(part.Text))
+		if name == "$levels" {
+			if value.Text == "max" {
+				item.Levels = -1
+				continue
+			}
+			levels, err := parseCount(value, name)
+			if err != nil {
+				return err
+			}
+			item.Levels = *levels
+			continue
+		}
+
+		if err := p.applyOption(item.Options, name, part.Offset(0), value, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseOrderBy(value source.Source) ([]ODataOrderByItem, error) {
+	parts, err := splitTopLevel(value, ',')
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ODataOrderByItem, 0, len(parts))
+	for _, part := range parts {
+		part = trimSpaces(part)
+		item := ODataOrderByItem{Pos: part.Position(0)}
+
+		if trimmed, ok := strings.CutSuffix(part.Text, " desc"); ok {
+			item.Desc = true
+			part = part.Slice(0, len(trimmed))
+		} else if trimmed, ok := strings.CutSuffix(part.Text, " asc"); ok {
+			part = part.Slice(0, len(trimmed))
+		}
+
+		expr, err := parseFilter(part)
+		if err != nil {
+			return nil, err
+		}
+		item.Expr = expr
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// ParseODataQuery - convenience function
+func ParseODataQuery(query string) (*ODataQuery, error) {
+	scanner := rfcquery.NewScanner(query)
+	if err := scanner.Valid(); err != nil {
+		return nil, err
+	}
+
+	result, err := NewODataParser().Parse(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, ok := result.(*ODataQuery)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %T", result)
+	}
+
+	return parsed, nil
+}
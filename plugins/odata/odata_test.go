@@ -0,0 +1,318 @@
+package odata_test
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/plugins/odata"
+)
+
+func TestODataParser_Filter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   string
+	}{
+		{"comparison", "Price%20gt%205", "Price gt 5"},
+		{"precedence", "A%20eq%201%20or%20B%20eq%202%20and%20not%20C", "A eq 1 or B eq 2 and not C"},
+		{"parentheses", "(A%20eq%201%20or%20B%20eq%202)%20and%20C%20ne%20null", "(A eq 1 or B eq 2) and C ne null"},
+		{"redundant parentheses", "((A%20eq%201))%20or%20(B%20add%201)%20mul%202%20gt%200", "A eq 1 or (B add 1) mul 2 gt 0"},
+		{"arithmetic", "Price%20add%202%20mul%203%20le%20-10.5", "Price add 2 mul 3 le -10.5"},
+		{"left associative", "A%20sub%20(B%20sub%20C)%20sub%20D%20eq%200", "A sub (B sub C) sub D eq 0"},
+		{"negation", "-Price%20lt%200", "-Price lt 0"},
+		{"negated literal", "-(5)%20lt%20-(A%20add%201)", "-(5) lt -(A add 1)"},
+		{"string escape", "Name%20eq%20'O''Neil'", "Name eq 'O''Neil'"},
+		{"functions", "contains(Name,'an')%20and%20startswith(tolower(City),%20'ro')", "contains(Name,'an') and startswith(tolower(City),'ro')"},
+		{"member path", "Address/City%20eq%20'Rome'", "Address/City eq 'Rome'"},
+		{"in list", "Status%20in%20('a',%20'b')", "Status in ('a','b')"},
+		{"has enum", "Style%20has%20Sales.Pattern'Yellow'", "Style has Sales.Pattern'Yellow'"},
+		{"date and date-time", "Born%20ge%202000-01-31%20and%20At%20lt%202020-01-01T10:00:00Z",
+			"Born ge 2000-01-31 and At lt 2020-01-01T10:00:00Z"},
+		{"guid", "Id%20eq%2001234567-89ab-cdef-0123-456789abcdef", "Id eq 01234567-89ab-cdef-0123-456789abcdef"},
+		{"booleans", "Active%20eq%20true%20and%20not(Deleted)", "Active eq true and not Deleted"},
+		{"not of comparison", "not%20A%20eq%201%20and%20(not%20B)%20eq%20C", "not A eq 1 and (not B) eq C"},
+		{"lambda any", "Tags/any(t:t%20eq%20'x')", "Tags/any(t:t eq 'x')"},
+		{"lambda all nested", "Orders/all(o:%20o/Items/any(i:i/Qty%20gt%201))", "Orders/all(o:o/Items/any(i:i/Qty gt 1))"},
+		{"empty any", "Tags/any()", "Tags/any()"},
+		{"typed duration", "Span%20lt%20duration'PT1H'", "Span lt duration'PT1H'"},
+		{"$it", "$it/Price%20gt%201", "$it/Price gt 1"},
+		{"qualified function", "NS.distance(A,B,C)%20lt%205", "NS.distance(A,B,C) lt 5"},
+		{"INF", "Score%20lt%20INF%20and%20Score%20gt%20-INF", "Score lt INF and Score gt -INF"},
+		{"decimal", "Score%20eq%205.0%20or%20Score%20eq%201E3", "Score eq 5.0 or Score eq 1000.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := odata.ParseODataQuery("$filter=" + tt.filter)
+			if err != nil {
+				t.Fatalf("ParseODataQuery() error = %v", err)
+			}
+			if got := q.Filter.String(); got != tt.want {
+				t.Errorf("Filter = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestODataParser_Literals(t *testing.T) {
+	tests := []struct {
+		filter   string
+		wantType string
+		want     any
+	}{
+		{"Name%20eq%20'O''Neil'", "string", "O'Neil"},
+		{"Price%20le%20-10.5", "decimal", -10.5},
+		{"Score%20lt%20INF", "decimal", math.Inf(1)},
+		{"Count%20eq%2042", "int", int64(42)},
+		{"Born%20ge%202000-01-31", "date", time.Date(2000, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"At%20lt%202020-01-01T10:00:00%2B02:00", "datetimeoffset", time.Date(2020, 1, 1, 8, 0, 0, 0, time.UTC)},
+		{"Span%20lt%20duration'PT1H'", "duration", "PT1H"},
+		{"Deleted%20eq%20null", "null", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			q, err := odata.ParseODataQuery("$filter=" + tt.filter)
+			if err != nil {
+				t.Fatalf("ParseODataQuery() error = %v", err)
+			}
+			lit := q.Filter.Right
+			got := lit.Value
+			if at, ok := got.(time.Time); ok {
+				got = at.UTC()
+			}
+			if lit.LiteralType != tt.wantType || got != tt.want {
+				t.Errorf("literal = %s %#v, want %s %#v", lit.LiteralType, lit.Value, tt.wantType, tt.want)
+			}
+		})
+	}
+}
+
+func TestODataParser_FilterPositions(t *testing.T) {
+	const (
+		logical = "$top=1&$filter=Name%20eq%20'x'%20and%20contains(City,'R')"
+		lambda  = "$filter=Tags/any(t:-t/Qty%20gt%201)"
+		grouped = "$filter=(A%20eq%201)%20or%20B"
+	)
+
+	tests := []struct {
+		name       string
+		input      string
+		node       func(f *odata.ODataExpr) *odata.ODataExpr
+		wantPos    int
+		wantTokens string
+	}{
+		{"and", logical, func(f *odata.ODataExpr) *odata.ODataExpr { return f }, 15, "Name%20eq%20'x'%20and%20contains(City,'R')"},
+		{"member", logical, func(f *odata.ODataExpr) *odata.ODataExpr { return f.Left.Left }, 15, "Name"},
+		{"string literal", logical, func(f *odata.ODataExpr) *odata.ODataExpr { return f.Left.Right }, 27, "'x'"},
+		{"call", logical, func(f *odata.ODataExpr) *odata.ODataExpr { return f.Right }, 39, "contains(City,'R')"},
+		{"call argument", logical, func(f *odata.ODataExpr) *odata.ODataExpr { return f.Right.Args[1] }, 53, "'R'"},
+		{"lambda", lambda, func(f *odata.ODataExpr) *odata.ODataExpr { return f }, 8, "Tags/any(t:-t/Qty%20gt%201)"},
+		{"lambda body", lambda, func(f *odata.ODataExpr) *odata.ODataExpr { return f.Right }, 19, "-t/Qty%20gt%201"},
+		{"negation", lambda, func(f *odata.ODataExpr) *odata.ODataExpr { return f.Right.Left }, 19, "-t/Qty"},
+		{"negated member", lambda, func(f *odata.ODataExpr) *odata.ODataExpr { return f.Right.Left.Left }, 20, "t/Qty"},
+		{"parenthesized", grouped, func(f *odata.ODataExpr) *odata.ODataExpr { return f.Left }, 9, "A%20eq%201"},
+		{"after parentheses", grouped, func(f *odata.ODataExpr) *odata.ODataExpr { return f.Right }, 28, "B"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := odata.ParseODataQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseODataQuery() error = %v", err)
+			}
+			node := tt.node(q.Filter)
+			if node.Pos.Offset != tt.wantPos || node.Tokens.String() != tt.wantTokens {
+				t.Errorf("node at %d with tokens %q, want %d with %q", node.Pos.Offset, node.Tokens.String(), tt.wantPos, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestODataParser_Options(t *testing.T) {
+	input := "$select=Name,Address/City,NS.*&$orderby=Price%20desc,Name&$top=10&$skip=20&$count=true" +
+		"&$expand=Orders($filter=Amount%20gt%205;$select=Id;$expand=Items($top=2);$orderby=Id%20desc),Manager/$ref,*($levels=max)" +
+		"&$search=blue%20OR%20%22dark%20red%22%20NOT%20green&custom=1&@p=2"
+
+	q, err := odata.ParseODataQuery(input)
+	if err != nil {
+		t.Fatalf("ParseODataQuery() error = %v", err)
+	}
+
+	var selects []string
+	for _, s := range q.Select {
+		selects = append(selects, s.Path)
+	}
+	if got := strings.Join(selects, ","); got != "Name,Address/City,NS.*" {
+		t.Errorf("Select = %s", got)
+	}
+	if q.Select[1].Pos.Offset != 13 {
+		t.Errorf("Address/City position = %d, want 13", q.Select[1].Pos.Offset)
+	}
+
+	if len(q.OrderBy) != 2 || q.OrderBy[0].Expr.String() != "Price" || !q.OrderBy[0].Desc || q.OrderBy[1].Desc {
+		t.Errorf("OrderBy = %+v", q.OrderBy)
+	}
+	if *q.Top != 10 || *q.Skip != 20 || !*q.Count {
+		t.Errorf("Top, Skip, Count = %d, %d, %v", *q.Top, *q.Skip, *q.Count)
+	}
+
+	if len(q.Expand) != 3 {
+		t.Fatalf("Expand = %+v", q.Expand)
+	}
+	orders := q.Expand[0]
+	if orders.Path != "Orders" || orders.Options.Filter.String() != "Amount gt 5" ||
+		orders.Options.Select[0].Path != "Id" || !orders.Options.OrderBy[0].Desc {
+		t.Errorf("Orders expand = %+v", orders)
+	}
+	if items := orders.Options.Expand; len(items) != 1 || items[0].Path != "Items" || *items[0].Options.Top != 2 {
+		t.Errorf("nested Items expand = %+v", items)
+	}
+	if m := q.Expand[1]; m.Path != "Manager" || !m.Ref || m.Options != nil {
+		t.Errorf("Manager expand = %+v", m)
+	}
+	if all := q.Expand[2]; all.Path != "*" || all.Levels != -1 {
+		t.Errorf("* expand = %+v", all)
+	}
+
+	if got := q.Search.String(); got != `blue OR "dark red" AND NOT green` {
+		t.Errorf("Search = %s", got)
+	}
+
+	if q.OtherParams["custom"][0] != "1" || q.OtherParams["@p"][0] != "2" {
+		t.Errorf("OtherParams = %v", q.OtherParams)
+	}
+}
+
+func TestODataParser_Search(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"blue", "blue"},
+		{"blue%20green", "blue AND green"},
+		{"blue%20AND%20green%20OR%20red", "blue AND green OR red"},
+		{"blue%20AND%20(green%20OR%20red)", "blue AND (green OR red)"},
+		{"NOT%20(a%20OR%20b)", "NOT (a OR b)"},
+		{"NOT%20NOT%20a", "NOT NOT a"},
+		{`%22say%20%5C%22hi%5C%22%22`, `"say \"hi\""`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			q, err := odata.ParseODataQuery("$search=" + tt.input)
+			if err != nil {
+				t.Fatalf("ParseODataQuery() error = %v", err)
+			}
+			if got := q.Search.String(); got != tt.want {
+				t.Errorf("Search = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestODataParser_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{"unknown option", "$top=1&$foo=1", 7, "unknown system query option"},
+		{"duplicate option", "$top=1&$top=2", 7, "duplicate"},
+		{"negative top", "$top=-1", 5, "non-negative integer"},
+		{"bad count", "$count=yes", 7, "true or false"},
+		{"empty filter", "$filter=", 0, "empty value"},
+		{"missing operand", "$filter=Price%20gt", 18, "expected operand"},
+		{"unterminated string", "$filter=Name%20eq%20'abc", 20, "unterminated string"},
+		{"unknown function", "$filter=frobnicate(Name)", 8, "unknown function"},
+		{"wrong arity", "$filter=contains(Name)", 8, "expects 2 arguments"},
+		{"missing paren", "$filter=(A%20eq%201", 19, "expected ')'"},
+		{"trailing garbage", "$filter=A%20eq%201)", 18, "unexpected ')'"},
+		{"empty in list", "$filter=A%20in%20()", 17, "empty list"},
+		{"bad select path", "$select=Name,Address//City", 21, "empty path segment"},
+		{"expand without paren", "$expand=Orders($top=1", 21, "missing ')'"},
+		{"unknown expand option", "$expand=Orders($foo=1)", 15, "unknown system query option"},
+		{"search operator only", "$search=AND", 8, "expected search term"},
+		{"too deep", "$filter=" + strings.Repeat("(", 200) + "A" + strings.Repeat(")", 200), 108, "nested deeper"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := odata.ParseODataQuery(tt.input)
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestODataParser_Limits(t *testing.T) {
+	parser := odata.NewODataParser()
+	parser.MaxTop = 100
+	parser.MaxExpandDepth = 1
+
+	if _, err := parser.Parse(rfcquery.NewScanner("$top=101")); err == nil {
+		t.Errorf("$top above MaxTop accepted")
+	}
+	if _, err := parser.Parse(rfcquery.NewScanner("$expand=A($expand=B)")); err == nil {
+		t.Errorf("$expand deeper than MaxExpandDepth accepted")
+	}
+	if _, err := parser.Parse(rfcquery.NewScanner("$top=100&$expand=A($top=1)")); err != nil {
+		t.Errorf("Parse() error = %v", err)
+	}
+}
+
+func FuzzODataParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		"$filter=Price%20gt%205",
+		"$filter=Tags/any(t:t%20eq%20'x')&$orderby=Name%20desc",
+		"$filter=-(A%20add%201)%20mul%20-5%20lt%20not%20B",
+		"$expand=Orders($filter=Amount%20gt%205;$expand=Items($levels=max))",
+		"$search=blue%20OR%20%22dark%20red%22",
+		"$filter=" + strings.Repeat("(", 50),
+		"$filter=Name%20eq%20'O''Neil",
+		"$select=*,NS.*&$top=1&$skip=0&$count=false",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		q, err := odata.ParseODataQuery(input)
+		if err != nil {
+			return
+		}
+
+		// rendered expressions parse back to the same expression
+		if q.Filter != nil {
+			rendered := q.Filter.String()
+			again, err := odata.ParseODataQuery("$filter=" + strings.ReplaceAll(url.QueryEscape(rendered), "+", "%20"))
+			if err != nil {
+				t.Fatalf("ParseODataQuery() of rendered filter %q error = %v", rendered, err)
+			}
+			if got := again.Filter.String(); got != rendered {
+				t.Fatalf("rendered filter %q renders again as %q", rendered, got)
+			}
+		}
+		if q.Search != nil {
+			rendered := q.Search.String()
+			again, err := odata.ParseODataQuery("$search=" + strings.ReplaceAll(url.QueryEscape(rendered), "+", "%20"))
+			if err != nil {
+				t.Fatalf("ParseODataQuery() of rendered search %q error = %v", rendered, err)
+			}
+			if got := again.Search.String(); got != rendered {
+				t.Fatalf("rendered search %q renders again as %q", rendered, got)
+			}
+		}
+	})
+}
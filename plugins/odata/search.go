@@ -0,0 +1,217 @@
+package odata
+
+import (
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+)
+
+// ODataSearchExpr is a node of a $search expression.
+//
+//	search-or  = search-and *( " OR " search-and )
+//	search-and = search-not *( [ " AND " ] search-not )   ; juxtaposition means AND
+//	search-not = "NOT " search-not / "(" search-or ")" / term / phrase
+//	phrase     = DQUOTE *( "\" DQUOTE / "\\" / char ) DQUOTE
+type ODataSearchExpr struct {
+	Op    string // "AND", "OR", "NOT" or "" for terms
+	Left  *ODataSearchExpr
+	Right *ODataSearchExpr // nil for "NOT"
+
+	Term   string
+	Phrase bool // the term was a quoted phrase
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// String renders the expression with explicit AND operators and only the
+// parentheses its precedence requires
+func (e *ODataSearchExpr) String() string {
+	switch e.Op {
+	case "":
+		if e.Phrase {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(e.Term) + `"`
+		}
+		return e.Term
+	case "NOT":
+		return "NOT " + e.Left.operand(3)
+	default:
+		return e.Left.operand(e.precedence()) + " " + e.Op + " " + e.Right.operand(e.precedence()+1)
+	}
+}
+
+// precedence ranks the node from "OR" (1) to the terms (4)
+func (e *ODataSearchExpr) precedence() int {
+	switch e.Op {
+	case "OR":
+		return 1
+	case "AND":
+		return 2
+	case "NOT":
+		return 3
+	default:
+		return 4
+	}
+}
+
+// operand renders e, parenthesized when it binds looser than min
+func (e *ODataSearchExpr) operand(min int) string {
+	if e.precedence() < min {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+type searchParser struct {
+	exprParser
+}
+
+func parseSearch(src source.Source) (*ODataSearchExpr, error) {
+	sp := &searchParser{exprParser{src: src}}
+
+	sp.skipSpaces()
+	expr, err := sp.parseSearchOr()
+	if err != nil {
+		return nil, err
+	}
+
+	sp.skipSpaces()
+	if !sp.eof() {
+		return nil, sp.errorf("unexpected %q in $search", sp.src.Text[sp.pos])
+	}
+	return expr, nil
+}
+
+func (sp *searchParser) searchNode(expr *ODataSearchExpr, start int) *ODataSearchExpr {
+	expr.Pos = sp.src.Position(start)
+	expr.Tokens = sp.src.Tokens[start:sp.pos]
+	return expr
+}
+
+func (sp *searchParser) parseSearchOr() (*ODataSearchExpr, error) {
+	if err := sp.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { sp.depth-- }()
+
+	start := sp.pos
+	left, err := sp.parseSearchAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := sp.binaryOp([]string{"OR"}, "(\""); !ok {
+			return left, nil
+		}
+		right, err := sp.parseSearchAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = sp.searchNode(&ODataSearchExpr{Op: "OR", Left: left, Right: right}, start)
+	}
+}
+
+func (sp *searchParser) parseSearchAnd() (*ODataSearchExpr, error) {
+	start := sp.pos
+	left, err := sp.parseSearchNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		save := sp.pos
+		if _, ok := sp.binaryOp([]string{"AND"}, "(\""); !ok {
+			// implicit AND between juxtaposed terms, OR and ')' end the sequence
+			sp.skipSpaces()
+			if sp.pos == save || sp.eof() || sp.peek() == ')' || strings.HasPrefix(sp.src.Text[sp.pos:], "OR ") {
+				sp.pos = save
+				return left, nil
+			}
+		}
+
+		right, err := sp.parseSearchNot()
+		if err != nil {
+			return nil, err
+		}
+		left = sp.searchNode(&ODataSearchExpr{Op: "AND", Left: left, Right: right}, start)
+	}
+}
+
+func (sp *searchParser) parseSearchNot() (*ODataSearchExpr, error) {
+	start := sp.pos
+
+	if _, ok := sp.keyword([]string{"NOT"}, "(\""); ok {
+		if err := sp.enter(); err != nil {
+			return nil, err
+		}
+		defer func() { sp.depth-- }()
+
+		sp.skipSpaces()
+		operand, err := sp.parseSearchNot()
+		if err != nil {
+			return nil, err
+		}
+		return sp.searchNode(&ODataSearchExpr{Op: "NOT", Left: operand}, start), nil
+	}
+
+	switch sp.peek() {
+	case '(':
+		sp.pos++
+		sp.skipSpaces()
+		expr, err := sp.parseSearchOr()
+		if err != nil {
+			return nil, err
+		}
+		sp.skipSpaces()
+		if sp.peek() != ')' {
+			return nil, sp.errorf("expected ')'")
+		}
+		sp.pos++
+		return expr, nil
+
+	case '"':
+		phrase, err := sp.parsePhrase()
+		if err != nil {
+			return nil, err
+		}
+		return sp.searchNode(&ODataSearchExpr{Term: phrase, Phrase: true}, start), nil
+	}
+
+	for !sp.eof() && strings.IndexByte(" ()\"", sp.src.Text[sp.pos]) < 0 {
+		sp.pos++
+	}
+	term := sp.src.Text[start:sp.pos]
+	switch term {
+	case "":
+		return nil, sp.errorf("expected search term")
+	case "AND", "OR", "NOT":
+		sp.pos = start
+		return nil, sp.errorf("unexpected %s, expected search term", term)
+	}
+	return sp.searchNode(&ODataSearchExpr{Term: term}, start), nil
+}
+
+func (sp *searchParser) parsePhrase() (string, error) {
+	start := sp.pos
+	sp.pos++
+
+	var sb strings.Builder
+	for !sp.eof() {
+		c := sp.src.Text[sp.pos]
+		sp.pos++
+		switch {
+		case c == '"':
+			return sb.String(), nil
+		case c == '\\' && (sp.peek() == '"' || sp.peek() == '\\'):
+			sb.WriteByte(sp.src.Text[sp.pos])
+			sp.pos++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	sp.pos = start
+	return "", sp.errorf("unterminated phrase")
+}
@@ -0,0 +1,304 @@
+package openapi
+
+import (
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+)
+
+// decoder tracks the query parameters consumed by the described ones
+type decoder struct {
+	params []source.Param
+	query  *OpenAPIQuery
+
+	// claimed maps the index of a query parameter to the Parameter that
+	// consumed it
+	claimed map[int]*Parameter
+
+	// primitives records every decoded primitive for validation
+	primitives []primitiveValue
+}
+
+// primitiveValue is a decoded primitive and the text it comes from
+type primitiveValue struct {
+	param  *Parameter
+	schema *Schema
+	value  any
+	src    source.Source
+}
+
+func newDecoder(values *rfcquery.Values) *decoder {
+	return &decoder{
+		params: source.Params(values),
+		query: &OpenAPIQuery{
+			Values:      make(map[string]any),
+			Positions:   make(map[string]rfcquery.Position),
+			OtherParams: make(map[string][]string),
+		},
+		claimed: make(map[int]*Parameter),
+	}
+}
+
+// run decodes the query parameters of params. report receives the
+// decoding error of a parameter and returns false to stop
+func (d *decoder) run(params []Parameter, report func(error) bool) {
+	// a free-form exploded object takes the parameters no other one claims
+	var freeForm *Parameter
+	for i := range params {
+		param := &params[i]
+		if param.In != "" && param.In != "query" {
+			continue
+		}
+		if param.style() == StyleForm && param.explode() && param.schemaType() == "object" && len(param.Schema.Properties) == 0 {
+			freeForm = param
+			continue
+		}
+		if err := d.decode(param); err != nil && !report(err) {
+			return
+		}
+	}
+	if freeForm != nil {
+		if err := d.decodeFormObject(freeForm); err != nil {
+			report(err)
+		}
+	}
+
+	for i, param := range d.params {
+		if d.claimed[i] == nil {
+			d.query.OtherParams[param.Key] = append(d.query.OtherParams[param.Key], param.Value().Text)
+		}
+	}
+}
+
+// set stores the decoded value of name, first found at pos
+func (d *decoder) set(name string, value any, pos rfcquery.Position) {
+	d.query.Values[name] = value
+	d.query.Positions[name] = pos
+}
+
+// named returns the indexes of the parameters whose key is name
+func (d *decoder) named(name string) []int {
+	var found []int
+	for i, param := range d.params {
+		if param.Key == name {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+func (d *decoder) decode(param *Parameter) error {
+	kind := param.schemaType()
+	switch {
+	case param.style() == StyleDeepObject:
+		return d.decodeDeepObject(param)
+	case kind == "object" && param.explode():
+		return d.decodeFormObject(param)
+	case kind == "array" && param.explode():
+		return d.decodeExplodedArray(param)
+	}
+
+	found := d.named(param.Name)
+	if len(found) == 0 {
+		return nil
+	}
+	for _, i := range found {
+		d.claimed[i] = param
+	}
+	if len(found) > 1 {
+		return rfcquery.NewError(d.params[found[1]].Pos.Offset, "duplicate parameter %q", param.Name)
+	}
+
+	value := d.params[found[0]].Value()
+	var decoded any
+	var err error
+	switch kind {
+	case "array":
+		decoded, err = d.decodeArray(param, splitValue(value, param.style()))
+	case "object":
+		decoded, err = d.decodeObject(param, value, splitValue(value, param.style()))
+	default:
+		decoded, err = d.decodePrimitive(param, param.Schema, value)
+	}
+	if err != nil {
+		return err
+	}
+	d.set(param.Name, decoded, d.params[found[0]].Pos)
+	return nil
+}
+
+// decodeExplodedArray reads "color=blue&color=black&color=brown"
+func (d *decoder) decodeExplodedArray(param *Parameter) error {
+	found := d.named(param.Name)
+	if len(found) == 0 {
+		return nil
+	}
+
+	var items []source.Source
+	for _, i := range found {
+		d.claimed[i] = param
+		items = append(items, d.params[i].Value())
+	}
+	decoded, err := d.decodeArray(param, items)
+	if err != nil {
+		return err
+	}
+	d.set(param.Name, decoded, d.params[found[0]].Pos)
+	return nil
+}
+
+// decodeFormObject reads "R=100&G=200&B=150", the keys are the object
+// properties, or every unclaimed parameter for a free-form object
+func (d *decoder) decodeFormObject(param *Parameter) error {
+	object := make(map[string]any)
+	var pos *rfcquery.Position
+
+	for i, p := range d.params {
+		if d.claimed[i] != nil {
+			continue
+		}
+		prop, listed := param.Schema.Properties[p.Key]
+		if !listed && len(param.Schema.Properties) > 0 {
+			continue
+		}
+		d.claimed[i] = param
+		if _, dup := object[p.Key]; dup {
+			return rfcquery.NewError(p.Pos.Offset, "duplicate property %q of parameter %q", p.Key, param.Name)
+		}
+
+		value, err := d.decodePrimitive(param, prop, p.Value())
+		if err != nil {
+			return err
+		}
+		object[p.Key] = value
+		if pos == nil {
+			pos = &p.Pos
+		}
+	}
+
+	if pos != nil {
+		d.set(param.Name, object, *pos)
+	}
+	return nil
+}
+
+// decodeDeepObject reads "color[R]=100&color[G]=200&color[B]=150"
+func (d *decoder) decodeDeepObject(param *Parameter) error {
+	object := make(map[string]any)
+	var pos *rfcquery.Position
+
+	for i, p := range d.params {
+		name, ok := strings.CutPrefix(p.Key, param.Name+"[")
+		if !ok || !strings.HasSuffix(name, "]") || d.claimed[i] != nil {
+			continue
+		}
+		d.claimed[i] = param
+		name = strings.TrimSuffix(name, "]")
+		if strings.ContainsAny(name, "[]") {
+			return rfcquery.NewError(p.Pos.Offset, "nested deepObject key %q is not supported", p.Key)
+		}
+		if _, dup := object[name]; dup {
+			return rfcquery.NewError(p.Pos.Offset, "duplicate property %q of parameter %q", name, param.Name)
+		}
+
+		prop, listed := param.Schema.Properties[name]
+		if !listed && param.Schema.AdditionalProperties != nil && !*param.Schema.AdditionalProperties {
+			return rfcquery.NewError(p.Pos.Offset, "unknown property %q of parameter %q", name, param.Name)
+		}
+
+		value, err := d.decodePrimitive(param, prop, p.Value())
+		if err != nil {
+			return err
+		}
+		object[name] = value
+		if pos == nil {
+			pos = &p.Pos
+		}
+	}
+
+	if pos != nil {
+		d.set(param.Name, object, *pos)
+	}
+	return nil
+}
+
+// splitValue splits a non-exploded value on the delimiter of style. An
+// empty value has no items
+func splitValue(value source.Source, style string) []source.Source {
+	if len(value.Tokens) == 0 {
+		return nil
+	}
+
+	var items []source.Source
+	start := 0
+	for i, tok := range value.Tokens {
+		if isDelimiter(tok, style) {
+			items = append(items, value.Slice(start, i))
+			start = i + 1
+		}
+	}
+	return append(items, value.Slice(start, len(value.Tokens)))
+}
+
+// isDelimiter reports whether tok separates the items of a non-exploded
+// value of style
+func isDelimiter(tok rfcquery.Token, style string) bool {
+	switch style {
+	case StyleSpaceDelimited:
+		return tok.Type == rfcquery.TokenPercentEncoded && tok.Decoded == " "
+	case StylePipeDelimited:
+		return tok.Type == rfcquery.TokenPercentEncoded && tok.Decoded == "|"
+	default:
+		return tok.Type == rfcquery.TokenSubDelims && tok.Value == ","
+	}
+}
+
+// decodeArray coerces the items of an array, a single empty item is an
+// empty array
+func (d *decoder) decodeArray(param *Parameter, items []source.Source) ([]any, error) {
+	array := []any{}
+	if len(items) == 1 && items[0].Text == "" {
+		return array, nil
+	}
+
+	for _, item := range items {
+		value, err := d.decodePrimitive(param, param.Schema.Items, item)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+	}
+	return array, nil
+}
+
+// decodeObject pairs the items of "R,100,G,200,B,150"
+func (d *decoder) decodeObject(param *Parameter, value source.Source, items []source.Source) (map[string]any, error) {
+	object := make(map[string]any)
+	if len(items)%2 != 0 {
+		return nil, value.Errorf(0, "parameter %q needs name and value pairs, got %d items", param.Name, len(items))
+	}
+
+	for i := 0; i < len(items); i += 2 {
+		name := items[i].Text
+		if _, dup := object[name]; dup {
+			return nil, items[i].Errorf(0, "duplicate property %q of parameter %q", name, param.Name)
+		}
+		v, err := d.decodePrimitive(param, param.Schema.Properties[name], items[i+1])
+		if err != nil {
+			return nil, err
+		}
+		object[name] = v
+	}
+	return object, nil
+}
+
+func (d *decoder) decodePrimitive(param *Parameter, schema *Schema, value source.Source) (any, error) {
+	kind := typeOf(schema)
+	v, err := coerce(kind, value.Text)
+	if err != nil {
+		return nil, value.Errorf(0, "invalid %s value %q for parameter %q", kind, value.Text, param.Name)
+	}
+	d.primitives = append(d.primitives, primitiveValue{param: param, schema: schema, value: v, src: value})
+	return v, nil
+}
@@ -0,0 +1,189 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+)
+
+// Document is the subset of an OpenAPI 3.x document that describes query
+// parameters
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Components holds the reusable parameters and schemas
+type Components struct {
+	Parameters map[string]*Parameter `json:"parameters"`
+	Schemas    map[string]*Schema    `json:"schemas"`
+}
+
+// PathItem holds the operations of a path and their shared parameters
+type PathItem struct {
+	Parameters []Parameter `json:"parameters"`
+
+	Get     *Operation `json:"get"`
+	Put     *Operation `json:"put"`
+	Post    *Operation `json:"post"`
+	Delete  *Operation `json:"delete"`
+	Options *Operation `json:"options"`
+	Head    *Operation `json:"head"`
+	Patch   *Operation `json:"patch"`
+	Trace   *Operation `json:"trace"`
+}
+
+// Operation is an operation of a path
+type Operation struct {
+	OperationID string      `json:"operationId"`
+	Parameters  []Parameter `json:"parameters"`
+}
+
+// maxRefDepth bounds the chains of $ref, recursive schemas have no
+// meaning in a query string
+const maxRefDepth = 32
+
+// LoadDocument reads an OpenAPI 3.x document in JSON or YAML from disk
+func LoadDocument(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// ParseDocument reads an OpenAPI 3.x document in JSON or YAML. YAML is
+// limited to the subset documents are written in: block and flow
+// collections, plain and quoted scalars, block scalars and comments, but
+// no anchors, aliases or tags
+func ParseDocument(data []byte) (*Document, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		value, err := parseYAML(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q, expected 3.x", doc.OpenAPI)
+	}
+	return &doc, nil
+}
+
+// operations lists the operations of the path item
+func (item *PathItem) operations() []*Operation {
+	return []*Operation{item.Get, item.Put, item.Post, item.Delete, item.Options, item.Head, item.Patch, item.Trace}
+}
+
+// QueryParameters returns the query parameters of an operation, the
+// parameters of its path included, with every $ref resolved
+func (doc *Document) QueryParameters(operationID string) ([]Parameter, error) {
+	for _, item := range doc.Paths {
+		if item == nil {
+			continue
+		}
+		for _, op := range item.operations() {
+			if op == nil || op.OperationID != operationID {
+				continue
+			}
+
+			// operation parameters override the path parameters of the same name and location
+			var params []Parameter
+			for _, list := range [][]Parameter{op.Parameters, item.Parameters} {
+				for _, param := range list {
+					resolved, err := doc.resolveParameter(param)
+					if err != nil {
+						return nil, fmt.Errorf("operation %q: %w", operationID, err)
+					}
+					if resolved.In == "query" && !hasParameter(params, resolved.Name) {
+						params = append(params, resolved)
+					}
+				}
+			}
+			return params, nil
+		}
+	}
+	return nil, fmt.Errorf("operation %q not found", operationID)
+}
+
+func hasParameter(params []Parameter, name string) bool {
+	for _, param := range params {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (doc *Document) resolveParameter(param Parameter) (Parameter, error) {
+	for depth := 0; param.Ref != ""; depth++ {
+		name, ok := strings.CutPrefix(param.Ref, "#/components/parameters/")
+		target := doc.Components.Parameters[unescapePointer(name)]
+		if !ok || target == nil || depth == maxRefDepth {
+			return param, fmt.Errorf("unresolvable parameter reference %q", param.Ref)
+		}
+		param = *target
+	}
+
+	schema, err := doc.resolveSchema(param.Schema, 0)
+	param.Schema = schema
+	return param, err
+}
+
+// resolveSchema returns a copy of schema with every $ref replaced by its
+// target
+func (doc *Document) resolveSchema(schema *Schema, depth int) (*Schema, error) {
+	if schema == nil {
+		return nil, nil
+	}
+	if depth == maxRefDepth {
+		return nil, fmt.Errorf("schema references nested deeper than %d levels", maxRefDepth)
+	}
+
+	for ref := schema.Ref; ref != ""; ref = schema.Ref {
+		name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+		target := doc.Components.Schemas[unescapePointer(name)]
+		if !ok || target == nil {
+			return nil, fmt.Errorf("unresolvable schema reference %q", ref)
+		}
+		if depth++; depth == maxRefDepth {
+			return nil, fmt.Errorf("schema references nested deeper than %d levels", maxRefDepth)
+		}
+		schema = target
+	}
+
+	resolved := *schema
+	var err error
+	if resolved.Items, err = doc.resolveSchema(schema.Items, depth+1); err != nil {
+		return nil, err
+	}
+	if schema.Properties != nil {
+		resolved.Properties = maps.Clone(schema.Properties)
+		for name, prop := range schema.Properties {
+			if resolved.Properties[name], err = doc.resolveSchema(prop, depth+1); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &resolved, nil
+}
+
+// unescapePointer decodes a JSON pointer segment
+func unescapePointer(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+}
@@ -0,0 +1,134 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Encode serializes value as the query parameter param, the reverse of
+// OpenAPIParser. Primitives are strings, booleans, integers and floats,
+// arrays are slices and objects are maps with string keys, written in
+// sorted key order. A nil value encodes to ""
+func Encode(param Parameter, value any) (string, error) {
+	if err := param.check(); err != nil {
+		return "", err
+	}
+	if value == nil {
+		return "", nil
+	}
+
+	name := escape(param.Name, false)
+	rv := reflect.ValueOf(value)
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if param.schemaType() != "array" {
+			return "", fmt.Errorf("parameter %q: cannot encode %T as %s", param.Name, value, param.schemaType())
+		}
+		items := make([]string, rv.Len())
+		for i := range items {
+			item, err := primitive(param, rv.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			items[i] = item
+		}
+		if param.explode() && len(items) > 0 {
+			return name + "=" + strings.Join(items, "&"+name+"="), nil
+		}
+		return name + "=" + strings.Join(items, delimiter(param.style())), nil
+
+	case reflect.Map:
+		if param.schemaType() != "object" || rv.Type().Key().Kind() != reflect.String {
+			return "", fmt.Errorf("parameter %q: cannot encode %T as %s", param.Name, value, param.schemaType())
+		}
+		keys := make([]string, 0, rv.Len())
+		for _, key := range rv.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		slices.Sort(keys)
+
+		var pairs []string
+		for _, key := range keys {
+			v, err := primitive(param, rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())).Interface())
+			if err != nil {
+				return "", err
+			}
+			switch {
+			case param.style() == StyleDeepObject:
+				pairs = append(pairs, name+"%5B"+escape(key, false)+"%5D="+v)
+			case param.explode():
+				pairs = append(pairs, escape(key, false)+"="+v)
+			default:
+				pairs = append(pairs, escape(key, param.AllowReserved), v)
+			}
+		}
+		if param.explode() {
+			return strings.Join(pairs, "&"), nil
+		}
+		return name + "=" + strings.Join(pairs, delimiter(param.style())), nil
+
+	default:
+		if !isPrimitive(param.schemaType()) {
+			return "", fmt.Errorf("parameter %q: cannot encode %T as %s", param.Name, value, param.schemaType())
+		}
+		v, err := primitive(param, value)
+		if err != nil {
+			return "", err
+		}
+		return name + "=" + v, nil
+	}
+}
+
+// primitive formats and escapes a primitive value
+func primitive(param Parameter, value any) (string, error) {
+	var s string
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.String:
+		s = v.String()
+	case reflect.Bool:
+		s = strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		s = strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	default:
+		return "", fmt.Errorf("parameter %q: %T is not a primitive", param.Name, value)
+	}
+	return escape(s, param.AllowReserved), nil
+}
+
+// delimiter returns the encoded separator of non-exploded values
+func delimiter(style string) string {
+	switch style {
+	case StyleSpaceDelimited:
+		return "%20"
+	case StylePipeDelimited:
+		return "%7C"
+	default:
+		return ","
+	}
+}
+
+// escape percent-encodes everything but the unreserved characters, and
+// the reserved characters valid in a query when allowReserved is set
+func escape(s string, allowReserved bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', strings.IndexByte("-._~", c) >= 0:
+			sb.WriteByte(c)
+		case allowReserved && strings.IndexByte("!$&'()*+,;=:@/?", c) >= 0:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,110 @@
+package openapi
+
+import (
+	"fmt"
+
+	"github.com/CRSylar/rfcquery"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+// OpenAPIQuery holds the query parameters decoded from their OpenAPI
+// serialization
+type OpenAPIQuery struct {
+	// Values maps parameter names to string, int64, float64 or bool
+	// primitives, []any arrays and map[string]any objects. Absent
+	// parameters have no entry
+	Values map[string]any
+
+	// Positions maps parameter names to the position of their first key
+	Positions map[string]rfcquery.Position
+
+	// OtherParams holds the parameters that no Parameter describes
+	OtherParams map[string][]string
+}
+
+// OpenAPIParser decodes query parameters per the style and explode of
+// their OpenAPI 3 description.
+//
+// Delimiters are read from the token stream: the ',' of form must be raw,
+// so that "%2C" is data, while the ' ' of spaceDelimited and the '|' of
+// pipeDelimited are always percent-encoded, "%20" and "%7C". deepObject
+// brackets are percent-encoded as well, "color%5BR%5D=100"
+type OpenAPIParser struct {
+	// Parameters describes the expected parameters
+	Parameters []Parameter
+
+	// StrictValidation enforces RFC3986 compliance
+	StrictValidation bool
+}
+
+// NewOpenAPIParser creates a parser decoding the given parameters
+func NewOpenAPIParser(params ...Parameter) *OpenAPIParser {
+	return &OpenAPIParser{
+		Parameters:       params,
+		StrictValidation: true,
+	}
+}
+
+// Name returns the parser identifier
+func (p *OpenAPIParser) Name() string {
+	return "openapi"
+}
+
+// Parse implements the Parser interface
+func (p *OpenAPIParser) Parse(scanner *rfcquery.Scanner) (any, error) {
+	for _, param := range p.Parameters {
+		if err := param.check(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.StrictValidation {
+		if err := scanner.Valid(); err != nil {
+			return nil, fmt.Errorf("RFC3986 validation failed: %w", err)
+		}
+		scanner.Reset()
+	}
+
+	formParser := &formurlencoded.FormURLEncodedParser{}
+	result, err := formParser.Parse(scanner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query parameters: %w", err)
+	}
+
+	d := newDecoder(result.(*rfcquery.Values))
+	d.run(p.Parameters, func(decodeErr error) bool {
+		err = decodeErr
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, param := range p.Parameters {
+		if _, ok := d.query.Values[param.Name]; !ok && param.Required && (param.In == "" || param.In == "query") {
+			return nil, fmt.Errorf("missing required parameter %q", param.Name)
+		}
+	}
+
+	return d.query, nil
+}
+
+// ParseOpenAPIQuery - convenience function
+func ParseOpenAPIQuery(query string, params ...Parameter) (*OpenAPIQuery, error) {
+	scanner := rfcquery.NewScanner(query)
+	if err := scanner.Valid(); err != nil {
+		return nil, err
+	}
+
+	result, err := NewOpenAPIParser(params...).Parse(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, ok := result.(*OpenAPIQuery)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %T", result)
+	}
+
+	return parsed, nil
+}
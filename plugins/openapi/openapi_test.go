@@ -0,0 +1,427 @@
+package openapi_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/plugins/openapi"
+)
+
+var (
+	yes = true
+	no  = false
+
+	stringSchema = &openapi.Schema{Type: "string"}
+	arraySchema  = &openapi.Schema{Type: "array", Items: stringSchema}
+	objectSchema = &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+		"R": {Type: "integer"}, "G": {Type: "integer"}, "B": {Type: "integer"},
+	}}
+
+	array  = []any{"blue", "black", "brown"}
+	object = map[string]any{"R": int64(100), "G": int64(200), "B": int64(150)}
+)
+
+// styleExamples is the query column of the Style Examples table of the
+// specification, with the '|' delimiter and the deepObject brackets
+// percent-encoded. Objects are encoded in sorted key order
+var styleExamples = []struct {
+	name    string
+	style   string
+	explode *bool
+	schema  *openapi.Schema
+	value   any
+	query   string
+	encoded string // when it differs from query
+}{
+	{"form empty", openapi.StyleForm, &no, stringSchema, "", "color=", ""},
+	{"form exploded empty", openapi.StyleForm, &yes, stringSchema, "", "color=", ""},
+	{"form string", openapi.StyleForm, &no, stringSchema, "blue", "color=blue", ""},
+	{"form exploded string", openapi.StyleForm, &yes, stringSchema, "blue", "color=blue", ""},
+	{"form array", openapi.StyleForm, &no, arraySchema, array, "color=blue,black,brown", ""},
+	{"form exploded array", openapi.StyleForm, &yes, arraySchema, array, "color=blue&color=black&color=brown", ""},
+	{"form object", openapi.StyleForm, &no, objectSchema, object, "color=R,100,G,200,B,150", "color=B,150,G,200,R,100"},
+	{"form exploded object", openapi.StyleForm, &yes, objectSchema, object, "R=100&G=200&B=150", "B=150&G=200&R=100"},
+	{"spaceDelimited array", openapi.StyleSpaceDelimited, &no, arraySchema, array, "color=blue%20black%20brown", ""},
+	{"spaceDelimited object", openapi.StyleSpaceDelimited, &no, objectSchema, object,
+		"color=R%20100%20G%20200%20B%20150", "color=B%20150%20G%20200%20R%20100"},
+	{"pipeDelimited array", openapi.StylePipeDelimited, &no, arraySchema, array, "color=blue%7Cblack%7Cbrown", ""},
+	{"pipeDelimited object", openapi.StylePipeDelimited, &no, objectSchema, object,
+		"color=R%7C100%7CG%7C200%7CB%7C150", "color=B%7C150%7CG%7C200%7CR%7C100"},
+	{"deepObject", openapi.StyleDeepObject, &yes, objectSchema, object,
+		"color%5BR%5D=100&color%5BG%5D=200&color%5BB%5D=150", "color%5BB%5D=150&color%5BG%5D=200&color%5BR%5D=100"},
+}
+
+func TestOpenAPIParser_StyleExamples(t *testing.T) {
+	for _, tt := range styleExamples {
+		t.Run(tt.name, func(t *testing.T) {
+			param := openapi.Parameter{Name: "color", Style: tt.style, Explode: tt.explode, Schema: tt.schema}
+
+			query, err := openapi.ParseOpenAPIQuery(tt.query, param)
+			if err != nil {
+				t.Fatalf("ParseOpenAPIQuery() error = %v", err)
+			}
+			if got := query.Values["color"]; !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("decoded %#v, want %#v", got, tt.value)
+			}
+			if len(query.OtherParams) != 0 {
+				t.Errorf("OtherParams = %v, want none", query.OtherParams)
+			}
+
+			want := tt.query
+			if tt.encoded != "" {
+				want = tt.encoded
+			}
+			if got, err := openapi.Encode(param, tt.value); err != nil || got != want {
+				t.Errorf("Encode() = %q, %v, want %q", got, err, want)
+			}
+		})
+	}
+}
+
+func TestOpenAPIParser_Parse(t *testing.T) {
+	params := []openapi.Parameter{
+		{Name: "ids", Style: openapi.StyleForm, Explode: &no, Schema: &openapi.Schema{Type: "array", Items: &openapi.Schema{Type: "integer"}}},
+		{Name: "tags", Schema: arraySchema},
+		{Name: "limit", Schema: &openapi.Schema{Type: "integer"}, Required: true},
+		{Name: "verbose", Schema: &openapi.Schema{Type: "boolean"}},
+		{Name: "filter", Style: openapi.StyleDeepObject, Schema: &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+			"min": {Type: "number"},
+		}}},
+		{Name: "X-Trace", In: "header"},
+		{Name: "extra", Schema: &openapi.Schema{Type: "object"}},
+	}
+
+	query, err := openapi.ParseOpenAPIQuery("ids=1,2,3&tags=a%2Cb&tags=c&limit=10&verbose=true&"+
+		"filter%5Bmin%5D=1.5&filter%5Bname%5D=x&page=2", params...)
+	if err != nil {
+		t.Fatalf("ParseOpenAPIQuery() error = %v", err)
+	}
+
+	want := map[string]any{
+		"ids":     []any{int64(1), int64(2), int64(3)},
+		"tags":    []any{"a,b", "c"},
+		"limit":   int64(10),
+		"verbose": true,
+		"filter":  map[string]any{"min": 1.5, "name": "x"},
+		"extra":   map[string]any{"page": "2"},
+	}
+	if !reflect.DeepEqual(query.Values, want) {
+		t.Errorf("Values = %#v, want %#v", query.Values, want)
+	}
+	if pos := query.Positions["tags"]; pos.Offset != 10 {
+		t.Errorf("tags at %d, want 10", pos.Offset)
+	}
+	if len(query.OtherParams) != 0 {
+		t.Errorf("OtherParams = %v, the free-form object takes them", query.OtherParams)
+	}
+
+	tags, err := openapi.Encode(params[1], []string{"a,b", "c d"})
+	if err != nil || tags != "tags=a%2Cb&tags=c%20d" {
+		t.Errorf("Encode() = %q, %v", tags, err)
+	}
+	reserved := openapi.Parameter{Name: "path", AllowReserved: true}
+	if got, _ := openapi.Encode(reserved, "/a/b?c"); got != "path=/a/b?c" {
+		t.Errorf("Encode() with AllowReserved = %q", got)
+	}
+}
+
+func TestOpenAPIParser_Errors(t *testing.T) {
+	ints := &openapi.Schema{Type: "array", Items: &openapi.Schema{Type: "integer"}}
+	closedSchema := &openapi.Schema{Type: "object", Properties: objectSchema.Properties, AdditionalProperties: &no}
+
+	tests := []struct {
+		name    string
+		param   openapi.Parameter
+		query   string
+		wantPos int
+		wantMsg string
+	}{
+		{"bad item", openapi.Parameter{Name: "ids", Explode: &no, Schema: ints}, "ids=1,x", 6, `invalid integer value "x"`},
+		{"odd pairs", openapi.Parameter{Name: "c", Explode: &no, Schema: objectSchema}, "c=R,1,G", 2, "name and value pairs"},
+		{"duplicate", openapi.Parameter{Name: "c", Explode: &no, Schema: arraySchema}, "c=a&c=b", 4, `duplicate parameter "c"`},
+		{"bad boolean", openapi.Parameter{Name: "v", Schema: &openapi.Schema{Type: "boolean"}}, "v=1", 2, "invalid boolean"},
+		{"nested deepObject", openapi.Parameter{Name: "f", Style: openapi.StyleDeepObject, Schema: objectSchema},
+			"f%5Ba%5D%5Bb%5D=1", 0, "nested deepObject key"},
+		{"additional deepObject property", openapi.Parameter{Name: "f", Style: openapi.StyleDeepObject, Schema: closedSchema},
+			"f%5BR%5D=1&f%5Bname%5D=x", 11, `unknown property "name" of parameter "f"`},
+		{"missing required", openapi.Parameter{Name: "q", Required: true}, "x=1", -1, `missing required parameter "q"`},
+		{"deepObject array", openapi.Parameter{Name: "f", Style: openapi.StyleDeepObject, Schema: arraySchema},
+			"f=1", -1, "deepObject applies to exploded objects"},
+		{"spaceDelimited string", openapi.Parameter{Name: "s", Style: openapi.StyleSpaceDelimited}, "s=1", -1, "applies to arrays and objects"},
+		{"exploded pipe object", openapi.Parameter{Name: "p", Style: openapi.StylePipeDelimited, Explode: &yes, Schema: objectSchema},
+			"p=1", -1, "does not explode objects"},
+		{"nested array", openapi.Parameter{Name: "n", Schema: &openapi.Schema{Type: "array", Items: arraySchema}}, "n=1", -1, "items must be primitive"},
+		{"unknown style", openapi.Parameter{Name: "u", Style: "matrix"}, "u=1", -1, `unknown style "matrix"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := openapi.ParseOpenAPIQuery(tt.query, tt.param)
+			if tt.wantPos < 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantMsg) {
+					t.Errorf("got %v, want %q", err, tt.wantMsg)
+				}
+				return
+			}
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func FuzzOpenAPIParser_Parse(f *testing.F) {
+	for _, example := range styleExamples {
+		f.Add(example.query)
+	}
+
+	params := []openapi.Parameter{
+		{Name: "color", Explode: &no, Schema: arraySchema},
+		{Name: "space", Style: openapi.StyleSpaceDelimited, Schema: arraySchema},
+		{Name: "pipe", Style: openapi.StylePipeDelimited, Schema: objectSchema},
+		{Name: "deep", Style: openapi.StyleDeepObject, Schema: &openapi.Schema{Type: "object"}},
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		query, err := openapi.ParseOpenAPIQuery(input, params...)
+		if err != nil {
+			return
+		}
+
+		// re-encoding a decoded value decodes to the same value
+		for _, param := range params {
+			value, ok := query.Values[param.Name]
+			if !ok {
+				continue
+			}
+			encoded, err := openapi.Encode(param, value)
+			if err != nil {
+				t.Fatalf("Encode(%s, %#v) error = %v", param.Name, value, err)
+			}
+			again, err := openapi.ParseOpenAPIQuery(encoded, param)
+			if err != nil {
+				t.Fatalf("ParseOpenAPIQuery(%q) error = %v", encoded, err)
+			}
+			if !reflect.DeepEqual(again.Values[param.Name], value) {
+				t.Fatalf("%q decodes to %#v, re-encoded as %q it decodes to %#v", input, value, encoded, again.Values[param.Name])
+			}
+		}
+	})
+}
+
+const petsYAML = `
+openapi: 3.1.0 # the 3.1 type lists and numeric exclusive bounds
+info:
+  title: Pets
+  description: |
+    Lists the pets,
+    by status.
+paths:
+  /pets:
+    parameters:
+    - $ref: '#/components/parameters/limit'
+    get:
+      operationId: listPets
+      parameters:
+        - name: status
+          in: query
+          required: true
+          schema:
+            type: string
+            enum: [available, pending, sold]
+        - name: tags
+          in: query
+          explode: false
+          schema:
+            type: array
+            items: {type: string, maxLength: 8}
+            maxItems: 3
+        - name: name
+          in: query
+          schema: {$ref: '#/components/schemas/Name'}
+        - name: filter
+          in: query
+          style: deepObject
+          schema:
+            type: object
+            required: [kind]
+            properties:
+              kind: {type: string}
+              age:
+                type: integer
+                minimum: 0
+            additionalProperties: {type: string}
+        - name: X-Trace
+          in: header
+components:
+  parameters:
+    limit:
+      name: limit
+      in: query
+      schema:
+        type: [integer, "null"]
+        minimum: 1
+        exclusiveMaximum: 100
+  schemas:
+    Name:
+      type: string
+      pattern: >-
+        ^[a-z]+$
+`
+
+const petsJSON = `{
+  "openapi": "3.0.3",
+  "paths": {"/pets": {"get": {"operationId": "listPets", "parameters": [
+    {"name": "limit", "in": "query", "schema": {"type": "integer", "maximum": 100, "exclusiveMaximum": true}},
+    {"name": "q", "in": "query", "allowReserved": true}
+  ]}}}
+}`
+
+func TestParseDocument(t *testing.T) {
+	doc, err := openapi.ParseDocument([]byte(petsYAML))
+	if err != nil {
+		t.Fatalf("ParseDocument() error = %v", err)
+	}
+	params, err := doc.QueryParameters("listPets")
+	if err != nil {
+		t.Fatalf("QueryParameters() error = %v", err)
+	}
+
+	var names []string
+	for _, param := range params {
+		names = append(names, param.Name)
+	}
+	if want := []string{"status", "tags", "name", "filter", "limit"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("query parameters = %v, want %v", names, want)
+	}
+
+	limit := params[4].Schema
+	if limit.Type != "integer" || *limit.Minimum != 1 || *limit.Maximum != 100 || limit.ExclusiveMinimum || !limit.ExclusiveMaximum {
+		t.Errorf("limit schema = %+v", limit)
+	}
+	if name := params[2].Schema; name.Ref != "" || name.Pattern != "^[a-z]+$" {
+		t.Errorf("name schema = %+v, want the resolved reference", name)
+	}
+	if items := params[1].Schema.Items; items.Type != "string" || *items.MaxLength != 8 {
+		t.Errorf("tags items = %+v", items)
+	}
+	if additional := params[3].Schema.AdditionalProperties; additional == nil || !*additional {
+		t.Errorf("filter additionalProperties = %v, want the schema read as true", additional)
+	}
+
+	doc, err = openapi.ParseDocument([]byte(petsJSON))
+	if err != nil {
+		t.Fatalf("ParseDocument() error = %v", err)
+	}
+	params, err = doc.QueryParameters("listPets")
+	if err != nil || len(params) != 2 || !params[0].Schema.ExclusiveMaximum || !params[1].AllowReserved {
+		t.Errorf("QueryParameters() = %+v, %v", params, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "pets.yaml")
+	if err := os.WriteFile(path, []byte(petsYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openapi.LoadDocument(path); err != nil {
+		t.Errorf("LoadDocument() error = %v", err)
+	}
+}
+
+func TestParseDocument_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantMsg string
+	}{
+		{"swagger", "swagger: '2.0'\n", "unsupported OpenAPI version"},
+		{"tab", "openapi: 3.0.0\npaths:\n\t/a: {}\n", "line 3: tabs are not allowed"},
+		{"duplicate key", "openapi: 3.0.0\nopenapi: 3.1.0\n", `line 2: duplicate key "openapi"`},
+		{"anchor", "openapi: 3.0.0\ncomponents: &c\n", "line 2: anchors, aliases and tags are not supported"},
+		{"unterminated flow", "openapi: 3.0.0\npaths: {a: [1\n", "unterminated flow collection"},
+		{"bad indentation", "openapi: 3.0.0\npaths:\n    a: 1\n  b: 2\n", "line 4: unexpected indentation"},
+		{"bad json", `{"openapi": 3}`, "invalid OpenAPI document"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := openapi.ParseDocument([]byte(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("got %v, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestValidateQuery(t *testing.T) {
+	doc, err := openapi.ParseDocument([]byte(petsYAML))
+	if err != nil {
+		t.Fatalf("ParseDocument() error = %v", err)
+	}
+
+	type violation struct {
+		pos int
+		msg string
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  []violation
+	}{
+		{"valid", "status=sold&tags=a,b&limit=99&name=rex&filter%5Bkind%5D=dog&filter%5Bname%5D=rex", nil},
+		{"violations", "status=lost&tags=a,b,c,d&limit=100&name=Rex!&filter%5Bage%5D=-1&page=2", []violation{
+			{7, `value "lost" is not one of [available pending sold]`},
+			{12, `parameter "tags" allows at most 3 items, got 4`},
+			{31, "value 100 is above the maximum 100"},
+			{40, `value "Rex!" does not match pattern "^[a-z]+$"`},
+			{43, `reserved character "!" in parameter "name" must be percent-encoded`},
+			{45, `parameter "filter" is missing required property "kind"`},
+			{61, "value -1 is below the minimum 0"},
+			{64, `unknown parameter "page"`},
+		}},
+		{"missing", "limit=5", []violation{{7, `missing required parameter "status"`}}},
+		{"invalid type", "status=sold&limit=x&tags=toolongtag", []violation{
+			{18, `invalid integer value "x" for parameter "limit"`},
+			{25, `value "toolongtag" is longer than 8 characters`},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := openapi.ValidateQuery(doc, "listPets", tt.query)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("ValidateQuery() error = %v", err)
+				}
+				return
+			}
+
+			var validationErr *openapi.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected *openapi.ValidationError, got %v", err)
+			}
+			if len(validationErr.Violations) != len(tt.want) {
+				t.Fatalf("got %d violations, want %d: %v", len(validationErr.Violations), len(tt.want), err)
+			}
+			for i, w := range tt.want {
+				got := validationErr.Violations[i]
+				if got.Pos.Offset != w.pos || !strings.Contains(got.Msg, w.msg) {
+					t.Errorf("violation %d = %q at %d, want %q at %d", i, got.Msg, got.Pos.Offset, w.msg, w.pos)
+				}
+			}
+		})
+	}
+
+	if err := openapi.ValidateQuery(doc, "deletePet", "status=sold"); err == nil || !strings.Contains(err.Error(), `operation "deletePet" not found`) {
+		t.Errorf("unknown operation: got %v", err)
+	}
+}
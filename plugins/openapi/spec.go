@@ -0,0 +1,255 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Parameter styles of OpenAPI 3 query parameters
+const (
+	StyleForm           = "form"
+	StyleSpaceDelimited = "spaceDelimited"
+	StylePipeDelimited  = "pipeDelimited"
+	StyleDeepObject     = "deepObject"
+)
+
+// Parameter describes a query parameter as an OpenAPI 3 Parameter Object
+type Parameter struct {
+	// Ref is a local reference, "#/components/parameters/limit", resolved
+	// by Document.QueryParameters
+	Ref string `json:"$ref,omitempty"`
+
+	Name string `json:"name"`
+
+	// In is the parameter location, only "query" parameters (or an empty
+	// In) are decoded from a query string
+	In string `json:"in,omitempty"`
+
+	// Style is one of the Style constants, empty means form
+	Style string `json:"style,omitempty"`
+
+	// Explode is nil for the style default: true for form, false otherwise.
+	// deepObject is only defined exploded, so nil is true for it as well
+	Explode *bool `json:"explode,omitempty"`
+
+	Required bool `json:"required,omitempty"`
+
+	// AllowReserved lets Encode write the reserved characters of values
+	// without percent-encoding them
+	AllowReserved bool `json:"allowReserved,omitempty"`
+
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Schema is the subset of a Schema Object that drives serialization and
+// validation
+type Schema struct {
+	// Ref is a local reference, "#/components/schemas/Color", resolved by
+	// Document.QueryParameters
+	Ref string `json:"$ref,omitempty"`
+
+	// Type is "string", "integer", "number", "boolean", "array" or
+	// "object". Empty is read as "string"
+	Type string `json:"type,omitempty"`
+
+	// Items is the schema of array items, nil for strings
+	Items *Schema `json:"items,omitempty"`
+
+	// Properties are the schemas of object properties. Properties that are
+	// not listed decode as strings
+	Properties map[string]*Schema `json:"properties,omitempty"`
+
+	// Required lists the required properties of an object
+	Required []string `json:"required,omitempty"`
+
+	// AdditionalProperties set to false rejects the deepObject properties
+	// that are not listed. Nil allows them, and so does a schema, which is
+	// read as true
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
+
+	Enum []any `json:"enum,omitempty"`
+
+	// Minimum and Maximum bound numbers, exclusively when the matching
+	// Exclusive flag is set. The numeric exclusiveMinimum and
+	// exclusiveMaximum of OpenAPI 3.1 are read into them as well
+	Minimum          *float64 `json:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty"`
+	ExclusiveMinimum bool     `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum bool     `json:"exclusiveMaximum,omitempty"`
+
+	// MinLength, MaxLength and Pattern constrain strings, lengths count
+	// characters
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+
+	MinItems *int `json:"minItems,omitempty"`
+	MaxItems *int `json:"maxItems,omitempty"`
+}
+
+// UnmarshalJSON reads a Schema Object of OpenAPI 3.0 or 3.1: the type may
+// be a list such as ["string", "null"], and the exclusive bounds booleans
+// or numbers
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type plain Schema
+	var raw struct {
+		*plain
+		Type             json.RawMessage `json:"type"`
+		ExclusiveMinimum json.RawMessage `json:"exclusiveMinimum"`
+		ExclusiveMaximum json.RawMessage `json:"exclusiveMaximum"`
+
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}
+	raw.plain = (*plain)(s)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if len(raw.Type) > 0 {
+		var types []string
+		if err := json.Unmarshal(raw.Type, &s.Type); err != nil {
+			if err := json.Unmarshal(raw.Type, &types); err != nil {
+				return fmt.Errorf("schema type must be a string or a list of strings")
+			}
+			for _, t := range types {
+				if t != "null" {
+					s.Type = t
+					break
+				}
+			}
+		}
+	}
+
+	for _, bound := range []struct {
+		raw       json.RawMessage
+		value     **float64
+		exclusive *bool
+	}{
+		{raw.ExclusiveMinimum, &s.Minimum, &s.ExclusiveMinimum},
+		{raw.ExclusiveMaximum, &s.Maximum, &s.ExclusiveMaximum},
+	} {
+		if len(bound.raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(bound.raw, bound.exclusive); err == nil {
+			continue
+		}
+		var n float64
+		if err := json.Unmarshal(bound.raw, &n); err != nil {
+			return fmt.Errorf("exclusive bounds must be booleans or numbers")
+		}
+		*bound.value, *bound.exclusive = &n, true
+	}
+
+	if len(raw.AdditionalProperties) > 0 {
+		allowed := true
+		if err := json.Unmarshal(raw.AdditionalProperties, &allowed); err != nil {
+			var schema Schema
+			if err := json.Unmarshal(raw.AdditionalProperties, &schema); err != nil {
+				return fmt.Errorf("additionalProperties must be a boolean or a schema")
+			}
+		}
+		s.AdditionalProperties = &allowed
+	}
+	return nil
+}
+
+// style returns the effective style of p
+func (p Parameter) style() string {
+	if p.Style == "" {
+		return StyleForm
+	}
+	return p.Style
+}
+
+// explode returns the effective explode of p
+func (p Parameter) explode() bool {
+	if p.Explode != nil {
+		return *p.Explode
+	}
+	return p.style() == StyleForm || p.style() == StyleDeepObject
+}
+
+// schemaType returns the type of p, "string" when it has no schema
+func (p Parameter) schemaType() string {
+	return typeOf(p.Schema)
+}
+
+func typeOf(s *Schema) string {
+	if s == nil || s.Type == "" {
+		return "string"
+	}
+	return s.Type
+}
+
+// check rejects the style, explode and type combinations that the
+// serialization tables of the specification mark as n/a
+func (p Parameter) check() error {
+	if p.Name == "" {
+		return fmt.Errorf("parameter without a name")
+	}
+
+	kind := p.schemaType()
+	switch kind {
+	case "string", "integer", "number", "boolean":
+	case "array":
+		if !isPrimitive(typeOf(p.Schema.Items)) {
+			return fmt.Errorf("parameter %q: array items must be primitive", p.Name)
+		}
+	case "object":
+		for name, prop := range p.Schema.Properties {
+			if !isPrimitive(typeOf(prop)) {
+				return fmt.Errorf("parameter %q: property %q must be primitive", p.Name, name)
+			}
+		}
+	default:
+		return fmt.Errorf("parameter %q: unknown schema type %q", p.Name, kind)
+	}
+
+	switch style := p.style(); style {
+	case StyleForm:
+	case StyleSpaceDelimited, StylePipeDelimited:
+		if kind != "array" && kind != "object" {
+			return fmt.Errorf("parameter %q: style %s applies to arrays and objects", p.Name, style)
+		}
+		if kind == "object" && p.explode() {
+			return fmt.Errorf("parameter %q: style %s does not explode objects", p.Name, style)
+		}
+	case StyleDeepObject:
+		if kind != "object" || !p.explode() {
+			return fmt.Errorf("parameter %q: style deepObject applies to exploded objects", p.Name)
+		}
+	default:
+		return fmt.Errorf("parameter %q: unknown style %q", p.Name, style)
+	}
+	return nil
+}
+
+func isPrimitive(kind string) bool {
+	switch kind {
+	case "string", "integer", "number", "boolean":
+		return true
+	}
+	return false
+}
+
+// coerce converts a decoded primitive into string, int64, float64 or bool
+func coerce(kind, value string) (any, error) {
+	switch kind {
+	case "integer":
+		return strconv.ParseInt(value, 10, 64)
+	case "number":
+		return strconv.ParseFloat(value, 64)
+	case "boolean":
+		switch value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, strconv.ErrSyntax
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,248 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/CRSylar/rfcquery"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+// ValidationError lists every violation of a query, in query order
+type ValidationError struct {
+	Violations []*rfcquery.Error
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// validator collects the violations of a query
+type validator struct {
+	violations []*rfcquery.Error
+	patterns   map[string]*regexp.Regexp
+	err        error
+}
+
+// ValidateQuery checks query against the query parameters of an operation
+// of doc: required and unknown parameters, types, enums, numeric bounds,
+// lengths, patterns, item counts and required properties. Values of
+// parameters without allowReserved must percent-encode the reserved
+// characters, except for the ',' delimiting form arrays and objects.
+//
+// Every violation is reported, as a *ValidationError, positioned in
+// query. Missing parameters are reported at the end of the query
+func ValidateQuery(doc *Document, operationID, query string) error {
+	params, err := doc.QueryParameters(operationID)
+	if err != nil {
+		return err
+	}
+	for _, param := range params {
+		if err := param.check(); err != nil {
+			return err
+		}
+	}
+
+	scanner := rfcquery.NewScanner(query)
+	if err := scanner.Valid(); err != nil {
+		return err
+	}
+	scanner.Reset()
+
+	formParser := &formurlencoded.FormURLEncodedParser{}
+	result, err := formParser.Parse(scanner)
+	if err != nil {
+		return fmt.Errorf("failed to parse query parameters: %w", err)
+	}
+
+	v := &validator{patterns: make(map[string]*regexp.Regexp)}
+	d := newDecoder(result.(*rfcquery.Values))
+	d.run(params, func(decodeErr error) bool {
+		v.add(decodeErr)
+		return true
+	})
+
+	for i, param := range d.params {
+		claimer := d.claimed[i]
+		if claimer == nil {
+			v.violations = append(v.violations, rfcquery.NewError(param.Pos.Offset, "unknown parameter %q", param.Key))
+			continue
+		}
+		if !claimer.AllowReserved {
+			v.checkReserved(claimer, param.ValueTokens)
+		}
+	}
+
+	consumed := make(map[*Parameter]bool)
+	for _, param := range d.claimed {
+		consumed[param] = true
+	}
+	for i := range params {
+		param := &params[i]
+		value, decoded := d.query.Values[param.Name]
+		if !decoded {
+			// a parameter that failed to decode is reported already
+			if param.Required && !consumed[param] {
+				v.violations = append(v.violations, rfcquery.NewError(len(query), "missing required parameter %q", param.Name))
+			}
+			continue
+		}
+		v.checkCollection(param, value, d.query.Positions[param.Name].Offset)
+	}
+
+	for _, p := range d.primitives {
+		v.checkPrimitive(p)
+	}
+
+	if v.err != nil {
+		return v.err
+	}
+	if len(v.violations) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(v.violations, func(a, b *rfcquery.Error) int {
+		return a.Pos.Offset - b.Pos.Offset
+	})
+	return &ValidationError{Violations: v.violations}
+}
+
+// add records a positioned error as a violation, and keeps the first
+// other error
+func (v *validator) add(err error) {
+	var rfcErr *rfcquery.Error
+	switch {
+	case errors.As(err, &rfcErr):
+		v.violations = append(v.violations, rfcErr)
+	case v.err == nil:
+		v.err = err
+	}
+}
+
+// checkReserved flags the reserved characters written raw in the value
+// of param
+func (v *validator) checkReserved(param *Parameter, tokens rfcquery.TokenSlice) {
+	delimited := param.style() == StyleForm && !param.explode() && !isPrimitive(param.schemaType())
+	for _, tok := range tokens {
+		switch tok.Type {
+		case rfcquery.TokenSubDelims, rfcquery.TokenPcharOther, rfcquery.TokenPathChar:
+			if delimited && isDelimiter(tok, StyleForm) {
+				continue
+			}
+			v.violations = append(v.violations, rfcquery.NewError(tok.Start.Offset,
+				"reserved character %q in parameter %q must be percent-encoded", tok.Value, param.Name))
+		}
+	}
+}
+
+// checkCollection checks the item count of arrays and the required
+// properties of objects
+func (v *validator) checkCollection(param *Parameter, value any, pos int) {
+	schema := param.Schema
+	switch value := value.(type) {
+	case []any:
+		if schema.MinItems != nil && len(value) < *schema.MinItems {
+			v.violations = append(v.violations, rfcquery.NewError(pos, "parameter %q needs at least %d items, got %d", param.Name, *schema.MinItems, len(value)))
+		}
+		if schema.MaxItems != nil && len(value) > *schema.MaxItems {
+			v.violations = append(v.violations, rfcquery.NewError(pos, "parameter %q allows at most %d items, got %d", param.Name, *schema.MaxItems, len(value)))
+		}
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := value[name]; !ok {
+				v.violations = append(v.violations, rfcquery.NewError(pos, "parameter %q is missing required property %q", param.Name, name))
+			}
+		}
+	}
+}
+
+// checkPrimitive checks a decoded primitive against its schema
+func (v *validator) checkPrimitive(p primitiveValue) {
+	schema := p.schema
+	if schema == nil {
+		return
+	}
+	violation := func(format string, args ...any) {
+		v.violations = append(v.violations, rfcquery.NewError(p.src.Offset(0), "parameter %q: %s", p.param.Name, fmt.Sprintf(format, args...)))
+	}
+
+	if len(schema.Enum) > 0 && !slices.ContainsFunc(schema.Enum, func(e any) bool { return equal(e, p.value) }) {
+		violation("value %q is not one of %v", p.src.Text, schema.Enum)
+	}
+
+	switch value := p.value.(type) {
+	case int64, float64:
+		n := toFloat(value)
+		if m := schema.Minimum; m != nil && (n < *m || schema.ExclusiveMinimum && n == *m) {
+			violation("value %s is below the minimum %v", p.src.Text, *m)
+		}
+		if m := schema.Maximum; m != nil && (n > *m || schema.ExclusiveMaximum && n == *m) {
+			violation("value %s is above the maximum %v", p.src.Text, *m)
+		}
+
+	case string:
+		length := utf8.RuneCountInString(value)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			violation("value %q is shorter than %d characters", value, *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			violation("value %q is longer than %d characters", value, *schema.MaxLength)
+		}
+		if schema.Pattern != "" {
+			re, err := v.pattern(schema.Pattern)
+			if err != nil {
+				if v.err == nil {
+					v.err = fmt.Errorf("parameter %q: %w", p.param.Name, err)
+				}
+				return
+			}
+			if !re.MatchString(value) {
+				violation("value %q does not match pattern %q", value, schema.Pattern)
+			}
+		}
+	}
+}
+
+// pattern compiles the patterns of the document once
+func (v *validator) pattern(expr string) (*regexp.Regexp, error) {
+	if re, ok := v.patterns[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", expr, err)
+	}
+	v.patterns[expr] = re
+	return re, nil
+}
+
+// equal compares a decoded value with an enum value, numbers by value
+func equal(enum, value any) bool {
+	if a, ok := toNumber(enum); ok {
+		b, ok := toNumber(value)
+		return ok && a == b
+	}
+	return enum == value
+}
+
+func toNumber(value any) (float64, bool) {
+	switch value.(type) {
+	case int64, float64:
+		return toFloat(value), true
+	}
+	return 0, false
+}
+
+func toFloat(value any) float64 {
+	if n, ok := value.(int64); ok {
+		return float64(n)
+	}
+	return value.(float64)
+}
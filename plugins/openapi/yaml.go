@@ -0,0 +1,573 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yamlParser reads the YAML subset of OpenAPI documents into the values
+// of encoding/json: map[string]any, []any, string, bool, json.Number and nil
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+var (
+	yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+func parseYAML(data []byte) (any, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	p := &yamlParser{lines: strings.Split(text, "\n")}
+
+	p.skipBlank()
+	if !p.eof() && p.content() == "---" {
+		p.pos++
+		p.skipBlank()
+	}
+	if p.eof() {
+		return nil, nil
+	}
+
+	indent, err := p.indent()
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.parseBlock(indent, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipBlank()
+	if !p.eof() && p.content() != "..." {
+		return nil, p.errorf("unexpected content %q", p.content())
+	}
+	return value, nil
+}
+
+func (p *yamlParser) eof() bool {
+	return p.pos >= len(p.lines)
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("yaml line %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// indent returns the indentation of the current line
+func (p *yamlParser) indent() (int, error) {
+	line := p.lines[p.pos]
+	n := len(line) - len(strings.TrimLeft(line, " "))
+	if n < len(line) && line[n] == '\t' {
+		return 0, p.errorf("tabs are not allowed in indentation")
+	}
+	return n, nil
+}
+
+// content returns the current line without indentation and comment
+func (p *yamlParser) content() string {
+	return strings.TrimSpace(stripComment(p.lines[p.pos]))
+}
+
+// skipBlank moves past empty and comment lines, and directives
+func (p *yamlParser) skipBlank() {
+	for !p.eof() && (p.content() == "" || strings.HasPrefix(p.lines[p.pos], "%")) {
+		p.pos++
+	}
+}
+
+// stripComment removes a '#' comment that is outside quotes
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.IndexByte(" [{,:-", line[i-1]) >= 0 {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseBlock parses the node starting on the current line at indent,
+// nested in a node at parent
+func (p *yamlParser) parseBlock(indent, parent int) (any, error) {
+	content := p.content()
+	switch {
+	case content == "-" || strings.HasPrefix(content, "- "):
+		return p.parseSequence(indent)
+	case mappingKey(content) >= 0:
+		return p.parseMapping(indent)
+	default:
+		p.pos++
+		return p.parseValue(content, parent)
+	}
+}
+
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	mapping := make(map[string]any)
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return mapping, nil
+		}
+		n, err := p.indent()
+		if err != nil {
+			return nil, err
+		}
+		if n < indent {
+			return mapping, nil
+		}
+		content := p.content()
+		if n > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		if content == "..." {
+			return mapping, nil
+		}
+
+		colon := mappingKey(content)
+		if colon < 0 {
+			return nil, p.errorf("expected a mapping key, got %q", content)
+		}
+		key, err := p.parseKey(strings.TrimSpace(content[:colon]))
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := mapping[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+
+		p.pos++
+		value, err := p.parseValue(strings.TrimSpace(content[colon+1:]), indent)
+		if err != nil {
+			return nil, err
+		}
+		mapping[key] = value
+	}
+}
+
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	sequence := []any{}
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return sequence, nil
+		}
+		n, err := p.indent()
+		if err != nil {
+			return nil, err
+		}
+		content := p.content()
+		if n != indent || !(content == "-" || strings.HasPrefix(content, "- ")) {
+			if n > indent {
+				return nil, p.errorf("unexpected indentation")
+			}
+			return sequence, nil
+		}
+
+		item := strings.TrimSpace(content[1:])
+		var value any
+		if mappingKey(item) >= 0 || item == "-" || strings.HasPrefix(item, "- ") {
+			// a compact collection, "- name: x", continues at the column of its first key
+			line := p.lines[p.pos]
+			p.lines[p.pos] = line[:n] + " " + line[n+1:]
+			itemIndent, _ := p.indent()
+			value, err = p.parseBlock(itemIndent, indent)
+		} else {
+			p.pos++
+			value, err = p.parseValue(item, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, value)
+	}
+}
+
+// parseValue parses the value following a key or a dash on the previous
+// line, a nested block when rest is empty
+func (p *yamlParser) parseValue(rest string, parent int) (any, error) {
+	switch {
+	case rest == "":
+		p.skipBlank()
+		if p.eof() {
+			return nil, nil
+		}
+		n, err := p.indent()
+		if err != nil {
+			return nil, err
+		}
+		content := p.content()
+		// a sequence may sit at the indentation of its key
+		if n > parent || n == parent && (content == "-" || strings.HasPrefix(content, "- ")) {
+			return p.parseBlock(n, parent)
+		}
+		return nil, nil
+
+	case rest[0] == '|' || rest[0] == '>':
+		return p.parseBlockScalar(rest, parent)
+
+	case rest[0] == '&' || rest[0] == '*' || rest[0] == '!':
+		p.pos--
+		return nil, p.errorf("anchors, aliases and tags are not supported")
+
+	case rest[0] == '[' || rest[0] == '{':
+		// flow collections may span lines
+		text := rest
+		for !flowComplete(text) {
+			if p.eof() {
+				return nil, p.errorf("unterminated flow collection")
+			}
+			text += " " + p.content()
+			p.pos++
+		}
+		fp := &flowParser{text: text}
+		value, err := fp.parse()
+		if err != nil {
+			p.pos--
+			return nil, p.errorf("%v", err)
+		}
+		return value, nil
+
+	default:
+		// a plain scalar continues on more indented lines
+		if rest[0] != '"' && rest[0] != '\'' {
+			for !p.eof() && p.content() != "" && mappingKey(p.content()) < 0 {
+				if n, err := p.indent(); err != nil || n <= parent {
+					break
+				}
+				rest += " " + p.content()
+				p.pos++
+			}
+		}
+		value, err := scalar(rest)
+		if err != nil {
+			p.pos--
+			return nil, p.errorf("%v", err)
+		}
+		return value, nil
+	}
+}
+
+// parseBlockScalar reads a literal "|" or folded ">" scalar
+func (p *yamlParser) parseBlockScalar(header string, parent int) (any, error) {
+	folded := header[0] == '>'
+	chomp := byte(0)
+	explicit := 0
+	for _, c := range []byte(header[1:]) {
+		switch {
+		case c == '-' || c == '+':
+			chomp = c
+		case '1' <= c && c <= '9':
+			explicit = int(c - '0')
+		default:
+			p.pos--
+			return nil, p.errorf("invalid block scalar header %q", header)
+		}
+	}
+
+	indent := -1
+	if explicit > 0 {
+		indent = parent + explicit
+	}
+
+	var lines []string
+	for ; !p.eof(); p.pos++ {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if indent < 0 {
+			indent = n
+		}
+		if n <= parent || n < indent {
+			break
+		}
+		lines = append(lines, line[indent:])
+	}
+
+	// trailing blank lines belong to the chomping
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var text string
+	if folded {
+		var sb strings.Builder
+		for i, line := range lines {
+			switch {
+			case i == 0:
+			case line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(lines[i-1], " "):
+				sb.WriteByte('\n')
+			case lines[i-1] == "":
+				// the blank line wrote the line break
+			default:
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(line)
+		}
+		text = sb.String()
+	} else {
+		text = strings.Join(lines, "\n")
+	}
+
+	switch {
+	case len(lines) == 0:
+	case chomp == '-':
+	case chomp == '+':
+		text += strings.Repeat("\n", trailing+1)
+	default:
+		text += "\n"
+	}
+	return text, nil
+}
+
+// parseKey unquotes a mapping key
+func (p *yamlParser) parseKey(key string) (string, error) {
+	if key == "" || key[0] == '&' || key[0] == '*' || key[0] == '!' || key[0] == '?' {
+		return "", p.errorf("unsupported mapping key %q", key)
+	}
+	if key[0] != '"' && key[0] != '\'' {
+		return key, nil
+	}
+	value, err := scalar(key)
+	if err != nil {
+		return "", p.errorf("%v", err)
+	}
+	return value.(string), nil
+}
+
+// mappingKey returns the index of the ':' ending the key of a mapping
+// entry, -1 if s is not one
+func mappingKey(s string) int {
+	if s == "" || s[0] == '[' || s[0] == '{' || s[0] == '-' && (len(s) == 1 || s[1] == ' ') {
+		return -1
+	}
+
+	i := 0
+	if s[0] == '"' || s[0] == '\'' {
+		end := closingYAMLQuote(s, 0)
+		if end < 0 {
+			return -1
+		}
+		i = end + 1
+	}
+	for ; i < len(s); i++ {
+		if s[i] == ':' && (i+1 == len(s) || s[i+1] == ' ') {
+			return i
+		}
+	}
+	return -1
+}
+
+// closingYAMLQuote returns the index of the quote closing the one at i
+func closingYAMLQuote(s string, i int) int {
+	quote := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case s[j] == '\\' && quote == '"':
+			j++
+		case s[j] == quote && quote == '\'' && j+1 < len(s) && s[j+1] == '\'':
+			j++
+		case s[j] == quote:
+			return j
+		}
+	}
+	return -1
+}
+
+// scalar resolves a quoted or plain scalar
+func scalar(s string) (any, error) {
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		if closingYAMLQuote(s, 0) != len(s)-1 {
+			return nil, fmt.Errorf("invalid quoted scalar %s", s)
+		}
+		if s[0] == '\'' {
+			return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+		}
+		value, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double-quoted scalar %s", s)
+		}
+		return value, nil
+	}
+
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if yamlInt.MatchString(s) || yamlFloat.MatchString(s) {
+		return json.Number(strings.TrimPrefix(s, "+")), nil
+	}
+	return s, nil
+}
+
+// flowComplete reports whether the brackets of a flow collection are
+// balanced
+func flowComplete(s string) bool {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			end := closingYAMLQuote(s, i)
+			if end < 0 {
+				return false
+			}
+			i = end
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// flowParser reads a flow collection, "[a, b]" or "{a: 1}"
+type flowParser struct {
+	text string
+	pos  int
+}
+
+func (fp *flowParser) parse() (any, error) {
+	value, err := fp.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	fp.skipSpaces()
+	if fp.pos < len(fp.text) {
+		return nil, fmt.Errorf("unexpected %q after flow collection", fp.text[fp.pos:])
+	}
+	return value, nil
+}
+
+func (fp *flowParser) skipSpaces() {
+	for fp.pos < len(fp.text) && fp.text[fp.pos] == ' ' {
+		fp.pos++
+	}
+}
+
+func (fp *flowParser) parseNode() (any, error) {
+	fp.skipSpaces()
+	if fp.pos == len(fp.text) {
+		return nil, fmt.Errorf("unexpected end of flow collection")
+	}
+
+	switch fp.text[fp.pos] {
+	case '[':
+		fp.pos++
+		sequence := []any{}
+		for {
+			fp.skipSpaces()
+			if fp.pos < len(fp.text) && fp.text[fp.pos] == ']' {
+				fp.pos++
+				return sequence, nil
+			}
+			item, err := fp.parseNode()
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, item)
+			if err := fp.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+
+	case '{':
+		fp.pos++
+		mapping := make(map[string]any)
+		for {
+			fp.skipSpaces()
+			if fp.pos < len(fp.text) && fp.text[fp.pos] == '}' {
+				fp.pos++
+				return mapping, nil
+			}
+			key, err := fp.parseScalar(true)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				name = fmt.Sprint(key)
+			}
+
+			fp.skipSpaces()
+			var value any
+			if fp.pos < len(fp.text) && fp.text[fp.pos] == ':' {
+				fp.pos++
+				if value, err = fp.parseNode(); err != nil {
+					return nil, err
+				}
+			}
+			mapping[name] = value
+			if err := fp.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		return fp.parseScalar(false)
+	}
+}
+
+// separator consumes a ',' or leaves the closing bracket
+func (fp *flowParser) separator(closing byte) error {
+	fp.skipSpaces()
+	switch {
+	case fp.pos < len(fp.text) && fp.text[fp.pos] == ',':
+		fp.pos++
+		return nil
+	case fp.pos < len(fp.text) && fp.text[fp.pos] == closing:
+		return nil
+	default:
+		return fmt.Errorf("expected ',' or '%c' in flow collection", closing)
+	}
+}
+
+// parseScalar reads a quoted scalar, or a plain one ending before a flow
+// indicator, or before ": " for keys
+func (fp *flowParser) parseScalar(key bool) (any, error) {
+	start := fp.pos
+	if c := fp.text[fp.pos]; c == '"' || c == '\'' {
+		end := closingYAMLQuote(fp.text, fp.pos)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated quoted scalar")
+		}
+		fp.pos = end + 1
+		return scalar(fp.text[start:fp.pos])
+	}
+
+	for fp.pos < len(fp.text) {
+		c := fp.text[fp.pos]
+		if c == ',' || c == ']' || c == '}' || c == '[' || c == '{' {
+			break
+		}
+		if c == ':' && key && (fp.pos+1 == len(fp.text) || strings.IndexByte(" ,}", fp.text[fp.pos+1]) >= 0) {
+			break
+		}
+		fp.pos++
+	}
+	return scalar(strings.TrimSpace(fp.text[start:fp.pos]))
+}
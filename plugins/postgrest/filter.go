@@ -0,0 +1,393 @@
+package postgrest
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+)
+
+// PostgRESTFilterKind is the kind of a node of a filter tree
+type PostgRESTFilterKind int
+
+const (
+	PostgRESTCondition PostgRESTFilterKind = iota // Column Operator Value
+	PostgRESTAnd                                  // all Children
+	PostgRESTOr                                   // any of Children
+)
+
+func (k PostgRESTFilterKind) String() string {
+	switch k {
+	case PostgRESTCondition:
+		return "condition"
+	case PostgRESTAnd:
+		return "and"
+	case PostgRESTOr:
+		return "or"
+	default:
+		return "invalid"
+	}
+}
+
+// PostgRESTFilter is a horizontal filter: a condition such as age=gte.18,
+// or a logic tree such as or=(a.eq.1,and(b.lt.2,c.is.null))
+type PostgRESTFilter struct {
+	Kind    PostgRESTFilterKind
+	Negated bool // "not." prefix
+
+	// Column may hold JSON arrows, "data->a->>b"
+	Column   string
+	Operator string
+
+	// Modifier is the quantifier of "eq(any)" / "like(all)" or the
+	// language of "fts(english)"
+	Modifier string
+
+	// Value is the operand as written, without the double quotes of a
+	// logic tree value. Values holds the items of "in" lists and of
+	// quantified "{a,b}" lists
+	Value  string
+	Values []string
+
+	Children []*PostgRESTFilter
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// String renders the filter as an item of a logic tree, such as
+// "age.not.lt.18" or "not.or(a.eq.1,b.in.(1,2))", double-quoting the
+// values that hold reserved characters
+func (f *PostgRESTFilter) String() string {
+	var s string
+	if f.Kind != PostgRESTCondition {
+		children := make([]string, len(f.Children))
+		for i, child := range f.Children {
+			children[i] = child.String()
+		}
+		s = f.Kind.String() + "(" + strings.Join(children, ",") + ")"
+		if f.Negated {
+			s = "not." + s
+		}
+		return s
+	}
+
+	s = f.Column + "."
+	if f.Negated {
+		s += "not."
+	}
+	s += f.Operator
+	if f.Modifier != "" {
+		s += "(" + f.Modifier + ")"
+	}
+
+	switch {
+	case f.Modifier == "any" || f.Modifier == "all":
+		return s + "." + quoteList(f.Values, '{', '}')
+	case f.Values != nil:
+		return s + "." + quoteList(f.Values, '(', ')')
+	default:
+		return s + "." + quoteValue(f.Value)
+	}
+}
+
+// quoteValue double-quotes a value holding reserved characters
+func quoteValue(v string) string {
+	if !strings.ContainsAny(v, `,()[]{}"\`) {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+func quoteList(items []string, open, close byte) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = quoteValue(item)
+	}
+	return string(open) + strings.Join(quoted, ",") + string(close)
+}
+
+// operandKind tells how the value of an operator is read
+type operandKind int
+
+const (
+	operandScalar operandKind = iota // any text
+	operandList                      // "(a,b,...)"
+	operandIs                        // null, not_null, true, false or unknown
+)
+
+// operators maps the PostgREST operators to their operand kind
+var operators = map[string]operandKind{
+	"eq": operandScalar, "neq": operandScalar,
+	"gt": operandScalar, "gte": operandScalar, "lt": operandScalar, "lte": operandScalar,
+	"like": operandScalar, "ilike": operandScalar, "match": operandScalar, "imatch": operandScalar,
+	"in": operandList, "is": operandIs, "isdistinct": operandScalar,
+	"fts": operandScalar, "plfts": operandScalar, "phfts": operandScalar, "wfts": operandScalar,
+	"cs": operandScalar, "cd": operandScalar, "ov": operandScalar,
+	"sl": operandScalar, "sr": operandScalar, "nxr": operandScalar, "nxl": operandScalar, "adj": operandScalar,
+}
+
+// quantifiable operators accept the (any) and (all) modifiers
+var quantifiable = []string{"eq", "gt", "gte", "lt", "lte", "like", "ilike", "match", "imatch"}
+
+var ftsOperators = []string{"fts", "plfts", "phfts", "wfts"}
+
+var isValues = []string{"null", "not_null", "true", "false", "unknown"}
+
+// maxFilterDepth bounds the nesting of logic trees
+const maxFilterDepth = 100
+
+// parseOperation parses "[not.]op[(modifier)].value" into filter
+func parseOperation(filter *PostgRESTFilter, src source.Source) error {
+	rest := src
+	if strings.HasPrefix(rest.Text, "not.") {
+		filter.Negated = true
+		rest = rest.Slice(len("not."), len(rest.Text))
+	}
+
+	dot := strings.IndexByte(rest.Text, '.')
+	if dot < 0 {
+		return rest.Errorf(0, "expected operator.value, got %q", rest.Text)
+	}
+
+	op := rest.Slice(0, dot)
+	value := rest.Slice(dot+1, len(rest.Text))
+
+	name := op.Text
+	if open := strings.IndexByte(name, '('); open >= 0 {
+		if !strings.HasSuffix(name, ")") {
+			return op.Errorf(len(name), "expected ')' after the modifier of %q", name[:open])
+		}
+		filter.Modifier = name[open+1 : len(name)-1]
+		name = name[:open]
+	}
+
+	kind, ok := operators[name]
+	if !ok {
+		return op.Errorf(0, "unknown operator %q", name)
+	}
+	filter.Operator = name
+
+	switch {
+	case filter.Modifier == "":
+	case slices.Contains(ftsOperators, name):
+		if !isIdentifier(filter.Modifier) {
+			return op.Errorf(len(name)+1, "invalid text search language %q", filter.Modifier)
+		}
+	case filter.Modifier == "any" || filter.Modifier == "all":
+		if !slices.Contains(quantifiable, name) {
+			return op.Errorf(len(name)+1, "operator %q does not accept (%s)", name, filter.Modifier)
+		}
+		items, err := parseList(value, '{', '}')
+		if err != nil {
+			return err
+		}
+		filter.Values = items
+		filter.Value = value.Text
+		return nil
+	default:
+		return op.Errorf(len(name)+1, "unknown modifier %q", filter.Modifier)
+	}
+
+	switch kind {
+	case operandList:
+		items, err := parseList(value, '(', ')')
+		if err != nil {
+			return err
+		}
+		filter.Values = items
+	case operandIs:
+		if !slices.Contains(isValues, strings.ToLower(value.Text)) {
+			return value.Errorf(0, "is expects null, not_null, true, false or unknown, got %q", value.Text)
+		}
+	}
+	filter.Value = value.Text
+	return nil
+}
+
+// parseList parses a delimited, comma-separated list whose items may be
+// double-quoted with backslash escapes
+func parseList(src source.Source, open, close byte) ([]string, error) {
+	text := src.Text
+	if len(text) < 2 || text[0] != open || text[len(text)-1] != close {
+		return nil, src.Errorf(0, "expected a list in '%c' '%c'", open, close)
+	}
+
+	items := []string{}
+	if len(text) == 2 {
+		return items, nil
+	}
+
+	var sb strings.Builder
+	quoted := false
+	for i := 1; i < len(text)-1; i++ {
+		switch c := text[i]; {
+		case c == '"' && !quoted && sb.Len() == 0:
+			end := closingQuote(text[:len(text)-1], i)
+			if end < 0 {
+				return nil, src.Errorf(i, "unterminated quoted value")
+			}
+			sb.WriteString(unquote(text[i : end+1]))
+			quoted = true
+			i = end
+		case c == ',':
+			items = append(items, sb.String())
+			sb.Reset()
+			quoted = false
+		case quoted:
+			return nil, src.Errorf(i, "expected ',' after quoted value")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return append(items, sb.String()), nil
+}
+
+// closingQuote returns the index of the double quote closing the one at
+// i, -1 if unterminated
+func closingQuote(text string, i int) int {
+	for j := i + 1; j < len(text); j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '"':
+			return j
+		}
+	}
+	return -1
+}
+
+// unquote removes the quotes and escapes of a double-quoted value
+func unquote(quoted string) string {
+	var sb strings.Builder
+	for i := 1; i < len(quoted)-1; i++ {
+		if quoted[i] == '\\' && i+1 < len(quoted)-1 {
+			i++
+		}
+		sb.WriteByte(quoted[i])
+	}
+	return sb.String()
+}
+
+// parseLogic parses the "(item,item,...)" operand of an and/or parameter
+func parseLogic(filter *PostgRESTFilter, src source.Source, depth int) error {
+	if depth > maxFilterDepth {
+		return src.Errorf(0, "logic tree nested deeper than %d levels", maxFilterDepth)
+	}
+
+	text := src.Text
+	if len(text) < 2 || text[0] != '(' || text[len(text)-1] != ')' {
+		return src.Errorf(0, "expected a parenthesized list of conditions")
+	}
+
+	items, err := splitItems(src.Slice(1, len(text)-1))
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		child, err := parseLogicItem(item, depth)
+		if err != nil {
+			return err
+		}
+		filter.Children = append(filter.Children, child)
+	}
+	return nil
+}
+
+// parseLogicItem parses a nested "[not.]and(...)", "[not.]or(...)" or
+// "column.[not.]op.value" condition
+func parseLogicItem(item source.Source, depth int) (*PostgRESTFilter, error) {
+	filter := &PostgRESTFilter{Pos: item.Position(0), Tokens: item.Tokens}
+	if item.Text == "" {
+		return nil, item.Errorf(0, "empty condition")
+	}
+
+	rest := item
+	negated := strings.HasPrefix(rest.Text, "not.")
+	if negated {
+		rest = rest.Slice(len("not."), len(rest.Text))
+	}
+	for _, logic := range []string{"and", "or"} {
+		if strings.HasPrefix(rest.Text, logic+"(") {
+			filter.Kind = logicKind(logic)
+			filter.Negated = negated
+			return filter, parseLogic(filter, rest.Slice(len(logic), len(rest.Text)), depth+1)
+		}
+	}
+
+	// the column ends before the operator, it may traverse embedded resources
+	segments := strings.Split(item.Text, ".")
+	offset := 0
+	for i, segment := range segments[:len(segments)-1] {
+		name, _, _ := strings.Cut(segment, "(")
+		if _, ok := operators[name]; ok && i > 0 || segment == "not" && i > 0 {
+			filter.Column = item.Text[:offset-1]
+			if err := parseOperation(filter, item.Slice(offset, len(item.Text))); err != nil {
+				return nil, err
+			}
+			// values with reserved characters are double-quoted
+			if v := filter.Value; filter.Values == nil && strings.HasPrefix(v, `"`) && closingQuote(v, 0) == len(v)-1 {
+				filter.Value = unquote(v)
+			}
+			return filter, nil
+		}
+		offset += len(segment) + 1
+	}
+	return nil, item.Errorf(0, "expected column.operator.value, got %q", item.Text)
+}
+
+// splitItems splits src on the commas outside of parentheses, brackets,
+// braces and double quotes
+func splitItems(src source.Source) ([]source.Source, error) {
+	var items []source.Source
+	depth, start := 0, 0
+
+	for i := 0; i < len(src.Text); i++ {
+		switch src.Text[i] {
+		case '"':
+			end := closingQuote(src.Text, i)
+			if end < 0 {
+				return nil, src.Errorf(i, "unterminated quoted value")
+			}
+			i = end
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			// ranges such as [1,10) close with a different bracket
+			if depth == 0 {
+				return nil, src.Errorf(i, "unbalanced '%c'", src.Text[i])
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, src.Slice(start, i))
+				start = i + 1
+			}
+		}
+	}
+	if depth > 0 {
+		return nil, src.Errorf(len(src.Text), "missing closing bracket")
+	}
+	return append(items, src.Slice(start, len(src.Text))), nil
+}
+
+func logicKind(name string) PostgRESTFilterKind {
+	if name == "or" {
+		return PostgRESTOr
+	}
+	return PostgRESTAnd
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,385 @@
+package postgrest
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+// PostgRESTQuery holds the read parameters of a PostgREST request
+type PostgRESTQuery struct {
+	// Filters are combined with AND, in query order
+	Filters []*PostgRESTFilter
+
+	// Select is nil when absent, which selects every column
+	Select []PostgRESTSelectItem
+
+	Order []PostgRESTOrderItem
+
+	// Limit and Offset are nil when absent
+	Limit  *int
+	Offset *int
+
+	// Embedded holds the filters, order, limit and offset of embedded
+	// resources, actors.order=name sets Embedded["actors"].Order
+	Embedded map[string]*PostgRESTQuery
+
+	// OtherParams holds the write parameters, columns and on_conflict
+	OtherParams map[string][]string
+}
+
+// PostgRESTSelectItem is a column or an embedded resource of select,
+// "director:directors!inner(id,last_name)"
+type PostgRESTSelectItem struct {
+	// Name is a column, "*", or a resource; it may hold JSON arrows
+	Name  string
+	Alias string
+	Cast  string // "::text"
+
+	// Hints are the "!" suffixes of an embedded resource, such as "inner"
+	// or a foreign key name
+	Hints []string
+
+	// Spread is set by "...", which inlines the columns of the resource
+	Spread bool
+
+	// Embedded is set for resources, Children holds their columns
+	Embedded bool
+	Children []PostgRESTSelectItem
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// String renders the item in select syntax
+func (item PostgRESTSelectItem) String() string {
+	var sb strings.Builder
+	if item.Spread {
+		sb.WriteString("...")
+	}
+	if item.Alias != "" {
+		sb.WriteString(item.Alias + ":")
+	}
+	sb.WriteString(item.Name)
+	for _, hint := range item.Hints {
+		sb.WriteString("!" + hint)
+	}
+	if item.Embedded {
+		children := make([]string, len(item.Children))
+		for i, child := range item.Children {
+			children[i] = child.String()
+		}
+		sb.WriteString("(" + strings.Join(children, ",") + ")")
+	}
+	if item.Cast != "" {
+		sb.WriteString("::" + item.Cast)
+	}
+	return sb.String()
+}
+
+// PostgRESTOrderItem is a term of order, "created.desc.nullslast"
+type PostgRESTOrderItem struct {
+	Column string
+	Desc   bool
+
+	// Nulls is "first", "last", or empty for the database default
+	Nulls string
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// PostgRESTParser parses PostgREST horizontal and vertical filtering.
+// Every parameter that is not reserved is a column filter, age=gte.18
+type PostgRESTParser struct {
+	// StrictValidation enforces RFC3986 compliance
+	StrictValidation bool
+
+	// MaxLimit caps limit, larger values are lowered to it like the
+	// db-max-rows setting does. 0 means no maximum
+	MaxLimit int
+}
+
+// NewPostgRESTParser creates a parser with default settings
+func NewPostgRESTParser() *PostgRESTParser {
+	return &PostgRESTParser{
+		StrictValidation: true,
+	}
+}
+
+// Name returns the parser identifier
+func (p *PostgRESTParser) Name() string {
+	return "postgrest"
+}
+
+// Parse implements the Parser interface
+func (p *PostgRESTParser) Parse(scanner *rfcquery.Scanner) (any, error) {
+	if p.StrictValidation {
+		if err := scanner.Valid(); err != nil {
+			return nil, fmt.Errorf("RFC3986 validation failed: %w", err)
+		}
+		scanner.Reset()
+	}
+
+	formParser := &formurlencoded.FormURLEncodedParser{}
+	result, err := formParser.Parse(scanner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query parameters: %w", err)
+	}
+
+	query := newQuery()
+	seen := make(map[string]bool)
+
+	for _, param := range source.Params(result.(*rfcquery.Values)) {
+		key := source.New(param.KeyTokens, param.Pos.Offset)
+		value := param.Value()
+
+		switch param.Key {
+		case "columns", "on_conflict":
+			query.OtherParams[param.Key] = append(query.OtherParams[param.Key], value.Text)
+			continue
+		case "select":
+			if seen[param.Key] {
+				return nil, rfcquery.NewError(param.Pos.Offset, "duplicate parameter %q", param.Key)
+			}
+			seen[param.Key] = true
+			query.Select, err = parseSelect(value, 0)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := p.apply(query, key, value, seen); err != nil {
+			return nil, err
+		}
+	}
+
+	return query, nil
+}
+
+// apply stores the parameter key=value in query, descending into the
+// embedded resource named by each dotted prefix of key
+func (p *PostgRESTParser) apply(query *PostgRESTQuery, key, value source.Source, seen map[string]bool) error {
+	base := key
+	for {
+		dot := strings.IndexByte(base.Text, '.')
+		if dot < 0 || base.Text[:dot] == "not" {
+			break
+		}
+		if dot == 0 {
+			return base.Errorf(0, "empty resource name")
+		}
+
+		name := base.Text[:dot]
+		if query.Embedded[name] == nil {
+			query.Embedded[name] = newQuery()
+		}
+		query = query.Embedded[name]
+		base = base.Slice(dot+1, len(base.Text))
+	}
+
+	var err error
+	switch base.Text {
+	case "order", "limit", "offset":
+		if seen[key.Text] {
+			return key.Errorf(0, "duplicate parameter %q", key.Text)
+		}
+		seen[key.Text] = true
+	}
+
+	switch base.Text {
+	case "":
+		return key.Errorf(0, "empty column name")
+	case "order":
+		query.Order, err = parseOrder(value)
+	case "limit":
+		query.Limit, err = p.parseCount(base.Text, value)
+	case "offset":
+		query.Offset, err = p.parseCount(base.Text, value)
+	case "and", "or", "not.and", "not.or":
+		filter := &PostgRESTFilter{Pos: key.Position(0), Tokens: value.Tokens}
+		filter.Negated = strings.HasPrefix(base.Text, "not.")
+		filter.Kind = logicKind(strings.TrimPrefix(base.Text, "not."))
+		err = parseLogic(filter, value, 1)
+		query.Filters = append(query.Filters, filter)
+	default:
+		filter := &PostgRESTFilter{Column: base.Text, Pos: key.Position(0), Tokens: value.Tokens}
+		err = parseOperation(filter, value)
+		query.Filters = append(query.Filters, filter)
+	}
+	return err
+}
+
+// parseSelect parses the comma-separated items of select and of the
+// column lists of embedded resources
+func parseSelect(value source.Source, depth int) ([]PostgRESTSelectItem, error) {
+	if depth > maxFilterDepth {
+		return nil, value.Errorf(0, "select nested deeper than %d levels", maxFilterDepth)
+	}
+
+	parts, err := splitItems(value)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []PostgRESTSelectItem{}
+	if value.Text == "" {
+		return items, nil
+	}
+	for _, part := range parts {
+		item, err := parseSelectItem(part, depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseSelectItem parses "[...][alias:]name[!hint...][(children)][::cast]"
+func parseSelectItem(part source.Source, depth int) (PostgRESTSelectItem, error) {
+	item := PostgRESTSelectItem{Pos: part.Position(0), Tokens: part.Tokens}
+
+	head := part
+	if strings.HasPrefix(head.Text, "...") {
+		item.Spread = true
+		head = head.Slice(len("..."), len(head.Text))
+	}
+
+	if i := strings.Index(head.Text, "::"); i > strings.LastIndexByte(head.Text, ')') {
+		item.Cast = head.Text[i+2:]
+		if !isIdentifier(item.Cast) {
+			return item, head.Errorf(i+2, "invalid cast %q", item.Cast)
+		}
+		if strings.HasSuffix(head.Text[:i], ")") {
+			return item, head.Errorf(i, "cannot cast an embedded resource")
+		}
+		head = head.Slice(0, i)
+	}
+
+	if open := strings.IndexByte(head.Text, '('); open >= 0 {
+		if !strings.HasSuffix(head.Text, ")") {
+			return item, head.Errorf(len(head.Text), "expected ')' closing the columns of %q", head.Text[:open])
+		}
+		children, err := parseSelect(head.Slice(open+1, len(head.Text)-1), depth+1)
+		if err != nil {
+			return item, err
+		}
+		item.Embedded = true
+		item.Children = children
+		head = head.Slice(0, open)
+	} else if item.Spread {
+		return item, part.Errorf(0, "spread %q must embed a resource", part.Text)
+	}
+
+	if i := strings.IndexByte(head.Text, ':'); i >= 0 {
+		item.Alias = head.Text[:i]
+		if !isIdentifier(item.Alias) {
+			return item, head.Errorf(0, "invalid alias %q", item.Alias)
+		}
+		head = head.Slice(i+1, len(head.Text))
+	}
+
+	name, hints, hinted := strings.Cut(head.Text, "!")
+	if hinted {
+		if !item.Embedded {
+			return item, head.Errorf(len(name), "only embedded resources accept hints")
+		}
+		item.Hints = strings.Split(hints, "!")
+		if slices.Contains(item.Hints, "") {
+			return item, head.Errorf(len(name), "empty hint")
+		}
+	}
+
+	if name == "" {
+		return item, head.Errorf(0, "empty select item")
+	}
+	if i := strings.IndexAny(name, `()!:,"`); i >= 0 {
+		return item, head.Errorf(i, "unexpected %q in select item", name[i])
+	}
+	item.Name = name
+	return item, nil
+}
+
+// parseOrder parses "column[.asc|.desc][.nullsfirst|.nullslast]" terms
+// separated by commas
+func parseOrder(value source.Source) ([]PostgRESTOrderItem, error) {
+	var items []PostgRESTOrderItem
+
+	start := 0
+	for i := 0; i <= len(value.Text); i++ {
+		if i < len(value.Text) && value.Text[i] != ',' {
+			continue
+		}
+		part := value.Slice(start, i)
+		start = i + 1
+
+		item := PostgRESTOrderItem{Pos: part.Position(0), Tokens: part.Tokens}
+		column, modifiers, _ := strings.Cut(part.Text, ".")
+		offset := len(column) + 1
+		for modifier := range strings.SplitSeq(modifiers, ".") {
+			switch {
+			case modifiers == "":
+			case (modifier == "asc" || modifier == "desc") && !item.Desc && item.Nulls == "" && offset == len(column)+1:
+				item.Desc = modifier == "desc"
+			case (modifier == "nullsfirst" || modifier == "nullslast") && item.Nulls == "":
+				item.Nulls = strings.TrimPrefix(modifier, "nulls")
+			default:
+				return nil, part.Errorf(offset, "expected asc, desc, nullsfirst or nullslast, got %q", modifier)
+			}
+			offset += len(modifier) + 1
+		}
+
+		if column == "" {
+			return nil, part.Errorf(0, "empty order column")
+		}
+		item.Column = column
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseCount parses limit and offset
+func (p *PostgRESTParser) parseCount(name string, value source.Source) (*int, error) {
+	n, err := strconv.Atoi(value.Text)
+	if err != nil || n < 0 || strings.HasPrefix(value.Text, "+") {
+		return nil, value.Errorf(0, "%s must be a non-negative integer, got %q", name, value.Text)
+	}
+	if name == "limit" && p.MaxLimit > 0 {
+		n = min(n, p.MaxLimit)
+	}
+	return &n, nil
+}
+
+func newQuery() *PostgRESTQuery {
+	return &PostgRESTQuery{
+		Embedded:    make(map[string]*PostgRESTQuery),
+		OtherParams: make(map[string][]string),
+	}
+}
+
+// ParsePostgRESTQuery - convenience function
+func ParsePostgRESTQuery(query string) (*PostgRESTQuery, error) {
+	scanner := rfcquery.NewScanner(query)
+	if err := scanner.Valid(); err != nil {
+		return nil, err
+	}
+
+	result, err := NewPostgRESTParser().Parse(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, ok := result.(*PostgRESTQuery)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %T", result)
+	}
+
+	return parsed, nil
+}
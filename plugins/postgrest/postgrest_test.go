@@ -0,0 +1,233 @@
+package postgrest_test
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/plugins/postgrest"
+)
+
+func TestPostgRESTParser_Filters(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"comparison", "age=gte.18", "age.gte.18"},
+		{"pattern", "name=ilike.*john*", "name.ilike.*john*"},
+		{"negation", "age=not.lt.18", "age.not.lt.18"},
+		{"dots in value", "version=eq.1.2.3", "version.eq.1.2.3"},
+		{"in", `id=in.(1,2,%22a,b%22)`, `id.in.(1,2,"a,b")`},
+		{"empty in", "id=in.()", "id.in.()"},
+		{"is", "deleted=is.null", "deleted.is.null"},
+		{"quantifier", "name=like(any).%7BO*,P*%7D", "name.like(any).{O*,P*}"},
+		{"fts language", "body=fts(english).cat", "body.fts(english).cat"},
+		{"json path", "data-%3E%3Eowner=eq.bob", "data->>owner.eq.bob"},
+		{"range", "during=ov.%5B2000-01-01,2001-01-01)", `during.ov."[2000-01-01,2001-01-01)"`},
+		{"or", "or=(a.eq.1,b.lt.2)", "or(a.eq.1,b.lt.2)"},
+		{"nested logic", "and=(grade.gte.90,student.is.true,or(age.eq.14,not.and(age.gte.11,age.lte.17)))",
+			"and(grade.gte.90,student.is.true,or(age.eq.14,not.and(age.gte.11,age.lte.17)))"},
+		{"negated logic", "not.or=(a.not.eq.1,b.in.(1,2))", "not.or(a.not.eq.1,b.in.(1,2))"},
+		{"quoted logic value", `or=(name.eq.%22a,b%22,name.like.%22*%5C%22*%22)`, `or(name.eq."a,b",name.like."*\"*")`},
+		{"embedded column", "or=(actors.name.eq.x)", "or(actors.name.eq.x)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := postgrest.ParsePostgRESTQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParsePostgRESTQuery() error = %v", err)
+			}
+			if len(query.Filters) != 1 {
+				t.Fatalf("got %d filters, want 1", len(query.Filters))
+			}
+			if got := query.Filters[0].String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgRESTParser_Query(t *testing.T) {
+	parser := postgrest.NewPostgRESTParser()
+	parser.MaxLimit = 100
+
+	result, err := parser.Parse(rfcquery.NewScanner("select=id,title,author:authors!inner(name,...org(name)),total::text&" +
+		"age=gt.1&age=lt.5&order=created.desc.nullslast,id&limit=500&offset=20&" +
+		"actors.order=name&actors.limit=3&actors.first_name=eq.Jo&columns=a,b"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	query := result.(*postgrest.PostgRESTQuery)
+
+	var items []string
+	for _, item := range query.Select {
+		items = append(items, item.String())
+	}
+	if got, want := strings.Join(items, ","), "id,title,author:authors!inner(name,...org(name)),total::text"; got != want {
+		t.Errorf("Select = %s, want %s", got, want)
+	}
+	if got := query.Select[2].Pos.Offset; got != 16 {
+		t.Errorf("embedded select item at %d, want 16", got)
+	}
+
+	var filters []string
+	for _, f := range query.Filters {
+		filters = append(filters, f.String())
+	}
+	if got, want := strings.Join(filters, " "), "age.gt.1 age.lt.5"; got != want {
+		t.Errorf("Filters = %s, want %s", got, want)
+	}
+
+	var order []string
+	for _, o := range query.Order {
+		order = append(order, fmt.Sprintf("%s:%v:%s@%d", o.Column, o.Desc, o.Nulls, o.Pos.Offset))
+	}
+	if got, want := strings.Join(order, " "), "created:true:last@92 id:false:@115"; got != want {
+		t.Errorf("Order = %s, want %s", got, want)
+	}
+
+	if *query.Limit != 100 || *query.Offset != 20 {
+		t.Errorf("limit, offset = %d, %d, want 100 (capped), 20", *query.Limit, *query.Offset)
+	}
+
+	actors := query.Embedded["actors"]
+	if actors == nil || len(actors.Order) != 1 || actors.Order[0].Column != "name" || *actors.Limit != 3 {
+		t.Fatalf("Embedded[actors] = %+v", actors)
+	}
+	if got := actors.Filters[0].String(); got != "first_name.eq.Jo" {
+		t.Errorf("embedded filter = %s", got)
+	}
+	if got := query.OtherParams["columns"]; len(got) != 1 || got[0] != "a,b" {
+		t.Errorf("OtherParams = %v", query.OtherParams)
+	}
+}
+
+func TestPostgRESTParser_Positions(t *testing.T) {
+	const (
+		logic   = "x=eq.1&or=(a.eq.1,and(b.lt.2))"
+		negated = "or=(not.and(a.is.null),b.eq.%22x,y%22)"
+	)
+
+	tests := []struct {
+		name       string
+		input      string
+		node       func(filters []*postgrest.PostgRESTFilter) *postgrest.PostgRESTFilter
+		wantPos    int
+		wantTokens string
+	}{
+		{"condition", logic, func(fs []*postgrest.PostgRESTFilter) *postgrest.PostgRESTFilter { return fs[0] }, 0, "eq.1"},
+		{"logic", logic, func(fs []*postgrest.PostgRESTFilter) *postgrest.PostgRESTFilter { return fs[1] }, 7, "(a.eq.1,and(b.lt.2))"},
+		{"logic item", logic, func(fs []*postgrest.PostgRESTFilter) *postgrest.PostgRESTFilter { return fs[1].Children[0] }, 11, "a.eq.1"},
+		{"nested logic", logic, func(fs []*postgrest.PostgRESTFilter) *postgrest.PostgRESTFilter { return fs[1].Children[1] }, 18, "and(b.lt.2)"},
+		{"nested item", logic, func(fs []*postgrest.PostgRESTFilter) *postgrest.PostgRESTFilter { return fs[1].Children[1].Children[0] }, 22, "b.lt.2"},
+		{"negated logic", negated, func(fs []*postgrest.PostgRESTFilter) *postgrest.PostgRESTFilter { return fs[0].Children[0] }, 4, "not.and(a.is.null)"},
+		{"negated item", negated, func(fs []*postgrest.PostgRESTFilter) *postgrest.PostgRESTFilter { return fs[0].Children[0].Children[0] }, 12, "a.is.null"},
+		{"quoted value", negated, func(fs []*postgrest.PostgRESTFilter) *postgrest.PostgRESTFilter { return fs[0].Children[1] }, 23, "b.eq.%22x,y%22"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := postgrest.ParsePostgRESTQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParsePostgRESTQuery() error = %v", err)
+			}
+			node := tt.node(query.Filters)
+			if node.Pos.Offset != tt.wantPos || node.Tokens.String() != tt.wantTokens {
+				t.Errorf("node at %d with tokens %q, want %d with %q", node.Pos.Offset, node.Tokens.String(), tt.wantPos, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestPostgRESTParser_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{"missing operator", "age=18", 4, "expected operator.value"},
+		{"unknown operator", "age=between.1", 4, `unknown operator "between"`},
+		{"bad is", "a=is.maybe", 5, "is expects null"},
+		{"in without list", "a=in.1,2", 5, "expected a list"},
+		{"quantifier on in", "a=in(any).%7B1%7D", 5, `does not accept (any)`},
+		{"unknown modifier", "a=eq(some).%7B1%7D", 5, `unknown modifier "some"`},
+		{"unterminated quote", `a=in.(%22x)`, 6, "unterminated quoted value"},
+		{"logic without parens", "or=a.eq.1", 3, "expected a parenthesized list"},
+		{"empty condition", "or=(a.eq.1,)", 11, "empty condition"},
+		{"bad condition", "or=(a,b)", 4, "expected column.operator.value"},
+		{"unbalanced", "or=(a.eq.1))", 10, "unbalanced ')'"},
+		{"bad order", "order=a.up", 8, `got "up"`},
+		{"order after nulls", "order=a.nullslast.desc", 18, `got "desc"`},
+		{"negative limit", "limit=-1", 6, "non-negative integer"},
+		{"duplicate order", "order=a&order=b", 8, "duplicate parameter"},
+		{"duplicate embedded limit", "x.limit=1&x.limit=2", 10, "duplicate parameter"},
+		{"hint on column", "select=id!inner", 9, "only embedded resources accept hints"},
+		{"cast on resource", "select=a(b)::text", 11, "cannot cast"},
+		{"bare spread", "select=...a", 7, "must embed a resource"},
+		{"empty select item", "select=a,,b", 9, "empty select item"},
+		{"too deep", "or=" + strings.Repeat("(or", 120) + strings.Repeat(")", 120), 303, "nested deeper"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := postgrest.ParsePostgRESTQuery(tt.input)
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func FuzzPostgRESTParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		"age=gte.18&name=ilike.*john*",
+		"or=(a.eq.1,and(b.lt.2,not.or(c.is.null,d.in.(1,%22x,y%22))))",
+		"select=id,author:authors!inner(name,...org(*))&order=a.desc.nullslast&limit=1",
+		"actors.order=name&actors.x=like(any).{a,b}",
+		"or=" + strings.Repeat("(or", 50),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		query, err := postgrest.ParsePostgRESTQuery(input)
+		if err != nil {
+			return
+		}
+
+		// rendered logic trees parse back to the same tree, columns are
+		// never quoted so they must not need it
+		for _, filter := range query.Filters {
+			if filter.Kind == postgrest.PostgRESTCondition || hasReservedColumn(filter) {
+				continue
+			}
+			rendered := filter.String()
+			again, err := postgrest.ParsePostgRESTQuery("and=" + strings.ReplaceAll(url.QueryEscape("("+rendered+")"), "+", "%20"))
+			if err != nil {
+				t.Fatalf("ParsePostgRESTQuery() of rendered filter %q error = %v", rendered, err)
+			}
+			if got := again.Filters[0].Children[0].String(); got != rendered {
+				t.Fatalf("rendered filter %q renders again as %q", rendered, got)
+			}
+		}
+	})
+}
+
+func hasReservedColumn(f *postgrest.PostgRESTFilter) bool {
+	for _, child := range f.Children {
+		if hasReservedColumn(child) {
+			return true
+		}
+	}
+	return strings.ContainsAny(f.Column, `,()[]{}"`)
+}
@@ -0,0 +1,206 @@
+package rison
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// Encode writes v, marshaled with encoding/json, in notation. The result
+// is RFC3986-valid and ready to use as a form value: '(', ')', '!', ':',
+// quotes, '*' and '~' are kept, other reserved and non-ASCII bytes are
+// percent-encoded
+func Encode(v any, notation Notation) (string, error) {
+	text, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	switch notation {
+	case NotationRison:
+		encodeRison(&sb, value)
+	case NotationORison:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("o-rison encodes objects, got %T", value)
+		}
+		encodeRisonMembers(&sb, object)
+	case NotationARison:
+		array, ok := value.([]any)
+		if !ok {
+			return "", fmt.Errorf("a-rison encodes arrays, got %T", value)
+		}
+		encodeRisonElements(&sb, array)
+	case NotationJSURL:
+		if err := encodeJSURL(&sb, value); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown notation %v", notation)
+	}
+	return escape(sb.String()), nil
+}
+
+func encodeRison(sb *strings.Builder, value any) {
+	switch value := value.(type) {
+	case nil:
+		sb.WriteString("!n")
+	case bool:
+		if value {
+			sb.WriteString("!t")
+		} else {
+			sb.WriteString("!f")
+		}
+	case json.Number:
+		// Rison exponents have no '+'
+		sb.WriteString(strings.ReplaceAll(strings.ToLower(value.String()), "+", ""))
+	case string:
+		encodeRisonString(sb, value)
+	case []any:
+		sb.WriteString("!(")
+		encodeRisonElements(sb, value)
+		sb.WriteByte(')')
+	case map[string]any:
+		sb.WriteByte('(')
+		encodeRisonMembers(sb, value)
+		sb.WriteByte(')')
+	}
+}
+
+func encodeRisonElements(sb *strings.Builder, array []any) {
+	for i, item := range array {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		encodeRison(sb, item)
+	}
+}
+
+// encodeRisonMembers writes the members of object with sorted keys
+func encodeRisonMembers(sb *strings.Builder, object map[string]any) {
+	for i, key := range sortedKeys(object) {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		encodeRisonString(sb, key)
+		sb.WriteByte(':')
+		encodeRison(sb, object[key])
+	}
+}
+
+// encodeRisonString writes s as an id when possible, quoted otherwise
+func encodeRisonString(sb *strings.Builder, s string) {
+	if s != "" && strings.IndexByte("-0123456789", s[0]) < 0 && !strings.ContainsAny(s, notIDChar) {
+		sb.WriteString(s)
+		return
+	}
+
+	sb.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '!' || s[i] == '\'' {
+			sb.WriteByte('!')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('\'')
+}
+
+func encodeJSURL(sb *strings.Builder, value any) error {
+	sb.WriteByte('~')
+	switch value := value.(type) {
+	case nil:
+		sb.WriteString("null")
+	case bool:
+		fmt.Fprint(sb, value)
+	case json.Number:
+		sb.WriteString(value.String())
+	case string:
+		sb.WriteByte('\'')
+		encodeJSURLString(sb, value)
+	case []any:
+		sb.WriteByte('(')
+		if len(value) == 0 {
+			sb.WriteByte('~')
+		}
+		for _, item := range value {
+			if err := encodeJSURL(sb, item); err != nil {
+				return err
+			}
+		}
+		sb.WriteByte(')')
+	case map[string]any:
+		sb.WriteByte('(')
+		for i, key := range sortedKeys(value) {
+			if i > 0 {
+				sb.WriteByte('~')
+			} else if key == "" {
+				// "(~" opens an array
+				return errors.New("jsurl cannot encode an object whose first key is empty")
+			}
+			encodeJSURLString(sb, key)
+			if err := encodeJSURL(sb, value[key]); err != nil {
+				return err
+			}
+		}
+		sb.WriteByte(')')
+	}
+	return nil
+}
+
+// encodeJSURLString writes s with "*XX" and "**XXXX" escapes for
+// everything but letters, digits, '_', '-' and '.', and '!' for '$'
+func encodeJSURLString(sb *strings.Builder, s string) {
+	for _, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '_' || r == '-' || r == '.':
+			sb.WriteRune(r)
+		case r == '$':
+			sb.WriteByte('!')
+		case r < 0x100:
+			fmt.Fprintf(sb, "*%02x", r)
+		default:
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(sb, "**%04x", unit)
+			}
+		}
+	}
+}
+
+func sortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// escape percent-encodes the bytes of s that are not unreserved, nor
+// sub-delimiters or pchar without a form meaning
+func escape(s string) string {
+	const upperhex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~!$'()*,;:@/?", c) >= 0 {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(upperhex[c>>4])
+		sb.WriteByte(upperhex[c&0xf])
+	}
+	return sb.String()
+}
@@ -0,0 +1,476 @@
+package rison
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+)
+
+// maxValueDepth bounds the recursion of the parser when MaxJSONDepth is 0
+const maxValueDepth = 10000
+
+// notIDChar are the bytes that cannot appear in a Rison id
+const notIDChar = " '!:(),*@$"
+
+// valueParser works on the decoded value, positions are mapped back to
+// the original query through the source tokens
+type valueParser struct {
+	src       source.Source
+	pos       int
+	depth     int
+	useNumber bool
+	maxDepth  int
+}
+
+func (vp *valueParser) parse(notation Notation) (any, error) {
+	var value any
+	var err error
+	switch notation {
+	case NotationORison:
+		value, err = vp.risonObject(0)
+	case NotationARison:
+		value, err = vp.risonArray(0)
+	case NotationJSURL:
+		value, err = vp.jsurlValue()
+	default:
+		value, err = vp.risonValue()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !vp.eof() {
+		return nil, vp.errorf("unexpected %q after the %s value", vp.src.Text[vp.pos], notation)
+	}
+	return value, nil
+}
+
+func (vp *valueParser) eof() bool {
+	return vp.pos >= len(vp.src.Text)
+}
+
+func (vp *valueParser) peek() byte {
+	if vp.eof() {
+		return 0
+	}
+	return vp.src.Text[vp.pos]
+}
+
+func (vp *valueParser) errorf(format string, args ...any) error {
+	return vp.src.Errorf(vp.pos, format, args...)
+}
+
+// expect consumes c, or reports what was found instead
+func (vp *valueParser) expect(c byte) error {
+	if vp.eof() {
+		return vp.errorf("expected %q, got end of value", c)
+	}
+	if vp.peek() != c {
+		return vp.errorf("expected %q, got %q", c, vp.peek())
+	}
+	vp.pos++
+	return nil
+}
+
+// enter accounts for an object or array opening at the current position
+func (vp *valueParser) enter() error {
+	vp.depth++
+	if vp.maxDepth > 0 && vp.depth > vp.maxDepth {
+		return rfcquery.NewLimitError(rfcquery.LimitJSONDepth, vp.maxDepth, vp.src.Offset(vp.pos))
+	}
+	if vp.depth > maxValueDepth {
+		return vp.errorf("value nested deeper than %d levels", maxValueDepth)
+	}
+	return nil
+}
+
+// number converts the number text at start
+func (vp *valueParser) number(text string, start int) (any, error) {
+	if vp.useNumber {
+		return json.Number(text), nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		vp.pos = start
+		return nil, vp.errorf("number %s out of range", text)
+	}
+	return f, nil
+}
+
+// scanNumber reads -?digits[.digits][e[sign]digits], signs lists the
+// exponent signs allowed. The number is returned in JSON syntax
+func (vp *valueParser) scanNumber(signs string) (string, error) {
+	start := vp.pos
+	digits := func() bool {
+		from := vp.pos
+		for !vp.eof() && '0' <= vp.peek() && vp.peek() <= '9' {
+			vp.pos++
+		}
+		return vp.pos > from
+	}
+
+	if vp.peek() == '-' {
+		vp.pos++
+	}
+	intStart := vp.pos
+	if !digits() {
+		return "", vp.errorf("invalid number")
+	}
+	if vp.pos-intStart > 1 && vp.src.Text[intStart] == '0' {
+		vp.pos = intStart
+		return "", vp.errorf("leading zeros are not allowed")
+	}
+	if vp.peek() == '.' {
+		vp.pos++
+		if !digits() {
+			return "", vp.errorf("invalid number fraction")
+		}
+	}
+	if vp.peek() == 'e' || vp.peek() == 'E' {
+		vp.pos++
+		if c := vp.peek(); c != 0 && strings.IndexByte(signs, c) >= 0 {
+			vp.pos++
+		}
+		if !digits() {
+			return "", vp.errorf("invalid number exponent")
+		}
+	}
+	return vp.src.Text[start:vp.pos], nil
+}
+
+func (vp *valueParser) risonValue() (any, error) {
+	if vp.eof() {
+		return nil, vp.errorf("unexpected end of Rison value")
+	}
+
+	start := vp.pos
+	switch c := vp.peek(); {
+	case c == '(':
+		vp.pos++
+		return vp.risonObject(')')
+
+	case c == '!':
+		vp.pos++
+		switch vp.peek() {
+		case 't':
+			vp.pos++
+			return true, nil
+		case 'f':
+			vp.pos++
+			return false, nil
+		case 'n':
+			vp.pos++
+			return nil, nil
+		case '(':
+			vp.pos++
+			return vp.risonArray(')')
+		}
+		vp.pos = start
+		return nil, vp.errorf("unknown Rison literal, expected !t, !f, !n or !(")
+
+	case c == '\'':
+		return vp.risonString()
+
+	case c == '-' || '0' <= c && c <= '9':
+		text, err := vp.scanNumber("-")
+		if err != nil {
+			return nil, err
+		}
+		return vp.number(text, start)
+	}
+
+	if id := vp.risonID(); id != "" {
+		return id, nil
+	}
+	return nil, vp.errorf("unexpected %q looking for a Rison value", vp.src.Text[vp.pos])
+}
+
+// risonID reads an unquoted string
+func (vp *valueParser) risonID() string {
+	start := vp.pos
+	for !vp.eof() && strings.IndexByte(notIDChar, vp.peek()) < 0 {
+		r, size := utf8.DecodeRuneInString(vp.src.Text[vp.pos:])
+		if r == utf8.RuneError && size == 1 {
+			break
+		}
+		vp.pos += size
+	}
+	return vp.src.Text[start:vp.pos]
+}
+
+// risonString reads a quoted string, where '!' escapes '!' and the quote
+func (vp *valueParser) risonString() (string, error) {
+	vp.pos++
+	var sb strings.Builder
+	for {
+		if vp.eof() {
+			return "", vp.errorf("unterminated Rison string")
+		}
+		switch vp.peek() {
+		case '\'':
+			vp.pos++
+			return sb.String(), nil
+		case '!':
+			vp.pos++
+			if e := vp.peek(); e != '!' && e != '\'' {
+				vp.pos--
+				return "", vp.errorf("invalid Rison string escape, expected !! or !'")
+			}
+			sb.WriteByte(vp.peek())
+			vp.pos++
+		default:
+			r, size := utf8.DecodeRuneInString(vp.src.Text[vp.pos:])
+			if r == utf8.RuneError && size == 1 {
+				return "", vp.errorf("invalid UTF-8 in Rison string")
+			}
+			sb.WriteString(vp.src.Text[vp.pos : vp.pos+size])
+			vp.pos += size
+		}
+	}
+}
+
+// risonKey reads an object key, an id or a quoted string
+func (vp *valueParser) risonKey() (string, error) {
+	if vp.peek() == '\'' {
+		return vp.risonString()
+	}
+	if c := vp.peek(); c == '-' || '0' <= c && c <= '9' {
+		return "", vp.errorf("object keys must be strings")
+	}
+	if id := vp.risonID(); id != "" {
+		return id, nil
+	}
+	if vp.eof() {
+		return "", vp.errorf("unexpected end of Rison value, expected an object key")
+	}
+	return "", vp.errorf("unexpected %q, expected an object key", vp.peek())
+}
+
+// risonObject reads the members of an object up to close, 0 for the end
+// of the value as in O-Rison
+func (vp *valueParser) risonObject(close byte) (map[string]any, error) {
+	if err := vp.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { vp.depth-- }()
+
+	object := map[string]any{}
+	if vp.peek() == close {
+		if close != 0 {
+			vp.pos++
+		}
+		return object, nil
+	}
+
+	for {
+		keyStart := vp.pos
+		key, err := vp.risonKey()
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := object[key]; dup {
+			vp.pos = keyStart
+			return nil, vp.errorf("duplicate key %q", key)
+		}
+		if err := vp.expect(':'); err != nil {
+			return nil, err
+		}
+		if object[key], err = vp.risonValue(); err != nil {
+			return nil, err
+		}
+
+		if vp.peek() == ',' {
+			vp.pos++
+			continue
+		}
+		if close == 0 {
+			return object, nil
+		}
+		return object, vp.expect(close)
+	}
+}
+
+// risonArray reads the elements of an array up to close, 0 for the end of
+// the value as in A-Rison
+func (vp *valueParser) risonArray(close byte) ([]any, error) {
+	if err := vp.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { vp.depth-- }()
+
+	array := []any{}
+	if vp.peek() == close {
+		if close != 0 {
+			vp.pos++
+		}
+		return array, nil
+	}
+
+	for {
+		value, err := vp.risonValue()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+
+		if vp.peek() == ',' {
+			vp.pos++
+			continue
+		}
+		if close == 0 {
+			return array, nil
+		}
+		return array, vp.expect(close)
+	}
+}
+
+func (vp *valueParser) jsurlValue() (any, error) {
+	if err := vp.expect('~'); err != nil {
+		return nil, err
+	}
+
+	start := vp.pos
+	switch c := vp.peek(); {
+	case c == '(':
+		if err := vp.enter(); err != nil {
+			return nil, err
+		}
+		defer func() { vp.depth-- }()
+		vp.pos++
+		if vp.peek() == '~' {
+			return vp.jsurlArray()
+		}
+		return vp.jsurlObject()
+
+	case c == '\'':
+		vp.pos++
+		return vp.jsurlString()
+
+	case c == '-' || '0' <= c && c <= '9':
+		text, err := vp.scanNumber("+-")
+		if err != nil {
+			return nil, err
+		}
+		return vp.number(text, start)
+	}
+
+	for !vp.eof() && vp.peek() != '~' && vp.peek() != ')' {
+		vp.pos++
+	}
+	switch word := vp.src.Text[start:vp.pos]; word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	case "":
+		return nil, vp.errorf("missing JSURL value")
+	default:
+		vp.pos = start
+		return nil, vp.errorf("unknown JSURL keyword %q", word)
+	}
+}
+
+// jsurlArray reads the elements after "(", "~)" is the empty array
+func (vp *valueParser) jsurlArray() ([]any, error) {
+	array := []any{}
+	if strings.HasPrefix(vp.src.Text[vp.pos:], "~)") {
+		vp.pos += 2
+		return array, nil
+	}
+	for vp.peek() == '~' {
+		value, err := vp.jsurlValue()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+	}
+	return array, vp.expect(')')
+}
+
+// jsurlObject reads the members after "("
+func (vp *valueParser) jsurlObject() (map[string]any, error) {
+	object := map[string]any{}
+	if vp.peek() == ')' {
+		vp.pos++
+		return object, nil
+	}
+
+	for {
+		keyStart := vp.pos
+		key, err := vp.jsurlString()
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := object[key]; dup {
+			vp.pos = keyStart
+			return nil, vp.errorf("duplicate key %q", key)
+		}
+		if object[key], err = vp.jsurlValue(); err != nil {
+			return nil, err
+		}
+
+		if vp.peek() != '~' {
+			return object, vp.expect(')')
+		}
+		vp.pos++
+	}
+}
+
+// jsurlString reads a string up to '~' or ')', unescaping "*XX" Latin-1
+// characters, "**XXXX" UTF-16 code units and "!" for '$'
+func (vp *valueParser) jsurlString() (string, error) {
+	var sb strings.Builder
+	var units []uint16
+	flush := func() {
+		if len(units) > 0 {
+			sb.WriteString(string(utf16.Decode(units)))
+			units = units[:0]
+		}
+	}
+
+	for !vp.eof() && vp.peek() != '~' && vp.peek() != ')' {
+		switch c := vp.peek(); c {
+		case '*':
+			digits := 2
+			if strings.HasPrefix(vp.src.Text[vp.pos:], "**") {
+				digits = 4
+			}
+			hexStart := vp.pos + digits/2
+			if hexStart+digits > len(vp.src.Text) {
+				return "", vp.errorf("invalid JSURL escape")
+			}
+			n, err := strconv.ParseUint(vp.src.Text[hexStart:hexStart+digits], 16, 16)
+			if err != nil {
+				return "", vp.errorf("invalid JSURL escape")
+			}
+			vp.pos = hexStart + digits
+			if digits == 4 {
+				units = append(units, uint16(n))
+				continue
+			}
+			flush()
+			sb.WriteRune(rune(n))
+		case '!':
+			flush()
+			sb.WriteByte('$')
+			vp.pos++
+		default:
+			flush()
+			r, size := utf8.DecodeRuneInString(vp.src.Text[vp.pos:])
+			if r == utf8.RuneError && size == 1 {
+				return "", vp.errorf("invalid UTF-8 in JSURL string")
+			}
+			sb.WriteString(vp.src.Text[vp.pos : vp.pos+size])
+			vp.pos += size
+		}
+	}
+	flush()
+	return sb.String(), nil
+}
@@ -0,0 +1,167 @@
+package rison
+
+import (
+	"fmt"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+// Notation is the object notation of a value
+type Notation int
+
+const (
+	// NotationRison is Rison, as used by Kibana: (a:1,b:!(x,y),c:'it!'s')
+	//
+	//	value  = object / array / "!t" / "!f" / "!n" / number / string
+	//	object = "(" [ key ":" value *( "," key ":" value ) ] ")"
+	//	array  = "!(" [ value *( "," value ) ] ")"
+	//	string = id / "'" *( char / "!!" / "!'" ) "'"
+	//	id     = idstart *idchar   ; no " '!:(),*@$", idstart neither '-' nor a digit
+	//	number = [ "-" ] 1*DIGIT [ "." 1*DIGIT ] [ "e" [ "-" ] 1*DIGIT ]
+	NotationRison Notation = iota
+
+	// NotationORison is O-Rison, an object without its parentheses: a:1,b:2
+	NotationORison
+
+	// NotationARison is A-Rison, an array without its "!(" and ")": x,y
+	NotationARison
+
+	// NotationJSURL is JSURL: ~(a~1~b~(~'x~'y)~c~true)
+	//
+	//	value  = "~" ( object / array / "'" string / number / "true" / "false" / "null" )
+	//	object = "(" [ string value *( "~" string value ) ] ")"
+	//	array  = "(" ( "~)" / 1*value ")" )
+	//	string = *( char / "*" 2HEXDIG / "**" 4HEXDIG / "!" )   ; "!" is '$'
+	NotationJSURL
+)
+
+func (n Notation) String() string {
+	switch n {
+	case NotationRison:
+		return "rison"
+	case NotationORison:
+		return "o-rison"
+	case NotationARison:
+		return "a-rison"
+	case NotationJSURL:
+		return "jsurl"
+	default:
+		return fmt.Sprintf("Notation(%d)", int(n))
+	}
+}
+
+// RisonParser parses a Rison or JSURL value into the values of
+// encoding/json: map[string]any, []any, string, float64, bool and nil
+type RisonParser struct {
+	// TargetParam is the parameter holding the value, e.g. "_a".
+	// Empty means the whole query is the value
+	TargetParam string
+
+	// Notation of the value, Rison by default
+	Notation Notation
+
+	// UseNumber decodes numbers as json.Number instead of float64
+	UseNumber bool
+
+	// StrictValidation enforces RFC3986 compliance
+	StrictValidation bool
+}
+
+// NewRisonParser creates a Rison parser reading the parameter param,
+// empty for the whole query
+func NewRisonParser(param string) *RisonParser {
+	return &RisonParser{
+		TargetParam:      param,
+		Notation:         NotationRison,
+		StrictValidation: true,
+	}
+}
+
+// NewJSURLParser creates a JSURL parser reading the parameter param,
+// empty for the whole query
+func NewJSURLParser(param string) *RisonParser {
+	return &RisonParser{
+		TargetParam:      param,
+		Notation:         NotationJSURL,
+		StrictValidation: true,
+	}
+}
+
+// Name returns the parser identifier
+func (p *RisonParser) Name() string {
+	if p.TargetParam != "" {
+		return fmt.Sprintf("%s[%s]", p.Notation, p.TargetParam)
+	}
+	return p.Notation.String()
+}
+
+// Parse implements the Parser interface, the result is the decoded value
+func (p *RisonParser) Parse(scanner *rfcquery.Scanner) (any, error) {
+	if p.Notation < NotationRison || p.Notation > NotationJSURL {
+		return nil, fmt.Errorf("unknown notation %v", p.Notation)
+	}
+
+	if p.StrictValidation {
+		if err := scanner.Valid(); err != nil {
+			return nil, fmt.Errorf("RFC3986 validation failed: %w", err)
+		}
+		scanner.Reset()
+	}
+
+	src, err := p.value(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	vp := &valueParser{
+		src:       src,
+		useNumber: p.UseNumber,
+		maxDepth:  scanner.Options().MaxJSONDepth,
+	}
+	return vp.parse(p.Notation)
+}
+
+// value returns the Source of the value to parse
+func (p *RisonParser) value(scanner *rfcquery.Scanner) (source.Source, error) {
+	if p.TargetParam == "" {
+		tokens, err := scanner.CollectAll()
+		if err != nil {
+			return source.Source{}, err
+		}
+		return source.New(tokens, scanner.Pos()), nil
+	}
+
+	formParser := &formurlencoded.FormURLEncodedParser{}
+	result, err := formParser.Parse(scanner)
+	if err != nil {
+		return source.Source{}, fmt.Errorf("failed to parse query parameters: %w", err)
+	}
+
+	param, err := source.Single(source.Params(result.(*rfcquery.Values)), p.TargetParam, p.Notation.String())
+	if err != nil {
+		return source.Source{}, err
+	}
+	return param.Value(), nil
+}
+
+// ParseRison - convenience function, parses the Rison value of param,
+// empty for the whole query
+func ParseRison(query, param string) (any, error) {
+	return parse(query, NewRisonParser(param))
+}
+
+// ParseJSURL - convenience function, parses the JSURL value of param,
+// empty for the whole query
+func ParseJSURL(query, param string) (any, error) {
+	return parse(query, NewJSURLParser(param))
+}
+
+func parse(query string, parser *RisonParser) (any, error) {
+	scanner := rfcquery.NewScanner(query)
+	if err := scanner.Valid(); err != nil {
+		return nil, err
+	}
+	return parser.Parse(scanner)
+}
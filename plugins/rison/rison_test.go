@@ -0,0 +1,224 @@
+package rison_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/plugins/rison"
+)
+
+func TestRisonParser_Parse(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		notation rison.Notation
+		want     any
+	}{
+		{"kibana state", "_a=(columns:!(_source),filters:!(),query:(language:kuery,query:'status:200'))", rison.NotationRison,
+			map[string]any{"columns": []any{"_source"}, "filters": []any{}, "query": map[string]any{"language": "kuery", "query": "status:200"}}},
+		{"literals", "_a=!(!t,!f,!n,-1.5e-3,42,'',a-b.c/d~e)", rison.NotationRison,
+			[]any{true, false, nil, -0.0015, 42.0, "", "a-b.c/d~e"}},
+		{"string escapes", "_a='it!'s%20a!!'", rison.NotationRison, "it's a!"},
+		{"percent-encoded id", "_a=(na%C3%AFve:caf%C3%A9)", rison.NotationRison, map[string]any{"naïve": "café"}},
+		{"o-rison", "_a=a:1,b:(c:x)", rison.NotationORison, map[string]any{"a": 1.0, "b": map[string]any{"c": "x"}}},
+		{"empty o-rison", "_a=", rison.NotationORison, map[string]any{}},
+		{"a-rison", "_a=x,!(1,2),'y'", rison.NotationARison, []any{"x", []any{1.0, 2.0}, "y"}},
+		{"jsurl", "_a=~(name~'John*20Doe~age~30~tags~(~'a~'b)~ok~true~none~null~empty~(~))", rison.NotationJSURL,
+			map[string]any{"name": "John Doe", "age": 30.0, "tags": []any{"a", "b"}, "ok": true, "none": nil, "empty": []any{}}},
+		{"jsurl escapes", "_a=~'!5*e9**20ac**d83d**de00", rison.NotationJSURL, "$5é€😀"},
+		{"jsurl empty object", "_a=~()", rison.NotationJSURL, map[string]any{}},
+		{"jsurl numbers", "_a=~(~-1~2.5e%2B3)", rison.NotationJSURL, []any{-1.0, 2500.0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := rison.NewRisonParser("_a")
+			parser.Notation = tt.notation
+			got, err := parser.Parse(rfcquery.NewScanner("page=1&" + tt.query))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	whole, err := rison.ParseRison("(a:1)", "")
+	if err != nil || !reflect.DeepEqual(whole, map[string]any{"a": 1.0}) {
+		t.Errorf("ParseRison() of the whole query = %#v, %v", whole, err)
+	}
+
+	parser := rison.NewJSURLParser("q")
+	parser.UseNumber = true
+	numbers, err := parser.Parse(rfcquery.NewScanner("q=~(~12345678901234567890)"))
+	if err != nil || !reflect.DeepEqual(numbers, []any{json.Number("12345678901234567890")}) {
+		t.Errorf("Parse() with UseNumber = %#v, %v", numbers, err)
+	}
+}
+
+func TestRisonParser_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		notation rison.Notation
+		wantPos  int
+		wantMsg  string
+	}{
+		{"unknown literal", "x=1&q=(a:!x)", rison.NotationRison, 9, "unknown Rison literal"},
+		{"bad escape", "q='a!b'", rison.NotationRison, 4, "invalid Rison string escape"},
+		{"unterminated string", "q='abc", rison.NotationRison, 6, "unterminated Rison string"},
+		{"missing colon", "q=(a,b)", rison.NotationRison, 4, `expected ':', got ','`},
+		{"unclosed object", "q=(a:1", rison.NotationRison, 6, `expected ')', got end of value`},
+		{"number key", "q=(1:a)", rison.NotationRison, 3, "object keys must be strings"},
+		{"duplicate key", "q=(a:1,a:2)", rison.NotationRison, 7, `duplicate key "a"`},
+		{"leading zero", "q=!(007)", rison.NotationRison, 4, "leading zeros are not allowed"},
+		{"trailing data", "q=(a:1))", rison.NotationRison, 7, `unexpected ')' after the rison value`},
+		{"percent-encoded error", "q=(a:%21z)", rison.NotationRison, 5, "unknown Rison literal"},
+		{"jsurl missing tilde", "q=(a~1)", rison.NotationJSURL, 2, `expected '~', got '('`},
+		{"jsurl keyword", "q=~(a~yes)", rison.NotationJSURL, 6, `unknown JSURL keyword "yes"`},
+		{"jsurl escape", "q=~'*zz", rison.NotationJSURL, 4, "invalid JSURL escape"},
+		{"jsurl unclosed", "q=~(~1", rison.NotationJSURL, 6, `expected ')', got end of value`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := rison.NewRisonParser("q")
+			parser.Notation = tt.notation
+			_, err := parser.Parse(rfcquery.NewScanner(tt.query))
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+
+	scanner := rfcquery.NewScannerContext(context.Background(), "q=!(!(!(1)))", rfcquery.ParseOptions{MaxJSONDepth: 2})
+	_, err := rison.NewRisonParser("q").Parse(scanner)
+	var limitErr *rfcquery.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != rfcquery.LimitJSONDepth || limitErr.Pos.Offset != 8 {
+		t.Errorf("expected a json-depth limit error at position 8, got %v", err)
+	}
+
+	if _, err := rison.ParseRison("q=1&q=2", "q"); err == nil || !strings.Contains(err.Error(), "multiple values") {
+		t.Errorf("expected a multiple values error, got %v", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	value := map[string]any{
+		"query":   map[string]any{"language": "kuery", "query": "status:200 AND it's 100%"},
+		"columns": []any{"_source", "a&b=c", "-x", "$"},
+		"empty":   "",
+		"n":       []any{1, -2.5, 1e21, nil, true, false},
+		"naïve":   "😀",
+	}
+
+	tests := []struct {
+		notation rison.Notation
+		value    any
+		want     string
+	}{
+		{rison.NotationRison, map[string]any{"a": []any{1, "x y", true}, "b": nil}, "(a:!(1,'x%20y',!t),b:!n)"},
+		{rison.NotationORison, map[string]any{"a": "it's"}, "a:'it!'s'"},
+		{rison.NotationARison, []any{"a", 1e21}, "a,1e21"},
+		{rison.NotationJSURL, map[string]any{"a": []any{1, "x y"}, "b": map[string]any{}}, "~(a~(~1~'x*20y)~b~())"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.notation.String(), func(t *testing.T) {
+			got, err := rison.Encode(tt.value, tt.notation)
+			if err != nil || got != tt.want {
+				t.Errorf("Encode() = %q, %v, want %q", got, err, tt.want)
+			}
+
+			// the lexer accepts the output, and it decodes to the same value
+			encoded, err := rison.Encode(value, tt.notation)
+			if tt.notation == rison.NotationARison {
+				encoded, err = rison.Encode([]any{value, "x"}, tt.notation)
+			}
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			parser := rison.NewRisonParser("s")
+			parser.Notation = tt.notation
+			decoded, err := parser.Parse(rfcquery.NewScanner("s=" + encoded))
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", encoded, err)
+			}
+			var want any
+			roundTrip(t, value, &want)
+			if tt.notation == rison.NotationARison {
+				want = []any{want, "x"}
+			}
+			if !reflect.DeepEqual(decoded, want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", encoded, decoded, want)
+			}
+		})
+	}
+
+	if _, err := rison.Encode([]any{1}, rison.NotationORison); err == nil {
+		t.Error("Encode() of an array as O-Rison should fail")
+	}
+	if _, err := rison.Encode(map[string]any{"": 1}, rison.NotationJSURL); err == nil {
+		t.Error("Encode() of an empty first key as JSURL should fail")
+	}
+}
+
+// roundTrip converts v to the values of encoding/json
+func roundTrip(t *testing.T, v any, out *any) {
+	t.Helper()
+	text, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(text, out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func FuzzRisonParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		"(columns:!(_source),query:(language:kuery,query:'status:200'))",
+		"!(!t,!f,!n,-1.5e-3,42,'',a-b.c/d~e,'it!'s')",
+		"~(name~'John*20Doe~tags~(~'a~'b)~ok~true~empty~(~))",
+		"a:1,b:(c:x)",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		for notation := rison.NotationRison; notation <= rison.NotationJSURL; notation++ {
+			parser := rison.NewRisonParser("q")
+			parser.Notation = notation
+			parsed, err := parser.Parse(rfcquery.NewScanner("q=" + value))
+			if err != nil {
+				continue
+			}
+
+			// parsed values encode back to an equal value
+			encoded, err := rison.Encode(parsed, notation)
+			if err != nil {
+				if notation == rison.NotationJSURL {
+					continue // an empty first key
+				}
+				t.Fatalf("Encode(%#v) error = %v", parsed, err)
+			}
+			again, err := parser.Parse(rfcquery.NewScanner("q=" + encoded))
+			if err != nil {
+				t.Fatalf("Parse(%q) of the encoded value error = %v", encoded, err)
+			}
+			if !reflect.DeepEqual(again, parsed) {
+				t.Fatalf("%v round trip of %q = %#v, want %#v", notation, encoded, again, parsed)
+			}
+		}
+	})
+}
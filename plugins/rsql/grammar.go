@@ -0,0 +1,313 @@
+package rsql
+
+import (
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+)
+
+// maxExprDepth bounds the nesting of parenthesized groups
+const maxExprDepth = 100
+
+// reservedChars are quoted when rendering an argument
+const reservedChars = `"'();,=!<> `
+
+// cursor walks a TokenSlice, reporting the end of input as position end
+type cursor struct {
+	tokens rfcquery.TokenSlice
+	pos    int
+	end    int
+}
+
+func (c *cursor) eof() bool {
+	return c.pos >= len(c.tokens)
+}
+
+func (c *cursor) peek() rfcquery.Token {
+	return c.tokens[c.pos]
+}
+
+// offset returns the query offset of the current token, or of the end of input
+func (c *cursor) offset() int {
+	if c.eof() {
+		return c.end
+	}
+	return c.tokens[c.pos].Start.Offset
+}
+
+// sym returns the structural character of the current token, 0 for data
+// and at the end of input
+func (c *cursor) sym() byte {
+	if c.eof() {
+		return 0
+	}
+	return symbol(c.peek())
+}
+
+// symbol returns the structural character of t, 0 for data. The
+// sub-delimiters are structural when unencoded, while '<', '>' and '"'
+// can only be written percent-encoded
+func symbol(t rfcquery.Token) byte {
+	switch t.Type {
+	case rfcquery.TokenSubDelims:
+		if strings.Contains(";,=()!'", t.Value) {
+			return t.Value[0]
+		}
+	case rfcquery.TokenPercentEncoded:
+		if strings.Contains(`<>"`, t.Decoded) {
+			return t.Decoded[0]
+		}
+	}
+	return 0
+}
+
+// char returns the decoded byte of t
+func char(t rfcquery.Token) byte {
+	if t.Type == rfcquery.TokenPercentEncoded {
+		return t.Decoded[0]
+	}
+	return t.Value[0]
+}
+
+type exprParser struct {
+	cursor
+	operators map[string]RSQLOperator
+	depth     int
+}
+
+func (ep *exprParser) position(i int) rfcquery.Position {
+	if i >= len(ep.tokens) {
+		return rfcquery.Position{Offset: ep.end}
+	}
+	return ep.tokens[i].Start
+}
+
+// parseOr parses ',' separated conjunctions
+func (ep *exprParser) parseOr() (RSQLNode, error) {
+	ep.depth++
+	defer func() { ep.depth-- }()
+	if ep.depth > maxExprDepth {
+		return nil, rfcquery.NewError(ep.offset(), "expression nested deeper than %d levels", maxExprDepth)
+	}
+
+	return ep.parseLogical(RSQLOr, ',', ep.parseAnd)
+}
+
+// parseAnd parses ';' separated constraints
+func (ep *exprParser) parseAnd() (RSQLNode, error) {
+	return ep.parseLogical(RSQLAnd, ';', ep.parseConstraint)
+}
+
+func (ep *exprParser) parseLogical(op RSQLLogicOp, sep byte, operand func() (RSQLNode, error)) (RSQLNode, error) {
+	start := ep.pos
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	children := appendFlat(nil, op, first)
+	for ep.sym() == sep {
+		ep.pos++
+		child, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		children = appendFlat(children, op, child)
+	}
+
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &RSQLLogical{
+		Op:       op,
+		Children: children,
+		Pos:      ep.position(start),
+		Tokens:   ep.tokens[start:ep.pos],
+	}, nil
+}
+
+// appendFlat appends node to children, or its children when a parenthesized
+// group has the same operator: "(a;b);c" is "a;b;c"
+func appendFlat(children []RSQLNode, op RSQLLogicOp, node RSQLNode) []RSQLNode {
+	if l, ok := node.(*RSQLLogical); ok && l.Op == op {
+		return append(children, l.Children...)
+	}
+	return append(children, node)
+}
+
+func (ep *exprParser) parseConstraint() (RSQLNode, error) {
+	if ep.sym() == '(' {
+		ep.pos++
+		node, err := ep.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if ep.sym() != ')' {
+			return nil, rfcquery.NewError(ep.offset(), "expected ')'")
+		}
+		ep.pos++
+		return node, nil
+	}
+
+	return ep.parseComparison()
+}
+
+func (ep *exprParser) parseComparison() (*RSQLComparison, error) {
+	start := ep.pos
+
+	selector, selectorTokens, err := ep.parseUnquoted("selector")
+	if err != nil {
+		return nil, err
+	}
+
+	opStart := ep.pos
+	name, err := ep.parseOperator()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := ep.operators[name]
+	if !ok {
+		return nil, rfcquery.NewError(ep.tokens[opStart].Start.Offset, "unknown operator %q", name)
+	}
+
+	cmp := &RSQLComparison{
+		Selector:       selector,
+		Operator:       op.Canonical,
+		Pos:            ep.position(start),
+		SelectorTokens: selectorTokens,
+		OperatorTokens: ep.tokens[opStart:ep.pos],
+	}
+
+	if ep.sym() == '(' {
+		listStart := ep.offset()
+		ep.pos++
+		for {
+			arg, tokens, err := ep.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			cmp.Arguments = append(cmp.Arguments, arg)
+			cmp.ArgumentTokens = append(cmp.ArgumentTokens, tokens)
+
+			if ep.sym() != ',' {
+				break
+			}
+			ep.pos++
+		}
+		if ep.sym() != ')' {
+			return nil, rfcquery.NewError(ep.offset(), "expected ',' or ')' in argument list")
+		}
+		ep.pos++
+
+		if !op.Multi && len(cmp.Arguments) > 1 {
+			return nil, rfcquery.NewError(listStart, "operator %q takes a single argument", name)
+		}
+	} else {
+		arg, tokens, err := ep.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		cmp.Arguments = []string{arg}
+		cmp.ArgumentTokens = []rfcquery.TokenSlice{tokens}
+	}
+
+	cmp.Tokens = ep.tokens[start:ep.pos]
+	return cmp, nil
+}
+
+// parseOperator reads "==", "!=", "=name=", "<", "<=", ">" or ">="
+func (ep *exprParser) parseOperator() (string, error) {
+	start := ep.offset()
+
+	switch ep.sym() {
+	case '=':
+		ep.pos++
+		if ep.sym() == '=' {
+			ep.pos++
+			return "==", nil
+		}
+
+		var name strings.Builder
+		for !ep.eof() && ep.sym() == 0 && isAlpha(char(ep.peek())) {
+			name.WriteByte(char(ep.peek()))
+			ep.pos++
+		}
+		if name.Len() == 0 || ep.sym() != '=' {
+			return "", rfcquery.NewError(start, "malformed operator, expected \"=name=\"")
+		}
+		ep.pos++
+		return "=" + name.String() + "=", nil
+
+	case '!':
+		ep.pos++
+		if ep.sym() != '=' {
+			return "", rfcquery.NewError(start, "malformed operator, expected \"!=\"")
+		}
+		ep.pos++
+		return "!=", nil
+
+	case '<', '>':
+		op := string(ep.sym())
+		ep.pos++
+		if ep.sym() == '=' {
+			ep.pos++
+			op += "="
+		}
+		return op, nil
+	}
+
+	return "", rfcquery.NewError(start, "expected comparison operator")
+}
+
+// parseValue reads a quoted or unquoted argument
+func (ep *exprParser) parseValue() (string, rfcquery.TokenSlice, error) {
+	quote := ep.sym()
+	if quote != '\'' && quote != '"' {
+		return ep.parseUnquoted("argument")
+	}
+
+	start := ep.pos
+	ep.pos++
+
+	var sb strings.Builder
+	for !ep.eof() {
+		t := ep.peek()
+		ep.pos++
+
+		switch {
+		case symbol(t) == quote:
+			return sb.String(), ep.tokens[start:ep.pos], nil
+		case char(t) == '\\' && !ep.eof():
+			sb.WriteByte(char(ep.peek()))
+			ep.pos++
+		default:
+			sb.WriteByte(char(t))
+		}
+	}
+
+	return "", nil, rfcquery.NewError(ep.tokens[start].Start.Offset, "unterminated quoted argument")
+}
+
+// parseUnquoted reads a selector or unquoted argument, what names it in errors
+func (ep *exprParser) parseUnquoted(what string) (string, rfcquery.TokenSlice, error) {
+	start := ep.pos
+	for !ep.eof() && ep.sym() == 0 {
+		if char(ep.peek()) == ' ' {
+			return "", nil, rfcquery.NewError(ep.offset(), "unexpected space in %s, quote the value", what)
+		}
+		ep.pos++
+	}
+
+	tokens := ep.tokens[start:ep.pos]
+	if len(tokens) == 0 {
+		if ep.eof() {
+			return "", nil, rfcquery.NewError(ep.offset(), "expected %s", what)
+		}
+		return "", nil, rfcquery.NewError(ep.offset(), "expected %s, got %q", what, ep.peek().Value)
+	}
+	return tokens.StringDecoded(), tokens, nil
+}
+
+func isAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
@@ -0,0 +1,238 @@
+package rsql
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+// RSQLOperator describes a comparison operator
+type RSQLOperator struct {
+	// Canonical is the symbol stored in RSQLComparison.Operator,
+	// aliases such as "<" and "=lt=" share it
+	Canonical string
+
+	// Multi operators accept a parenthesized list of arguments,
+	// the others a single one
+	Multi bool
+}
+
+// defaultOperators are the FIQL operators, their RSQL aliases and =in= / =out=
+var defaultOperators = map[string]RSQLOperator{
+	"==":    {Canonical: "=="},
+	"!=":    {Canonical: "!="},
+	"=lt=":  {Canonical: "=lt="},
+	"<":     {Canonical: "=lt="},
+	"=le=":  {Canonical: "=le="},
+	"<=":    {Canonical: "=le="},
+	"=gt=":  {Canonical: "=gt="},
+	">":     {Canonical: "=gt="},
+	"=ge=":  {Canonical: "=ge="},
+	">=":    {Canonical: "=ge="},
+	"=in=":  {Canonical: "=in=", Multi: true},
+	"=out=": {Canonical: "=out=", Multi: true},
+}
+
+// DefaultOperators returns a copy of the standard operators, to be extended
+// (e.g. with "=like=") and assigned to RSQLParser.Operators
+func DefaultOperators() map[string]RSQLOperator {
+	return maps.Clone(defaultOperators)
+}
+
+// RSQLNode is a node of an RSQL expression, either a *RSQLLogical
+// or a *RSQLComparison
+type RSQLNode interface {
+	Position() rfcquery.Position
+
+	// String renders the node back to RSQL, with canonical operators
+	String() string
+}
+
+// RSQLLogicOp is the operator of a logical node
+type RSQLLogicOp string
+
+const (
+	RSQLAnd RSQLLogicOp = "and" // ';'
+	RSQLOr  RSQLLogicOp = "or"  // ','
+)
+
+// RSQLLogical joins two or more nodes
+type RSQLLogical struct {
+	Op       RSQLLogicOp
+	Children []RSQLNode
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// RSQLComparison is a "selector operator arguments" constraint
+type RSQLComparison struct {
+	Selector  string
+	Operator  string   // canonical symbol, e.g. "==" or "=gt="
+	Arguments []string // a single item unless the operator is Multi
+
+	Pos            rfcquery.Position
+	Tokens         rfcquery.TokenSlice
+	SelectorTokens rfcquery.TokenSlice
+	OperatorTokens rfcquery.TokenSlice
+	ArgumentTokens []rfcquery.TokenSlice
+}
+
+func (n *RSQLLogical) Position() rfcquery.Position    { return n.Pos }
+func (n *RSQLComparison) Position() rfcquery.Position { return n.Pos }
+
+func (n *RSQLLogical) String() string {
+	sep := ";"
+	if n.Op == RSQLOr {
+		sep = ","
+	}
+
+	parts := make([]string, len(n.Children))
+	for i, child := range n.Children {
+		parts[i] = child.String()
+		// an OR inside an AND needs parentheses
+		if l, ok := child.(*RSQLLogical); ok && n.Op == RSQLAnd && l.Op == RSQLOr {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+func (n *RSQLComparison) String() string {
+	args := make([]string, len(n.Arguments))
+	for i, arg := range n.Arguments {
+		args[i] = quoteArgument(arg)
+	}
+
+	if len(args) == 1 {
+		return n.Selector + n.Operator + args[0]
+	}
+	return n.Selector + n.Operator + "(" + strings.Join(args, ",") + ")"
+}
+
+// quoteArgument quotes arguments that are not valid unquoted strings
+func quoteArgument(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, reservedChars) {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// RSQLParser parses RSQL / FIQL filter expressions.
+//
+// The grammar, where the structural characters ; , = ! ( ) ' must appear
+// unencoded (percent-encoded they are plain data) and < > " percent-encoded.
+// Unquoted selectors and values may not contain spaces:
+//
+//	or          = and *( "," and )
+//	and         = constraint *( ";" constraint )
+//	constraint  = "(" or ")" / comparison
+//	comparison  = selector operator ( value / "(" value *( "," value ) ")" )
+//	operator    = "==" / "!=" / "=" 1*ALPHA "=" / "<" / "<=" / ">" / ">="
+//	value       = 1*char / DQUOTE *char DQUOTE / "'" *char "'"   ; %5C escapes a quote
+type RSQLParser struct {
+	// TargetParam is the parameter holding the expression, e.g. "filter".
+	// Empty means the whole query is the expression
+	TargetParam string
+
+	// Operators maps every accepted operator symbol to its definition,
+	// nil means DefaultOperators()
+	Operators map[string]RSQLOperator
+
+	// StrictValidation enforces RFC3986 compliance
+	StrictValidation bool
+}
+
+// NewRSQLParser creates a parser reading the whole query as an expression
+func NewRSQLParser() *RSQLParser {
+	return &RSQLParser{
+		Operators:        DefaultOperators(),
+		StrictValidation: true,
+	}
+}
+
+// Name returns the parser identifier
+func (p *RSQLParser) Name() string {
+	return "rsql"
+}
+
+// Parse implements the Parser interface, the result is a RSQLNode
+func (p *RSQLParser) Parse(scanner *rfcquery.Scanner) (any, error) {
+	if p.StrictValidation {
+		if err := scanner.Valid(); err != nil {
+			return nil, fmt.Errorf("RFC3986 validation failed: %w", err)
+		}
+		scanner.Reset()
+	}
+
+	tokens, end, err := p.expressionTokens(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	ep := &exprParser{
+		cursor:    cursor{tokens: tokens, end: end},
+		operators: p.Operators,
+	}
+	if ep.operators == nil {
+		ep.operators = defaultOperators
+	}
+
+	if ep.eof() {
+		return nil, rfcquery.NewError(end, "empty RSQL expression")
+	}
+
+	node, err := ep.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !ep.eof() {
+		return nil, rfcquery.NewError(ep.offset(), "unexpected %q", ep.peek().Value)
+	}
+	return node, nil
+}
+
+// expressionTokens returns the tokens of the expression and the offset following them
+func (p *RSQLParser) expressionTokens(scanner *rfcquery.Scanner) (rfcquery.TokenSlice, int, error) {
+	if p.TargetParam == "" {
+		tokens, err := scanner.CollectAll()
+		return tokens, scanner.Pos(), err
+	}
+
+	formParser := &formurlencoded.FormURLEncodedParser{}
+	result, err := formParser.Parse(scanner)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse query parameters: %w", err)
+	}
+
+	param, err := source.Single(source.Params(result.(*rfcquery.Values)), p.TargetParam, "RSQL")
+	if err != nil {
+		return nil, 0, err
+	}
+	value := param.Value()
+	return value.Tokens, value.Offset(len(value.Tokens)), nil
+}
+
+// ParseRSQL - convenience function, the whole query is the expression
+func ParseRSQL(query string) (RSQLNode, error) {
+	scanner := rfcquery.NewScanner(query)
+	if err := scanner.Valid(); err != nil {
+		return nil, err
+	}
+
+	result, err := NewRSQLParser().Parse(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	node, ok := result.(RSQLNode)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %T", result)
+	}
+
+	return node, nil
+}
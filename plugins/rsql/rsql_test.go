@@ -0,0 +1,223 @@
+package rsql_test
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/plugins/rsql"
+)
+
+func TestParseRSQL(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		want         string
+		wantChildren int // of a logical root node
+	}{
+		{"comparison", "name==Kill", "name==Kill", 0},
+		{"fiql operator", "year=gt=2000", "year=gt=2000", 0},
+		{"alias", "year%3E=2000;year%3C2010", "year=ge=2000;year=lt=2010", 2},
+		{"not equal", "genre!=horror", "genre!=horror", 0},
+		{"and binds tighter", "a==1,b==2;c==3", "a==1,b==2;c==3", 2},
+		{"n-ary", "a==1;b==2;c==3", "a==1;b==2;c==3", 3},
+		{"parentheses", "(a==1,b==2);c==3", "(a==1,b==2);c==3", 2},
+		{"nested groups", "((a==1))", "a==1", 0},
+		{"same operator group", "(a==1;b==2);c==3", "a==1;b==2;c==3", 3},
+		{"in list", "genre=in=(sci-fi,action)", "genre=in=(sci-fi,action)", 0},
+		{"single in", "genre=out=drama", "genre=out=drama", 0},
+		{"single quoted", "name=='Kill%20Bill'", `name=="Kill Bill"`, 0},
+		{"double quoted", "name==%22a;b,c%22", `name=="a;b,c"`, 0},
+		{"escaped quote", "name=='it%5C's'", `name=="it's"`, 0},
+		{"empty quoted", "name==''", `name==""`, 0},
+		{"encoded delimiters", "name==a%3Bb%2Cc", `name=="a;b,c"`, 0},
+		{"dotted selector", "director.lastName==Nolan", "director.lastName==Nolan", 0},
+		{"wildcard", "name==*Bill*", "name==*Bill*", 0},
+		{"quoted in list", "genre=in=(sci-fi,'film%20noir')", `genre=in=(sci-fi,"film noir")`, 0},
+		{"escaped double quote", "name==%22say%20%5C%22hi%5C%22%22", `name=="say \"hi\""`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := rsql.ParseRSQL(tt.input)
+			if err != nil {
+				t.Fatalf("ParseRSQL() error = %v", err)
+			}
+			if got := node.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			children := 0
+			if l, ok := node.(*rsql.RSQLLogical); ok {
+				children = len(l.Children)
+			}
+			if children != tt.wantChildren {
+				t.Errorf("root node has %d children, want %d", children, tt.wantChildren)
+			}
+		})
+	}
+}
+
+func TestParseRSQL_Positions(t *testing.T) {
+	node, err := rsql.ParseRSQL("a==1;(b=in=(x,'y'),c%3E2)")
+	if err != nil {
+		t.Fatalf("ParseRSQL() error = %v", err)
+	}
+
+	and := node.(*rsql.RSQLLogical)
+	or := and.Children[1].(*rsql.RSQLLogical)
+	in := or.Children[0].(*rsql.RSQLComparison)
+	gt := or.Children[1].(*rsql.RSQLComparison)
+
+	if and.Pos.Offset != 0 || or.Pos.Offset != 6 || in.Pos.Offset != 6 || gt.Pos.Offset != 19 {
+		t.Errorf("positions = %d, %d, %d, %d", and.Pos.Offset, or.Pos.Offset, in.Pos.Offset, gt.Pos.Offset)
+	}
+	if got := in.OperatorTokens.String(); got != "=in=" {
+		t.Errorf("OperatorTokens = %q", got)
+	}
+	if got := in.ArgumentTokens[1].String(); got != "'y'" {
+		t.Errorf("ArgumentTokens[1] = %q", got)
+	}
+	if got := gt.OperatorTokens.String(); got != "%3E" || gt.Operator != "=gt=" {
+		t.Errorf("gt operator = %s from %q", gt.Operator, got)
+	}
+	if got := or.Tokens.String(); got != "b=in=(x,'y'),c%3E2" {
+		t.Errorf("or Tokens = %q", got)
+	}
+}
+
+func TestRSQLParser_CustomOperators(t *testing.T) {
+	parser := rsql.NewRSQLParser()
+	parser.Operators["=like="] = rsql.RSQLOperator{Canonical: "=like="}
+	parser.Operators["=between="] = rsql.RSQLOperator{Canonical: "=between=", Multi: true}
+
+	result, err := parser.Parse(rfcquery.NewScanner("name=like=Kill*;year=between=(2000,2010)"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := result.(rsql.RSQLNode).String(); got != "name=like=Kill*;year=between=(2000,2010)" {
+		t.Errorf("got %s", got)
+	}
+
+	if _, err := rsql.ParseRSQL("name=like=Kill*"); err == nil {
+		t.Errorf("custom operator accepted by the default parser")
+	}
+	if _, err := parser.Parse(rfcquery.NewScanner("name=like=(a,b)")); err == nil {
+		t.Errorf("argument list accepted for a single-value operator")
+	}
+}
+
+func TestRSQLParser_TargetParam(t *testing.T) {
+	parser := rsql.NewRSQLParser()
+	parser.TargetParam = "filter"
+
+	result, err := parser.Parse(rfcquery.NewScanner("page=2&filter=a==1,b=out=(x,y)&size=10"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	node := result.(rsql.RSQLNode)
+	if got := node.String(); got != "a==1,b=out=(x,y)" {
+		t.Errorf("got %s", got)
+	}
+	if node.Position().Offset != 14 {
+		t.Errorf("Position() = %d, want 14", node.Position().Offset)
+	}
+
+	if _, err := parser.Parse(rfcquery.NewScanner("page=2")); err == nil {
+		t.Errorf("missing parameter accepted")
+	}
+
+	_, err = parser.Parse(rfcquery.NewScanner("filter=a==1&filter=b=="))
+	var rfcErr *rfcquery.Error
+	if !errors.As(err, &rfcErr) || rfcErr.Pos.Offset != 12 {
+		t.Errorf("got %v, want an error on the second parameter (12)", err)
+	}
+}
+
+func TestParseRSQL_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{"empty", "", 0, "empty RSQL expression"},
+		{"missing selector", "==1", 0, "expected selector"},
+		{"missing operator", "name", 4, "expected comparison operator"},
+		{"malformed operator", "name=gt1", 4, "malformed operator"},
+		{"unknown operator", "name=like=x", 4, "unknown operator"},
+		{"missing argument", "name==", 6, "expected argument"},
+		{"missing operand", "a==1;", 5, "expected selector"},
+		{"unquoted space", "name==Kill%20Bill", 10, "unexpected space"},
+		{"unterminated quote", "name=='Kill", 6, "unterminated quoted argument"},
+		{"unclosed group", "(a==1,b==2", 10, "expected ')'"},
+		{"unbalanced paren", "a==1)", 4, "unexpected \")\""},
+		{"unclosed list", "a=in=(1,2", 9, "expected ',' or ')'"},
+		{"list for single value", "a==(1,2)", 3, "takes a single argument"},
+		{"too deep", strings.Repeat("(", 200) + "a==1" + strings.Repeat(")", 200), 100, "nested deeper"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := rsql.ParseRSQL(tt.input)
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func FuzzRSQLParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		"name==Kill;year=gt=2000",
+		"(a==1,b==2);c%3E=3",
+		"genre=in=(sci-fi,'film%20noir')",
+		"name==%22a%5C%22b%22",
+		strings.Repeat("(", 50),
+		"a==1)",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		node, err := rsql.ParseRSQL(input)
+		if err != nil {
+			return
+		}
+
+		// the rendering of a valid expression must parse to the same tree,
+		// selectors are never quoted so they must not need it
+		if hasReservedSelector(node) {
+			return
+		}
+		rendered := node.String()
+		structural := strings.NewReplacer("+", "%20", "%3B", ";", "%2C", ",", "%3D", "=", "%21", "!", "%28", "(", "%29", ")", "%27", "'")
+		reparsed, err := rsql.ParseRSQL(structural.Replace(url.QueryEscape(rendered)))
+		if err != nil {
+			t.Fatalf("rendering %q of %q does not parse: %v", rendered, input, err)
+		}
+		if got := reparsed.String(); got != rendered {
+			t.Fatalf("%q renders as %q, which renders again as %q", input, rendered, got)
+		}
+	})
+}
+
+func hasReservedSelector(n rsql.RSQLNode) bool {
+	switch n := n.(type) {
+	case *rsql.RSQLLogical:
+		for _, child := range n.Children {
+			if hasReservedSelector(child) {
+				return true
+			}
+		}
+	case *rsql.RSQLComparison:
+		return strings.ContainsAny(n.Selector, `"'();,=!<> `)
+	}
+	return false
+}
@@ -0,0 +1,476 @@
+package scim
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+)
+
+// SCIMExprKind is the kind of a node of a filter expression
+type SCIMExprKind int
+
+const (
+	SCIMLogical   SCIMExprKind = iota // Left Op Right, Op is "and" or "or"
+	SCIMNot                           // not (Left)
+	SCIMCompare                       // Attr Op Value, Op is "eq", "co", ... or "pr" without a Value
+	SCIMValuePath                     // Attr[Left], Left is evaluated on each value of a multi-valued attribute
+)
+
+func (k SCIMExprKind) String() string {
+	switch k {
+	case SCIMLogical:
+		return "logical"
+	case SCIMNot:
+		return "not"
+	case SCIMCompare:
+		return "compare"
+	case SCIMValuePath:
+		return "valuePath"
+	default:
+		return "invalid"
+	}
+}
+
+// SCIMExpr is a node of a filter expression, RFC 7644 section 3.4.2.2.
+// Keywords and operators are case-insensitive and stored lowercased.
+//
+//	filter    = or-expr
+//	or-expr   = and-expr *( SP "or" SP and-expr )
+//	and-expr  = operand *( SP "and" SP operand )
+//	operand   = "not" [SP] "(" filter ")" / "(" filter ")"
+//	          / attrPath "[" filter "]" / attrPath SP "pr"
+//	          / attrPath SP compareOp SP compValue
+//	compareOp = "eq" / "ne" / "co" / "sw" / "ew" / "gt" / "lt" / "ge" / "le"
+//	compValue = "false" / "null" / "true" / number / string
+type SCIMExpr struct {
+	Kind SCIMExprKind
+
+	Op    string
+	Left  *SCIMExpr
+	Right *SCIMExpr
+
+	Attr *SCIMAttrPath
+
+	// Value is the comparison value: string, int64, float64, bool or nil
+	Value any
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// String renders the expression in filter syntax, with only the
+// parentheses its precedence requires
+func (e *SCIMExpr) String() string {
+	switch e.Kind {
+	case SCIMLogical:
+		return e.Left.operand(e.precedence()) + " " + e.Op + " " + e.Right.operand(e.precedence()+1)
+	case SCIMNot:
+		return "not (" + e.Left.String() + ")"
+	case SCIMValuePath:
+		return e.Attr.String() + "[" + e.Left.String() + "]"
+	case SCIMCompare:
+		if e.Op == "pr" {
+			return e.Attr.String() + " pr"
+		}
+		return e.Attr.String() + " " + e.Op + " " + e.value()
+	default:
+		return "?"
+	}
+}
+
+// precedence ranks the node from "or" (1) to the operands (3)
+func (e *SCIMExpr) precedence() int {
+	if e.Kind != SCIMLogical {
+		return 3
+	}
+	if e.Op == "or" {
+		return 1
+	}
+	return 2
+}
+
+// operand renders e, parenthesized when it binds looser than min
+func (e *SCIMExpr) operand(min int) string {
+	if e.precedence() < min {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+func (e *SCIMExpr) value() string {
+	switch v := e.Value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case string:
+		b, _ := json.Marshal(v)
+		return string(b)
+	default:
+		return "?"
+	}
+}
+
+// SCIMAttrPath is an attribute path such as "name.givenName" or
+// "urn:ietf:params:scim:schemas:core:2.0:User:userName"
+type SCIMAttrPath struct {
+	URI     string // schema URI, "" when not qualified
+	Name    string
+	SubAttr string
+
+	Pos    rfcquery.Position
+	Tokens rfcquery.TokenSlice
+}
+
+// String renders the path as written, without the URI when unqualified
+func (a *SCIMAttrPath) String() string {
+	s := a.Name
+	if a.SubAttr != "" {
+		s += "." + a.SubAttr
+	}
+	if a.URI != "" {
+		s = a.URI + ":" + s
+	}
+	return s
+}
+
+// maxExprDepth bounds the recursion of the filter parser
+const maxExprDepth = 100
+
+var (
+	numberPattern   = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?`)
+	attrNamePattern = regexp.MustCompile(`^(\$ref|[A-Za-z][A-Za-z0-9_-]*)$`)
+)
+
+var compareOps = []string{"eq", "ne", "co", "sw", "ew", "gt", "lt", "ge", "le"}
+
+// filterParser works on the decoded filter value, positions are mapped
+// back to the original query through the source tokens
+type filterParser struct {
+	src   source.Source
+	pos   int
+	depth int
+}
+
+func parseFilter(src source.Source) (*SCIMExpr, error) {
+	fp := &filterParser{src: src}
+
+	fp.skipSpaces()
+	expr, err := fp.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	fp.skipSpaces()
+	if !fp.eof() {
+		return nil, fp.errorf("unexpected %q in filter", fp.src.Text[fp.pos])
+	}
+	return expr, nil
+}
+
+func (fp *filterParser) eof() bool {
+	return fp.pos >= len(fp.src.Text)
+}
+
+func (fp *filterParser) peek() byte {
+	if fp.eof() {
+		return 0
+	}
+	return fp.src.Text[fp.pos]
+}
+
+func (fp *filterParser) errorf(format string, args ...any) error {
+	return fp.src.Errorf(fp.pos, format, args...)
+}
+
+func (fp *filterParser) skipSpaces() {
+	for !fp.eof() && fp.src.Text[fp.pos] == ' ' {
+		fp.pos++
+	}
+}
+
+// node fills the position and tokens of a node that started at start
+func (fp *filterParser) node(expr *SCIMExpr, start int) *SCIMExpr {
+	expr.Pos = fp.src.Position(start)
+	expr.Tokens = fp.src.Tokens[start:fp.pos]
+	return expr
+}
+
+// keyword consumes one of words, case-insensitively, when it is followed
+// by a space, by one of the bytes in also or by the end of the value
+func (fp *filterParser) keyword(words []string, also string) (string, bool) {
+	rest := fp.src.Text[fp.pos:]
+	for _, w := range words {
+		if len(rest) < len(w) || !strings.EqualFold(rest[:len(w)], w) {
+			continue
+		}
+		if next := len(w); next == len(rest) || rest[next] == ' ' || strings.IndexByte(also, rest[next]) >= 0 {
+			fp.pos += len(w)
+			return w, true
+		}
+	}
+	return "", false
+}
+
+// binaryOp consumes " op " after an operand
+func (fp *filterParser) binaryOp(ops []string) (string, bool) {
+	save := fp.pos
+	if fp.peek() != ' ' {
+		return "", false
+	}
+	fp.skipSpaces()
+	if op, ok := fp.keyword(ops, "("); ok {
+		fp.skipSpaces()
+		return op, true
+	}
+	fp.pos = save
+	return "", false
+}
+
+func (fp *filterParser) enter() error {
+	fp.depth++
+	if fp.depth > maxExprDepth {
+		return fp.errorf("filter nested deeper than %d levels", maxExprDepth)
+	}
+	return nil
+}
+
+func (fp *filterParser) parseOr() (*SCIMExpr, error) {
+	if err := fp.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { fp.depth-- }()
+
+	start := fp.pos
+	left, err := fp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := fp.binaryOp([]string{"or"}); !ok {
+			return left, nil
+		}
+		right, err := fp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = fp.node(&SCIMExpr{Kind: SCIMLogical, Op: "or", Left: left, Right: right}, start)
+	}
+}
+
+func (fp *filterParser) parseAnd() (*SCIMExpr, error) {
+	start := fp.pos
+	left, err := fp.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := fp.binaryOp([]string{"and"}); !ok {
+			return left, nil
+		}
+		right, err := fp.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = fp.node(&SCIMExpr{Kind: SCIMLogical, Op: "and", Left: left, Right: right}, start)
+	}
+}
+
+func (fp *filterParser) parseOperand() (*SCIMExpr, error) {
+	start := fp.pos
+
+	if _, ok := fp.keyword([]string{"not"}, "("); ok {
+		fp.skipSpaces()
+		if fp.peek() != '(' {
+			return nil, fp.errorf("expected '(' after not")
+		}
+		inner, err := fp.parseGroup('(', ')')
+		if err != nil {
+			return nil, err
+		}
+		return fp.node(&SCIMExpr{Kind: SCIMNot, Op: "not", Left: inner}, start), nil
+	}
+
+	if fp.peek() == '(' {
+		return fp.parseGroup('(', ')')
+	}
+
+	attr, err := fp.parseAttrPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if fp.peek() == '[' {
+		inner, err := fp.parseGroup('[', ']')
+		if err != nil {
+			return nil, err
+		}
+		return fp.node(&SCIMExpr{Kind: SCIMValuePath, Attr: attr, Left: inner}, start), nil
+	}
+
+	if fp.peek() != ' ' {
+		return nil, fp.errorf("expected operator after attribute %q", attr.String())
+	}
+	fp.skipSpaces()
+
+	opStart := fp.pos
+	if _, ok := fp.keyword([]string{"pr"}, ")]"); ok {
+		return fp.node(&SCIMExpr{Kind: SCIMCompare, Op: "pr", Attr: attr}, start), nil
+	}
+
+	op, ok := fp.keyword(compareOps, "")
+	if !ok {
+		return nil, fp.errorf("expected comparison operator after attribute %q", attr.String())
+	}
+	if fp.peek() != ' ' {
+		fp.pos = opStart
+		return nil, fp.errorf("expected value after %q", op)
+	}
+	fp.skipSpaces()
+
+	value, err := fp.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return fp.node(&SCIMExpr{Kind: SCIMCompare, Op: op, Attr: attr, Value: value}, start), nil
+}
+
+// parseGroup parses a filter enclosed in open and close
+func (fp *filterParser) parseGroup(open, close byte) (*SCIMExpr, error) {
+	fp.pos++
+	fp.skipSpaces()
+	inner, err := fp.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	fp.skipSpaces()
+	if fp.peek() != close {
+		return nil, fp.errorf("expected '%c' to close '%c'", close, open)
+	}
+	fp.pos++
+	return inner, nil
+}
+
+func (fp *filterParser) parseAttrPath() (*SCIMAttrPath, error) {
+	start := fp.pos
+	for !fp.eof() && strings.IndexByte(" []()\"", fp.src.Text[fp.pos]) < 0 {
+		fp.pos++
+	}
+	return parseAttrPath(fp.src.Slice(start, fp.pos))
+}
+
+// parseAttrPath parses [URI ":"] ATTRNAME ["." ATTRNAME]
+func parseAttrPath(src source.Source) (*SCIMAttrPath, error) {
+	if src.Text == "" {
+		return nil, src.Errorf(0, "expected attribute path")
+	}
+
+	attr := &SCIMAttrPath{Pos: src.Position(0), Tokens: src.Tokens}
+
+	// the URI ends at the last ':', attribute names never contain one
+	nameStart := strings.LastIndexByte(src.Text, ':') + 1
+	if nameStart > 0 {
+		attr.URI = src.Text[:nameStart-1]
+		if !strings.HasPrefix(strings.ToLower(attr.URI), "urn:") {
+			return nil, src.Errorf(0, "invalid schema URI %q", attr.URI)
+		}
+	}
+
+	name := src.Text[nameStart:]
+	// a URI may contain dots ("2.0"), the sub-attribute follows the name
+	if dot := strings.IndexByte(name, '.'); dot >= 0 {
+		attr.SubAttr = name[dot+1:]
+		name = name[:dot]
+		if !attrNamePattern.MatchString(attr.SubAttr) {
+			return nil, src.Errorf(nameStart+dot+1, "invalid sub-attribute name %q", attr.SubAttr)
+		}
+	}
+	if !attrNamePattern.MatchString(name) {
+		return nil, src.Errorf(nameStart, "invalid attribute name %q", name)
+	}
+	attr.Name = name
+	return attr, nil
+}
+
+func (fp *filterParser) parseValue() (any, error) {
+	if fp.peek() == '"' {
+		return fp.parseString()
+	}
+
+	if word, ok := fp.keyword([]string{"true", "false", "null"}, ")]"); ok {
+		switch word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, nil
+	}
+
+	text := numberPattern.FindString(fp.src.Text[fp.pos:])
+	if text == "" || !fp.endOfValue(fp.pos+len(text)) {
+		return nil, fp.errorf("expected a string, number, true, false or null value")
+	}
+
+	var value any
+	if strings.ContainsAny(text, ".eE") {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fp.errorf("invalid number %q", text)
+		}
+		value = f
+	} else {
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fp.errorf("number %q out of range", text)
+		}
+		value = n
+	}
+	fp.pos += len(text)
+	return value, nil
+}
+
+// endOfValue reports whether a value may end at i
+func (fp *filterParser) endOfValue(i int) bool {
+	return i == len(fp.src.Text) || strings.IndexByte(" )]", fp.src.Text[i]) >= 0
+}
+
+// parseString reads a JSON string literal
+func (fp *filterParser) parseString() (string, error) {
+	start := fp.pos
+	end := -1
+	for i := start + 1; i < len(fp.src.Text); i++ {
+		if fp.src.Text[i] == '\\' {
+			i++
+			continue
+		}
+		if fp.src.Text[i] == '"' {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return "", fp.errorf("unterminated string")
+	}
+
+	var s string
+	if err := json.Unmarshal([]byte(fp.src.Text[start:end+1]), &s); err != nil {
+		return "", fp.errorf("invalid string: %v", err)
+	}
+	fp.pos = end + 1
+	return s, nil
+}
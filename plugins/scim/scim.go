@@ -0,0 +1,178 @@
+package scim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+	formurlencoded "github.com/CRSylar/rfcquery/plugins/form_urlencoded"
+)
+
+// SCIMQuery holds the query parameters of a SCIM 2.0 list or search
+// request, RFC 7644 section 3.4.2. Parameters that were not present are
+// left nil (or "" for SortOrder)
+type SCIMQuery struct {
+	Filter *SCIMExpr
+
+	// Attributes and ExcludedAttributes are mutually exclusive
+	Attributes         []*SCIMAttrPath
+	ExcludedAttributes []*SCIMAttrPath
+
+	SortBy    *SCIMAttrPath
+	SortOrder string // "ascending" or "descending"
+
+	// StartIndex is 1-based, smaller values are read as 1.
+	// Negative Count values are read as 0
+	StartIndex *int
+	Count      *int
+
+	// OtherParams holds the parameters not defined by SCIM
+	OtherParams map[string][]string
+}
+
+// SCIMParser parses SCIM query parameters and filter expressions.
+// Spaces in a filter must be percent-encoded as %20
+type SCIMParser struct {
+	// StrictValidation enforces RFC3986 compliance
+	StrictValidation bool
+}
+
+// NewSCIMParser creates a parser with default settings
+func NewSCIMParser() *SCIMParser {
+	return &SCIMParser{
+		StrictValidation: true,
+	}
+}
+
+// Name returns the parser identifier
+func (p *SCIMParser) Name() string {
+	return "scim"
+}
+
+// Parse implements the Parser interface
+func (p *SCIMParser) Parse(scanner *rfcquery.Scanner) (any, error) {
+	if p.StrictValidation {
+		if err := scanner.Valid(); err != nil {
+			return nil, fmt.Errorf("RFC3986 validation failed: %w", err)
+		}
+		scanner.Reset()
+	}
+
+	formParser := &formurlencoded.FormURLEncodedParser{}
+	result, err := formParser.Parse(scanner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query parameters: %w", err)
+	}
+
+	query := &SCIMQuery{OtherParams: make(map[string][]string)}
+	seen := make(map[string]bool)
+
+	for _, param := range source.Params(result.(*rfcquery.Values)) {
+		if !isSCIMParam(param.Key) {
+			query.OtherParams[param.Key] = append(query.OtherParams[param.Key], param.ValueTokens.StringDecoded())
+			continue
+		}
+
+		if seen[param.Key] {
+			return nil, rfcquery.NewError(param.Pos.Offset, "duplicate parameter %q", param.Key)
+		}
+		seen[param.Key] = true
+		if seen["attributes"] && seen["excludedAttributes"] {
+			return nil, rfcquery.NewError(param.Pos.Offset, "attributes and excludedAttributes cannot be combined")
+		}
+
+		if err := applyParam(query, param.Key, param.Pos.Offset, param.Value()); err != nil {
+			return nil, err
+		}
+	}
+
+	return query, nil
+}
+
+func isSCIMParam(key string) bool {
+	switch key {
+	case "filter", "attributes", "excludedAttributes", "sortBy", "sortOrder", "startIndex", "count":
+		return true
+	}
+	return false
+}
+
+func applyParam(query *SCIMQuery, name string, pos int, value source.Source) error {
+	if value.Text == "" {
+		return rfcquery.NewError(pos, "empty value for %s", name)
+	}
+
+	var err error
+	switch name {
+	case "filter":
+		query.Filter, err = parseFilter(value)
+	case "attributes":
+		query.Attributes, err = parseAttrList(value)
+	case "excludedAttributes":
+		query.ExcludedAttributes, err = parseAttrList(value)
+	case "sortBy":
+		query.SortBy, err = parseAttrPath(value)
+	case "sortOrder":
+		switch strings.ToLower(value.Text) {
+		case "ascending", "descending":
+			query.SortOrder = strings.ToLower(value.Text)
+		default:
+			err = value.Errorf(0, "sortOrder must be ascending or descending, got %q", value.Text)
+		}
+	case "startIndex":
+		query.StartIndex, err = parseInt(value, name, 1)
+	case "count":
+		query.Count, err = parseInt(value, name, 0)
+	}
+	return err
+}
+
+// parseInt parses an integer, values below minimum are read as minimum
+func parseInt(value source.Source, name string, minimum int) (*int, error) {
+	n, err := strconv.Atoi(value.Text)
+	if err != nil || strings.HasPrefix(value.Text, "+") {
+		return nil, value.Errorf(0, "%s must be an integer, got %q", name, value.Text)
+	}
+	n = max(n, minimum)
+	return &n, nil
+}
+
+// parseAttrList parses a comma-separated list of attribute paths
+func parseAttrList(value source.Source) ([]*SCIMAttrPath, error) {
+	var attrs []*SCIMAttrPath
+	start := 0
+	for i := 0; i <= len(value.Text); i++ {
+		if i < len(value.Text) && value.Text[i] != ',' {
+			continue
+		}
+		attr, err := parseAttrPath(value.Slice(start, i))
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+		start = i + 1
+	}
+	return attrs, nil
+}
+
+// ParseSCIMQuery - convenience function
+func ParseSCIMQuery(query string) (*SCIMQuery, error) {
+	scanner := rfcquery.NewScanner(query)
+	if err := scanner.Valid(); err != nil {
+		return nil, err
+	}
+
+	result, err := NewSCIMParser().Parse(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, ok := result.(*SCIMQuery)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %T", result)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,199 @@
+package scim_test
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/plugins/scim"
+)
+
+func TestSCIMParser_Filter(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"equality", "filter=userName%20eq%20%22bjensen%22", `userName eq "bjensen"`},
+		{"request example", "filter=userName%20eq%20%22bjensen%22%20and%20%28emails%20co%20%22example.com%22%20or%20emails.type%20eq%20%22work%22%29", `userName eq "bjensen" and (emails co "example.com" or emails.type eq "work")`},
+		{"and binds tighter", "filter=a%20pr%20or%20b%20pr%20and%20c%20pr", "a pr or b pr and c pr"},
+		{"left grouping", "filter=%28a%20pr%20or%20b%20pr%29%20and%20c%20pr", "(a pr or b pr) and c pr"},
+		{"case-insensitive keywords", "filter=title%20PR%20AND%20userType%20Eq%20%22Employee%22", `title pr and userType eq "Employee"`},
+		{"not", "filter=not%20%28name.familyName%20sw%20%22J%22%29", `not (name.familyName sw "J")`},
+		{"not without space", "filter=not%28active%20eq%20true%29", "not (active eq true)"},
+		{"value path", "filter=emails%5Btype%20eq%20%22work%22%20and%20value%20ew%20%22%40example.com%22%5D", `emails[type eq "work" and value ew "@example.com"]`},
+		{"value path in logic", "filter=userType%20eq%20%22Employee%22%20and%20emails%5Btype%20eq%20%22work%22%5D", `userType eq "Employee" and emails[type eq "work"]`},
+		{"schema uri", "filter=urn%3Aietf%3Aparams%3Ascim%3Aschemas%3Acore%3A2.0%3AUser%3Aname.familyName%20co%20%22O%27Malley%22", `urn:ietf:params:scim:schemas:core:2.0:User:name.familyName co "O'Malley"`},
+		{"integer", "filter=meta.version%20gt%2010", "meta.version gt 10"},
+		{"decimal", "filter=score%20le%20-1.5e2", "score le -150.0"},
+		{"null", "filter=manager%20eq%20null", "manager eq null"},
+		{"escaped string", "filter=displayName%20eq%20%22say%20%5C%22hi%5C%22%20%5Cu00e9%22", `displayName eq "say \"hi\" é"`},
+		{"ref attribute", "filter=groups.%24ref%20pr", "groups.$ref pr"},
+		{"nested groups", "filter=%28%28a%20pr%29%29", "a pr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := scim.ParseSCIMQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseSCIMQuery() error = %v", err)
+			}
+			if got := q.Filter.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSCIMParser_FilterPositions(t *testing.T) {
+	const (
+		logical = "filter=userName%20eq%20%22b%22%20and%20emails%5Btype%20pr%5D"
+		not     = "filter=not%20(a%20pr)"
+		grouped = "filter=(a%20pr)%20or%20b%20pr"
+	)
+
+	tests := []struct {
+		name       string
+		input      string
+		node       func(f *scim.SCIMExpr) *scim.SCIMExpr
+		wantPos    int
+		wantTokens string
+	}{
+		{"and", logical, func(f *scim.SCIMExpr) *scim.SCIMExpr { return f }, 7, "userName%20eq%20%22b%22%20and%20emails%5Btype%20pr%5D"},
+		{"comparison", logical, func(f *scim.SCIMExpr) *scim.SCIMExpr { return f.Left }, 7, "userName%20eq%20%22b%22"},
+		{"value path", logical, func(f *scim.SCIMExpr) *scim.SCIMExpr { return f.Right }, 39, "emails%5Btype%20pr%5D"},
+		{"value filter", logical, func(f *scim.SCIMExpr) *scim.SCIMExpr { return f.Right.Left }, 48, "type%20pr"},
+		{"not", not, func(f *scim.SCIMExpr) *scim.SCIMExpr { return f }, 7, "not%20(a%20pr)"},
+		{"negated filter", not, func(f *scim.SCIMExpr) *scim.SCIMExpr { return f.Left }, 14, "a%20pr"},
+		{"parenthesized", grouped, func(f *scim.SCIMExpr) *scim.SCIMExpr { return f.Left }, 8, "a%20pr"},
+		{"after parentheses", grouped, func(f *scim.SCIMExpr) *scim.SCIMExpr { return f.Right }, 23, "b%20pr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := scim.ParseSCIMQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseSCIMQuery() error = %v", err)
+			}
+			node := tt.node(q.Filter)
+			if node.Pos.Offset != tt.wantPos || node.Tokens.String() != tt.wantTokens {
+				t.Errorf("node at %d with tokens %q, want %d with %q", node.Pos.Offset, node.Tokens.String(), tt.wantPos, tt.wantTokens)
+			}
+		})
+	}
+
+	q, err := scim.ParseSCIMQuery(logical)
+	if err != nil {
+		t.Fatalf("ParseSCIMQuery() error = %v", err)
+	}
+	if attr := q.Filter.Right.Left.Attr; attr.Pos.Offset != 48 || attr.Tokens.String() != "type" {
+		t.Errorf("attribute at %d with tokens %q, want 48 with %q", attr.Pos.Offset, attr.Tokens.String(), "type")
+	}
+}
+
+func TestSCIMParser_Options(t *testing.T) {
+	q, err := scim.ParseSCIMQuery("attributes=userName,name.givenName,urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager" +
+		"&sortBy=meta.created&sortOrder=Descending&startIndex=0&count=-5&tenant=acme")
+	if err != nil {
+		t.Fatalf("ParseSCIMQuery() error = %v", err)
+	}
+
+	var attrs []string
+	for _, a := range q.Attributes {
+		attrs = append(attrs, a.String())
+	}
+	want := "userName name.givenName urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager"
+	if got := strings.Join(attrs, " "); got != want {
+		t.Errorf("Attributes = %s, want %s", got, want)
+	}
+	if a := q.Attributes[2]; a.URI != "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User" || a.Name != "manager" {
+		t.Errorf("Attributes[2] = %+v", a)
+	}
+
+	if q.SortBy.Name != "meta" || q.SortBy.SubAttr != "created" || q.SortOrder != "descending" {
+		t.Errorf("sort = %s %s", q.SortBy, q.SortOrder)
+	}
+	if *q.StartIndex != 1 || *q.Count != 0 {
+		t.Errorf("startIndex = %d, count = %d, want 1 and 0", *q.StartIndex, *q.Count)
+	}
+	if q.Filter != nil || q.ExcludedAttributes != nil {
+		t.Errorf("absent parameters are set")
+	}
+	if got := q.OtherParams["tenant"]; len(got) != 1 || got[0] != "acme" {
+		t.Errorf("OtherParams = %v", q.OtherParams)
+	}
+}
+
+func TestSCIMParser_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{"empty filter", "filter=", 0, "empty value"},
+		{"missing operator", "filter=userName", 15, "expected operator"},
+		{"unknown operator", "filter=userName%20like%20%22x%22", 18, "expected comparison operator"},
+		{"missing value", "filter=userName%20eq", 18, "expected value"},
+		{"bad value", "filter=userName%20eq%20bjensen", 23, "expected a string"},
+		{"unterminated string", "filter=userName%20eq%20%22bj", 23, "unterminated string"},
+		{"not without group", "filter=not%20userName%20pr", 13, "expected '('"},
+		{"unclosed group", "filter=%28a%20pr", 16, "expected ')'"},
+		{"unclosed value path", "filter=emails%5Btype%20pr", 25, "expected ']'"},
+		{"trailing input", "filter=a%20pr%20b%20pr", 16, "unexpected"},
+		{"bad attribute", "filter=1abc%20pr", 7, "invalid attribute name"},
+		{"bad sub-attribute", "filter=name.given-name.%20pr", 12, "invalid sub-attribute"},
+		{"bad uri", "filter=http%3Aname%20pr", 7, "invalid schema URI"},
+		{"duplicate", "count=1&count=2", 8, "duplicate parameter"},
+		{"bad count", "count=ten", 6, "must be an integer"},
+		{"bad sort order", "sortOrder=up", 10, "ascending or descending"},
+		{"attributes and excluded", "attributes=a&excludedAttributes=b", 13, "cannot be combined"},
+		{"empty attribute", "attributes=a,,b", 13, "expected attribute path"},
+		{"too deep", "filter=" + strings.Repeat("(", 200) + "a%20pr" + strings.Repeat(")", 200), 107, "nested deeper"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := scim.ParseSCIMQuery(tt.input)
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func FuzzSCIMParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		"filter=userName%20eq%20%22bjensen%22%20and%20%28emails%20co%20%22example.com%22%20or%20emails.type%20eq%20%22work%22%29",
+		"filter=not%20%28emails%5Btype%20eq%20%22work%22%20and%20value%20pr%5D%29",
+		"filter=meta.lastModified%20gt%20%222011-05-13T04%3A42%3A34Z%22%20or%20score%20ge%201.5e3",
+		"attributes=userName&sortBy=name.familyName&sortOrder=ascending&startIndex=1&count=10",
+		"filter=" + strings.Repeat("(", 50),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		q, err := scim.ParseSCIMQuery(input)
+		if err != nil || q.Filter == nil {
+			return
+		}
+
+		// rendered filters parse back to the same filter
+		rendered := q.Filter.String()
+		again, err := scim.ParseSCIMQuery("filter=" + strings.ReplaceAll(url.QueryEscape(rendered), "+", "%20"))
+		if err != nil {
+			t.Fatalf("ParseSCIMQuery() of rendered filter %q error = %v", rendered, err)
+		}
+		if got := again.Filter.String(); got != rendered {
+			t.Fatalf("rendered filter %q renders again as %q", rendered, got)
+		}
+	})
+}
@@ -0,0 +1,582 @@
+package tmfparser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+)
+
+// The TMF630 query grammar recognized by TMFParser, over RFC3986 tokens:
+//
+//	query    = [ term ] *( sep [ term ] )
+//	sep      = ";" / "&"
+//	term     = groups / segment
+//	groups   = group *( "," group )              ; OR, only with EnableGrouping
+//	group    = "(" [ term ] *( sep [ term ] ) ")" ; AND
+//	segment  = field [ operator [ values ] ]
+//	field    = 1*( token that is not a sep and does not start an operator )
+//	operator = the longest symbolic OperatorMap key ( "%3E%3D", "%3C", ... )
+//	         / dot-operator ( "=" / "%3D" )   ; field ends with an OperatorMap key like ".gt"
+//	values   = value *( "," value )      ; not starting with "=" / "%3D", nor with
+//	                                     ; an operator unit unless the operator ends in "="
+//	value    = 1*( token that is not a sep nor "," )
+//
+// With EnableGrouping, fields and values also end at a ")" that closes no
+// "(" of their own, so "a=1)" reports the unmatched ")".
+//
+// A literal "=" and its encoded form "%3D" are interchangeable inside operators,
+// and percent-encoded hex digits are compared case-insensitively.
+
+// operatorTable is the lookup structure built from a TMFParser.OperatorMap
+type operatorTable struct {
+	symbolic map[string]TMFOperator // normalized symbolic operators
+	dot      map[string]TMFOperator // dot-notation suffixes (".gt")
+	starts   map[string]bool        // normalized first unit of every symbolic operator
+	maxUnits int                    // longest symbolic operator, in tokens
+}
+
+func newOperatorTable(operators map[string]TMFOperator) *operatorTable {
+	table := &operatorTable{
+		symbolic: make(map[string]TMFOperator),
+		dot:      make(map[string]TMFOperator),
+		starts:   make(map[string]bool),
+	}
+
+	for key, op := range operators {
+		if strings.HasPrefix(key, ".") && len(key) > 1 {
+			table.dot[key] = op
+			continue
+		}
+
+		units := operatorUnits(key)
+		// symbolic operators must not be confused with field names or separators
+		if len(units) == 0 || isFieldUnit(units[0]) || strings.ContainsAny(key, ";&,") {
+			continue
+		}
+
+		table.symbolic[strings.Join(units, "")] = op
+		table.starts[units[0]] = true
+		table.maxUnits = max(table.maxUnits, len(units))
+	}
+
+	// "=" is the TMF630 equality, it must always be recognized
+	if _, ok := table.symbolic["%3D"]; !ok {
+		table.symbolic["%3D"] = TMFOperatorEq
+		table.starts["%3D"] = true
+		table.maxUnits = max(table.maxUnits, 1)
+	}
+
+	return table
+}
+
+// operatorUnits splits an OperatorMap key into normalized token values
+func operatorUnits(key string) []string {
+	var units []string
+	for i := 0; i < len(key); i++ {
+		if key[i] == '%' && i+2 < len(key) {
+			units = append(units, normalizeUnit("%"+key[i+1:i+3]))
+			i += 2
+			continue
+		}
+		units = append(units, normalizeUnit(key[i:i+1]))
+	}
+	return units
+}
+
+// normalizeUnit maps "=" to "%3D" and upper-cases percent-encoded hex digits
+func normalizeUnit(s string) string {
+	if s == "=" {
+		return "%3D"
+	}
+	if strings.HasPrefix(s, "%") {
+		return strings.ToUpper(s)
+	}
+	return s
+}
+
+// isFieldUnit reports whether a normalized unit can be part of a field name
+func isFieldUnit(unit string) bool {
+	for i := 0; i < len(unit); i++ {
+		c := unit[i]
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~') {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns the longest symbolic operator starting at tokens[0]
+// and the number of tokens it spans
+func (t *operatorTable) match(tokens rfcquery.TokenSlice) (TMFOperator, int, bool) {
+	n := min(t.maxUnits, len(tokens))
+
+	for k := n; k > 0; k-- {
+		var sb strings.Builder
+		for _, tok := range tokens[:k] {
+			sb.WriteString(normalizeUnit(tok.Value))
+		}
+		if op, ok := t.symbolic[sb.String()]; ok {
+			return op, k, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// dotSuffix returns the dot-notation operator the field ends with, if any
+func (t *operatorTable) dotSuffix(field string) (string, TMFOperator, bool) {
+	best := ""
+	for suffix := range t.dot {
+		if len(suffix) > len(best) && len(field) > len(suffix) && strings.HasSuffix(field, suffix) {
+			best = suffix
+		}
+	}
+	if best == "" {
+		return "", "", false
+	}
+	return best, t.dot[best], true
+}
+
+// tokenCursor walks a TokenSlice, reporting the end of input as position end
+type tokenCursor struct {
+	tokens rfcquery.TokenSlice
+	pos    int
+	end    int
+}
+
+func (c *tokenCursor) eof() bool {
+	return c.pos >= len(c.tokens)
+}
+
+func (c *tokenCursor) peek() rfcquery.Token {
+	return c.tokens[c.pos]
+}
+
+// offset returns the query offset of the current token, or of the end of input
+func (c *tokenCursor) offset() int {
+	if c.eof() {
+		return c.end
+	}
+	return c.tokens[c.pos].Start.Offset
+}
+
+// collect consumes tokens until stop returns true or the input ends
+func (c *tokenCursor) collect(stop func(rfcquery.Token) bool) rfcquery.TokenSlice {
+	start := c.pos
+	for !c.eof() && !stop(c.peek()) {
+		c.pos++
+	}
+	return c.tokens[start:c.pos]
+}
+
+// segment is a single "field operator values" filter or parameter
+type segment struct {
+	Field       string
+	FieldTokens rfcquery.TokenSlice
+
+	Operator       TMFOperator
+	OperatorTokens rfcquery.TokenSlice // empty for a bare field
+	OperatorPos    int                 // query offset of the operator, or of the dot-notation suffix
+
+	// Values holds the comma-separated items, ValueTokens all of them
+	Values      []rfcquery.TokenSlice
+	ValueTokens rfcquery.TokenSlice
+}
+
+// parseSegment parses a segment starting at the cursor, the cursor is left
+// on the separator, closing ")" or end of input that follows it
+func (p *TMFParser) parseSegment(c *tokenCursor, table *operatorTable, grouping bool) (*segment, error) {
+	start := c.offset()
+	parens := 0 // "(" opened by the segment itself, as in a JSONPath filter
+	endOfValue := func(t rfcquery.Token) bool {
+		switch {
+		case isSeparator(t):
+			return true
+		case !grouping:
+			return false
+		case isSubDelim(t, "("):
+			parens++
+		case isSubDelim(t, ")"):
+			if parens == 0 {
+				return true
+			}
+			parens--
+		}
+		return false
+	}
+
+	fieldTokens := c.collect(func(t rfcquery.Token) bool {
+		return endOfValue(t) || table.starts[normalizeUnit(t.Value)]
+	})
+	if len(fieldTokens) == 0 {
+		return nil, rfcquery.NewError(start, "missing field name")
+	}
+
+	seg := &segment{
+		Field:       fieldTokens.StringDecoded(),
+		FieldTokens: fieldTokens,
+	}
+
+	suffix, dotOp, hasDot := table.dotSuffix(seg.Field)
+	if hasDot {
+		seg.Field = seg.Field[:len(seg.Field)-len(suffix)]
+		seg.FieldTokens = trimDecoded(fieldTokens, len(suffix))
+	}
+
+	if c.eof() || endOfValue(c.peek()) {
+		if hasDot {
+			return nil, rfcquery.NewError(c.offset(), "missing value for operator %s", dotOp)
+		}
+		return seg, nil
+	}
+
+	opStart := c.offset()
+	op, n, ok := table.match(c.tokens[c.pos:])
+	if !ok {
+		return nil, rfcquery.NewError(opStart, "invalid operator starting with %q", c.peek().Value)
+	}
+	seg.Operator = op
+	seg.OperatorTokens = c.tokens[c.pos : c.pos+n]
+	seg.OperatorPos = opStart
+	c.pos += n
+
+	if hasDot {
+		if op != TMFOperatorEq {
+			return nil, rfcquery.NewError(opStart, "operator %s conflicts with dot-notation operator %s", op, dotOp)
+		}
+		seg.Operator = dotOp
+		seg.OperatorPos = fieldTokens[len(seg.FieldTokens)].Start.Offset
+	}
+
+	// "a==1" and "a%3E%3E1" are mistyped operators, not comparisons with "=1"
+	// or ">1", while after an operator ending in "=" other operator
+	// characters start the value, as in "a=%3E5"
+	if !c.eof() {
+		next := normalizeUnit(c.peek().Value)
+		last := normalizeUnit(seg.OperatorTokens[len(seg.OperatorTokens)-1].Value)
+		if next == "%3D" || table.starts[next] && last != "%3D" {
+			return nil, rfcquery.NewError(c.offset(), "unexpected %q after operator %s", c.peek().Value, seg.Operator)
+		}
+	}
+
+	seg.ValueTokens = c.collect(endOfValue)
+	if len(seg.ValueTokens) == 0 {
+		if seg.Operator != TMFOperatorEq || hasDot {
+			return nil, rfcquery.NewError(c.offset(), "missing value for operator %s", seg.Operator)
+		}
+		return seg, nil
+	}
+
+	for i, value := range seg.ValueTokens.SplitSubDelimiter(",") {
+		if len(value) == 0 {
+			return nil, rfcquery.NewError(emptyItemOffset(seg.ValueTokens, i), "empty value in list")
+		}
+		seg.Values = append(seg.Values, value)
+	}
+
+	return seg, nil
+}
+
+// emptyItemOffset returns the query offset of the i-th (empty) comma-separated item
+func emptyItemOffset(tokens rfcquery.TokenSlice, i int) int {
+	if i == 0 {
+		return tokens[0].Start.Offset
+	}
+
+	commas := 0
+	for _, tok := range tokens {
+		if tok.Type == rfcquery.TokenSubDelims && tok.Value == "," {
+			commas++
+			if commas == i {
+				return tok.End.Offset
+			}
+		}
+	}
+	return tokens[len(tokens)-1].End.Offset
+}
+
+// trimDecoded drops the trailing tokens that decode to the last n bytes,
+// every token decodes to exactly one byte
+func trimDecoded(tokens rfcquery.TokenSlice, n int) rfcquery.TokenSlice {
+	return tokens[:len(tokens)-n]
+}
+
+func isSeparator(t rfcquery.Token) bool {
+	return isSubDelim(t, ";") || isSubDelim(t, "&")
+}
+
+func isSubDelim(t rfcquery.Token, value string) bool {
+	return t.Type == rfcquery.TokenSubDelims && t.Value == value
+}
+
+// queryParser holds the state of a single TMFParser.Parse call
+type queryParser struct {
+	parser *TMFParser
+	cursor *tokenCursor
+	table  *operatorTable
+	opts   rfcquery.ParseOptions
+	query  *TMFQuery
+
+	params      int
+	expressions int
+}
+
+// parseConjunction parses separator-delimited terms up to the end of input,
+// or up to the closing ")" when depth > 0, into an AND group
+func (qp *queryParser) parseConjunction(depth int) (*TMFFilterGroup, error) {
+	c := qp.cursor
+	group := &TMFFilterGroup{Logic: TMFLogicAnd}
+	grouping := qp.parser.EnableGrouping
+
+	for !c.eof() {
+		tok := c.peek()
+
+		switch {
+		case isSeparator(tok):
+			// empty segment
+			c.pos++
+			continue
+
+		case grouping && isSubDelim(tok, ")"):
+			if depth == 0 {
+				return nil, rfcquery.NewError(tok.Start.Offset, "unexpected ')' without matching '('")
+			}
+			return group, nil
+
+		case grouping && isSubDelim(tok, "("):
+			sub, err := qp.parseDisjunction(depth)
+			if err != nil {
+				return nil, err
+			}
+			appendGroup(group, *sub)
+
+		default:
+			if err := qp.parseSegmentTerm(group, depth); err != nil {
+				return nil, err
+			}
+		}
+
+		if !c.eof() && !isSeparator(c.peek()) && !(grouping && isSubDelim(c.peek(), ")")) {
+			return nil, rfcquery.NewError(c.offset(), "expected separator, got %q", c.peek().Value)
+		}
+	}
+
+	return group, nil
+}
+
+// parseDisjunction parses one or more comma-separated groups into an OR group
+func (qp *queryParser) parseDisjunction(depth int) (*TMFFilterGroup, error) {
+	c := qp.cursor
+	start := c.pos
+	or := &TMFFilterGroup{Logic: TMFLogicOr}
+
+	for {
+		open := c.peek()
+		openPos := c.pos
+		c.pos++
+
+		inner, err := qp.parseConjunction(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if c.eof() {
+			return nil, rfcquery.NewError(open.Start.Offset, "unclosed group")
+		}
+		c.pos++ // consume ")"
+
+		if inner.IsEmpty() {
+			return nil, rfcquery.NewError(open.Start.Offset, "empty group")
+		}
+		inner.Tokens = c.tokens[openPos:c.pos]
+		or.Groups = append(or.Groups, *inner)
+
+		if c.eof() || !isSubDelim(c.peek(), ",") {
+			break
+		}
+		c.pos++ // consume ","
+		if c.eof() || !isSubDelim(c.peek(), "(") {
+			return nil, rfcquery.NewError(c.offset(), "expected '(' after ',' between groups")
+		}
+	}
+
+	if len(or.Groups) == 1 {
+		return &or.Groups[0], nil
+	}
+	or.Tokens = c.tokens[start:c.pos]
+	return or, nil
+}
+
+// parseSegmentTerm parses a single segment, recording filters both in the
+// flat Expressions map and in group
+func (qp *queryParser) parseSegmentTerm(group *TMFFilterGroup, depth int) error {
+	c := qp.cursor
+	p := qp.parser
+	start := c.peek().Start
+	tokStart := c.pos
+
+	seg, err := p.parseSegment(c, qp.table, p.EnableGrouping)
+	if err != nil {
+		return err
+	}
+
+	if err := qp.opts.CheckParam(qp.params, start, seg.FieldTokens, seg.ValueTokens); err != nil {
+		return err
+	}
+	qp.params++
+
+	if depth > 0 && !p.isFilterSegment(seg.Field) {
+		return rfcquery.NewError(start.Offset, "parameter %q not allowed inside a group", seg.Field)
+	}
+
+	if !p.isFilterSegment(seg.Field) {
+		return qp.addReserved(seg)
+	}
+
+	exprs := p.segmentExpressions(seg)
+	for i := range exprs {
+		if err := p.coerceExpression(&exprs[i], seg); err != nil {
+			return err
+		}
+	}
+
+	qp.expressions += len(exprs)
+	if qp.opts.MaxTMFExpressions > 0 && qp.expressions > qp.opts.MaxTMFExpressions {
+		return rfcquery.NewLimitError(rfcquery.LimitTMFExpressions, qp.opts.MaxTMFExpressions, start.Offset)
+	}
+	qp.query.Expressions[seg.Field] = append(qp.query.Expressions[seg.Field], exprs...)
+
+	switch {
+	case len(exprs) == 1:
+		group.Expressions = append(group.Expressions, exprs[0])
+	case len(exprs) > 1:
+		// a value list means "any of", except for "!=" where it means "none of"
+		logic := TMFLogicOr
+		if seg.Operator == TMFOperatorNe {
+			logic = TMFLogicAnd
+		}
+		appendGroup(group, TMFFilterGroup{
+			Logic:       logic,
+			Expressions: exprs,
+			Tokens:      c.tokens[tokStart:c.pos],
+		})
+	}
+
+	return nil
+}
+
+// addReserved records a non-filter parameter according to its TMFParamKind
+func (qp *queryParser) addReserved(seg *segment) error {
+	p := qp.parser
+	query := qp.query
+
+	if seg.Operator != "" && seg.Operator != TMFOperatorEq {
+		return rfcquery.NewError(seg.OperatorTokens[0].Start.Offset, "operator %s not allowed on parameter %q", seg.Operator, seg.Field)
+	}
+
+	kind, _ := p.reservedKind(seg.Field)
+	switch kind {
+	case TMFParamSort:
+		sortFields, err := p.parseSortValue(seg)
+		if err != nil {
+			return fmt.Errorf("invalid sort syntax: %w", err)
+		}
+		query.Sorting = append(query.Sorting, sortFields...)
+		return nil
+
+	case TMFParamFields:
+		fields, err := p.parseFieldsValue(seg)
+		if err != nil {
+			return err
+		}
+		query.Fields = append(query.Fields, fields...)
+
+	case TMFParamOffset, TMFParamLimit:
+		n, err := p.parsePaginationValue(seg)
+		if err != nil {
+			return err
+		}
+		if err := qp.setPagination(kind, n, seg); err != nil {
+			return err
+		}
+
+	case TMFParamFilter:
+		if len(seg.ValueTokens) == 0 {
+			return rfcquery.NewError(seg.FieldTokens[len(seg.FieldTokens)-1].End.Offset, "missing JSONPath for %q", seg.Field)
+		}
+		path, err := ParseTMFJSONPath(seg.ValueTokens)
+		if err != nil {
+			return err
+		}
+		query.JSONPaths = append(query.JSONPaths, path)
+	}
+
+	values := make([]string, 0, len(seg.Values))
+	for _, v := range seg.Values {
+		values = append(values, v.StringDecoded())
+	}
+	query.OtherParams[seg.Field] = append(query.OtherParams[seg.Field], values...)
+	return nil
+}
+
+func (qp *queryParser) setPagination(kind TMFParamKind, n int, seg *segment) error {
+	pagination := &qp.query.Pagination
+	pos := seg.FieldTokens[0].Start.Offset
+
+	if kind == TMFParamOffset {
+		if pagination.OffsetTokens != nil {
+			return rfcquery.NewError(pos, "duplicate %q parameter", seg.Field)
+		}
+		pagination.Offset = n
+		pagination.OffsetTokens = seg.ValueTokens
+		return nil
+	}
+
+	if pagination.LimitTokens != nil {
+		return rfcquery.NewError(pos, "duplicate %q parameter", seg.Field)
+	}
+	if n == 0 {
+		return rfcquery.NewError(seg.ValueTokens[0].Start.Offset, "%q must be positive", seg.Field)
+	}
+	if max := qp.parser.MaxLimit; max > 0 && n > max {
+		return rfcquery.NewError(seg.ValueTokens[0].Start.Offset, "%q of %d exceeds the maximum of %d", seg.Field, n, max)
+	}
+	pagination.Limit = n
+	pagination.LimitTokens = seg.ValueTokens
+	return nil
+}
+
+// appendGroup adds sub to group, merging it when both share the same logic
+func appendGroup(group *TMFFilterGroup, sub TMFFilterGroup) {
+	if sub.Logic == group.Logic {
+		group.Expressions = append(group.Expressions, sub.Expressions...)
+		group.Groups = append(group.Groups, sub.Groups...)
+		return
+	}
+	group.Groups = append(group.Groups, sub)
+}
+
+// segmentExpressions turns a filter segment into one expression per listed value.
+// A bare field is an equality with an empty value, a field followed by "="
+// and no value yields no expressions
+func (p *TMFParser) segmentExpressions(seg *segment) []TMFExpression {
+	if seg.Operator == "" {
+		return []TMFExpression{{
+			Field:    seg.Field,
+			Operator: TMFOperatorEq,
+			Value:    "",
+			Token:    seg.FieldTokens,
+		}}
+	}
+
+	results := make([]TMFExpression, 0, len(seg.Values))
+	for _, v := range seg.Values {
+		results = append(results, TMFExpression{
+			Field:    seg.Field,
+			Operator: seg.Operator,
+			Value:    v.StringDecoded(),
+			Token:    v,
+		})
+	}
+	return results
+}
@@ -0,0 +1,409 @@
+package tmfparser
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	"github.com/CRSylar/rfcquery/internal/source"
+)
+
+// TMFJSONPath is a JSONPath expression from a TMF630 "filter" parameter,
+// e.g. productOrderItem[?(@.state=='Completed' && @.quantity>1)]
+//
+// The supported grammar, a subset of RFC 9535:
+//
+//	jsonpath   = ( "$" / "@" / name ) *segment
+//	segment    = "." ( name / "*" ) / ".." ( name / "*" ) / "[" selector "]"
+//	selector   = "*" / index *( "," index ) / quoted *( "," quoted ) / "?" or-expr
+//	or-expr    = and-expr *( "||" and-expr )
+//	and-expr   = unary *( "&&" unary )
+//	unary      = "!" unary / "(" or-expr ")" / operand [ compare operand ]
+//	compare    = "==" / "!=" / "<" / "<=" / ">" / ">="
+//	operand    = jsonpath / quoted / number / "true" / "false" / "null"
+type TMFJSONPath struct {
+	// Root is "$" for absolute paths, "@" for paths relative to the
+	// current filter item, "" when the path starts with a bare member name
+	Root     string
+	Segments []TMFJSONPathSegment
+	Pos      rfcquery.Position
+}
+
+// TMFJSONPathSegment selects children (or descendants) of the current nodes
+type TMFJSONPathSegment struct {
+	Descendant bool     // ".." segment
+	Wildcard   bool     // "*"
+	Names      []string // member names
+	Indexes    []int    // array indexes
+	Filter     *TMFJSONPathExpr
+	Pos        rfcquery.Position
+}
+
+// TMFJSONPathExpr is a node of a JSONPath filter expression.
+// Logical and comparison nodes set Op, operands leave it empty and set
+// either Path or Literal
+type TMFJSONPathExpr struct {
+	Op    string // "||", "&&", "!", "==", "!=", "<", "<=", ">", ">=" or "" for operands
+	Left  *TMFJSONPathExpr
+	Right *TMFJSONPathExpr // nil for "!"
+
+	Path      *TMFJSONPath // operand path, tested for existence when used alone
+	Literal   any          // operand literal: string, float64, bool or nil
+	IsLiteral bool
+
+	Pos rfcquery.Position
+}
+
+// ParseTMFJSONPath parses the decoded JSONPath carried by tokens,
+// positions and errors refer to the original query offsets
+func ParseTMFJSONPath(tokens rfcquery.TokenSlice) (*TMFJSONPath, error) {
+	jp := &jsonPathParser{src: source.New(tokens, 0)}
+
+	jp.skipSpaces()
+	path, err := jp.parsePath(true)
+	if err != nil {
+		return nil, err
+	}
+
+	jp.skipSpaces()
+	if !jp.eof() {
+		return nil, jp.errorf("unexpected %q in JSONPath", jp.src.Text[jp.pos])
+	}
+	return path, nil
+}
+
+// jsonPathParser works on the decoded value, src maps its bytes back to
+// query offsets
+type jsonPathParser struct {
+	src source.Source
+	pos int
+}
+
+func (jp *jsonPathParser) eof() bool {
+	return jp.pos >= len(jp.src.Text)
+}
+
+func (jp *jsonPathParser) position() rfcquery.Position {
+	return jp.src.Position(jp.pos)
+}
+
+func (jp *jsonPathParser) errorf(format string, args ...any) error {
+	return jp.src.Errorf(jp.pos, format, args...)
+}
+
+func (jp *jsonPathParser) skipSpaces() {
+	for !jp.eof() && (jp.src.Text[jp.pos] == ' ' || jp.src.Text[jp.pos] == '\t') {
+		jp.pos++
+	}
+}
+
+func (jp *jsonPathParser) consume(s string) bool {
+	if strings.HasPrefix(jp.src.Text[jp.pos:], s) {
+		jp.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (jp *jsonPathParser) parsePath(top bool) (*TMFJSONPath, error) {
+	path := &TMFJSONPath{Pos: jp.position()}
+
+	switch {
+	case jp.consume("$"):
+		path.Root = "$"
+	case !top && jp.consume("@"):
+		path.Root = "@"
+	default:
+		name := jp.parseName()
+		if name == "" {
+			return nil, jp.errorf("expected JSONPath root or member name")
+		}
+		path.Segments = append(path.Segments, TMFJSONPathSegment{Names: []string{name}, Pos: path.Pos})
+	}
+
+	for !jp.eof() {
+		segPos := jp.position()
+		var seg TMFJSONPathSegment
+		var err error
+
+		switch {
+		case jp.consume(".."):
+			seg, err = jp.parseDotSegment()
+			seg.Descendant = true
+		case jp.consume("."):
+			seg, err = jp.parseDotSegment()
+		case jp.consume("["):
+			seg, err = jp.parseBracketSegment()
+		default:
+			return path, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		seg.Pos = segPos
+		path.Segments = append(path.Segments, seg)
+	}
+
+	return path, nil
+}
+
+func (jp *jsonPathParser) parseName() string {
+	start := jp.pos
+	for !jp.eof() {
+		c := jp.src.Text[jp.pos]
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c >= 0x80) {
+			break
+		}
+		jp.pos++
+	}
+	return jp.src.Text[start:jp.pos]
+}
+
+func (jp *jsonPathParser) parseDotSegment() (TMFJSONPathSegment, error) {
+	if jp.consume("*") {
+		return TMFJSONPathSegment{Wildcard: true}, nil
+	}
+
+	name := jp.parseName()
+	if name == "" {
+		return TMFJSONPathSegment{}, jp.errorf("expected member name after '.'")
+	}
+	return TMFJSONPathSegment{Names: []string{name}}, nil
+}
+
+func (jp *jsonPathParser) parseBracketSegment() (TMFJSONPathSegment, error) {
+	var seg TMFJSONPathSegment
+	jp.skipSpaces()
+
+	switch {
+	case jp.consume("*"):
+		seg.Wildcard = true
+
+	case jp.consume("?"):
+		jp.skipSpaces()
+		filter, err := jp.parseOr()
+		if err != nil {
+			return seg, err
+		}
+		seg.Filter = filter
+
+	default:
+		for {
+			jp.skipSpaces()
+			if jp.eof() {
+				return seg, jp.errorf("unterminated '['")
+			}
+
+			if c := jp.src.Text[jp.pos]; c == '\'' || c == '"' {
+				name, err := jp.parseQuoted()
+				if err != nil {
+					return seg, err
+				}
+				seg.Names = append(seg.Names, name)
+			} else {
+				start := jp.pos
+				index, ok := jp.parseInteger()
+				if !ok {
+					jp.pos = start
+					return seg, jp.errorf("expected index, quoted name, '*' or '?' filter")
+				}
+				seg.Indexes = append(seg.Indexes, index)
+			}
+
+			jp.skipSpaces()
+			if !jp.consume(",") {
+				break
+			}
+		}
+		if len(seg.Names) > 0 && len(seg.Indexes) > 0 {
+			return seg, jp.errorf("cannot mix member names and indexes in a selector")
+		}
+	}
+
+	jp.skipSpaces()
+	if !jp.consume("]") {
+		return seg, jp.errorf("expected ']'")
+	}
+	return seg, nil
+}
+
+func (jp *jsonPathParser) parseInteger() (int, bool) {
+	start := jp.pos
+	jp.consume("-")
+	for !jp.eof() && jp.src.Text[jp.pos] >= '0' && jp.src.Text[jp.pos] <= '9' {
+		jp.pos++
+	}
+	n, err := strconv.Atoi(jp.src.Text[start:jp.pos])
+	return n, err == nil
+}
+
+func (jp *jsonPathParser) parseQuoted() (string, error) {
+	quote := jp.src.Text[jp.pos]
+	start := jp.pos
+	jp.pos++
+
+	var sb strings.Builder
+	for !jp.eof() {
+		c := jp.src.Text[jp.pos]
+		switch {
+		case c == quote:
+			jp.pos++
+			return sb.String(), nil
+		case c == '\\' && jp.pos+1 < len(jp.src.Text):
+			sb.WriteByte(jp.src.Text[jp.pos+1])
+			jp.pos += 2
+		default:
+			sb.WriteByte(c)
+			jp.pos++
+		}
+	}
+
+	jp.pos = start
+	return "", jp.errorf("unterminated string")
+}
+
+func (jp *jsonPathParser) parseOr() (*TMFJSONPathExpr, error) {
+	left, err := jp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		jp.skipSpaces()
+		pos := jp.position()
+		if !jp.consume("||") {
+			return left, nil
+		}
+		jp.skipSpaces()
+		right, err := jp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &TMFJSONPathExpr{Op: "||", Left: left, Right: right, Pos: pos}
+	}
+}
+
+func (jp *jsonPathParser) parseAnd() (*TMFJSONPathExpr, error) {
+	left, err := jp.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		jp.skipSpaces()
+		pos := jp.position()
+		if !jp.consume("&&") {
+			return left, nil
+		}
+		jp.skipSpaces()
+		right, err := jp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &TMFJSONPathExpr{Op: "&&", Left: left, Right: right, Pos: pos}
+	}
+}
+
+func (jp *jsonPathParser) parseUnary() (*TMFJSONPathExpr, error) {
+	jp.skipSpaces()
+	pos := jp.position()
+
+	if jp.consume("!") {
+		if jp.consume("=") {
+			jp.pos -= 2
+			return nil, jp.errorf("expected operand before '!='")
+		}
+		operand, err := jp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &TMFJSONPathExpr{Op: "!", Left: operand, Pos: pos}, nil
+	}
+
+	if jp.consume("(") {
+		expr, err := jp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		jp.skipSpaces()
+		if !jp.consume(")") {
+			return nil, jp.errorf("expected ')'")
+		}
+		return expr, nil
+	}
+
+	left, err := jp.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	jp.skipSpaces()
+	opPos := jp.position()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if jp.consume(op) {
+			jp.skipSpaces()
+			right, err := jp.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return &TMFJSONPathExpr{Op: op, Left: left, Right: right, Pos: opPos}, nil
+		}
+	}
+
+	if left.IsLiteral {
+		return nil, rfcquery.NewError(left.Pos.Offset, "literal used as a filter condition")
+	}
+	return left, nil
+}
+
+func (jp *jsonPathParser) parseOperand() (*TMFJSONPathExpr, error) {
+	pos := jp.position()
+	if jp.eof() {
+		return nil, jp.errorf("expected operand")
+	}
+
+	c := jp.src.Text[jp.pos]
+	switch {
+	case c == '@' || c == '$':
+		path, err := jp.parsePath(false)
+		if err != nil {
+			return nil, err
+		}
+		return &TMFJSONPathExpr{Path: path, Pos: pos}, nil
+
+	case c == '\'' || c == '"':
+		s, err := jp.parseQuoted()
+		if err != nil {
+			return nil, err
+		}
+		return &TMFJSONPathExpr{Literal: s, IsLiteral: true, Pos: pos}, nil
+
+	case c == '-' || c >= '0' && c <= '9':
+		start := jp.pos
+		jp.pos++
+		for !jp.eof() && strings.IndexByte("0123456789.eE+-", jp.src.Text[jp.pos]) >= 0 {
+			jp.pos++
+		}
+		text := jp.src.Text[start:jp.pos]
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			jp.pos = start
+			return nil, jp.errorf("invalid number %q", text)
+		}
+		return &TMFJSONPathExpr{Literal: n, IsLiteral: true, Pos: pos}, nil
+	}
+
+	start := jp.pos
+	switch jp.parseName() {
+	case "true":
+		return &TMFJSONPathExpr{Literal: true, IsLiteral: true, Pos: pos}, nil
+	case "false":
+		return &TMFJSONPathExpr{Literal: false, IsLiteral: true, Pos: pos}, nil
+	case "null":
+		return &TMFJSONPathExpr{Literal: nil, IsLiteral: true, Pos: pos}, nil
+	}
+	jp.pos = start
+
+	return nil, jp.errorf("expected operand")
+}
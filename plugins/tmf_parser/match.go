@@ -0,0 +1,410 @@
+package tmfparser
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/CRSylar/rfcquery"
+)
+
+// Match reports whether record satisfies the filters of query.
+//
+// record is a struct, a map[string]any (or any map keyed by strings) or a
+// pointer to one of them. Struct fields are looked up by their "tmf" tag,
+// then their "json" tag, then their Go name. Dotted fields such as
+// productOrderItem.state walk nested values, when a slice is met along the
+// path the expression matches if any element does, and "!=" matches when
+// no element equals the value.
+//
+// Values are compared with the type of the record field: the filter value
+// "10" matches the int 10 and the float 10.0, dates are compared as
+// time.Time. A record missing a field never matches an expression on it.
+func Match(query *TMFQuery, record any) (bool, error) {
+	if len(query.JSONPaths) > 0 {
+		return false, rfcquery.NewError(query.JSONPaths[0].Pos.Offset, "JSONPath filters cannot be evaluated")
+	}
+
+	return matchGroup(*query.Tree(), reflect.ValueOf(record))
+}
+
+// Filter returns the records matching query, in their original order
+func Filter[T any](query *TMFQuery, records []T) ([]T, error) {
+	var matched []T
+	for _, record := range records {
+		ok, err := Match(query, record)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, record)
+		}
+	}
+	return matched, nil
+}
+
+// Sort orders records in place following query.Sorting. The sort is stable
+// and records missing a sort field come first in ascending order
+func Sort[T any](query *TMFQuery, records []T) error {
+	var sortErr error
+
+	slices.SortStableFunc(records, func(a, b T) int {
+		for _, sort := range query.Sorting {
+			c, err := compareRecords(reflect.ValueOf(a), reflect.ValueOf(b), sort.Field)
+			if err != nil {
+				if sortErr == nil {
+					sortErr = rfcquery.NewError(sort.Pos(), "cannot sort on field %q: %v", sort.Field, err)
+				}
+				return 0
+			}
+			if sort.Direction == "desc" {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	return sortErr
+}
+
+// Paginate returns the window of records selected by query.Pagination,
+// a negative offset on a hand-built query counts as 0
+func Paginate[T any](query *TMFQuery, records []T) []T {
+	offset := min(max(query.Pagination.Offset, 0), len(records))
+	records = records[offset:]
+
+	if limit := query.Pagination.Limit; limit > 0 && limit < len(records) {
+		records = records[:limit]
+	}
+	return records
+}
+
+func matchGroup(g TMFFilterGroup, record reflect.Value) (bool, error) {
+	isOr := g.Logic == TMFLogicOr
+
+	for _, expr := range g.Expressions {
+		ok, err := matchExpression(expr, record)
+		if err != nil {
+			return false, err
+		}
+		if ok == isOr {
+			return isOr, nil
+		}
+	}
+
+	for _, sub := range g.Groups {
+		ok, err := matchGroup(sub, record)
+		if err != nil {
+			return false, err
+		}
+		if ok == isOr {
+			return isOr, nil
+		}
+	}
+
+	// an empty OR matches nothing, an empty AND everything
+	return !isOr, nil
+}
+
+// matchExpression reports whether any value of the field satisfies expr.
+// On a list "!=" is the negation of "=": no element equals the value
+func matchExpression(expr TMFExpression, record reflect.Value) (bool, error) {
+	fields := lookupField(record, expr.Field)
+	if expr.Operator != TMFOperatorNe {
+		return matchAny(expr, fields)
+	}
+	if len(fields) == 0 {
+		return false, nil
+	}
+
+	eq := expr
+	eq.Operator = TMFOperatorEq
+	matched, err := matchAny(eq, fields)
+	return !matched && err == nil, err
+}
+
+// matchAny reports whether any of fields satisfies expr
+func matchAny(expr TMFExpression, fields []reflect.Value) (bool, error) {
+	for _, field := range fields {
+		value, ok := scalar(field)
+		if !ok {
+			return false, rfcquery.NewError(expr.Pos(), "field %q of type %s cannot be compared", expr.Field, field.Type())
+		}
+
+		other, err := operandLike(value, expr)
+		if err != nil {
+			return false, err
+		}
+
+		c, ok := compareScalars(value, other)
+		if !ok {
+			return false, rfcquery.NewError(expr.Pos(), "value %q cannot be compared with field %q", expr.Value, expr.Field)
+		}
+
+		var matched bool
+		switch expr.Operator {
+		case TMFOperatorEq:
+			matched = c == 0
+		case TMFOperatorGt:
+			matched = c > 0
+		case TMFOperatorGte:
+			matched = c >= 0
+		case TMFOperatorLt:
+			matched = c < 0
+		case TMFOperatorLte:
+			matched = c <= 0
+		default:
+			return false, rfcquery.NewError(expr.Pos(), "operator %s cannot be evaluated", expr.Operator)
+		}
+
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// operandLike returns the filter value with the type of the record value,
+// preferring the schema-typed value when it is comparable
+func operandLike(value any, expr TMFExpression) (any, error) {
+	if expr.TypedValue != nil {
+		if _, ok := compareScalars(value, expr.TypedValue); ok {
+			return expr.TypedValue, nil
+		}
+	}
+
+	var kinds []FieldKind
+	switch value.(type) {
+	case string:
+		return expr.Value, nil
+	case int64:
+		kinds = []FieldKind{FieldInteger, FieldNumber}
+	case float64:
+		kinds = []FieldKind{FieldNumber}
+	case bool:
+		kinds = []FieldKind{FieldBoolean}
+	case time.Time:
+		kinds = []FieldKind{FieldDateTime}
+	}
+
+	for _, kind := range kinds {
+		if typed, err := (FieldType{Kind: kind}).Coerce(expr.Value); err == nil {
+			return typed, nil
+		}
+	}
+	return nil, rfcquery.NewError(expr.Pos(), "value %q of field %q is not a valid %T", expr.Value, expr.Field, value)
+}
+
+// lookupField resolves a dotted field path, slices along the path fan out
+func lookupField(v reflect.Value, path string) []reflect.Value {
+	values := []reflect.Value{v}
+
+	for name := range strings.SplitSeq(path, ".") {
+		var next []reflect.Value
+		for _, v := range values {
+			next = append(next, member(v, name)...)
+		}
+		values = next
+	}
+
+	var leaves []reflect.Value
+	for _, v := range values {
+		leaves = append(leaves, flatten(indirect(v))...)
+	}
+	return leaves
+}
+
+// member returns the named member of v, of every element when v is a slice
+func member(v reflect.Value, name string) []reflect.Value {
+	v = indirect(v)
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		var members []reflect.Value
+		for i := range v.Len() {
+			members = append(members, member(v.Index(i), name)...)
+		}
+		return members
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		m := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		if !m.IsValid() {
+			return nil
+		}
+		return []reflect.Value{m}
+
+	case reflect.Struct:
+		if f, ok := structField(v, name); ok {
+			return []reflect.Value{f}
+		}
+	}
+	return nil
+}
+
+// structField finds an exported field named name. A field is named by its
+// "tmf" tag, else its "json" tag, else its Go name
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	for _, f := range reflect.VisibleFields(v.Type()) {
+		if !f.IsExported() || f.Anonymous || fieldName(f) != name {
+			continue
+		}
+		// FieldByIndexErr fails on nil embedded pointers
+		if fv, err := v.FieldByIndexErr(f.Index); err == nil {
+			return fv, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func fieldName(f reflect.StructField) string {
+	for _, tag := range []string{"tmf", "json"} {
+		if name, _, _ := strings.Cut(f.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// flatten expands a slice leaf into its elements (list attributes)
+func flatten(v reflect.Value) []reflect.Value {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []reflect.Value{v}
+	}
+
+	var elems []reflect.Value
+	for i := range v.Len() {
+		elems = append(elems, flatten(indirect(v.Index(i)))...)
+	}
+	return elems
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		v = v.Elem()
+	}
+	return v
+}
+
+// scalar converts v into a string, int64, float64, bool or time.Time
+func scalar(v reflect.Value) (any, bool) {
+	if !v.CanInterface() {
+		return nil, false
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t, true
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() <= math.MaxInt64 {
+			return int64(v.Uint()), true
+		}
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Bool:
+		return v.Bool(), true
+	}
+	return nil, false
+}
+
+// compareScalars compares two values returned by scalar, integers and
+// floats compare with each other
+func compareScalars(a, b any) (int, bool) {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return cmp.Compare(a, b), true
+		}
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return cmp.Compare(a, b), true
+		case float64:
+			return cmp.Compare(float64(a), b), true
+		}
+	case float64:
+		switch b := b.(type) {
+		case float64:
+			return cmp.Compare(a, b), true
+		case int64:
+			return cmp.Compare(a, float64(b)), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, true
+			case b:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b), true
+		}
+	}
+	return 0, false
+}
+
+// compareRecords compares the first value of field in a and b,
+// a missing value sorts before any other
+func compareRecords(a, b reflect.Value, field string) (int, error) {
+	av, aok, err := sortKey(a, field)
+	if err != nil {
+		return 0, err
+	}
+	bv, bok, err := sortKey(b, field)
+	if err != nil {
+		return 0, err
+	}
+
+	if !aok || !bok {
+		return cmp.Compare(btoi(aok), btoi(bok)), nil
+	}
+
+	c, ok := compareScalars(av, bv)
+	if !ok {
+		return 0, fmt.Errorf("%T and %T values cannot be compared", av, bv)
+	}
+	return c, nil
+}
+
+func sortKey(record reflect.Value, field string) (any, bool, error) {
+	values := lookupField(record, field)
+	if len(values) == 0 {
+		return nil, false, nil
+	}
+
+	value, ok := scalar(values[0])
+	if !ok {
+		return nil, false, fmt.Errorf("%s values cannot be compared", values[0].Type())
+	}
+	return value, true, nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -2,6 +2,9 @@ package tmfparser
 
 import (
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/CRSylar/rfcquery"
@@ -19,7 +22,8 @@ const (
 	TMFOperatorNe  TMFOperator = "ne"  // %21%3D
 )
 
-// OperatorMap maps encoded operators to their string reprentation
+// operatorsMap maps encoded operators to their string reprentation.
+// Symbolic operators follow the field, dot-notation ones are a field suffix followed by "="
 var operatorsMap = map[string]TMFOperator{
 	"%3D":    TMFOperatorEq,
 	"%3E":    TMFOperatorGt,
@@ -34,31 +38,172 @@ var operatorsMap = map[string]TMFOperator{
 }
 
 type TMFExpression struct {
+	Field    string
 	Operator TMFOperator
 	Value    string
 	Token    rfcquery.TokenSlice
+
+	// TypedValue is Value coerced according to TMFParser.Schema:
+	// int64, float64, bool, time.Time or string. nil when no Schema is set
+	TypedValue any
+}
+
+// Pos returns the query offset of the expression value, -1 for an
+// expression built without tokens
+func (e TMFExpression) Pos() int {
+	if len(e.Token) > 0 {
+		return e.Token[0].Start.Offset
+	}
+	return -1
+}
+
+// Operand returns TypedValue when the Schema set it, Value otherwise
+func (e TMFExpression) Operand() any {
+	if e.TypedValue != nil {
+		return e.TypedValue
+	}
+	return e.Value
 }
 
+// TMFLogic is the boolean operator joining the members of a TMFFilterGroup
+type TMFLogic string
+
+const (
+	TMFLogicAnd TMFLogic = "and" // ";" between segments
+	TMFLogicOr  TMFLogic = "or"  // "," between groups or values
+)
+
+// TMFFilterGroup is a node of the filter expression tree:
+// its Expressions and nested Groups are combined using Logic
 type TMFFilterGroup struct {
+	Logic       TMFLogic
 	Expressions []TMFExpression
+	Groups      []TMFFilterGroup
 	Tokens      rfcquery.TokenSlice
 }
 
+// IsEmpty reports whether the group holds no expression at all
+func (g *TMFFilterGroup) IsEmpty() bool {
+	return len(g.Expressions) == 0 && len(g.Groups) == 0
+}
+
+// IsMembership reports whether the group is a value list on a single
+// field: an OR of equalities ("status=a,b") or an AND of inequalities
+// ("status!=a,b")
+func (g *TMFFilterGroup) IsMembership() bool {
+	if len(g.Groups) > 0 || len(g.Expressions) < 2 {
+		return false
+	}
+
+	want := TMFOperatorEq
+	if g.Logic == TMFLogicAnd {
+		want = TMFOperatorNe
+	}
+
+	for _, expr := range g.Expressions {
+		if expr.Field != g.Expressions[0].Field || expr.Operator != want {
+			return false
+		}
+	}
+	return true
+}
+
+// TMFParamKind is the role of a reserved, non-filter, query parameter
+type TMFParamKind int
+
+const (
+	TMFParamOther  TMFParamKind = iota // kept verbatim in OtherParams
+	TMFParamSort                       // sort=-created,+name
+	TMFParamFields                     // fields=id,name,productOrderItem.state
+	TMFParamOffset                     // offset=20
+	TMFParamLimit                      // limit=10
+	TMFParamFilter                     // filter=<JSONPath>
+)
+
+// reservedParams are the TMF630 parameters that are not attribute filters
+var reservedParams = map[string]TMFParamKind{
+	"sort":   TMFParamSort,
+	"fields": TMFParamFields,
+	"offset": TMFParamOffset,
+	"limit":  TMFParamLimit,
+	"filter": TMFParamFilter,
+}
+
+// TMFPagination holds the validated offset/limit parameters
+type TMFPagination struct {
+	Offset int
+	Limit  int // 0 when no limit was requested
+
+	OffsetTokens rfcquery.TokenSlice
+	LimitTokens  rfcquery.TokenSlice
+}
+
 type TMFSortField struct {
 	Field     string
 	Direction string // "asc" or "desc"
 	Tokens    rfcquery.TokenSlice
 }
 
+// Pos returns the query offset of the sort field, -1 for a field built
+// without tokens
+func (s TMFSortField) Pos() int {
+	if len(s.Tokens) > 0 {
+		return s.Tokens[0].Start.Offset
+	}
+	return -1
+}
+
 // TMFQuery represents a complete parsed TMF Query
 type TMFQuery struct {
-	Expressions map[string][]TMFExpression // Top-level filter expressions
+	Expressions map[string][]TMFExpression // All filter expressions by field, regardless of grouping
+	FilterTree  *TMFFilterGroup            // Boolean expression tree of the filters, rooted in an AND group
 	Sorting     []TMFSortField             // Parsed sort fields
-	OtherParams map[string][]string        // Non-filter params ( limit, offset, etc...)
+	Fields      []string                   // Attribute selection, nested attributes as "a.b" paths
+	Pagination  TMFPagination              // Parsed offset and limit
+	JSONPaths   []*TMFJSONPath             // JSONPath "filter" parameters, all of them must match
+	OtherParams map[string][]string        // Raw values of every non-filter param except sort ( limit, offset, etc...)
+}
+
+// Tree returns FilterTree, or for queries that were not produced by
+// TMFParser an AND of the flat Expressions per field: the equalities on a
+// field match any of their values and its inequalities none, as a value
+// list does. Fields are sorted for a stable order
+func (q *TMFQuery) Tree() *TMFFilterGroup {
+	if q.FilterTree != nil {
+		return q.FilterTree
+	}
+
+	root := &TMFFilterGroup{Logic: TMFLogicAnd}
+	for _, field := range slices.Sorted(maps.Keys(q.Expressions)) {
+		lists := map[TMFOperator]*TMFFilterGroup{
+			TMFOperatorEq: {Logic: TMFLogicOr},
+			TMFOperatorNe: {Logic: TMFLogicAnd},
+		}
+		for _, expr := range q.Expressions[field] {
+			if list, ok := lists[expr.Operator]; ok {
+				list.Expressions = append(list.Expressions, expr)
+			} else {
+				root.Expressions = append(root.Expressions, expr)
+			}
+		}
+
+		for _, op := range []TMFOperator{TMFOperatorEq, TMFOperatorNe} {
+			switch list := lists[op]; len(list.Expressions) {
+			case 0:
+			case 1:
+				root.Expressions = append(root.Expressions, list.Expressions[0])
+			default:
+				root.Groups = append(root.Groups, *list)
+			}
+		}
+	}
+	return root
 }
 
 type TMFParser struct {
-	// OperatorMap allows customizing recognized operators
+	// OperatorMap allows customizing recognized operators.
+	// Keys are either symbolic, starting with a percent-encoded or sub-delimiter
+	// character ("%3E%3D", "%7E"), or dot-notation suffixes (".gt", ".like")
 	OperatorMap map[string]TMFOperator
 
 	// StrictValidation enforces RFC3986 compliance
@@ -66,11 +211,35 @@ type TMFParser struct {
 
 	// EnableGrouping enables support for parantheses grouping
 	EnableGrouping bool
+
+	// ReservedParams lists the parameters that are not attribute filters,
+	// nil means DefaultReservedParams()
+	ReservedParams map[string]TMFParamKind
+
+	// MaxLimit rejects larger "limit" values, 0 means no maximum
+	MaxLimit int
+
+	// Schema enables typed values: filter values of the listed fields are
+	// coerced into TMFExpression.TypedValue, the others are kept as strings
+	Schema map[string]FieldType
+}
+
+// DefaultOperatorMap returns a copy of the TMF630 operators, to be extended
+// and assigned to TMFParser.OperatorMap
+func DefaultOperatorMap() map[string]TMFOperator {
+	return maps.Clone(operatorsMap)
+}
+
+// DefaultReservedParams returns a copy of the TMF630 reserved parameters,
+// to be extended and assigned to TMFParser.ReservedParams
+func DefaultReservedParams() map[string]TMFParamKind {
+	return maps.Clone(reservedParams)
 }
 
 func NewTMFParser() *TMFParser {
 	return &TMFParser{
-		OperatorMap:      operatorsMap,
+		OperatorMap:      DefaultOperatorMap(),
+		ReservedParams:   DefaultReservedParams(),
 		StrictValidation: true,
 		EnableGrouping:   true,
 	}
@@ -88,190 +257,55 @@ func (p *TMFParser) Parse(scanner *rfcquery.Scanner) (any, error) {
 		scanner.Reset()
 	}
 
-	query := &TMFQuery{
-		Expressions: make(map[string][]TMFExpression),
-		Sorting:     make([]TMFSortField, 0),
-		OtherParams: make(map[string][]string),
-	}
-
-	if err := p.parseQuery(scanner, query); err != nil {
-		return nil, err
-	}
-
-	return query, nil
-}
-
-func (p *TMFParser) parseQuery(scanner *rfcquery.Scanner, query *TMFQuery) error {
-outer:
-	for {
-		tk, err := scanner.PeekToken()
-		if err != nil {
-			return err
-		}
-
-		if tk.Type == rfcquery.TokenEOF {
-			break outer
-		}
-
-		segment, err := p.parseSegment(scanner)
-		if err != nil {
-			return err
-		}
-
-		if segment.Key == "sort" {
-			sortFields, err := p.parseSortValue(segment.ValueTokens)
-			if err != nil {
-				return fmt.Errorf("invalid sort syntax: %w", err)
-			}
-			query.Sorting = append(query.Sorting, sortFields...)
-			continue
-		}
-
-		if p.isFilterSegment(segment.Key) {
-			if segment.Expressions != nil {
-				query.Expressions[segment.Key] = append(query.Expressions[segment.Key], segment.Expressions...)
-			}
-		} else {
-			query.OtherParams[segment.Key] = append(query.OtherParams[segment.Key], segment.Value...)
-		}
-
-		tok, err := scanner.PeekToken()
-		if err != nil {
-			return err
-		}
-		if tok.Type == rfcquery.TokenSubDelims && (tok.Value == ";" || tok.Value == "&") {
-			scanner.NextToken() // consume separator
-		}
-	}
-
-	return nil
-}
-
-type segmentResult struct {
-	Key         string
-	Value       []string
-	ValueTokens rfcquery.TokenSlice
-	Expressions []TMFExpression
-}
-
-func (p *TMFParser) parseSegment(scanner *rfcquery.Scanner) (*segmentResult, error) {
-	// the keyTokens will be the field -- NOTE. can contain an operator in the dot-notation (.gt/.lt/.gte/.lte)
-	keyTokens, err := scanner.CollectUntil(func(t rfcquery.Token) bool {
-		separator := t.Type == rfcquery.TokenSubDelims && (t.Value == "=" || t.Value == ";" || t.Value == "&")
-
-		// 																		checking operators    =										>									<											!=
-		operator := t.Type == rfcquery.TokenPercentEncoded && (t.Value == "%3D" || t.Value == "%3E" || t.Value == "%3C" ||  t.Value == "%21")
-		return separator || operator
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	sepToken, err := scanner.PeekToken()
+	tokens, err := scanner.CollectAll()
 	if err != nil {
 		return nil, err
 	}
 
-	key := keyTokens.StringDecoded()
-	dotOperator := "%3D"
-
-	if hasDotNotationOperatorSuffix(key) {
-		lastDot := strings.LastIndex(key, ".")
-		dotOperator = key[lastDot:]
-		key = key[:lastDot]
-	}
-
-	result := &segmentResult{
-		Key: keyTokens.StringDecoded(),
-	}
-
-	if sepToken.Type == rfcquery.TokenSubDelims && (sepToken.Value == ";" || sepToken.Value == "&") {
-		// TODO: perform some simulation, maybe here is more appropriate return an error since i've the key with no value ( or just skip it )
-		result.Value = []string{}
-		result.ValueTokens = rfcquery.TokenSlice{}
-
-		result.Expressions = append(result.Expressions, TMFExpression{
-			Operator: TMFOperatorEq,
-			Value:    "",
-			Token:    keyTokens,
-		})
-		return result, nil
+	query := &TMFQuery{
+		Expressions: make(map[string][]TMFExpression),
+		Sorting:     make([]TMFSortField, 0),
+		OtherParams: make(map[string][]string),
 	}
 
-	if sepToken.Value == "=" {
-		_, err := scanner.NextToken()
-		if err != nil {
-			return nil, err
-		}
+	qp := &queryParser{
+		parser: p,
+		cursor: &tokenCursor{tokens: tokens, end: scanner.Pos()},
+		table:  newOperatorTable(p.OperatorMap),
+		opts:   scanner.Options(),
+		query:  query,
 	}
 
-	valueTokens, err := scanner.CollectUntil(func(t rfcquery.Token) bool {
-		return t.Type == rfcquery.TokenSubDelims && (t.Value == ";" || t.Value == "&")
-	})
+	tree, err := qp.parseConjunction(0)
 	if err != nil {
 		return nil, err
 	}
+	query.FilterTree = tree
 
-	if len(valueTokens) == 0 {
-		// No values extracted, return
-		result.Expressions = make([]TMFExpression, 0)
-		return result, nil
-	}
-
-	result.Value = strings.Split(valueTokens.StringDecoded(), ",")
-	result.ValueTokens = valueTokens
-
-	if p.isFilterSegment(keyTokens.StringDecoded()) {
-		result.Expressions = append(result.Expressions, p.parseFilterValue(dotOperator, valueTokens)...)
-	}
-
-	return result, nil
+	return query, nil
 }
 
 func (p *TMFParser) isFilterSegment(key string) bool {
-	return key != "" && key != "sort" && key != "limit" && key != "offset"
+	_, reserved := p.reservedKind(key)
+	return key != "" && !reserved
 }
 
-func (p *TMFParser) parseFilterValue(dotOperator string, tokens rfcquery.TokenSlice) []TMFExpression {
-
-	results := []TMFExpression{}
-
-	// check if the tokenSlice first (and second) element is a TokenPercentEncoded
-	if tokens[0].Type == rfcquery.TokenPercentEncoded && isPercentOperator(tokens[0]) {
-		// if the first token is a valid operator we can proceed to extract it from the slice (there can be up to 2 operators, for cases like >= / <= )
-		operator, opLen := parseOperatorFromTokenSlice(tokens)
-
-		values := tokens[opLen:].SplitSubDelimiter(",")
-		for _, v := range values {
-			results = append(results, TMFExpression{
-				Operator: operator,
-				Value:    v.StringDecoded(),
-				Token:    v,
-			})
-		}
-	} else {
-		values := tokens.SplitSubDelimiter(",")
-		for _, v := range values {
-			results = append(results, TMFExpression{
-				Operator: operatorsMap[dotOperator],
-				Value:    v.StringDecoded(),
-				Token:    v,
-			})
-		}
+func (p *TMFParser) reservedKind(key string) (TMFParamKind, bool) {
+	params := p.ReservedParams
+	if params == nil {
+		params = reservedParams
 	}
-
-	return results
+	kind, ok := params[key]
+	return kind, ok
 }
 
-func (p *TMFParser) parseSortValue(tokens rfcquery.TokenSlice) ([]TMFSortField, error) {
-	var fields []TMFSortField
-
-	splitTokens := p.splitTokens(tokens, ",")
-	for _, fieldTokens := range splitTokens {
-		if len(fieldTokens) == 0 {
-			continue
-		}
+func (p *TMFParser) parseSortValue(seg *segment) ([]TMFSortField, error) {
+	if len(seg.Values) == 0 {
+		return nil, rfcquery.NewError(seg.FieldTokens[len(seg.FieldTokens)-1].End.Offset, "empty sort list for %q", seg.Field)
+	}
 
+	var fields []TMFSortField
+	for _, fieldTokens := range seg.Values {
 		firstTok := fieldTokens[0]
 		direction := "asc"
 
@@ -285,12 +319,11 @@ func (p *TMFParser) parseSortValue(tokens rfcquery.TokenSlice) ([]TMFSortField,
 		}
 
 		if len(fieldTokens) == 0 {
-			return nil, fmt.Errorf("empty sort field")
+			return nil, rfcquery.NewError(firstTok.End.Offset, "empty sort field")
 		}
 
-		fieldName := fieldTokens.StringDecoded()
 		fields = append(fields, TMFSortField{
-			Field:     fieldName,
+			Field:     fieldTokens.StringDecoded(),
 			Direction: direction,
 			Tokens:    fieldTokens,
 		})
@@ -298,24 +331,51 @@ func (p *TMFParser) parseSortValue(tokens rfcquery.TokenSlice) ([]TMFSortField,
 	return fields, nil
 }
 
-func (p *TMFParser) splitTokens(tokens rfcquery.TokenSlice, sep string) []rfcquery.TokenSlice {
-	var result []rfcquery.TokenSlice
-	currStart := 0
-
-	for i, tok := range tokens {
-		if tok.Type == rfcquery.TokenSubDelims && tok.Value == sep {
-			if i > currStart {
-				result = append(result, tokens[currStart:i])
+// parseFieldsValue validates the attribute selection paths
+func (p *TMFParser) parseFieldsValue(seg *segment) ([]string, error) {
+	fields := make([]string, 0, len(seg.Values))
+	for _, v := range seg.Values {
+		path := v.StringDecoded()
+		for i, name := range strings.Split(path, ".") {
+			if name == "" {
+				return nil, rfcquery.NewError(pathSegmentOffset(v, i), "empty attribute name in field %q", path)
 			}
-			currStart = i + 1
 		}
+		fields = append(fields, path)
 	}
+	return fields, nil
+}
 
-	if currStart < len(tokens) {
-		result = append(result, tokens[currStart:])
+// pathSegmentOffset returns the query offset of the i-th dot-separated part of tokens
+func pathSegmentOffset(tokens rfcquery.TokenSlice, i int) int {
+	for _, tok := range tokens {
+		if i == 0 {
+			return tok.Start.Offset
+		}
+		if tok.Value == "." || tok.Decoded == "." {
+			i--
+		}
 	}
+	return tokens[len(tokens)-1].End.Offset
+}
 
-	return result
+// parsePaginationValue parses a non-negative offset or limit value
+func (p *TMFParser) parsePaginationValue(seg *segment) (int, error) {
+	if len(seg.Values) == 0 {
+		return 0, rfcquery.NewError(seg.FieldTokens[len(seg.FieldTokens)-1].End.Offset, "missing value for %q", seg.Field)
+	}
+	if len(seg.Values) > 1 {
+		return 0, rfcquery.NewError(seg.Values[1][0].Start.Offset, "%q accepts a single value", seg.Field)
+	}
+
+	// ASCII digits only, strconv.Atoi alone accepts "+5" and "-0"
+	value := seg.Values[0]
+	text := value.StringDecoded()
+	n, err := strconv.Atoi(text)
+	if err != nil || strings.TrimLeft(text, "0123456789") != "" {
+		return 0, rfcquery.NewError(value[0].Start.Offset, "%q must be a non-negative integer, got %q", seg.Field, text)
+	}
+	return n, nil
 }
 
 func ParseTMFQuery(query string) (*TMFQuery, error) {
@@ -337,49 +397,3 @@ func ParseTMFQuery(query string) (*TMFQuery, error) {
 
 	return tmfQuery, nil
 }
-
-func hasDotNotationOperatorSuffix(s string) bool {
-
-	for operator := range operatorsMap {
-		if operator[0] == '.' {
-			found := strings.HasSuffix(s, operator)
-			if found {
-				return true
-			}
-		}
-	}
-	return false
-}
-
-func isPercentOperator(t rfcquery.Token) bool {
-	// the first token can be > / < / !
-	// even for cases like >= / <= / !=
-	return t.Value == "%3C" || t.Value == "%3E" || t.Value == "%21"
-}
-
-func parseOperatorFromTokenSlice(tokens rfcquery.TokenSlice) (TMFOperator, int) {
-	first := tokens[0].Value
-	var operator TMFOperator
-	var ok bool
-	opLen := 0
-
-	var second *string
-	if tokens[1].Type == rfcquery.TokenPercentEncoded {
-		second = &tokens[1].Value
-	}
-
-	if second != nil {
-		// try to get the operator using the first 2 token ( for >= / <= / !=)
-		operator, ok = operatorsMap[first+*second]
-		opLen = 2
-	}
-	if !ok {
-		// fallback to get operator using the first token ( > / < / =)
-		// Note. since the first token was already confirmed that is a valid operator, this is a safe map access
-		operator = operatorsMap[first]
-		opLen = 1
-	}
-
-	return operator, opLen
-
-}
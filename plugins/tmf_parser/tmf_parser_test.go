@@ -1,8 +1,15 @@
 package tmfparser_test
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/CRSylar/rfcquery"
 	tmfparser "github.com/CRSylar/rfcquery/plugins/tmf_parser"
@@ -317,6 +324,24 @@ func TestTMFParser_Parse(t *testing.T) {
 			input:   "dateTime>2013-04-20",
 			wantErr: true,
 		},
+		{
+			name:  "single encoded operator as value",
+			input: "a=%3E",
+			check: func(t *testing.T, q *tmfparser.TMFQuery) {
+				expr := q.Expressions["a"]
+				if len(expr) != 1 {
+					t.Fatalf("expected 1 expression for a, got %+v", q.Expressions)
+				}
+				if expr[0].Field != "a" || expr[0].Operator != tmfparser.TMFOperatorEq || expr[0].Value != ">" {
+					t.Errorf("expected equality with value '>', got: %+v", expr[0])
+				}
+			},
+		},
+		{
+			name:    "incomplete not-equal operator",
+			input:   "status%21deleted",
+			wantErr: true,
+		},
 		{
 			name:  "empty value",
 			input: "name=",
@@ -388,3 +413,899 @@ func BenchmarkTMFParser_Complex(b *testing.B) {
 		}
 	}
 }
+
+func TestTMFParser_MaxExpressions(t *testing.T) {
+	input := "status=active,suspended;name=John;age%3E25"
+
+	_, err := rfcquery.ParseContext(context.Background(), tmfparser.NewTMFParser(), input, rfcquery.ParseOptions{MaxTMFExpressions: 3})
+
+	var limitErr *rfcquery.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != rfcquery.LimitTMFExpressions {
+		t.Fatalf("expected TMF expressions LimitError, got %v", err)
+	}
+	if limitErr.Pos.Offset != 34 {
+		t.Errorf("Pos = %d, want 34", limitErr.Pos.Offset)
+	}
+}
+
+func FuzzTMFParser_Parse(f *testing.F) {
+	for _, seed := range []string{
+		"name=John;age%3E25;status=active,suspended&sort=-created,+name&limit=10",
+		"dateTime%3E%3D2013-04-20;dateTime%3C%3D2017-04-20",
+		"status%21%3Ddeleted",
+		"date.gt=2020-01-01",
+		"a=%3E",
+		"a%3E",
+		"sort=-",
+		"0%210",
+		"(status=active;type=x),(status=pending)",
+		"((a=1),(b=2));c%3E3",
+		"fields=id,a.b&offset=0&limit=10",
+		"filter=items%5B?(@.state%3D%3D'x'%20%26%26%20!@.y)%5D",
+		"key",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		result, err := tmfparser.NewTMFParser().Parse(rfcquery.NewScanner(input))
+		if err != nil {
+			return
+		}
+
+		q := result.(*tmfparser.TMFQuery)
+		for key, exprs := range q.Expressions {
+			for _, expr := range exprs {
+				if expr.Operator == "" {
+					t.Fatalf("expression for %q has no operator: %+v", key, expr)
+				}
+				if expr.Field != key {
+					t.Fatalf("expression keyed %q has field %q", key, expr.Field)
+				}
+			}
+		}
+	})
+}
+
+func TestTMFParser_Grammar(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		field string
+		want  []tmfparser.TMFExpression
+	}{
+		{
+			name:  "dot-notation operator strips the field",
+			input: "dateTime.gt=2013-04-20",
+			field: "dateTime",
+			want:  []tmfparser.TMFExpression{{Field: "dateTime", Operator: tmfparser.TMFOperatorGt, Value: "2013-04-20"}},
+		},
+		{
+			name:  "dot-notation with encoded equal",
+			input: "age.lte%3D65",
+			field: "age",
+			want:  []tmfparser.TMFExpression{{Field: "age", Operator: tmfparser.TMFOperatorLte, Value: "65"}},
+		},
+		{
+			name:  "encoded operator followed by literal equal",
+			input: "age%3E=25",
+			field: "age",
+			want:  []tmfparser.TMFExpression{{Field: "age", Operator: tmfparser.TMFOperatorGte, Value: "25"}},
+		},
+		{
+			name:  "lowercase percent-encoding",
+			input: "age%3c%3d65",
+			field: "age",
+			want:  []tmfparser.TMFExpression{{Field: "age", Operator: tmfparser.TMFOperatorLte, Value: "65"}},
+		},
+		{
+			name:  "encoded operator after equal is part of the value",
+			input: "a=%3E5",
+			field: "a",
+			want:  []tmfparser.TMFExpression{{Field: "a", Operator: tmfparser.TMFOperatorEq, Value: ">5"}},
+		},
+		{
+			name:  "empty segments are skipped",
+			input: ";;name=John;&",
+			field: "name",
+			want:  []tmfparser.TMFExpression{{Field: "name", Operator: tmfparser.TMFOperatorEq, Value: "John"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tmfparser.ParseTMFQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseTMFQuery() error = %v", err)
+			}
+			if len(q.Expressions) != 1 {
+				t.Fatalf("expected 1 field, got %+v", q.Expressions)
+			}
+
+			got := q.Expressions[tt.field]
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d expressions for %q, got %+v", len(tt.want), tt.field, q.Expressions)
+			}
+			for i, want := range tt.want {
+				if got[i].Field != want.Field || got[i].Operator != want.Operator || got[i].Value != want.Value {
+					t.Errorf("expression %d = %+v, want %+v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestTMFParser_GrammarErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{"incomplete not-equal", "status%21deleted", 6, "invalid operator"},
+		{"single encoded operator without value", "age%3E", 6, "missing value for operator gt"},
+		{"operator without value before separator", "age%3C%3D;name=John", 9, "missing value for operator lte"},
+		{"dot-notation without value", "dateTime.gt", 11, "missing value for operator gt"},
+		{"dot-notation with symbolic operator", "dateTime.gt%3E2013", 11, "conflicts with dot-notation"},
+		{"missing field", "name=John;=value", 10, "missing field name"},
+		{"missing field before operator", "%3E5", 0, "missing field name"},
+		{"empty list item", "status=active,,pending", 14, "empty value in list"},
+		{"operator on non-filter param", "limit%3E10", 5, "not allowed on parameter"},
+		{"empty sort field", "sort=name,-", 11, "empty sort field"},
+		{"empty sort list", "sort=", 4, "empty sort list"},
+		{"bare sort", "a=1&sort", 8, "empty sort list"},
+		{"doubled equal", "a==1", 2, `unexpected "=" after operator eq`},
+		{"doubled encoded equal", "a%3D%3D1", 4, `unexpected "%3D" after operator eq`},
+		{"encoded equal after literal equal", "a=%3d1", 2, `unexpected "%3d" after operator eq`},
+		{"equal after encoded operator", "age%3E%3D=25", 9, `unexpected "=" after operator gte`},
+		{"doubled encoded operator", "a%3E%3E1", 4, `unexpected "%3E" after operator gt`},
+		{"mixed encoded operators", "a%3C%3E1", 4, `unexpected "%3E" after operator lt`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tmfparser.ParseTMFQuery(tt.input)
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos {
+				t.Errorf("error position = %d, want %d (%v)", rfcErr.Pos.Offset, tt.wantPos, err)
+			}
+			if !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("error = %q, want it to contain %q", rfcErr.Msg, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestTMFParser_CustomOperatorMap(t *testing.T) {
+	const like tmfparser.TMFOperator = "like"
+
+	parser := tmfparser.NewTMFParser()
+	parser.OperatorMap["%7E"] = like
+	parser.OperatorMap[".like"] = like
+	delete(parser.OperatorMap, "%21%3D")
+
+	result, err := parser.Parse(rfcquery.NewScanner("name%7EJo*;title.like=Dr*"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	q := result.(*tmfparser.TMFQuery)
+	if e := q.Expressions["name"]; len(e) != 1 || e[0].Operator != like || e[0].Value != "Jo*" {
+		t.Errorf("symbolic custom operator not honored: %+v", q.Expressions)
+	}
+	if e := q.Expressions["title"]; len(e) != 1 || e[0].Operator != like || e[0].Value != "Dr*" {
+		t.Errorf("dot-notation custom operator not honored: %+v", q.Expressions)
+	}
+
+	// without "%21%3D" the "!" is just part of the field name
+	result, err = parser.Parse(rfcquery.NewScanner("status%21%3Ddeleted"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if e := result.(*tmfparser.TMFQuery).Expressions["status!"]; len(e) != 1 || e[0].Operator != tmfparser.TMFOperatorEq {
+		t.Errorf("removed operator still recognized: %+v", result)
+	}
+
+	// customizing a parser must not leak into the defaults
+	if _, ok := tmfparser.NewTMFParser().OperatorMap["%7E"]; ok {
+		t.Errorf("custom operator leaked into the default operator map")
+	}
+}
+
+// describeGroup renders a filter tree in a compact prefix notation
+func describeGroup(g tmfparser.TMFFilterGroup) string {
+	parts := make([]string, 0, len(g.Expressions)+len(g.Groups))
+	for _, e := range g.Expressions {
+		parts = append(parts, e.Field+" "+string(e.Operator)+" "+e.Value)
+	}
+	for _, sub := range g.Groups {
+		parts = append(parts, describeGroup(sub))
+	}
+	return string(g.Logic) + "(" + strings.Join(parts, ", ") + ")"
+}
+
+func TestTMFParser_Grouping(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantTree string
+		wantFlat map[string]int
+	}{
+		{
+			name:     "no groups",
+			input:    "name=John;age%3E25",
+			wantTree: "and(name eq John, age gt 25)",
+			wantFlat: map[string]int{"name": 1, "age": 1},
+		},
+		{
+			name:     "value list is an OR",
+			input:    "status=active,suspended;type=x",
+			wantTree: "and(type eq x, or(status eq active, status eq suspended))",
+			wantFlat: map[string]int{"status": 2, "type": 1},
+		},
+		{
+			name:     "not-equal list is an AND",
+			input:    "status%21%3Da,b",
+			wantTree: "and(status ne a, status ne b)",
+			wantFlat: map[string]int{"status": 2},
+		},
+		{
+			name:     "groups joined by OR",
+			input:    "(status=active;type=x),(status=pending)",
+			wantTree: "and(or(and(status eq active, type eq x), and(status eq pending)))",
+			wantFlat: map[string]int{"status": 2, "type": 1},
+		},
+		{
+			name:     "single group is an AND",
+			input:    "(status=active;type=x);name=John",
+			wantTree: "and(status eq active, type eq x, name eq John)",
+			wantFlat: map[string]int{"status": 1, "type": 1, "name": 1},
+		},
+		{
+			name:     "nested groups",
+			input:    "(type=x;(a=1),(b%3E2)),(type=y)&sort=-a",
+			wantTree: "and(or(and(type eq x, or(and(a eq 1), and(b gt 2))), and(type eq y)))",
+			wantFlat: map[string]int{"type": 2, "a": 1, "b": 1},
+		},
+		{
+			name:     "balanced parentheses in a value",
+			input:    "(name=f(x)),(name=y)",
+			wantTree: "and(or(and(name eq f(x)), and(name eq y)))",
+			wantFlat: map[string]int{"name": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tmfparser.ParseTMFQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseTMFQuery() error = %v", err)
+			}
+
+			if got := describeGroup(*q.FilterTree); got != tt.wantTree {
+				t.Errorf("FilterTree = %s, want %s", got, tt.wantTree)
+			}
+
+			if len(q.Expressions) != len(tt.wantFlat) {
+				t.Fatalf("flat Expressions = %+v, want %v", q.Expressions, tt.wantFlat)
+			}
+			for field, n := range tt.wantFlat {
+				if len(q.Expressions[field]) != n {
+					t.Errorf("flat Expressions[%q] has %d entries, want %d", field, len(q.Expressions[field]), n)
+				}
+			}
+		})
+	}
+}
+
+func TestTMFParser_GroupingTokens(t *testing.T) {
+	q, err := tmfparser.ParseTMFQuery("(a=1),(b=2)")
+	if err != nil {
+		t.Fatalf("ParseTMFQuery() error = %v", err)
+	}
+
+	or := q.FilterTree.Groups[0]
+	if or.Tokens.String() != "(a=1),(b=2)" {
+		t.Errorf("OR group tokens = %q", or.Tokens.String())
+	}
+	if or.Groups[1].Tokens.String() != "(b=2)" || or.Groups[1].Tokens[0].Start.Offset != 6 {
+		t.Errorf("second group tokens = %q", or.Groups[1].Tokens.String())
+	}
+}
+
+func TestTMFQuery_Tree(t *testing.T) {
+	q, err := tmfparser.ParseTMFQuery("status=a,b;id=1")
+	if err != nil {
+		t.Fatalf("ParseTMFQuery() error = %v", err)
+	}
+	if q.Tree() != q.FilterTree {
+		t.Error("Tree() should return the parsed FilterTree")
+	}
+	if list := q.FilterTree.Groups[0]; !list.IsMembership() || list.Expressions[1].Pos() != 9 {
+		t.Errorf("value list = %+v, want a membership with the second value at 9", list)
+	}
+
+	// queries built by hand get an AND of their expressions, sorted by field
+	built := &tmfparser.TMFQuery{Expressions: map[string][]tmfparser.TMFExpression{
+		"name": {{Field: "name", Operator: tmfparser.TMFOperatorEq, Value: "x"}},
+		"age":  {{Field: "age", Operator: tmfparser.TMFOperatorGt, Value: "3", TypedValue: int64(3)}},
+	}}
+	tree := built.Tree()
+	if got := describeGroup(*tree); got != "and(age gt 3, name eq x)" {
+		t.Errorf("Tree() = %s", got)
+	}
+	if expr := tree.Expressions[0]; expr.Pos() != -1 || expr.Operand() != int64(3) {
+		t.Errorf("Pos(), Operand() = %d, %v, want -1, 3", expr.Pos(), expr.Operand())
+	}
+
+	// several values on a field are a value list, as "status=a,b" is
+	multi := &tmfparser.TMFQuery{Expressions: map[string][]tmfparser.TMFExpression{
+		"status": {
+			{Field: "status", Operator: tmfparser.TMFOperatorEq, Value: "active"},
+			{Field: "status", Operator: tmfparser.TMFOperatorNe, Value: "x"},
+			{Field: "status", Operator: tmfparser.TMFOperatorEq, Value: "suspended"},
+			{Field: "status", Operator: tmfparser.TMFOperatorNe, Value: "y"},
+		},
+		"age": {
+			{Field: "age", Operator: tmfparser.TMFOperatorGt, Value: "3"},
+			{Field: "age", Operator: tmfparser.TMFOperatorLt, Value: "9"},
+		},
+	}}
+	want := "and(age gt 3, age lt 9, or(status eq active, status eq suspended), and(status ne x, status ne y))"
+	if got := describeGroup(*multi.Tree()); got != want {
+		t.Errorf("Tree() = %s, want %s", got, want)
+	}
+}
+
+func TestTMFParser_GroupingErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{"unclosed group", "a=1;(b=2;c=3", 4, "unclosed group"},
+		{"unexpected closing", "a=1;);b=2", 4, "unexpected ')'"},
+		{"closing after a value", "a=1)", 3, "unexpected ')'"},
+		{"closing after a field", "a)=1", 1, "unexpected ')'"},
+		{"empty group", "(a=1),()", 6, "empty group"},
+		{"missing group after comma", "(a=1),b=2", 6, "expected '('"},
+		{"garbage after group", "(a=1)b", 5, "expected separator"},
+		{"sort inside group", "(sort=-a)", 1, "not allowed inside a group"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tmfparser.ParseTMFQuery(tt.input)
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestTMFParser_GroupingDisabled(t *testing.T) {
+	parser := tmfparser.NewTMFParser()
+	parser.EnableGrouping = false
+
+	result, err := parser.Parse(rfcquery.NewScanner("(a=1)"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	q := result.(*tmfparser.TMFQuery)
+	if e := q.Expressions["(a"]; len(e) != 1 || e[0].Value != "1)" {
+		t.Errorf("parentheses should be literal without grouping, got %+v", q.Expressions)
+	}
+}
+
+func TestTMFParser_FieldsAndPagination(t *testing.T) {
+	q, err := tmfparser.ParseTMFQuery("fields=id,name,productOrderItem.state&offset=20&limit=10&status=active")
+	if err != nil {
+		t.Fatalf("ParseTMFQuery() error = %v", err)
+	}
+
+	if want := []string{"id", "name", "productOrderItem.state"}; !slices.Equal(q.Fields, want) {
+		t.Errorf("Fields = %v, want %v", q.Fields, want)
+	}
+	if q.Pagination.Offset != 20 || q.Pagination.Limit != 10 {
+		t.Errorf("Pagination = %+v, want offset 20 limit 10", q.Pagination)
+	}
+	if q.Pagination.LimitTokens.String() != "10" || q.Pagination.LimitTokens[0].Start.Offset != 54 {
+		t.Errorf("limit tokens not preserved: %+v", q.Pagination.LimitTokens)
+	}
+	if len(q.Expressions) != 1 || len(q.Expressions["status"]) != 1 {
+		t.Errorf("reserved params leaked into Expressions: %+v", q.Expressions)
+	}
+	if q.OtherParams["limit"][0] != "10" {
+		t.Errorf("raw limit missing from OtherParams: %+v", q.OtherParams)
+	}
+}
+
+func TestTMFParser_ReservedParamErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		maxLimit int
+		wantPos  int
+		wantMsg  string
+	}{
+		{"negative offset", "offset=-1", 0, 7, "non-negative integer"},
+		{"non numeric limit", "limit=ten", 0, 6, "non-negative integer"},
+		{"signed limit", "limit=%2B5", 0, 6, "non-negative integer"},
+		{"negative zero offset", "offset=-0", 0, 7, "non-negative integer"},
+		{"zero limit", "limit=0", 0, 6, "must be positive"},
+		{"limit above maximum", "limit=500", 100, 6, "exceeds the maximum of 100"},
+		{"duplicate limit", "limit=1&limit=2", 0, 8, "duplicate"},
+		{"multiple offsets in list", "offset=1,2", 0, 9, "single value"},
+		{"missing limit value", "limit", 0, 5, "missing value"},
+		{"operator on limit", "limit%3E10", 0, 5, "not allowed on parameter"},
+		{"empty nested attribute", "fields=id,item..state", 0, 15, "empty attribute name"},
+		{"trailing dot in field", "fields=item.", 0, 12, "empty attribute name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := tmfparser.NewTMFParser()
+			parser.MaxLimit = tt.maxLimit
+
+			_, err := parser.Parse(rfcquery.NewScanner(tt.input))
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestTMFParser_CustomReservedParams(t *testing.T) {
+	parser := tmfparser.NewTMFParser()
+	parser.ReservedParams["depth"] = tmfparser.TMFParamOther
+	parser.ReservedParams["page_size"] = tmfparser.TMFParamLimit
+	delete(parser.ReservedParams, "filter")
+
+	result, err := parser.Parse(rfcquery.NewScanner("depth=2&page_size=25&filter=x"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	q := result.(*tmfparser.TMFQuery)
+	if q.OtherParams["depth"][0] != "2" {
+		t.Errorf("custom reserved param not kept in OtherParams: %+v", q.OtherParams)
+	}
+	if q.Pagination.Limit != 25 {
+		t.Errorf("custom limit param not honored: %+v", q.Pagination)
+	}
+	if len(q.Expressions["filter"]) != 1 || len(q.JSONPaths) != 0 {
+		t.Errorf("unreserved filter should be an attribute filter: %+v", q.Expressions)
+	}
+}
+
+func TestTMFParser_JSONPathFilter(t *testing.T) {
+	// filter=productOrderItem[?(@.state=='Completed' && @.quantity>=2)].product
+	input := "filter=productOrderItem%5B?(@.state%3D%3D'Completed'%20%26%26%20@.quantity%3E%3D2)%5D.product&limit=5"
+
+	q, err := tmfparser.ParseTMFQuery(input)
+	if err != nil {
+		t.Fatalf("ParseTMFQuery() error = %v", err)
+	}
+	if len(q.JSONPaths) != 1 {
+		t.Fatalf("expected 1 JSONPath, got %d", len(q.JSONPaths))
+	}
+
+	path := q.JSONPaths[0]
+	if len(path.Segments) != 3 || path.Segments[0].Names[0] != "productOrderItem" || path.Segments[2].Names[0] != "product" {
+		t.Fatalf("unexpected segments: %+v", path.Segments)
+	}
+
+	filter := path.Segments[1].Filter
+	if filter == nil || filter.Op != "&&" {
+		t.Fatalf("expected && filter, got %+v", filter)
+	}
+	if filter.Pos.Offset != 55 {
+		t.Errorf("&& position = %d, want 55", filter.Pos.Offset)
+	}
+
+	left, right := filter.Left, filter.Right
+	if left.Op != "==" || left.Left.Path.Root != "@" || left.Left.Path.Segments[0].Names[0] != "state" || left.Right.Literal != "Completed" {
+		t.Errorf("unexpected left comparison: %+v", left)
+	}
+	if right.Op != ">=" || right.Right.Literal != float64(2) {
+		t.Errorf("unexpected right comparison: %+v", right)
+	}
+	if q.Pagination.Limit != 5 {
+		t.Errorf("limit after filter lost: %+v", q.Pagination)
+	}
+}
+
+func TestParseTMFJSONPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+		wantPos int
+	}{
+		{name: "root and wildcard", input: "$.items[*].id"},
+		{name: "descendant", input: "$..name"},
+		{name: "indexes and names", input: "items[0,-1]['a','b']"},
+		{name: "existence and negation", input: "items[?(!@.deleted || @.tags[0])]"},
+		{name: "literals", input: "items[?(@.a==true && @.b!=null && @.c<-1.5)]"},
+		{name: "missing bracket", input: "items[?(@.a==1)", wantErr: "expected ']'", wantPos: 15},
+		{name: "unterminated string", input: "items[?(@.a=='x)]", wantErr: "unterminated string", wantPos: 13},
+		{name: "missing operand", input: "items[?(@.a==)]", wantErr: "expected operand", wantPos: 13},
+		{name: "literal condition", input: "items[?(1)]", wantErr: "literal used as a filter condition", wantPos: 8},
+		{name: "mixed selector", input: "items['a',1]", wantErr: "cannot mix", wantPos: 11},
+		{name: "trailing garbage", input: "items)", wantErr: "unexpected", wantPos: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := rfcquery.NewScanner(url.PathEscape(tt.input)).CollectAll()
+			if err != nil {
+				t.Fatalf("CollectAll() error = %v", err)
+			}
+
+			_, err = tmfparser.ParseTMFJSONPath(tokens)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseTMFJSONPath() error = %v", err)
+				}
+				return
+			}
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) || !strings.Contains(rfcErr.Msg, tt.wantErr) {
+				t.Fatalf("expected %q error, got %v", tt.wantErr, err)
+			}
+			// map the expected decoded offset to the escaped query
+			if want := queryOffset(tokens, tt.wantPos); rfcErr.Pos.Offset != want {
+				t.Errorf("error position = %d, want %d", rfcErr.Pos.Offset, want)
+			}
+		})
+	}
+}
+
+// queryOffset returns the query offset of the i-th decoded byte,
+// every token decodes to a single byte
+func queryOffset(tokens rfcquery.TokenSlice, i int) int {
+	if i >= len(tokens) {
+		return tokens[len(tokens)-1].End.Offset
+	}
+	return tokens[i].Start.Offset
+}
+
+func TestTMFParser_TypedValues(t *testing.T) {
+	parser := tmfparser.NewTMFParser()
+	parser.Schema = map[string]tmfparser.FieldType{
+		"quantity":  {Kind: tmfparser.FieldInteger},
+		"price":     {Kind: tmfparser.FieldNumber},
+		"active":    {Kind: tmfparser.FieldBoolean},
+		"birthDate": {Kind: tmfparser.FieldDate},
+		"dateTime":  {Kind: tmfparser.FieldDateTime},
+		"created":   {Kind: tmfparser.FieldRFC3339},
+		"status":    {Kind: tmfparser.FieldEnum, Enum: []string{"active", "suspended"}},
+	}
+
+	input := "quantity%3E%3D10;price.lt=9.99;active=true;birthDate=1990-01-31;" +
+		"dateTime%3E2013-04-20;created%3C2020-01-01T10:00:00Z;status=active,suspended;name=John"
+
+	result, err := parser.Parse(rfcquery.NewScanner(input))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	q := result.(*tmfparser.TMFQuery)
+
+	want := map[string]any{
+		"quantity":  int64(10),
+		"price":     9.99,
+		"active":    true,
+		"birthDate": time.Date(1990, 1, 31, 0, 0, 0, 0, time.UTC),
+		"dateTime":  time.Date(2013, 4, 20, 0, 0, 0, 0, time.UTC),
+		"created":   time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC),
+		"status":    "active",
+		"name":      "John",
+	}
+	for field, value := range want {
+		exprs := q.Expressions[field]
+		if len(exprs) == 0 {
+			t.Errorf("missing expression for %q", field)
+			continue
+		}
+		if !reflect.DeepEqual(exprs[0].TypedValue, value) {
+			t.Errorf("%s TypedValue = %#v, want %#v", field, exprs[0].TypedValue, value)
+		}
+	}
+
+	// the tree carries the same typed values
+	if q.FilterTree.Expressions[0].TypedValue != int64(10) {
+		t.Errorf("FilterTree expression not typed: %+v", q.FilterTree.Expressions[0])
+	}
+}
+
+func TestTMFParser_TypedValueErrors(t *testing.T) {
+	schema := map[string]tmfparser.FieldType{
+		"quantity": {Kind: tmfparser.FieldInteger},
+		"active":   {Kind: tmfparser.FieldBoolean},
+		"dateTime": {Kind: tmfparser.FieldDateTime},
+		"created":  {Kind: tmfparser.FieldRFC3339},
+		"status":   {Kind: tmfparser.FieldEnum, Enum: []string{"active"}},
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{"not an integer", "quantity=1,x", 11, "not a valid integer"},
+		{"not a boolean", "active=yes", 7, "not a valid boolean"},
+		{"not a date-time", "dateTime%3E2013-13-01", 11, "not a valid date-time"},
+		{"date is not RFC 3339", "created%3E2013-04-20", 10, "not a valid RFC 3339 timestamp"},
+		{"not in enum", "status=deleted", 7, "not one of [active]"},
+		{"gt on boolean", "active%3Etrue", 6, "operator gt not allowed on boolean field"},
+		{"dot-notation gt on enum", "status.gt=active", 6, "operator gt not allowed on enum field"},
+		{"bare typed field", "quantity", 8, "not a valid integer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := tmfparser.NewTMFParser()
+			parser.Schema = schema
+
+			_, err := parser.Parse(rfcquery.NewScanner(tt.input))
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
+
+type matchItem struct {
+	State    string `json:"state"`
+	Quantity int    `json:"quantity"`
+}
+
+type matchOrder struct {
+	ID       string      `json:"id"`
+	Priority int         `tmf:"priority" json:"prio"`
+	Price    float64     `json:"price"`
+	Active   bool        `json:"active"`
+	Created  time.Time   `json:"created"`
+	Tags     []string    `json:"tags"`
+	Items    []matchItem `json:"productOrderItem"`
+	Note     *string     `json:"note"`
+}
+
+func TestMatch(t *testing.T) {
+	order := matchOrder{
+		ID:       "42",
+		Priority: 3,
+		Price:    9.5,
+		Active:   true,
+		Created:  time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC),
+		Tags:     []string{"gold", "eu"},
+		Items:    []matchItem{{State: "Completed", Quantity: 1}, {State: "Pending", Quantity: 5}},
+	}
+	record := map[string]any{
+		"id":       "42",
+		"priority": float64(3), // as decoded by encoding/json
+		"status":   "active",
+		"billing":  map[string]any{"country": "IT"},
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		wantStruct bool
+		wantMap    bool
+	}{
+		{"empty query", "", true, true},
+		{"string equality", "id=42", true, true},
+		{"numeric comparison", "priority%3E%3D3;priority%3C4", true, true},
+		{"numeric value is not a string compare", "priority%3E10", false, false},
+		{"tmf tag wins over json tag", "prio=3", false, false},
+		{"value list", "id=1,42", true, true},
+		{"not-equal list", "id%21%3D1,42", false, false},
+		{"float field", "price%3C10", true, false},
+		{"boolean field", "active=true", true, false},
+		{"date against time.Time", "created%3E2020-04-30;created%3C2020-05-02T00:00:00Z", true, false},
+		{"list attribute", "tags=eu", true, false},
+		{"not-equal on a list holding the value", "tags%21%3Deu", false, false},
+		{"not-equal on a list without the value", "tags%21%3Dus", true, false},
+		{"not-equal on nested list", "productOrderItem.state%21%3DPending", false, false},
+		{"nested slice fans out", "productOrderItem.state=Pending", true, false},
+		{"nested slice comparison", "productOrderItem.quantity%3E4", true, false},
+		{"nested map", "billing.country=IT", false, true},
+		{"missing field never matches", "status%21%3Ddeleted", false, true},
+		{"nil pointer never matches", "note=x", false, false},
+		{"groups", "(id=1),(priority=3;id=42)", true, true},
+		{"failing group", "(id=1),(priority=4)", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tmfparser.ParseTMFQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseTMFQuery() error = %v", err)
+			}
+
+			if got, err := tmfparser.Match(q, &order); err != nil || got != tt.wantStruct {
+				t.Errorf("Match(struct) = %v, %v, want %v", got, err, tt.wantStruct)
+			}
+			if got, err := tmfparser.Match(q, record); err != nil || got != tt.wantMap {
+				t.Errorf("Match(map) = %v, %v, want %v", got, err, tt.wantMap)
+			}
+		})
+	}
+}
+
+func TestMatch_FlatExpressions(t *testing.T) {
+	// queries built by hand have no FilterTree, the values of a field are
+	// any of
+	q := &tmfparser.TMFQuery{Expressions: map[string][]tmfparser.TMFExpression{
+		"status": {
+			{Field: "status", Operator: tmfparser.TMFOperatorEq, Value: "active"},
+			{Field: "status", Operator: tmfparser.TMFOperatorEq, Value: "suspended"},
+		},
+	}}
+
+	for status, want := range map[string]bool{"active": true, "suspended": true, "deleted": false} {
+		if got, err := tmfparser.Match(q, map[string]any{"status": status}); err != nil || got != want {
+			t.Errorf("Match(status=%s) = %v, %v, want %v", status, got, err, want)
+		}
+	}
+}
+
+func TestMatch_TypedValues(t *testing.T) {
+	parser := tmfparser.NewTMFParser()
+	parser.Schema = map[string]tmfparser.FieldType{
+		"quantity": {Kind: tmfparser.FieldInteger},
+	}
+
+	result, err := parser.Parse(rfcquery.NewScanner("quantity%3E%3D10"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	q := result.(*tmfparser.TMFQuery)
+
+	for record, want := range map[*map[string]any]bool{
+		{"quantity": uint8(10)}:   true,
+		{"quantity": 9.99}:        false,
+		{"quantity": int32(1000)}: true,
+	} {
+		if got, err := tmfparser.Match(q, *record); err != nil || got != want {
+			t.Errorf("Match(%v) = %v, %v, want %v", *record, got, err, want)
+		}
+	}
+}
+
+func TestMatch_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		record  any
+		wantPos int
+		wantMsg string
+	}{
+		{"value not an integer", "priority%3Ehigh", map[string]any{"priority": 3}, 11, "not a valid int64"},
+		{"value not a date", "created=yesterday", map[string]any{"created": time.Now()}, 8, "not a valid time.Time"},
+		{"struct field", "billing=IT", map[string]any{"billing": struct{}{}}, 8, "cannot be compared"},
+		{"JSONPath filter", "filter=items%5B0%5D", map[string]any{}, 7, "JSONPath"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tmfparser.ParseTMFQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseTMFQuery() error = %v", err)
+			}
+
+			_, err = tmfparser.Match(q, tt.record)
+
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("expected positioned *rfcquery.Error, got %v", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos || !strings.Contains(rfcErr.Msg, tt.wantMsg) {
+				t.Errorf("got %v, want %q at position %d", err, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+
+	// custom operators have no evaluation
+	parser := tmfparser.NewTMFParser()
+	parser.OperatorMap[".like"] = "like"
+	result, err := parser.Parse(rfcquery.NewScanner("id.like=4"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, err := tmfparser.Match(result.(*tmfparser.TMFQuery), map[string]any{"id": "42"}); err == nil {
+		t.Errorf("Match() with a custom operator succeeded")
+	}
+}
+
+func TestFilterSortPaginate(t *testing.T) {
+	records := []map[string]any{
+		{"id": "a", "priority": 2, "state": "open"},
+		{"id": "b", "priority": 1, "state": "open"},
+		{"id": "c", "priority": 2, "state": "closed"},
+		{"id": "d", "priority": 3, "state": "open"},
+		{"id": "e", "state": "open"},
+		{"id": "f", "priority": 1, "state": "open"},
+	}
+
+	ids := func(records []map[string]any) string {
+		var out []string
+		for _, r := range records {
+			out = append(out, r["id"].(string))
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"filter only", "state=open", "a,b,d,e,f"},
+		{"ascending, missing first, stable", "state=open&sort=priority", "e,b,f,a,d"},
+		{"descending", "state=open&sort=-priority", "d,a,b,f,e"},
+		{"secondary key", "sort=-priority,-id", "d,c,a,f,b,e"},
+		{"pagination", "sort=id&offset=1&limit=2", "b,c"},
+		{"offset past the end", "offset=10", ""},
+		{"limit larger than the result", "state=closed&limit=5", "c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tmfparser.ParseTMFQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseTMFQuery() error = %v", err)
+			}
+
+			got, err := tmfparser.Filter(q, records)
+			if err != nil {
+				t.Fatalf("Filter() error = %v", err)
+			}
+			if err := tmfparser.Sort(q, got); err != nil {
+				t.Fatalf("Sort() error = %v", err)
+			}
+			if ids := ids(tmfparser.Paginate(q, got)); ids != tt.want {
+				t.Errorf("got %s, want %s", ids, tt.want)
+			}
+		})
+	}
+
+	q, err := tmfparser.ParseTMFQuery("sort=id,-priority")
+	if err != nil {
+		t.Fatalf("ParseTMFQuery() error = %v", err)
+	}
+	mixed := []map[string]any{{"id": "a", "priority": 1}, {"id": "a", "priority": "high"}}
+	var rfcErr *rfcquery.Error
+	if err := tmfparser.Sort(q, mixed); !errors.As(err, &rfcErr) || rfcErr.Pos.Offset != 9 {
+		t.Errorf("Sort() on mismatching types = %v, want a positioned error at 9", err)
+	}
+
+	built := &tmfparser.TMFQuery{Pagination: tmfparser.TMFPagination{Offset: -3, Limit: 2}}
+	if ids := ids(tmfparser.Paginate(built, records)); ids != "a,b" {
+		t.Errorf("Paginate() with a negative offset = %s, want a,b", ids)
+	}
+}
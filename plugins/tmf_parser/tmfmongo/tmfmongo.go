@@ -0,0 +1,207 @@
+// Package tmfmongo translates parsed TMF queries into MongoDB-style filter documents
+package tmfmongo
+
+import (
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	tmfparser "github.com/CRSylar/rfcquery/plugins/tmf_parser"
+)
+
+// mongoOperators maps the TMF630 operators to MongoDB query operators
+var mongoOperators = map[tmfparser.TMFOperator]string{
+	tmfparser.TMFOperatorEq:  "$eq",
+	tmfparser.TMFOperatorNe:  "$ne",
+	tmfparser.TMFOperatorGt:  "$gt",
+	tmfparser.TMFOperatorGte: "$gte",
+	tmfparser.TMFOperatorLt:  "$lt",
+	tmfparser.TMFOperatorLte: "$lte",
+}
+
+// Translator converts a TMFQuery into a filter document and a sort spec.
+// The output uses plain map[string]any and slices, shaped so that it can be
+// handed to a BSON encoder as is
+type Translator struct {
+	// Fields is the allow-list of TMF fields, mapped to their document field name
+	Fields map[string]string
+
+	// Operators adds query operators for custom TMF operators (e.g. "like": "$regex")
+	Operators map[tmfparser.TMFOperator]string
+}
+
+// SortKey is one entry of a sort spec, Order is 1 for ascending and -1 for descending
+type SortKey struct {
+	Key   string
+	Order int
+}
+
+// Query is a translated TMF query
+type Query struct {
+	Filter map[string]any // {} when there are no filters
+	Sort   []SortKey      // ordered, like a bson.D
+	Skip   int
+	Limit  int // 0 when there is no limit
+}
+
+// NewTranslator creates a translator for the given allow-list
+func NewTranslator(fields map[string]string) *Translator {
+	return &Translator{
+		Fields: fields,
+	}
+}
+
+// Translate converts the filters, sorting and pagination of q
+func (t *Translator) Translate(q *tmfparser.TMFQuery) (*Query, error) {
+	if len(q.JSONPaths) > 0 {
+		return nil, rfcquery.NewError(q.JSONPaths[0].Pos.Offset, "JSONPath filters cannot be translated to a filter document")
+	}
+
+	filter, err := t.group(*q.Tree())
+	if err != nil {
+		return nil, err
+	}
+
+	sort, err := t.sort(q.Sorting)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Query{
+		Filter: filter,
+		Sort:   sort,
+		Skip:   q.Pagination.Offset,
+		Limit:  q.Pagination.Limit,
+	}, nil
+}
+
+func (t *Translator) field(name string, pos int) (string, error) {
+	field, ok := t.Fields[name]
+	if !ok {
+		return "", rfcquery.NewError(pos, "field %q is not allowed", name)
+	}
+	return field, nil
+}
+
+func (t *Translator) operator(op tmfparser.TMFOperator, pos int) (string, error) {
+	if mongoOp, ok := mongoOperators[op]; ok {
+		return mongoOp, nil
+	}
+	if mongoOp, ok := t.Operators[op]; ok {
+		return mongoOp, nil
+	}
+	return "", rfcquery.NewError(pos, "operator %s has no filter document translation", op)
+}
+
+// group translates a filter group. Conditions of an AND on distinct fields
+// are merged into a single document, anything else uses $and / $or
+func (t *Translator) group(g tmfparser.TMFFilterGroup) (map[string]any, error) {
+	if g.IsMembership() {
+		return t.membership(g)
+	}
+
+	var docs []map[string]any
+
+	for _, expr := range g.Expressions {
+		doc, err := t.expression(expr)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	for _, sub := range g.Groups {
+		doc, err := t.group(sub)
+		if err != nil {
+			return nil, err
+		}
+		if len(doc) > 0 {
+			docs = append(docs, doc)
+		}
+	}
+
+	switch {
+	case len(docs) == 0:
+		return map[string]any{}, nil
+	case len(docs) == 1:
+		return docs[0], nil
+	}
+
+	if g.Logic == tmfparser.TMFLogicAnd {
+		if merged, ok := mergeFields(docs); ok {
+			return merged, nil
+		}
+	}
+
+	list := make([]any, len(docs))
+	for i, doc := range docs {
+		list[i] = doc
+	}
+	return map[string]any{"$" + string(g.Logic): list}, nil
+}
+
+// mergeFields merges {a: cond} documents when every field appears once
+// and none of them is a top level operator
+func mergeFields(docs []map[string]any) (map[string]any, bool) {
+	merged := make(map[string]any, len(docs))
+	for _, doc := range docs {
+		for key, cond := range doc {
+			if _, dup := merged[key]; dup || strings.HasPrefix(key, "$") {
+				return nil, false
+			}
+			merged[key] = cond
+		}
+	}
+	return merged, true
+}
+
+// membership translates a value list into $in or $nin
+func (t *Translator) membership(g tmfparser.TMFFilterGroup) (map[string]any, error) {
+	first := g.Expressions[0]
+	field, err := t.field(first.Field, first.Pos())
+	if err != nil {
+		return nil, err
+	}
+
+	op := "$in"
+	if g.Logic == tmfparser.TMFLogicAnd {
+		op = "$nin"
+	}
+
+	values := make([]any, 0, len(g.Expressions))
+	for _, expr := range g.Expressions {
+		values = append(values, expr.Operand())
+	}
+	return map[string]any{field: map[string]any{op: values}}, nil
+}
+
+func (t *Translator) expression(expr tmfparser.TMFExpression) (map[string]any, error) {
+	pos := expr.Pos()
+
+	field, err := t.field(expr.Field, pos)
+	if err != nil {
+		return nil, err
+	}
+	op, err := t.operator(expr.Operator, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{field: map[string]any{op: expr.Operand()}}, nil
+}
+
+func (t *Translator) sort(sorting []tmfparser.TMFSortField) ([]SortKey, error) {
+	var keys []SortKey
+	for _, sort := range sorting {
+		field, err := t.field(sort.Field, sort.Pos())
+		if err != nil {
+			return nil, err
+		}
+
+		order := 1
+		if sort.Direction == "desc" {
+			order = -1
+		}
+		keys = append(keys, SortKey{Key: field, Order: order})
+	}
+	return keys, nil
+}
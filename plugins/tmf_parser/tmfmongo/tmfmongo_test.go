@@ -0,0 +1,221 @@
+package tmfmongo_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/CRSylar/rfcquery"
+	tmfparser "github.com/CRSylar/rfcquery/plugins/tmf_parser"
+	"github.com/CRSylar/rfcquery/plugins/tmf_parser/tmfmongo"
+)
+
+var fields = map[string]string{
+	"name":     "name",
+	"status":   "status",
+	"type":     "@type",
+	"age":      "age",
+	"quantity": "quantity",
+	"created":  "createdAt",
+}
+
+func TestTranslator_Translate(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantFilter map[string]any
+		wantSort   []tmfmongo.SortKey
+		wantSkip   int
+		wantLimit  int
+	}{
+		{
+			name:       "empty query",
+			input:      "",
+			wantFilter: map[string]any{},
+		},
+		{
+			name:       "single equality",
+			input:      "name=John",
+			wantFilter: map[string]any{"name": map[string]any{"$eq": "John"}},
+		},
+		{
+			name:  "distinct fields are merged",
+			input: "name%21%3DJohn;age%3E%3D18;quantity%3C10",
+			wantFilter: map[string]any{
+				"name":     map[string]any{"$ne": "John"},
+				"age":      map[string]any{"$gte": "18"},
+				"quantity": map[string]any{"$lt": "10"},
+			},
+		},
+		{
+			name:  "repeated field uses $and",
+			input: "age%3E18;age%3C%3D65",
+			wantFilter: map[string]any{"$and": []any{
+				map[string]any{"age": map[string]any{"$gt": "18"}},
+				map[string]any{"age": map[string]any{"$lte": "65"}},
+			}},
+		},
+		{
+			name:  "field renaming and value list",
+			input: "status=active,suspended;type=x",
+			wantFilter: map[string]any{
+				"@type":  map[string]any{"$eq": "x"},
+				"status": map[string]any{"$in": []any{"active", "suspended"}},
+			},
+		},
+		{
+			name:       "not-equal list",
+			input:      "status%21%3Da,b",
+			wantFilter: map[string]any{"status": map[string]any{"$nin": []any{"a", "b"}}},
+		},
+		{
+			name:  "groups joined by OR",
+			input: "(status=active;type=x),(status=pending)",
+			wantFilter: map[string]any{"$or": []any{
+				map[string]any{
+					"status": map[string]any{"$eq": "active"},
+					"@type":  map[string]any{"$eq": "x"},
+				},
+				map[string]any{"status": map[string]any{"$eq": "pending"}},
+			}},
+		},
+		{
+			name:  "OR group next to a filter",
+			input: "(age%3C18),(age%3E65);name=John",
+			wantFilter: map[string]any{"$and": []any{
+				map[string]any{"name": map[string]any{"$eq": "John"}},
+				map[string]any{"$or": []any{
+					map[string]any{"age": map[string]any{"$lt": "18"}},
+					map[string]any{"age": map[string]any{"$gt": "65"}},
+				}},
+			}},
+		},
+		{
+			name:       "sorting and pagination",
+			input:      "sort=-created,name&offset=20&limit=10",
+			wantFilter: map[string]any{},
+			wantSort:   []tmfmongo.SortKey{{Key: "createdAt", Order: -1}, {Key: "name", Order: 1}},
+			wantSkip:   20,
+			wantLimit:  10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tmfparser.ParseTMFQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseTMFQuery() error = %v", err)
+			}
+
+			got, err := tmfmongo.NewTranslator(fields).Translate(q)
+			if err != nil {
+				t.Fatalf("Translate() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Filter, tt.wantFilter) {
+				t.Errorf("Filter = %#v, want %#v", got.Filter, tt.wantFilter)
+			}
+			if !reflect.DeepEqual(got.Sort, tt.wantSort) {
+				t.Errorf("Sort = %+v, want %+v", got.Sort, tt.wantSort)
+			}
+			if got.Skip != tt.wantSkip || got.Limit != tt.wantLimit {
+				t.Errorf("Skip, Limit = %d, %d, want %d, %d", got.Skip, got.Limit, tt.wantSkip, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestTranslator_TranslateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+	}{
+		{"unknown field", "name=John;password=x", 19},
+		{"operator as field name", "%24where=1", 9},
+		{"unknown field in a value list", "secret=a,b", 7},
+		{"unknown sort field", "sort=name,-secret", 11},
+		{"JSONPath filter", "filter=items%5B0%5D", 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tmfparser.ParseTMFQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseTMFQuery() error = %v", err)
+			}
+
+			_, err = tmfmongo.NewTranslator(fields).Translate(q)
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("Translate() error = %v, want *rfcquery.Error", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos {
+				t.Errorf("error position = %d, want %d (%v)", rfcErr.Pos.Offset, tt.wantPos, err)
+			}
+		})
+	}
+}
+
+func TestTranslator_Options(t *testing.T) {
+	parser := tmfparser.NewTMFParser()
+	parser.OperatorMap[".regex"] = "regex"
+	parser.Schema = map[string]tmfparser.FieldType{
+		"quantity": {Kind: tmfparser.FieldInteger},
+	}
+
+	result, err := parser.Parse(rfcquery.NewScanner("name.regex=%5EJo;quantity%3E%3D10"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	q := result.(*tmfparser.TMFQuery)
+
+	translator := tmfmongo.NewTranslator(fields)
+	if _, err := translator.Translate(q); err == nil {
+		t.Fatal("Translate() with an unmapped custom operator succeeded")
+	}
+
+	translator.Operators = map[tmfparser.TMFOperator]string{"regex": "$regex"}
+	got, err := translator.Translate(q)
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+
+	want := map[string]any{
+		"name":     map[string]any{"$regex": "^Jo"},
+		"quantity": map[string]any{"$gte": int64(10)},
+	}
+	if !reflect.DeepEqual(got.Filter, want) {
+		t.Errorf("Filter = %#v, want %#v", got.Filter, want)
+	}
+}
+
+func TestTranslator_FlatExpressions(t *testing.T) {
+	// queries built by hand have no FilterTree
+	q := &tmfparser.TMFQuery{
+		Expressions: map[string][]tmfparser.TMFExpression{
+			"age": {{Field: "age", Operator: tmfparser.TMFOperatorGt, Value: "25"}},
+			"status": {
+				{Field: "status", Operator: tmfparser.TMFOperatorEq, Value: "active"},
+				{Field: "status", Operator: tmfparser.TMFOperatorEq, Value: "suspended"},
+			},
+			"name": {
+				{Field: "name", Operator: tmfparser.TMFOperatorNe, Value: "a"},
+				{Field: "name", Operator: tmfparser.TMFOperatorNe, Value: "b"},
+			},
+		},
+	}
+
+	got, err := tmfmongo.NewTranslator(fields).Translate(q)
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+
+	want := map[string]any{
+		"age":    map[string]any{"$gt": "25"},
+		"name":   map[string]any{"$nin": []any{"a", "b"}},
+		"status": map[string]any{"$in": []any{"active", "suspended"}},
+	}
+	if !reflect.DeepEqual(got.Filter, want) {
+		t.Errorf("Filter = %#v, want %#v", got.Filter, want)
+	}
+}
@@ -0,0 +1,243 @@
+// Package tmfsql translates parsed TMF queries into parameterized SQL fragments
+package tmfsql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/CRSylar/rfcquery"
+	tmfparser "github.com/CRSylar/rfcquery/plugins/tmf_parser"
+)
+
+// Dialect selects the placeholder syntax
+type Dialect int
+
+const (
+	DialectPostgres Dialect = iota // $1, $2, ...
+	DialectMySQL                   // ?
+)
+
+// sqlOperators maps the TMF630 operators to SQL
+var sqlOperators = map[tmfparser.TMFOperator]string{
+	tmfparser.TMFOperatorEq:  "=",
+	tmfparser.TMFOperatorNe:  "<>",
+	tmfparser.TMFOperatorGt:  ">",
+	tmfparser.TMFOperatorGte: ">=",
+	tmfparser.TMFOperatorLt:  "<",
+	tmfparser.TMFOperatorLte: "<=",
+}
+
+// Translator converts a TMFQuery into a WHERE ... ORDER BY ... LIMIT ... OFFSET fragment.
+// Only fields listed in Columns can be filtered or sorted on and every value is
+// passed as a placeholder argument, so the output is safe from SQL injection
+// as long as the Columns and Operators values are trusted
+type Translator struct {
+	// Columns is the allow-list of TMF fields, mapped to their SQL column expression
+	Columns map[string]string
+
+	// Dialect selects the placeholder syntax
+	Dialect Dialect
+
+	// Operators adds SQL operators for custom TMF operators (e.g. "like": "ILIKE")
+	Operators map[tmfparser.TMFOperator]string
+
+	// ArgsOffset shifts Postgres placeholders, for fragments appended to a
+	// statement that already has ArgsOffset arguments
+	ArgsOffset int
+}
+
+// Clause is a translated TMF query
+type Clause struct {
+	Where   string // condition without the WHERE keyword, "" when there are no filters
+	OrderBy string // column list without the ORDER BY keywords
+	Limit   string // LIMIT placeholder, "" when there is no limit
+	Offset  string // OFFSET placeholder, "" when there is no offset
+	Args    []any
+}
+
+// SQL returns the full fragment, e.g. "WHERE a = $1 ORDER BY b DESC LIMIT $2"
+func (c *Clause) SQL() string {
+	var parts []string
+	if c.Where != "" {
+		parts = append(parts, "WHERE "+c.Where)
+	}
+	if c.OrderBy != "" {
+		parts = append(parts, "ORDER BY "+c.OrderBy)
+	}
+	if c.Limit != "" {
+		parts = append(parts, "LIMIT "+c.Limit)
+	}
+	if c.Offset != "" {
+		parts = append(parts, "OFFSET "+c.Offset)
+	}
+	return strings.Join(parts, " ")
+}
+
+// NewTranslator creates a Postgres translator for the given allow-list
+func NewTranslator(columns map[string]string) *Translator {
+	return &Translator{
+		Columns: columns,
+		Dialect: DialectPostgres,
+	}
+}
+
+// Translate converts the filters, sorting and pagination of q
+func (t *Translator) Translate(q *tmfparser.TMFQuery) (*Clause, error) {
+	if len(q.JSONPaths) > 0 {
+		return nil, rfcquery.NewError(q.JSONPaths[0].Pos.Offset, "JSONPath filters cannot be translated to SQL")
+	}
+
+	b := &builder{translator: t, clause: &Clause{}}
+
+	where, err := b.group(*q.Tree(), true)
+	if err != nil {
+		return nil, err
+	}
+	b.clause.Where = where
+
+	if err := b.orderBy(q.Sorting); err != nil {
+		return nil, err
+	}
+
+	if q.Pagination.Limit > 0 {
+		b.clause.Limit = b.arg(q.Pagination.Limit)
+	}
+	if q.Pagination.Offset > 0 {
+		b.clause.Offset = b.arg(q.Pagination.Offset)
+	}
+
+	return b.clause, nil
+}
+
+type builder struct {
+	translator *Translator
+	clause     *Clause
+}
+
+// arg records a value and returns its placeholder
+func (b *builder) arg(value any) string {
+	b.clause.Args = append(b.clause.Args, value)
+	if b.translator.Dialect == DialectMySQL {
+		return "?"
+	}
+	return "$" + strconv.Itoa(b.translator.ArgsOffset+len(b.clause.Args))
+}
+
+func (b *builder) column(field string, pos int) (string, error) {
+	column, ok := b.translator.Columns[field]
+	if !ok {
+		return "", rfcquery.NewError(pos, "field %q is not allowed", field)
+	}
+	return column, nil
+}
+
+func (b *builder) operator(op tmfparser.TMFOperator, pos int) (string, error) {
+	if sqlOp, ok := sqlOperators[op]; ok {
+		return sqlOp, nil
+	}
+	if sqlOp, ok := b.translator.Operators[op]; ok {
+		return sqlOp, nil
+	}
+	return "", rfcquery.NewError(pos, "operator %s has no SQL translation", op)
+}
+
+// group translates a filter group, top is true for the root where no
+// parentheses are needed
+func (b *builder) group(g tmfparser.TMFFilterGroup, top bool) (string, error) {
+	joiner := " AND "
+	if g.Logic == tmfparser.TMFLogicOr {
+		joiner = " OR "
+	}
+
+	if g.IsMembership() {
+		return b.membership(g)
+	}
+
+	// a lone subgroup needs no parentheses of its own
+	if len(g.Expressions) == 0 && len(g.Groups) == 1 {
+		return b.group(g.Groups[0], top)
+	}
+
+	var parts []string
+
+	for _, expr := range g.Expressions {
+		cond, err := b.expression(expr)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, cond)
+	}
+
+	for _, sub := range g.Groups {
+		cond, err := b.group(sub, false)
+		if err != nil {
+			return "", err
+		}
+		if cond != "" {
+			parts = append(parts, cond)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "", nil
+	}
+	if top || len(parts) == 1 {
+		return strings.Join(parts, joiner), nil
+	}
+	return "(" + strings.Join(parts, joiner) + ")", nil
+}
+
+// membership translates a value list into IN or NOT IN
+func (b *builder) membership(g tmfparser.TMFFilterGroup) (string, error) {
+	first := g.Expressions[0]
+	column, err := b.column(first.Field, first.Pos())
+	if err != nil {
+		return "", err
+	}
+
+	keyword := "IN"
+	if g.Logic == tmfparser.TMFLogicAnd {
+		keyword = "NOT IN"
+	}
+
+	placeholders := make([]string, 0, len(g.Expressions))
+	for _, expr := range g.Expressions {
+		placeholders = append(placeholders, b.arg(expr.Operand()))
+	}
+	return fmt.Sprintf("%s %s (%s)", column, keyword, strings.Join(placeholders, ", ")), nil
+}
+
+func (b *builder) expression(expr tmfparser.TMFExpression) (string, error) {
+	pos := expr.Pos()
+
+	column, err := b.column(expr.Field, pos)
+	if err != nil {
+		return "", err
+	}
+	op, err := b.operator(expr.Operator, pos)
+	if err != nil {
+		return "", err
+	}
+
+	return column + " " + op + " " + b.arg(expr.Operand()), nil
+}
+
+func (b *builder) orderBy(sorting []tmfparser.TMFSortField) error {
+	parts := make([]string, 0, len(sorting))
+	for _, sort := range sorting {
+		column, err := b.column(sort.Field, sort.Pos())
+		if err != nil {
+			return err
+		}
+
+		direction := "ASC"
+		if sort.Direction == "desc" {
+			direction = "DESC"
+		}
+		parts = append(parts, column+" "+direction)
+	}
+
+	b.clause.OrderBy = strings.Join(parts, ", ")
+	return nil
+}
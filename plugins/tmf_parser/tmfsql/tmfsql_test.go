@@ -0,0 +1,220 @@
+package tmfsql_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CRSylar/rfcquery"
+	tmfparser "github.com/CRSylar/rfcquery/plugins/tmf_parser"
+	"github.com/CRSylar/rfcquery/plugins/tmf_parser/tmfsql"
+)
+
+var columns = map[string]string{
+	"name":     "name",
+	"status":   "status",
+	"type":     "type",
+	"age":      "age",
+	"quantity": "quantity",
+	"created":  `"created_at"`,
+}
+
+func TestTranslator_Translate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		dialect  tmfsql.Dialect
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:    "empty query",
+			input:   "",
+			wantSQL: "",
+		},
+		{
+			name:     "single equality",
+			input:    "name=John",
+			wantSQL:  "WHERE name = $1",
+			wantArgs: []any{"John"},
+		},
+		{
+			name:     "all operators",
+			input:    "age%3E1;age%3E%3D2;age%3C3;age%3C%3D4;name%21%3DJohn",
+			wantSQL:  "WHERE age > $1 AND age >= $2 AND age < $3 AND age <= $4 AND name <> $5",
+			wantArgs: []any{"1", "2", "3", "4", "John"},
+		},
+		{
+			name:     "mysql placeholders",
+			input:    "name=John;age%3E25",
+			dialect:  tmfsql.DialectMySQL,
+			wantSQL:  "WHERE name = ? AND age > ?",
+			wantArgs: []any{"John", "25"},
+		},
+		{
+			name:     "value list becomes IN",
+			input:    "status=active,suspended;type=x",
+			wantSQL:  "WHERE type = $1 AND status IN ($2, $3)",
+			wantArgs: []any{"x", "active", "suspended"},
+		},
+		{
+			name:     "not-equal list becomes NOT IN",
+			input:    "status%21%3Da,b",
+			wantSQL:  "WHERE status NOT IN ($1, $2)",
+			wantArgs: []any{"a", "b"},
+		},
+		{
+			name:     "groups joined by OR",
+			input:    "(status=active;type=x),(status=pending)",
+			wantSQL:  "WHERE (status = $1 AND type = $2) OR status = $3",
+			wantArgs: []any{"active", "x", "pending"},
+		},
+		{
+			name:     "OR group next to a filter",
+			input:    "(type=x),(type=y);name=John",
+			wantSQL:  "WHERE name = $1 AND (type = $2 OR type = $3)",
+			wantArgs: []any{"John", "x", "y"},
+		},
+		{
+			name:     "nested groups",
+			input:    "(type=x;(age=1),(age%3E2)),(type=y)",
+			wantSQL:  "WHERE (type = $1 AND (age = $2 OR age > $3)) OR type = $4",
+			wantArgs: []any{"x", "1", "2", "y"},
+		},
+		{
+			name:     "sorting and pagination",
+			input:    "name=John&sort=-age,name&limit=10&offset=20",
+			wantSQL:  "WHERE name = $1 ORDER BY age DESC, name ASC LIMIT $2 OFFSET $3",
+			wantArgs: []any{"John", 10, 20},
+		},
+		{
+			name:    "column mapping",
+			input:   "sort=created",
+			wantSQL: `ORDER BY "created_at" ASC`,
+		},
+		{
+			name:     "injection attempt stays an argument",
+			input:    "name=x'%20OR%20'1'%3D'1",
+			wantSQL:  "WHERE name = $1",
+			wantArgs: []any{"x' OR '1'='1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tmfparser.ParseTMFQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseTMFQuery() error = %v", err)
+			}
+
+			translator := tmfsql.NewTranslator(columns)
+			translator.Dialect = tt.dialect
+
+			clause, err := translator.Translate(q)
+			if err != nil {
+				t.Fatalf("Translate() error = %v", err)
+			}
+			if got := clause.SQL(); got != tt.wantSQL {
+				t.Errorf("SQL() = %q, want %q", got, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(clause.Args, tt.wantArgs) {
+				t.Errorf("Args = %#v, want %#v", clause.Args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestTranslator_TranslateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+	}{
+		{"unknown field", "name=John;password=x", 19},
+		{"injection in field name", "name%20OR%201=x", 14},
+		{"unknown sort field", "sort=name,-secret", 11},
+		{"JSONPath filter", "filter=items%5B0%5D", 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tmfparser.ParseTMFQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseTMFQuery() error = %v", err)
+			}
+
+			_, err = tmfsql.NewTranslator(columns).Translate(q)
+			var rfcErr *rfcquery.Error
+			if !errors.As(err, &rfcErr) {
+				t.Fatalf("Translate() error = %v, want *rfcquery.Error", err)
+			}
+			if rfcErr.Pos.Offset != tt.wantPos {
+				t.Errorf("error position = %d, want %d (%v)", rfcErr.Pos.Offset, tt.wantPos, err)
+			}
+		})
+	}
+}
+
+func TestTranslator_Options(t *testing.T) {
+	parser := tmfparser.NewTMFParser()
+	parser.OperatorMap[".like"] = "like"
+	parser.Schema = map[string]tmfparser.FieldType{
+		"quantity": {Kind: tmfparser.FieldInteger},
+		"created":  {Kind: tmfparser.FieldRFC3339},
+	}
+
+	result, err := parser.Parse(rfcquery.NewScanner("name.like=Jo%25;quantity%3E%3D10;created%3C2020-01-01T10:00:00Z"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	q := result.(*tmfparser.TMFQuery)
+
+	translator := tmfsql.NewTranslator(columns)
+	if _, err := translator.Translate(q); err == nil {
+		t.Fatal("Translate() with an unmapped custom operator succeeded")
+	}
+
+	translator.Operators = map[tmfparser.TMFOperator]string{"like": "ILIKE"}
+	translator.ArgsOffset = 2
+
+	clause, err := translator.Translate(q)
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+
+	wantSQL := `WHERE name ILIKE $3 AND quantity >= $4 AND "created_at" < $5`
+	if got := clause.SQL(); got != wantSQL {
+		t.Errorf("SQL() = %q, want %q", got, wantSQL)
+	}
+	wantArgs := []any{"Jo%", int64(10), time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)}
+	if !reflect.DeepEqual(clause.Args, wantArgs) {
+		t.Errorf("Args = %#v, want %#v", clause.Args, wantArgs)
+	}
+}
+
+func TestTranslator_FlatExpressions(t *testing.T) {
+	// queries built by hand have no FilterTree
+	q := &tmfparser.TMFQuery{
+		Expressions: map[string][]tmfparser.TMFExpression{
+			"type": {{Field: "type", Operator: tmfparser.TMFOperatorEq, Value: "x"}},
+			"age":  {{Field: "age", Operator: tmfparser.TMFOperatorGt, Value: "25"}},
+			"status": {
+				{Field: "status", Operator: tmfparser.TMFOperatorEq, Value: "active"},
+				{Field: "status", Operator: tmfparser.TMFOperatorEq, Value: "suspended"},
+			},
+			"name": {
+				{Field: "name", Operator: tmfparser.TMFOperatorNe, Value: "a"},
+				{Field: "name", Operator: tmfparser.TMFOperatorNe, Value: "b"},
+			},
+		},
+	}
+
+	clause, err := tmfsql.NewTranslator(columns).Translate(q)
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+	if got, want := clause.SQL(), "WHERE age > $1 AND type = $2 AND name NOT IN ($3, $4) AND status IN ($5, $6)"; got != want {
+		t.Errorf("SQL() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package tmfparser
+
+import (
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/CRSylar/rfcquery"
+)
+
+// FieldKind is the type a filter value is coerced to
+type FieldKind int
+
+const (
+	FieldString   FieldKind = iota // string, any operator
+	FieldInteger                   // int64
+	FieldNumber                    // float64
+	FieldBoolean                   // bool, "true" or "false"
+	FieldDate                      // time.Time from an ISO 8601 date (2013-04-20)
+	FieldDateTime                  // time.Time from an ISO 8601 date-time, a bare date means midnight UTC
+	FieldRFC3339                   // time.Time from a strict RFC 3339 timestamp
+	FieldEnum                      // string, one of FieldType.Enum
+)
+
+func (k FieldKind) String() string {
+	switch k {
+	case FieldInteger:
+		return "integer"
+	case FieldNumber:
+		return "number"
+	case FieldBoolean:
+		return "boolean"
+	case FieldDate:
+		return "date"
+	case FieldDateTime:
+		return "date-time"
+	case FieldRFC3339:
+		return "RFC 3339 timestamp"
+	case FieldEnum:
+		return "enum"
+	default:
+		return "string"
+	}
+}
+
+// FieldType declares the type of a filterable field in TMFParser.Schema
+type FieldType struct {
+	Kind FieldKind
+
+	// Enum lists the accepted values of a FieldEnum
+	Enum []string
+}
+
+// isoDateTimeLayouts are the ISO 8601 date-time forms accepted by FieldDateTime,
+// values without a zone are read as UTC
+var isoDateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	time.DateOnly,
+}
+
+// allowedOperators returns the operators legal on a kind, nil means any
+func (t FieldType) allowedOperators() []TMFOperator {
+	switch t.Kind {
+	case FieldBoolean, FieldEnum:
+		return []TMFOperator{TMFOperatorEq, TMFOperatorNe}
+	case FieldInteger, FieldNumber, FieldDate, FieldDateTime, FieldRFC3339:
+		return []TMFOperator{TMFOperatorEq, TMFOperatorNe, TMFOperatorGt, TMFOperatorGte, TMFOperatorLt, TMFOperatorLte}
+	default:
+		return nil
+	}
+}
+
+// Coerce converts a raw value into the Go value of the field type
+func (t FieldType) Coerce(value string) (any, error) {
+	switch t.Kind {
+	case FieldInteger:
+		return strconv.ParseInt(value, 10, 64)
+
+	case FieldNumber:
+		return strconv.ParseFloat(value, 64)
+
+	case FieldBoolean:
+		switch value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, strconv.ErrSyntax
+
+	case FieldDate:
+		return time.Parse(time.DateOnly, value)
+
+	case FieldDateTime:
+		var err error
+		for _, layout := range isoDateTimeLayouts {
+			var parsed time.Time
+			if parsed, err = time.Parse(layout, value); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, err
+
+	case FieldRFC3339:
+		return time.Parse(time.RFC3339Nano, value)
+
+	case FieldEnum:
+		if !slices.Contains(t.Enum, value) {
+			return nil, strconv.ErrSyntax
+		}
+		return value, nil
+
+	default:
+		return value, nil
+	}
+}
+
+// coerceExpression fills expr.TypedValue according to the parser Schema
+func (p *TMFParser) coerceExpression(expr *TMFExpression, seg *segment) error {
+	if p.Schema == nil {
+		return nil
+	}
+
+	fieldType, ok := p.Schema[expr.Field]
+	if !ok {
+		expr.TypedValue = expr.Value
+		return nil
+	}
+
+	if allowed := fieldType.allowedOperators(); allowed != nil && !slices.Contains(allowed, expr.Operator) {
+		return rfcquery.NewError(seg.OperatorPos, "operator %s not allowed on %s field %q", expr.Operator, fieldType.Kind, expr.Field)
+	}
+
+	typed, err := fieldType.Coerce(expr.Value)
+	if err != nil {
+		pos := seg.FieldTokens[len(seg.FieldTokens)-1].End.Offset
+		if len(expr.Token) > 0 && seg.Operator != "" {
+			pos = expr.Token[0].Start.Offset
+		}
+		if fieldType.Kind == FieldEnum {
+			return rfcquery.NewError(pos, "value %q of field %q is not one of %v", expr.Value, expr.Field, fieldType.Enum)
+		}
+		return rfcquery.NewError(pos, "value %q of field %q is not a valid %s", expr.Value, expr.Field, fieldType.Kind)
+	}
+
+	expr.TypedValue = typed
+	return nil
+}
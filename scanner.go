@@ -1,6 +1,7 @@
 package rfcquery
 
 import (
+	"context"
 	"unicode"
 
 	"github.com/CRSylar/rfcquery/internal/percent"
@@ -13,8 +14,17 @@ type Scanner struct {
 	// Allow lookahead without consuming
 	nextToken *Token
 	nextErr   error
+
+	// Limits and cancellation
+	ctx     context.Context
+	opts    ParseOptions
+	scanned int // distinct tokens produced so far
+	mark    int // first offset not yet covered by a scanned token
 }
 
+// cancelCheckInterval is the number of tokens between two context checks
+const cancelCheckInterval = 256
+
 // NewScanner creates a new scanner for the query string
 func NewScanner(input string) *Scanner {
 	return &Scanner{
@@ -23,14 +33,50 @@ func NewScanner(input string) *Scanner {
 	}
 }
 
+// NewScannerContext creates a scanner that enforces opts and stops
+// with an error once ctx is canceled
+func NewScannerContext(ctx context.Context, input string, opts ParseOptions) *Scanner {
+	return &Scanner{
+		input: input,
+		pos:   0,
+		ctx:   ctx,
+		opts:  opts,
+	}
+}
+
+// Options returns the limits the scanner was created with
+func (s *Scanner) Options() ParseOptions {
+	return s.opts
+}
+
+// Context returns the scanner context, never nil
+func (s *Scanner) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
 // Valid performs full validation without tokenizing
 func (s *Scanner) Valid() error {
+	if err := s.checkInputLength(); err != nil {
+		return err
+	}
+	if err := s.checkContext(); err != nil {
+		return err
+	}
+
 	l := NewLexer(s.input)
 	return l.Valid()
 }
 
 // Nextoken returns the next token and advances the scanner
 func (s *Scanner) NextToken() (Token, error) {
+	if s.nextErr != nil {
+		// the peeked token failed, the error is sticky until the scanner is rewound
+		return Token{}, s.nextErr
+	}
+
 	if s.nextToken != nil {
 		tok := *s.nextToken
 		s.nextToken = nil
@@ -63,6 +109,10 @@ func (s *Scanner) Pos() int {
 func (s *Scanner) scanToken() (Token, error) {
 	startPos := s.pos
 
+	if err := s.checkInputLength(); err != nil {
+		return Token{}, err
+	}
+
 	if s.pos >= len(s.input) {
 		return Token{
 			Type:  TokenEOF,
@@ -72,6 +122,10 @@ func (s *Scanner) scanToken() (Token, error) {
 		}, nil
 	}
 
+	if err := s.account(); err != nil {
+		return Token{}, err
+	}
+
 	c := s.input[s.pos]
 
 	if c == '%' {
@@ -129,6 +183,50 @@ func (s *Scanner) scanToken() (Token, error) {
 	return tok, nil
 }
 
+// checkInputLength enforces MaxInputLength
+func (s *Scanner) checkInputLength() error {
+	if s.opts.MaxInputLength > 0 && len(s.input) > s.opts.MaxInputLength {
+		return NewLimitError(LimitInputLength, s.opts.MaxInputLength, s.opts.MaxInputLength)
+	}
+	return nil
+}
+
+// checkContext returns a positioned error if the scanner context is done
+func (s *Scanner) checkContext() error {
+	if s.ctx == nil {
+		return nil
+	}
+	if err := s.ctx.Err(); err != nil {
+		return &Error{
+			Pos: Position{Offset: s.pos},
+			Msg: "parsing canceled",
+			Err: err,
+		}
+	}
+	return nil
+}
+
+// account is called before scanning a token at s.pos: it enforces MaxTokens
+// and periodically checks for cancellation.
+// Tokens scanned again after a Rewind or PeekN are not counted twice
+func (s *Scanner) account() error {
+	if s.pos < s.mark {
+		return nil
+	}
+	s.mark = s.pos + 1
+	s.scanned++
+
+	if s.opts.MaxTokens > 0 && s.scanned > s.opts.MaxTokens {
+		return NewLimitError(LimitTokens, s.opts.MaxTokens, s.pos)
+	}
+
+	if (s.scanned-1)%cancelCheckInterval == 0 {
+		return s.checkContext()
+	}
+
+	return nil
+}
+
 func (s *Scanner) Rewind(n int) {
 	s.pos -= n
 	if s.pos < 0 {
@@ -142,6 +240,8 @@ func (s *Scanner) Reset() {
 	s.pos = 0
 	s.nextToken = nil
 	s.nextErr = nil
+	s.scanned = 0
+	s.mark = 0
 }
 
 // CollectAll reads all remaining tokens into a slice
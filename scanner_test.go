@@ -247,3 +247,72 @@ func TestScannerErrorPosition(t *testing.T) {
 		t.Errorf("expected position 4, got %d", rfcErr.Pos.Offset)
 	}
 }
+
+func FuzzScannerNextToken(f *testing.F) {
+	for _, seed := range []string{
+		"", "key=value", "hello%20world", "emoji=%F0%9F%91%8D", "a=!$&'()*+,;=",
+		"path/to/file?search", "test%GG", "%", "%4",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		scanner := NewScanner(input)
+		var tokens TokenSlice
+
+		for {
+			peeked, peekErr := scanner.PeekToken()
+			tok, err := scanner.NextToken()
+
+			if (peekErr == nil) != (err == nil) {
+				t.Fatalf("PeekToken() error = %v, NextToken() error = %v", peekErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if peeked != tok {
+				t.Fatalf("PeekToken() = %v, NextToken() = %v", peeked, tok)
+			}
+
+			if tok.Type == TokenEOF {
+				if tok.Start.Offset != len(input) {
+					t.Fatalf("EOF at %d, want %d", tok.Start.Offset, len(input))
+				}
+				break
+			}
+
+			// tokens must be contiguous and carry the raw input they span
+			if tok.Start.Offset != len(tokens.String()) {
+				t.Fatalf("token %v starts at %d, want %d", tok, tok.Start.Offset, len(tokens.String()))
+			}
+			if input[tok.Start.Offset:tok.End.Offset] != tok.Value {
+				t.Fatalf("token value %q does not match input span %q", tok.Value, input[tok.Start.Offset:tok.End.Offset])
+			}
+			if tok.Type == TokenPercentEncoded && len(tok.Decoded) != 1 {
+				t.Fatalf("percent-encoded token %q decoded to %q", tok.Value, tok.Decoded)
+			}
+
+			tokens = append(tokens, tok)
+		}
+
+		if got := tokens.String(); got != input {
+			t.Fatalf("TokenSlice.String() = %q, want %q", got, input)
+		}
+		if tokens.Span() != len(input) {
+			t.Fatalf("TokenSlice.Span() = %d, want %d", tokens.Span(), len(input))
+		}
+	})
+}
+
+func TestScannerNextTokenAfterFailedPeek(t *testing.T) {
+	scanner := NewScanner("%GG")
+
+	if _, err := scanner.PeekToken(); err == nil {
+		t.Fatal("PeekToken() expected error, got nil")
+	}
+
+	tok, err := scanner.NextToken()
+	if err == nil {
+		t.Fatalf("NextToken() after failed PeekToken() returned %v with nil error", tok)
+	}
+}
@@ -99,3 +99,11 @@ func (ts TokenSlice) SplitSubDelimiter(del string) []TokenSlice {
 
 	return slices
 }
+
+// Span returns the number of raw query bytes covered by the slice
+func (ts TokenSlice) Span() int {
+	if len(ts) == 0 {
+		return 0
+	}
+	return ts[len(ts)-1].End.Offset - ts[0].Start.Offset
+}